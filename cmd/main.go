@@ -1,28 +1,299 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/api"
+	dtos "event-processing-pipeline/internal/api/dtos"
 	"event-processing-pipeline/internal/config"
-	"log"
+	"event-processing-pipeline/internal/ingest"
+	"event-processing-pipeline/internal/live"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/migrations"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/sink"
+	"event-processing-pipeline/internal/storage"
+	"event-processing-pipeline/internal/tracing"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 )
 
+const usage = `Usage:
+  event-pipeline [serve]             start the HTTP server (default)
+  event-pipeline migrate up          apply pending schema migrations
+  event-pipeline migrate down [N]    revert the last N migrations (default 1)`
+
 func main() {
 	loadEnv()
+	logging.Setup(config.LogLevel())
+
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	switch args[0] {
+	case "serve":
+		serve()
+	case "migrate":
+		migrate(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// migrate runs "migrate up" or "migrate down [N]" against DB_DRIVER.
+func migrate(args []string) {
+	if len(args) == 0 || len(args) > 2 || (args[0] != "up" && args[0] != "down") || (args[0] == "up" && len(args) > 1) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		var err error
+		if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+			fmt.Fprintln(os.Stderr, "migrate down expects a positive number of steps")
+			os.Exit(2)
+		}
+	}
+
+	if config.DBDriver() == storage.DriverMemory {
+		slog.Error("The memory driver has no schema to migrate")
+		os.Exit(1)
+	}
+
+	db, err := config.NewDB()
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var count int
+	if args[0] == "up" {
+		count, err = migrations.Up(db)
+	} else {
+		count, err = migrations.Down(db, steps)
+	}
+	if err != nil {
+		slog.Error("Migration failed", "direction", args[0], "error", err)
+		db.Close()
+		os.Exit(1)
+	}
+
+	slog.Info("Migrations done", "direction", args[0], "count", count)
+}
+
+func serve() {
+	shutdownTracing, err := tracing.Setup(context.Background(), config.TracingConfig())
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	dtos.SetTimestampFormat(config.TimestampFormat())
+	dtos.SetExactMetadataNumbers(config.ExactMetadataNumbers())
+
+	eventMetrics := metrics.NewMetrics()
+	store, err := config.NewStorage(eventMetrics)
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	serviceConfig := config.ServiceConfig(eventMetrics)
+	eventService := pipeline.NewEventService(store.Events, serviceConfig)
+	deadLetters := pipeline.NewDeadLetterService(store.DeadLetters)
+
+	var redisClient *redis.Client
+	redisConfig := config.RedisConfig()
+	if redisConfig.Enabled || redisConfig.DeadLetterStream != "" {
+		redisClient = ingest.NewRedisClient(redisConfig)
+	}
+	if redisConfig.DeadLetterStream != "" {
+		deadLetters = ingest.NewRedisDeadLetterSink(redisClient, redisConfig.DeadLetterStream, deadLetters)
+	}
+
+	hub := live.NewHub(config.SubscriberBuffer())
+	publishers := pipeline.Publishers{hub}
+
+	var webhook *sink.Webhook
+	if webhookConfig := config.WebhookConfig(); webhookConfig.URL != "" {
+		webhook = sink.NewWebhook(webhookConfig, deadLetters, eventMetrics)
+		webhook.Start()
+		publishers = append(publishers, webhook)
+	}
 
-	ginRouter := config.Engine()
-	ginRouter = config.Routers(ginRouter)
+	var kafkaProducer *sink.KafkaProducer
+	if producerConfig := config.KafkaProducerConfig(); producerConfig.Topic != "" {
+		kafkaProducer = sink.NewKafkaProducer(producerConfig, eventMetrics)
+		kafkaProducer.Start()
+		publishers = append(publishers, kafkaProducer)
+	}
+
+	eventPipeline := pipeline.NewEventPipeline(eventService, deadLetters, eventMetrics, publishers, config.PipelineConfig())
+	eventPipeline.Start()
+
+	replayer := pipeline.NewReplayer(eventService, publishers, config.ReplayConfig())
+	retention := pipeline.NewRetention(eventService, eventMetrics, config.RetentionConfig())
+	eventController := api.NewEventController(eventService, deadLetters, eventPipeline, eventMetrics, hub, replayer, retention, config.EventControllerConfig())
 
-	err := ginRouter.Run(":9000")
+	ginRouter := config.Engine(eventMetrics)
+	healthController := api.NewHealthController(store, eventPipeline, config.HealthCheckTimeout())
+	limiter := api.NewRateLimiter(config.RateLimitConfig(), eventMetrics)
+	adminController := api.NewAdminController(eventPipeline, limiter)
+	auth := config.Auth(eventMetrics)
+	ginRouter = config.Routers(ginRouter, eventController, healthController, adminController, auth, config.EventMiddleware(auth, limiter)...)
 
+	addr, err := config.HTTPAddr()
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Invalid HTTP listen address", "error", err)
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: ginRouter,
+	}
+	// Live subscriptions never finish on their own, so end them as soon as
+	// shutdown starts rather than waiting out the shutdown timeout.
+	server.RegisterOnShutdown(hub.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var consumers sync.WaitGroup
+	if kafkaConfig := config.KafkaConfig(); kafkaConfig.Enabled {
+		consumer := ingest.NewKafkaConsumer(kafkaConfig, eventPipeline, deadLetters)
+		runConsumer(ctx, &consumers, "kafka", consumer.Run, consumer.Close)
+	}
+	if redisConfig.Enabled {
+		consumer := ingest.NewRedisConsumer(redisClient, redisConfig, eventPipeline, deadLetters)
+		runConsumer(ctx, &consumers, "redis", consumer.Run, nil)
+	}
+
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		retention.Run(ctx)
+	}()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		serviceConfig.WAL.Run(ctx, eventService, deadLetters, publishers)
+	}()
+
+	go func() {
+		slog.Info("Listening", "addr", addr)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down, draining in-flight events")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout())
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP server shutdown failed", "error", err)
+	}
+
+	consumers.Wait()
+	background.Wait()
+
+	if err := eventPipeline.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Pipeline shutdown failed", "error", err)
+	}
+
+	if webhook != nil {
+		if err := webhook.Close(shutdownCtx); err != nil {
+			slog.Error("Webhook shutdown failed", "error", err)
+		}
+	}
+	if kafkaProducer != nil {
+		if err := kafkaProducer.Close(shutdownCtx); err != nil {
+			slog.Error("Kafka producer shutdown failed", "error", err)
+		}
+	}
+
+	// The dead-letter sink may still publish while the pipeline drains.
+	if redisClient != nil {
+		if err := redisClient.Close(); err != nil {
+			slog.Error("Closing Redis client failed", "error", err)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		slog.Error("Closing database failed", "error", err)
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Flushing traces failed", "error", err)
 	}
 }
 
+// runConsumer runs an ingestion source until ctx is cancelled. A consumer that
+// fails on its own is logged and stopped without taking the server down. close
+// may be nil when the consumer holds nothing of its own to release.
+func runConsumer(ctx context.Context, wg *sync.WaitGroup, name string, run func(context.Context) error, close func() error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slog.Info("Starting consumer", "consumer", name)
+
+		if err := run(ctx); err != nil {
+			slog.Error("Consumer stopped", "consumer", name, "error", err)
+		}
+		if close == nil {
+			return
+		}
+		if err := close(); err != nil {
+			slog.Error("Closing consumer failed", "consumer", name, "error", err)
+		}
+	}()
+}
+
+// loadEnv loads variables from ENV_FILE (default .env) unless SKIP_ENV_FILE
+// is set. A missing default file is fine since production environments get
+// their variables from the orchestrator, but a malformed file or a missing
+// explicitly configured one is fatal.
 func loadEnv() {
-	err := godotenv.Load()
+	if skip, _ := strconv.ParseBool(os.Getenv("SKIP_ENV_FILE")); skip {
+		return
+	}
+
+	envFile, explicit := os.LookupEnv("ENV_FILE")
+	if !explicit || envFile == "" {
+		envFile = ".env"
+	}
+
+	err := godotenv.Load(envFile)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		slog.Info("No .env file found, using process environment")
+		return
+	}
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		slog.Error("Error loading env file", "file", envFile, "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,27 @@
+// Command openapigen writes the OpenAPI document annotated in the doc
+// comments of a directory tree, see package openapi. It is run by go generate
+// in internal/api.
+package main
+
+import (
+	"event-processing-pipeline/internal/openapi"
+	"flag"
+	"log/slog"
+	"os"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory tree holding the annotated Go files")
+	out := flag.String("out", "openapi.json", "file the document is written to")
+	flag.Parse()
+
+	spec, err := openapi.Generate(*dir)
+	if err != nil {
+		slog.Error("Failed to generate the OpenAPI document", "error", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		slog.Error("Failed to write the OpenAPI document", "path", *out, "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// maxAdminWorkers bounds the worker pool size settable at runtime.
+const maxAdminWorkers = 1024
+
+type AdminController interface {
+	// GetConfig returns the runtime configuration in effect.
+	GetConfig(ctx *gin.Context)
+	// PatchConfig changes the runtime configuration.
+	PatchConfig(ctx *gin.Context)
+}
+
+type adminController struct {
+	eventPipeline *pipeline.EventPipeline
+	limiter       *RateLimiter
+}
+
+func NewAdminController(eventPipeline *pipeline.EventPipeline, limiter *RateLimiter) AdminController {
+	return &adminController{
+		eventPipeline: eventPipeline,
+		limiter:       limiter,
+	}
+}
+
+// runtimeConfig is the configuration reported by GET /admin/config. The
+// fields named like their environment variables can be changed with PATCH,
+// the others are read-only.
+//
+// @Schema RuntimeConfig
+// @Property worker_min integer
+// @Property worker_max integer
+// @Property workers integer
+// @Property ingestion_buffer_size integer
+// @Property enqueue_timeout string
+// @Property process_timeout string
+// @Property flush_size integer
+// @Property flush_interval string
+// @Property rate_limit_rps number
+// @Property rate_limit_burst integer
+// @Property rate_limit_global_rps number
+// @Property rate_limit_global_burst integer
+type runtimeConfig struct {
+	WorkerMin            int     `json:"worker_min"`
+	WorkerMax            int     `json:"worker_max"`
+	Workers              int     `json:"workers"`
+	IngestionBufferSize  int     `json:"ingestion_buffer_size"`
+	EnqueueTimeout       string  `json:"enqueue_timeout"`
+	ProcessTimeout       string  `json:"process_timeout"`
+	FlushSize            int     `json:"flush_size"`
+	FlushInterval        string  `json:"flush_interval"`
+	RateLimitRPS         float64 `json:"rate_limit_rps"`
+	RateLimitBurst       int     `json:"rate_limit_burst"`
+	RateLimitGlobalRPS   float64 `json:"rate_limit_global_rps"`
+	RateLimitGlobalBurst int     `json:"rate_limit_global_burst"`
+}
+
+// configPatch holds the settings changeable at runtime. Absent fields are
+// left as they are.
+//
+// @Schema RuntimeConfigPatch
+// @Property worker_min integer
+// @Property worker_max integer
+// @Property flush_size integer
+// @Property rate_limit_rps number
+// @Property rate_limit_burst integer
+// @Property rate_limit_global_rps number
+// @Property rate_limit_global_burst integer
+// @Closed
+type configPatch struct {
+	WorkerMin            *int     `json:"worker_min"`
+	WorkerMax            *int     `json:"worker_max"`
+	FlushSize            *int     `json:"flush_size"`
+	RateLimitRPS         *float64 `json:"rate_limit_rps"`
+	RateLimitBurst       *int     `json:"rate_limit_burst"`
+	RateLimitGlobalRPS   *float64 `json:"rate_limit_global_rps"`
+	RateLimitGlobalBurst *int     `json:"rate_limit_global_burst"`
+}
+
+// GetConfig returns the runtime configuration in effect.
+//
+// @Router GET /admin/config getConfig
+// @Summary Get the runtime config
+// @Success 200 RuntimeConfig Runtime config
+// @Failure 401 403
+func (c *adminController) GetConfig(ctx *gin.Context) {
+	respondOK(ctx, http.StatusOK, c.runtimeConfig())
+}
+
+// PatchConfig validates every field before applying any, so a rejected patch
+// changes nothing. Shrinking the worker pool lets surplus workers finish
+// their current event first.
+//
+// @Router PATCH /admin/config patchConfig
+// @Summary Change the runtime config
+// @Accept application/json RuntimeConfigPatch
+// @Success 200 RuntimeConfig Runtime config after the change
+// @Failure 400 401 403 409 503 500
+func (c *adminController) PatchConfig(ctx *gin.Context) {
+	var patch configPatch
+	decoder := json.NewDecoder(ctx.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	current := c.runtimeConfig()
+	minWorkers, maxWorkers := valueOr(patch.WorkerMin, current.WorkerMin), valueOr(patch.WorkerMax, current.WorkerMax)
+	limits := RateLimitConfig{
+		PerClient:      rate.Limit(valueOr(patch.RateLimitRPS, current.RateLimitRPS)),
+		PerClientBurst: valueOr(patch.RateLimitBurst, current.RateLimitBurst),
+		Global:         rate.Limit(valueOr(patch.RateLimitGlobalRPS, current.RateLimitGlobalRPS)),
+		GlobalBurst:    valueOr(patch.RateLimitGlobalBurst, current.RateLimitGlobalBurst),
+	}
+
+	if err := validatePatch(patch, minWorkers, maxWorkers, limits); err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if patch.FlushSize != nil && current.FlushSize == 0 {
+		respondErr(ctx, http.StatusConflict, ErrCodeConflict, pipeline.ErrFlushDisabled.Error())
+		return
+	}
+
+	if patch.WorkerMin != nil || patch.WorkerMax != nil {
+		if err := c.eventPipeline.Resize(minWorkers, maxWorkers); err != nil {
+			if errors.Is(err, pipeline.ErrPipelineClosed) {
+				respondErr(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error())
+				return
+			}
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+			return
+		}
+	}
+	if patch.FlushSize != nil {
+		if err := c.eventPipeline.SetFlushSize(*patch.FlushSize); err != nil {
+			respondErr(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
+			return
+		}
+	}
+	c.limiter.SetConfig(limits)
+
+	updated := c.runtimeConfig()
+	logging.FromContext(ctx.Request.Context()).Warn("Runtime config changed", "config", updated)
+	respondOK(ctx, http.StatusOK, updated)
+}
+
+func (c *adminController) runtimeConfig() runtimeConfig {
+	cfg, workers := c.eventPipeline.Config()
+	limits := c.limiter.Config()
+
+	return runtimeConfig{
+		WorkerMin:            cfg.WorkerCount,
+		WorkerMax:            cfg.MaxWorkers,
+		Workers:              workers,
+		IngestionBufferSize:  cfg.BufferSize,
+		EnqueueTimeout:       cfg.EnqueueTimeout.String(),
+		ProcessTimeout:       cfg.ProcessTimeout.String(),
+		FlushSize:            cfg.FlushSize,
+		FlushInterval:        cfg.FlushInterval.String(),
+		RateLimitRPS:         float64(limits.PerClient),
+		RateLimitBurst:       limits.PerClientBurst,
+		RateLimitGlobalRPS:   float64(limits.Global),
+		RateLimitGlobalBurst: limits.GlobalBurst,
+	}
+}
+
+func validatePatch(patch configPatch, minWorkers, maxWorkers int, limits RateLimitConfig) error {
+	if minWorkers < 1 || minWorkers > maxAdminWorkers {
+		return fmt.Errorf("worker_min must be between 1 and %d", maxAdminWorkers)
+	}
+	if maxWorkers < minWorkers || maxWorkers > maxAdminWorkers {
+		return fmt.Errorf("worker_max must be between worker_min and %d", maxAdminWorkers)
+	}
+	if patch.FlushSize != nil && (*patch.FlushSize < 2 || *patch.FlushSize > storage.MaxInsertBatchSize) {
+		return fmt.Errorf("flush_size must be between 2 and %d", storage.MaxInsertBatchSize)
+	}
+	if limits.PerClient < 0 || limits.Global < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	if limits.PerClientBurst < 1 || limits.GlobalBurst < 1 {
+		return errors.New("rate limit bursts must be at least 1")
+	}
+
+	return nil
+}
+
+// valueOr returns *value, or fallback when value is nil.
+func valueOr[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/subtle"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is an accepted key and the name it is attributed to in logs and
+// metrics.
+type APIKey struct {
+	Name string
+	Key  string
+}
+
+// APIKeyAuth accepts requests carrying one of keys in an Authorization:
+// Bearer or X-API-Key header. It responds 401 when no key is sent and 403
+// when the key is unknown.
+func APIKeyAuth(keys []APIKey, eventMetrics *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		presented := requestAPIKey(ctx)
+		if presented == "" {
+			ctx.Header("WWW-Authenticate", "Bearer")
+			abortErr(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "missing API key")
+			return
+		}
+
+		name, ok := matchAPIKey(keys, presented)
+		if !ok {
+			logging.FromContext(ctx.Request.Context()).Warn("Rejected unknown API key", "client_ip", ctx.ClientIP())
+			abortErr(ctx, http.StatusForbidden, ErrCodeForbidden, "invalid API key")
+			return
+		}
+
+		eventMetrics.IncAPIKeyRequest(name)
+		ctx.Request = ctx.Request.WithContext(logging.WithAPIKey(ctx.Request.Context(), name))
+		ctx.Next()
+	}
+}
+
+func requestAPIKey(ctx *gin.Context) string {
+	if scheme, token, ok := strings.Cut(ctx.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	return ctx.GetHeader(APIKeyHeader)
+}
+
+// matchAPIKey compares against every key in constant time so response timing
+// does not reveal how much of a key matched.
+func matchAPIKey(keys []APIKey, presented string) (string, bool) {
+	name, ok := "", false
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(presented)) == 1 {
+			name, ok = key.Name, true
+		}
+	}
+
+	return name, ok
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Async batch job states.
+const (
+	batchJobRunning   = "running"
+	batchJobCompleted = "completed"
+)
+
+// batchJob tracks the events of an async batch as the pipeline finishes them.
+type batchJob struct {
+	id string
+
+	mu        sync.Mutex
+	processed int
+	failed    int
+	results   []batchEventResult
+}
+
+func newBatchJob(events []api.EventDTO) *batchJob {
+	job := &batchJob{
+		id:      uuid.NewString(),
+		results: make([]batchEventResult, len(events)),
+	}
+	for i, event := range events {
+		if event.ID != nil {
+			job.results[i].ID = *event.ID
+		}
+	}
+
+	return job
+}
+
+// finish records the outcome of the event at index i.
+func (j *batchJob) finish(i int, status, errMessage string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.results[i].Status, j.results[i].Error = status, errMessage
+	j.processed++
+	if status != batchStatusStored && status != batchStatusDuplicate && status != batchStatusSampledOut && status != batchStatusSpooled {
+		j.failed++
+	}
+}
+
+// body reports the job's progress, with per-event results once every event
+// is finished.
+//
+// @Schema BatchJob
+// @Property job_id string
+// @Property status string(enum=running,completed)
+// @Property total integer
+// @Property processed integer
+// @Property failed integer
+// @Property counts map[string]integer
+// @Property results []BatchResult
+func (j *batchJob) body() gin.H {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	body := gin.H{
+		"job_id":    j.id,
+		"status":    batchJobRunning,
+		"total":     len(j.results),
+		"processed": j.processed,
+		"failed":    j.failed,
+	}
+	if j.processed == len(j.results) {
+		counts := make(map[string]int)
+		for _, result := range j.results {
+			counts[result.Status]++
+		}
+		body["status"] = batchJobCompleted
+		body["counts"] = counts
+		body["results"] = append([]batchEventResult(nil), j.results...)
+	}
+
+	return body
+}
+
+// batchJobKey scopes job ids to the API key and tenant, so tenants cannot
+// read each other's results.
+func batchJobKey(ctx context.Context, id string) string {
+	return logging.APIKey(ctx) + "\x00" + logging.Tenant(ctx) + "\x00" + id
+}
+
+// enqueueBatchJob enqueues the events of an async batch, tracking them as a
+// job when tracking is enabled, and returns the job, nil when disabled, and
+// the number of events enqueued before the pipeline refused one. Refused
+// events are finished as rejected.
+func (c *eventController) enqueueBatchJob(ctx context.Context, events []api.EventDTO) (*batchJob, int, error) {
+	var job *batchJob
+	var key string
+	var results chan pipeline.JobResult
+	if c.batchJobs != nil {
+		job = newBatchJob(events)
+		key = batchJobKey(ctx, job.id)
+		results = make(chan pipeline.JobResult, len(events))
+		c.batchJobs.Put(key, job)
+	}
+
+	// The batch outlives the request, so keep its values but not its cancellation.
+	jobCtx := context.WithoutCancel(ctx)
+	for i, event := range events {
+		pipelineJob := pipeline.Job{Ctx: jobCtx, Event: event, Retryable: true, Index: i}
+		if job != nil {
+			pipelineJob.Result = results
+		}
+
+		if err := c.eventPipeline.Enqueue(pipelineJob); err != nil {
+			if job != nil {
+				for j := i; j < len(events); j++ {
+					job.finish(j, batchStatusRejected, err.Error())
+				}
+				go c.trackBatchJob(key, job, results, i)
+			}
+			return job, i, err
+		}
+	}
+
+	if job != nil {
+		go c.trackBatchJob(key, job, results, len(events))
+	}
+	return job, len(events), nil
+}
+
+// trackBatchJob records the results of the n enqueued events in the order
+// the pipeline delivers them, so an event waiting for a retry does not hold
+// back the progress of the others, and keeps the job for a full TTL after it
+// completes.
+func (c *eventController) trackBatchJob(key string, job *batchJob, results <-chan pipeline.JobResult, n int) {
+	for range n {
+		result := <-results
+		status, errMessage := batchStatus(result)
+		job.finish(result.Index, status, errMessage)
+	}
+
+	c.batchJobs.Put(key, job)
+}
+
+// GetBatchJob reports the progress of an async batch.
+//
+// @Router GET /events/batch/{jobID} getBatchJob
+// @Summary Get the progress of an async batch
+// @Param jobID path string
+// @Param ifNoneMatch
+// @Success 200 BatchJob Progress, with per-event results once completed
+// @Failure 304 404
+func (c *eventController) GetBatchJob(ctx *gin.Context) {
+	job, ok := c.batchJobs.Get(batchJobKey(ctx.Request.Context(), ctx.Param("jobID")))
+	if !ok {
+		respondErr(ctx, http.StatusNotFound, ErrCodeNotFound, "batch job not found")
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, job.body())
+}
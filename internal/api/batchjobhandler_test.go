@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// batchJobBody is the progress GET /events/batch/:jobID reports.
+type batchJobBody struct {
+	JobID     string             `json:"job_id"`
+	Status    string             `json:"status"`
+	Total     int                `json:"total"`
+	Processed int                `json:"processed"`
+	Failed    int                `json:"failed"`
+	Results   []batchEventResult `json:"results"`
+}
+
+func TestGetBatchJob(t *testing.T) {
+	s := newTestServer(t, testConfig{
+		service:    pipeline.ServiceConfig{ProcessDelay: 20 * time.Millisecond},
+		controller: ControllerConfig{BatchJobTTL: time.Minute, BatchJobCacheSize: 16},
+	})
+
+	// The second event fails validation.
+	batch := []map[string]any{testEventJSON("evt-1", 1), {"id": "evt-2", "source": "web"}, testEventJSON("evt-3", 3)}
+	recorder := s.do(t, http.MethodPost, "/events/batch", "", mustJSON(t, batch))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	data(t, recorder, &accepted)
+	if location := recorder.Header().Get("Location"); accepted.JobID == "" || location != "/events/batch/"+accepted.JobID {
+		t.Fatalf("job id %q, Location %q; want the job's location", accepted.JobID, location)
+	}
+
+	var job batchJobBody
+	for deadline := time.Now().Add(2 * time.Second); job.Status != batchJobCompleted; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s after %d of %d events", job.Status, job.Processed, job.Total)
+		}
+		job = batchJobBody{}
+		recorder := s.do(t, http.MethodGet, "/events/batch/"+accepted.JobID, "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+		data(t, recorder, &job)
+
+		if job.JobID != accepted.JobID || job.Total != len(batch) || job.Processed > job.Total {
+			t.Fatalf("progress %+v of job %s with %d events", job, accepted.JobID, len(batch))
+		}
+		if job.Status == batchJobRunning && job.Results != nil {
+			t.Errorf("running job reports results %v", job.Results)
+		}
+	}
+
+	if job.Processed != 3 || job.Failed != 1 {
+		t.Errorf("processed %d, failed %d; want 3 and 1", job.Processed, job.Failed)
+	}
+	var statuses []string
+	for _, result := range job.Results {
+		statuses = append(statuses, result.ID+":"+result.Status)
+	}
+	want := []string{"evt-1:" + batchStatusStored, "evt-2:" + batchStatusValidationFailed, "evt-3:" + batchStatusStored}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("results %v, want %v", statuses, want)
+	}
+}
+
+// rejectingRepository fails every transaction inserting the event with id.
+type rejectingRepository struct {
+	storage.EventRepository
+	id string
+}
+
+func (r rejectingRepository) InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []storage.ProcessedEvent) (storage.InsertResult, error) {
+	for _, event := range events {
+		if event.ID == r.id {
+			return storage.InsertResult{}, fmt.Errorf("event %s violates a constraint", r.id)
+		}
+	}
+	return r.EventRepository.InsertEventsTx(ctx, tx, events)
+}
+
+func TestGetBatchJobProgressWhileRetrying(t *testing.T) {
+	s := newTestServer(t, testConfig{
+		repo:       rejectingRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), id: "evt-1"},
+		pipeline:   pipeline.PipelineConfig{Retries: pipeline.RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: time.Hour}},
+		controller: ControllerConfig{BatchJobTTL: time.Minute, BatchJobCacheSize: 16},
+	})
+
+	// The first event waits an hour for its retry.
+	batch := []map[string]any{testEventJSON("evt-1", 1), testEventJSON("evt-2", 2), testEventJSON("evt-3", 3)}
+	recorder := s.do(t, http.MethodPost, "/events/batch", "", mustJSON(t, batch))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	data(t, recorder, &accepted)
+
+	var job batchJobBody
+	for deadline := time.Now().Add(time.Second); job.Processed != 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("progress %+v, want the events after the retried one processed", job)
+		}
+		job = batchJobBody{}
+		data(t, s.do(t, http.MethodGet, "/events/batch/"+accepted.JobID, "", nil), &job)
+	}
+	if job.Status != batchJobRunning || job.Failed != 0 {
+		t.Errorf("job %s with %d failed, want running with none failed", job.Status, job.Failed)
+	}
+}
+
+func TestGetBatchJobNotFound(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		jobID func(t *testing.T, s *testServer) string
+	}{
+		{name: "unknown job", ttl: time.Minute, jobID: func(*testing.T, *testServer) string { return "missing" }},
+		{
+			name: "expired job",
+			ttl:  time.Nanosecond,
+			jobID: func(t *testing.T, s *testServer) string {
+				var accepted struct {
+					JobID string `json:"job_id"`
+				}
+				data(t, s.do(t, http.MethodPost, "/events/batch", "", mustJSON(t, []map[string]any{testEventJSON("evt-1", 1)})), &accepted)
+				time.Sleep(time.Millisecond)
+				return accepted.JobID
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{BatchJobTTL: tt.ttl, BatchJobCacheSize: 16}})
+
+			recorder := s.do(t, http.MethodGet, "/events/batch/"+tt.jobID(t, s), "", nil)
+			if recorder.Code != http.StatusNotFound || errorCode(t, recorder) != ErrCodeNotFound {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusNotFound, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestListRetries(t *testing.T) {
+	s := newTestServer(t, testConfig{
+		repo:       failingRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), err: errors.New("disk full")},
+		pipeline:   pipeline.PipelineConfig{Retries: pipeline.RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: time.Hour}},
+		controller: ControllerConfig{BatchJobTTL: time.Minute, BatchJobCacheSize: 16},
+	})
+
+	batch := []map[string]any{testEventJSON("evt-1", 1), testEventJSON("evt-2", 2), testEventJSON("evt-3", 3)}
+	if recorder := s.do(t, http.MethodPost, "/events/batch", "", mustJSON(t, batch)); recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+
+	var envelope struct {
+		Data []pipeline.PendingRetry `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	for deadline := time.Now().Add(time.Second); envelope.Meta.Total != len(batch); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pending retries, want %d", envelope.Meta.Total, len(batch))
+		}
+		recorder := s.do(t, http.MethodGet, "/events/retries?limit=2", "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("decode %s: %v", recorder.Body, err)
+		}
+	}
+
+	if len(envelope.Data) != 2 {
+		t.Fatalf("page holds %d retries, want 2", len(envelope.Data))
+	}
+	for _, retry := range envelope.Data {
+		if retry.Attempts != 1 || !strings.Contains(retry.LastError, "disk full") || time.Until(retry.NextRetry) < 59*time.Minute {
+			t.Errorf("pending retry %+v, want 1 attempt, the store error and a retry in an hour", retry)
+		}
+	}
+}
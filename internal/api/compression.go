@@ -0,0 +1,52 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DecompressRequest transparently gunzips bodies sent with Content-Encoding:
+// gzip. Body size limits applied by the handlers then count decompressed
+// bytes, so a small compressed body cannot expand past MAX_BODY_BYTES.
+// Encodings other than gzip get 415 Unsupported Media Type.
+func DecompressRequest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(ctx.GetHeader("Content-Encoding")))
+		switch encoding {
+		case "", "identity":
+			ctx.Next()
+			return
+		case "gzip", "x-gzip":
+		default:
+			abortErr(ctx, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, "unsupported content encoding "+encoding)
+			return
+		}
+
+		reader, err := gzip.NewReader(ctx.Request.Body)
+		if err != nil {
+			abortErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid gzip body")
+			return
+		}
+
+		ctx.Request.Body = &gzipBody{Reader: reader, body: ctx.Request.Body}
+		ctx.Request.Header.Del("Content-Encoding")
+		ctx.Request.Header.Del("Content-Length")
+		ctx.Request.ContentLength = -1
+		ctx.Next()
+	}
+}
+
+// gzipBody closes both the gzip reader and the underlying request body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
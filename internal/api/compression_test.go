@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	batch := mustJSON(t, []map[string]any{testEventJSON("evt-1", 1), testEventJSON("evt-2", 2)})
+	// Far more than MaxBodyBytes once inflated, a few KiB compressed.
+	bomb := gzipped(t, []byte(strings.Repeat(" ", 8<<20)))
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipped(t, batch), wantStatus: http.StatusOK},
+		{name: "x-gzip", encoding: "x-gzip", body: gzipped(t, batch), wantStatus: http.StatusOK},
+		{name: "identity", encoding: "identity", body: batch, wantStatus: http.StatusOK},
+		{name: "expands past the limit", encoding: "gzip", body: bomb, wantStatus: http.StatusRequestEntityTooLarge, wantCode: ErrCodePayloadTooLarge},
+		{name: "not gzip", encoding: "gzip", body: batch, wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidRequest},
+		{name: "unsupported encoding", encoding: "br", body: batch, wantStatus: http.StatusUnsupportedMediaType, wantCode: ErrCodeUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, "/events/batch?mode=sync", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", ContentTypeJSON)
+			req.Header.Set("Content-Encoding", tt.encoding)
+			recorder := httptest.NewRecorder()
+			s.router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, recorder); code != tt.wantCode {
+					t.Errorf("error code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+			for _, id := range []string{"evt-1", "evt-2"} {
+				if _, err := s.repo.FindEventByID(context.Background(), id); err != nil {
+					t.Errorf("FindEventByID(%s): %v", id, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeCSV    = "text/csv"
+)
+
+// Content types accepted by each ingestion endpoint.
+var (
+	EventContentTypes  = []string{ContentTypeJSON, ContentTypeProtobuf, "application/protobuf"}
+	StreamContentTypes = []string{ContentTypeNDJSON, "application/jsonl"}
+	CSVContentTypes    = []string{ContentTypeCSV}
+)
+
+// RequireContentType answers 415 Unsupported Media Type before the body is
+// read unless the request's media type, ignoring parameters such as charset,
+// is one of types.
+func RequireContentType(types ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		contentType := strings.ToLower(ctx.ContentType())
+		if slices.Contains(types, contentType) {
+			ctx.Next()
+			return
+		}
+
+		message := "Content-Type header is required"
+		if contentType != "" {
+			message = fmt.Sprintf("unsupported content type %q", contentType)
+		}
+		ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, Envelope{Error: &ErrorBody{
+			Code:    ErrCodeUnsupportedMediaType,
+			Message: message,
+			Details: gin.H{"supported": types},
+		}})
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireContentType(t *testing.T) {
+	event := testEventJSON("evt-1", 1)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		wantStatus  int
+		wantMessage string
+	}{
+		{name: "json", target: "/events", contentType: "application/json", wantStatus: http.StatusCreated},
+		{name: "charset parameter", target: "/events", contentType: "application/json; charset=utf-8", wantStatus: http.StatusCreated},
+		{name: "upper case", target: "/events", contentType: "Application/JSON", wantStatus: http.StatusCreated},
+		{name: "missing", target: "/events", wantStatus: http.StatusUnsupportedMediaType, wantMessage: "Content-Type header is required"},
+		{name: "form", target: "/events", contentType: "application/x-www-form-urlencoded", wantStatus: http.StatusUnsupportedMediaType, wantMessage: `unsupported content type "application/x-www-form-urlencoded"`},
+		{name: "ndjson to the single endpoint", target: "/events", contentType: ContentTypeNDJSON, wantStatus: http.StatusUnsupportedMediaType, wantMessage: `unsupported content type "application/x-ndjson"`},
+		{name: "json to the csv endpoint", target: "/events/csv", contentType: ContentTypeJSON, wantStatus: http.StatusUnsupportedMediaType, wantMessage: `unsupported content type "application/json"`},
+		{name: "json to the stream endpoint", target: "/events/stream", contentType: ContentTypeJSON, wantStatus: http.StatusUnsupportedMediaType, wantMessage: `unsupported content type "application/json"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			body := bytes.NewReader(mustJSON(t, event))
+			req := httptest.NewRequest(http.MethodPost, tt.target, body)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			s.router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantMessage == "" {
+				return
+			}
+
+			var envelope Envelope
+			if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+				t.Fatal(err)
+			}
+			if envelope.Error.Code != ErrCodeUnsupportedMediaType || envelope.Error.Message != tt.wantMessage {
+				t.Errorf("error %s %q, want %s %q", envelope.Error.Code, envelope.Error.Message, ErrCodeUnsupportedMediaType, tt.wantMessage)
+			}
+			// Rejected before the body is read.
+			if body.Len() == 0 {
+				t.Error("the body of a rejected request was read")
+			}
+		})
+	}
+}
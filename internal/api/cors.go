@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins lists the origins browsers may call from, "*" allows
+	// any. Empty disables CORS.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts may read.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// CORS adds the CORS headers for allowed origins and answers preflight
+// requests itself with 204 No Content, before authentication, since browsers
+// send preflights without credentials. Requests from other origins pass
+// through without CORS headers, which makes the browser block the response.
+func CORS(cfg CORSConfig) gin.HandlerFunc {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !anyOrigin && !slices.Contains(cfg.AllowedOrigins, origin) {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			ctx.Header("Access-Control-Allow-Methods", methods)
+			ctx.Header("Access-Control-Allow-Headers", headers)
+			ctx.Header("Access-Control-Max-Age", maxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if exposed != "" {
+			ctx.Header("Access-Control-Expose-Headers", exposed)
+		}
+		ctx.Next()
+	}
+}
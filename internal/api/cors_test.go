@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"https://dashboard.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-API-Key"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	tests := []struct {
+		name       string
+		cfg        CORSConfig
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{
+			name:       "preflight",
+			cfg:        cfg,
+			method:     http.MethodOptions,
+			origin:     "https://dashboard.example.com",
+			preflight:  true,
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "https://dashboard.example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-API-Key",
+				"Access-Control-Max-Age":       "600",
+				"Vary":                         "Origin",
+			},
+		},
+		{
+			name:       "cross-origin POST",
+			cfg:        cfg,
+			method:     http.MethodPost,
+			origin:     "https://dashboard.example.com",
+			wantStatus: http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":   "https://dashboard.example.com",
+				"Access-Control-Expose-Headers": "X-Request-ID",
+				"Access-Control-Allow-Methods":  "",
+			},
+		},
+		{
+			name:       "any origin",
+			cfg:        CORSConfig{AllowedOrigins: []string{"*"}},
+			method:     http.MethodPost,
+			origin:     "https://other.example.com",
+			wantStatus: http.StatusCreated,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://other.example.com"},
+		},
+		{
+			name:       "preflight from another origin",
+			cfg:        cfg,
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			preflight:  true,
+			wantStatus: http.StatusNotFound,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:       "POST from another origin",
+			cfg:        cfg,
+			method:     http.MethodPost,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusCreated,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "same origin",
+			cfg:        cfg,
+			method:     http.MethodPost,
+			wantStatus: http.StatusCreated,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(CORS(tt.cfg))
+			router.POST("/events", func(ctx *gin.Context) { ctx.Status(http.StatusCreated) })
+
+			req := httptest.NewRequest(tt.method, "/events", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			for name, want := range tt.wantHeader {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
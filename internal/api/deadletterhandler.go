@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeadLetters returns a page of dead letters, newest first.
+//
+// @Router GET /events/dead-letter listDeadLetters
+// @Summary List dead letters
+// @Param limit offset ifNoneMatch
+// @Success 200 []DeadLetter meta={limit:integer,offset:integer} Dead letters,
+// newest first
+// @Failure 304 400 500
+func (c *eventController) ListDeadLetters(ctx *gin.Context) {
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	deadLetters, err := c.deadLetters.List(ctx.Request.Context(), limit, offset)
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to list dead letters", "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to list dead letters")
+		return
+	}
+
+	respondOKMeta(ctx, http.StatusOK, deadLetters, gin.H{
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// ListRetries lists the events of async batches waiting for another attempt
+// to store them, the next due first.
+//
+// @Router GET /events/retries listRetries
+// @Summary List events waiting for a retry
+// @Description Events of async batches that failed to store and wait in the
+// retry queue for another attempt, the next due first. After
+// RETRY_MAX_ATTEMPTS they are dead-lettered.
+// @Param limit offset
+// @Success 200 []PendingRetry meta={limit:integer,offset:integer,total:integer}
+// Pending retries
+// @Failure 400
+func (c *eventController) ListRetries(ctx *gin.Context) {
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	retries := c.eventPipeline.PendingRetries()
+	start := min(offset, len(retries))
+	respondOKMeta(ctx, http.StatusOK, retries[start:min(start+limit, len(retries))], gin.H{
+		"limit":  limit,
+		"offset": offset,
+		"total":  len(retries),
+	})
+}
+
+// RetryDeadLetter re-injects a dead-lettered event into the pipeline. If it
+// fails again it is dead-lettered anew.
+//
+// @Router POST /events/dead-letter/{id}/retry retryDeadLetter
+// @Summary Re-inject a dead-lettered event
+// @Param id path integer
+// @Success 202 {status:string,id:string} Enqueued
+// @Failure 400 404 503 500
+func (c *eventController) RetryDeadLetter(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "id must be an integer")
+		return
+	}
+
+	event, err := c.deadLetters.Take(ctx.Request.Context(), id)
+	if errors.Is(err, storage.ErrDeadLetterNotFound) {
+		respondErr(ctx, http.StatusNotFound, ErrCodeNotFound, "dead letter not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to load dead letter", "dead_letter_id", id, "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to load dead letter")
+		return
+	}
+
+	c.assignID(&event)
+	if err := c.eventPipeline.Enqueue(pipeline.Job{Ctx: context.WithoutCancel(ctx.Request.Context()), Event: event}); err != nil {
+		c.deadLetters.Send(ctx.Request.Context(), event, metrics.StageEnqueue, err)
+		c.respondEnqueueError(ctx, err)
+		return
+	}
+
+	respondOK(ctx, http.StatusAccepted, gin.H{"status": "retry enqueued", "id": event.ID})
+}
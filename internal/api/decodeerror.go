@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decodeErrorDetails locates a JSON decoding failure so clients can fix the
+// payload. Offset, Line and Column are only set when the decoder reports a
+// position; Line and Column are 1-based. Index is the failing element of a
+// batch.
+type decodeErrorDetails struct {
+	Offset   *int64 `json:"offset,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Index    *int   `json:"index,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// respondDecodeError answers 400 for a body decodeEvent or decodeEvents
+// rejected. JSON errors get a readable message and, when the decoder reports
+// a position, details; batch errors also name the failing array index.
+func (c *eventController) respondDecodeError(ctx *gin.Context, body []byte, err error, batch bool) {
+	if isProtobuf(ctx) {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid protobuf body: "+err.Error())
+		return
+	}
+
+	message, details := describeJSONError(body, err)
+	if batch {
+		if index, ok := failingBatchIndex(body, c.strictJSON); ok {
+			if details == nil {
+				details = &decodeErrorDetails{}
+			}
+			details.Index = &index
+			message = fmt.Sprintf("event %d: %s", index, message)
+		}
+	}
+
+	if details == nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request: "+message)
+		return
+	}
+	respondErrDetails(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request: "+message, details)
+}
+
+// describeJSONError rewrites err without the Go type names encoding/json
+// puts in its messages. details is nil when the error carries no position,
+// such as an invalid timestamp.
+func describeJSONError(body []byte, err error) (string, *decodeErrorDetails) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		details := position(body, syntaxErr.Offset)
+		return fmt.Sprintf("malformed JSON at line %d, column %d: %s", details.Line, details.Column, syntaxErr.Error()), details
+	}
+
+	// DisallowUnknownFields reports unknown fields with a plain error.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name, _ := strconv.Unquote(field)
+		return "unknown field " + field, &decodeErrorDetails{Field: name}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		// Errors of UnmarshalJSON methods, such as the event value's, carry
+		// no offset, and the start of the body would be a wrong position.
+		details := &decodeErrorDetails{}
+		if typeErr.Offset > 0 {
+			details = position(body, typeErr.Offset)
+		}
+		details.Field = trimIndex(typeErr.Field)
+		details.Expected = jsonType(typeErr.Type)
+		details.Actual = typeErr.Value
+		if details.Field == "" {
+			return fmt.Sprintf("expected %s, got %s", details.Expected, details.Actual), details
+		}
+		return fmt.Sprintf("field %q must be %s, got %s", details.Field, details.Expected, details.Actual), details
+	}
+
+	return err.Error(), nil
+}
+
+// failingBatchIndex decodes the array one element at a time to find the
+// first element that does not decode. It reports false when the array itself
+// is malformed before any element, for instance when the body is an object.
+func failingBatchIndex(body []byte, strict bool) (int, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return 0, false
+	}
+
+	for index := 0; decoder.More(); index++ {
+		var event api.EventDTO
+		if err := decoder.Decode(&event); err != nil {
+			return index, true
+		}
+	}
+
+	return 0, false
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(body []byte, offset int64) *decodeErrorDetails {
+	offset = min(max(offset, 0), int64(len(body)))
+	before := body[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return &decodeErrorDetails{Offset: &offset, Line: line, Column: column}
+}
+
+// trimIndex drops the leading array index newer encoding/json versions
+// include in the field path, since it is reported separately.
+func trimIndex(field string) string {
+	head, rest, found := strings.Cut(field, ".")
+	if _, err := strconv.Atoi(head); err == nil {
+		if !found {
+			return ""
+		}
+		return rest
+	}
+
+	return field
+}
+
+// jsonType names the JSON type a Go type decodes from.
+func jsonType(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intPtr(i int) *int       { return &i }
+func int64Ptr(i int64) *int64 { return &i }
+
+func TestDecodeErrorDetails(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		wantMessage string
+		wantDetails *decodeErrorDetails
+	}{
+		{
+			name:        "syntax error",
+			target:      "/events",
+			body:        "{\"id\": \"evt-1\",\n  \"type\": }",
+			wantMessage: "invalid request: malformed JSON at line 2, column 12: invalid character '}' looking for beginning of value",
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(27), Line: 2, Column: 12},
+		},
+		{
+			name:        "wrong type",
+			target:      "/events",
+			body:        `{"id": "evt-1", "source": 5}`,
+			wantMessage: `invalid request: field "source" must be string, got number`,
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(27), Line: 1, Column: 28, Field: "source", Expected: "string", Actual: "number"},
+		},
+		{
+			name:        "wrong nested type",
+			target:      "/events",
+			body:        `{"id": "evt-1", "data": {"action": ["click"]}}`,
+			wantMessage: `invalid request: field "data.action" must be string, got array`,
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(36), Line: 1, Column: 37, Field: "data.action", Expected: "string", Actual: "array"},
+		},
+		{
+			name:        "batch element",
+			target:      "/events/batch",
+			body:        `[{"id": "evt-1"}, {"id": "evt-2", "user_id": false}]`,
+			wantMessage: `invalid request: event 1: field "user_id" must be string, got bool`,
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(50), Line: 1, Column: 51, Index: intPtr(1), Field: "user_id", Expected: "string", Actual: "bool"},
+		},
+		{
+			name:        "batch syntax error",
+			target:      "/events/batch",
+			body:        "[{\"id\": \"evt-1\"},\n {\"id\" \"evt-2\"}]",
+			wantMessage: "invalid request: event 1: malformed JSON at line 2, column 9: invalid character '\"' after object key",
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(26), Line: 2, Column: 9, Index: intPtr(1)},
+		},
+		{
+			name:        "batch of an object",
+			target:      "/events/batch",
+			body:        `{"id": "evt-1"}`,
+			wantMessage: "invalid request: expected array, got object",
+			wantDetails: &decodeErrorDetails{Offset: int64Ptr(1), Line: 1, Column: 2, Expected: "array", Actual: "object"},
+		},
+		{
+			name:        "invalid timestamp",
+			target:      "/events",
+			body:        `{"id": "evt-1", "timestamp": "yesterday"}`,
+			wantMessage: `invalid request: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			code, message, details := decodeError(t, s.do(t, http.MethodPost, tt.target, "", []byte(tt.body)))
+			if code != ErrCodeInvalidRequest || message != tt.wantMessage {
+				t.Errorf("error %s %q, want %s %q", code, message, ErrCodeInvalidRequest, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(details, tt.wantDetails) {
+				got, _ := json.Marshal(details)
+				want, _ := json.Marshal(tt.wantDetails)
+				t.Errorf("details = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorOfValue(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+
+	// The value decodes itself, so encoding/json reports no offset for it.
+	_, message, details := decodeError(t, s.do(t, http.MethodPost, "/events", "", []byte(`{"id": "evt-1", "data": {"value": "12"}}`)))
+	if !strings.HasSuffix(message, "number, got string") {
+		t.Errorf("message = %q, want the expected and actual types", message)
+	}
+	if details == nil || details.Offset != nil || details.Line != 0 || details.Expected != "number" || details.Actual != "string" {
+		t.Errorf("details = %+v, want the types without a position", details)
+	}
+}
+
+// decodeError returns the code, message and details of a 400 response.
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) (ErrorCode, string, *decodeErrorDetails) {
+	t.Helper()
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+	}
+
+	var envelope struct {
+		Error struct {
+			Code    ErrorCode           `json:"code"`
+			Message string              `json:"message"`
+			Details *decodeErrorDetails `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	return envelope.Error.Code, envelope.Error.Message, envelope.Error.Details
+}
+
+func TestStrictJSON(t *testing.T) {
+	withField := func(path string, value any) map[string]any {
+		event := testEventJSON("evt-1", 1)
+		if data, field, nested := strings.Cut(path, "."); nested {
+			event[data].(map[string]any)[field] = value
+		} else {
+			event[path] = value
+		}
+		return event
+	}
+
+	tests := []struct {
+		name        string
+		strict      bool
+		target      string
+		body        any
+		wantStatus  int
+		wantMessage string
+	}{
+		{name: "typo ignored", target: "/events", body: withField("timestmp", "2024-05-01T09:30:00Z"), wantStatus: http.StatusCreated},
+		{name: "typo rejected", strict: true, target: "/events", body: withField("timestmp", "2024-05-01T09:30:00Z"), wantStatus: http.StatusBadRequest, wantMessage: `invalid request: unknown field "timestmp"`},
+		{name: "nested typo rejected", strict: true, target: "/events", body: withField("data.valeu", 2), wantStatus: http.StatusBadRequest, wantMessage: `invalid request: unknown field "valeu"`},
+		{name: "metadata keys allowed", strict: true, target: "/events", body: withField("data.metadata", map[string]any{"anything": 1}), wantStatus: http.StatusCreated},
+		{name: "batch typo ignored", target: "/events/batch?mode=sync", body: []any{testEventJSON("evt-2", 1), withField("usr_id", "u-1")}, wantStatus: http.StatusOK},
+		{name: "batch typo rejected", strict: true, target: "/events/batch?mode=sync", body: []any{testEventJSON("evt-2", 1), withField("usr_id", "u-1")}, wantStatus: http.StatusBadRequest, wantMessage: `invalid request: event 1: unknown field "usr_id"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{StrictJSON: tt.strict}})
+
+			recorder := s.do(t, http.MethodPost, tt.target, "", mustJSON(t, tt.body))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantMessage == "" {
+				return
+			}
+			if _, message, _ := decodeError(t, recorder); message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestStrictJSONTrailingData(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		s := newTestServer(t, testConfig{controller: ControllerConfig{StrictJSON: strict}})
+
+		body := append(mustJSON(t, testEventJSON("evt-1", 1)), `{"id": "evt-2"}`...)
+		if _, message, _ := decodeError(t, s.do(t, http.MethodPost, "/events", "", body)); !strings.Contains(message, "after top-level value") {
+			t.Errorf("strict %t: message = %q, want the trailing data reported", strict, message)
+		}
+	}
+}
@@ -1,24 +1,47 @@
 package api
 
-import (
-	"time"
-)
-
 type EventType string
 
 type Source string
 
 type Data struct {
-	Action   string                 `json:"action"`
-	Value    float32                `json:"value"`
-	Metadata map[string]interface{} `json:"metadata"`
+	Action string `json:"action"`
+	Value  Value  `json:"value"`
+	// ValueType is how Value is read, ValueTypeFloat when empty.
+	ValueType ValueType `json:"value_type,omitempty"`
+	Metadata  Metadata  `json:"metadata"`
 }
 
+// EventDTO is an event as clients send and receive it.
+//
+// @Schema Event
+// @Property id string(nullable) Generated when absent unless REQUIRE_EVENT_ID
+// is set
+// @Property type string May be left empty when DEFAULT_TYPE is configured
+// @Property source string May be left empty when DEFAULT_SOURCE is configured
+// @Property timestamp date-time RFC3339, or Unix seconds or milliseconds per
+// TIMESTAMP_FORMAT
+// @Property user_id string(nullable)
+// @Property data {}
+// @Property data.action string
+// @Property data.value number Read as a float64 unless value_type is int, in
+// which case it must be an integer within the int64 range and is kept exact
+// @Property data.value_type string(enum=float,int) How value is read, float
+// when absent. Stored events only carry it for int values.
+// @Property data.metadata object(nullable)
+// @Property schema_version integer(min=1) Version of the event shape the
+// payload follows. Older versions are upgraded to the current one before
+// validation; missing or unknown versions are read as 1. Stored events carry
+// the version they were upgraded to.
+// @Required type source timestamp
 type EventDTO struct {
 	ID        *string   `json:"id"`
 	Type      EventType `json:"type"`
 	Source    Source    `json:"source"`
-	Timestamp time.Time `json:"timestamp"`
+	Timestamp Timestamp `json:"timestamp"`
 	UserID    *string   `json:"user_id"`
 	Data      Data      `json:"data"`
+	// SchemaVersion is the version of the event shape the producer sent.
+	// Missing or unknown versions are read as version 1.
+	SchemaVersion int `json:"schema_version,omitempty"`
 }
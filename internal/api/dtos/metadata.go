@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+)
+
+// Metadata holds the free-form attributes of an event. Its numbers decode as
+// json.Number, which keeps integer ids beyond 2^53 exact where float64 would
+// round them, unless SetExactMetadataNumbers turned that off.
+type Metadata map[string]interface{}
+
+var floatMetadataNumbers atomic.Bool
+
+// SetExactMetadataNumbers selects whether numbers in the metadata of every
+// EventDTO decoded afterwards are kept as json.Number, the default, or read
+// as float64. It is meant to be called once at startup.
+func SetExactMetadataNumbers(exact bool) {
+	floatMetadataNumbers.Store(!exact)
+}
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*m = nil
+		return nil
+	}
+	if data[0] != '{' {
+		return &json.UnmarshalTypeError{Value: jsonKind(data), Type: reflect.TypeFor[map[string]interface{}]()}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if !floatMetadataNumbers.Load() {
+		decoder.UseNumber()
+	}
+
+	var decoded map[string]interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+
+	*m = decoded
+	return nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		float   bool
+		json    string
+		want    Metadata
+		wantErr bool
+	}{
+		{name: "64-bit integer", json: `{"id":9007199254740993}`, want: Metadata{"id": json.Number("9007199254740993")}},
+		{name: "largest int64", json: `{"id":9223372036854775807}`, want: Metadata{"id": json.Number("9223372036854775807")}},
+		{
+			name: "nested",
+			json: `{"order":{"ids":[1,2.5]}}`,
+			want: Metadata{"order": map[string]interface{}{"ids": []interface{}{json.Number("1"), json.Number("2.5")}}},
+		},
+		{name: "floats", float: true, json: `{"id":9007199254740993}`, want: Metadata{"id": float64(9007199254740992)}},
+		{name: "null", json: `null`},
+		{name: "not an object", json: `[1]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetExactMetadataNumbers(!tt.float)
+			t.Cleanup(func() { SetExactMetadataNumbers(true) })
+
+			var metadata Metadata
+			err := json.Unmarshal([]byte(tt.json), &metadata)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(metadata, tt.want) {
+				t.Errorf("metadata = %#v, want %#v", metadata, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	const body = `{"id":9223372036854775807,"ratio":0.1}`
+
+	var metadata Metadata
+	if err := json.Unmarshal([]byte(body), &metadata); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != body {
+		t.Errorf("metadata encodes as %s, want %s", data, body)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TimestampFormat decides how JSON numbers in the timestamp field are read.
+// RFC3339 strings are accepted in every format, so payloads the service
+// writes itself, such as dead-letter entries, always decode.
+type TimestampFormat string
+
+const (
+	// TimestampRFC3339 rejects numeric timestamps.
+	TimestampRFC3339 TimestampFormat = "rfc3339"
+	// TimestampUnix reads numbers as seconds since the epoch, fractions
+	// included.
+	TimestampUnix TimestampFormat = "unix"
+	// TimestampUnixMillis reads numbers as milliseconds since the epoch.
+	TimestampUnixMillis TimestampFormat = "unix_ms"
+)
+
+var timestampFormat atomic.Value
+
+// SetTimestampFormat selects the format for every EventDTO decoded
+// afterwards, whichever source it comes from. It is meant to be called once
+// at startup.
+func SetTimestampFormat(format TimestampFormat) {
+	timestampFormat.Store(format)
+}
+
+func currentTimestampFormat() TimestampFormat {
+	format, _ := timestampFormat.Load().(TimestampFormat)
+	if format == "" {
+		return TimestampRFC3339
+	}
+	return format
+}
+
+// Timestamp is a time.Time that also decodes from Unix seconds or
+// milliseconds, per SetTimestampFormat. It encodes as RFC3339 like time.Time.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] == '"' || bytes.Equal(data, []byte("null")) {
+		return t.Time.UnmarshalJSON(data)
+	}
+
+	format := currentTimestampFormat()
+	if format == TimestampRFC3339 {
+		return fmt.Errorf("timestamp must be an RFC3339 string, got %s", data)
+	}
+
+	parsed, err := parseUnix(string(data), format)
+	if err != nil {
+		return err
+	}
+
+	t.Time = parsed
+	return nil
+}
+
+// parseUnix parses an epoch number in seconds or milliseconds. Fractions
+// are kept down to the nanosecond; exponents are not accepted.
+func parseUnix(value string, format TimestampFormat) (time.Time, error) {
+	unit, fractionDigits := time.Second, 9
+	if format == TimestampUnixMillis {
+		unit, fractionDigits = time.Millisecond, 6
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	integer, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || strings.Trim(fraction, "0123456789") != "" {
+		return time.Time{}, fmt.Errorf("invalid %s timestamp %s", format, value)
+	}
+	if integer > math.MaxInt64/int64(unit) || integer < math.MinInt64/int64(unit) {
+		return time.Time{}, fmt.Errorf("timestamp %s is out of range", value)
+	}
+
+	nanos := integer * int64(unit)
+	if fraction != "" {
+		fraction = (fraction + strings.Repeat("0", fractionDigits))[:fractionDigits]
+		part, _ := strconv.ParseInt(fraction, 10, 64)
+		if strings.HasPrefix(whole, "-") {
+			part = -part
+		}
+		nanos += part
+	}
+
+	return time.Unix(0, nanos).UTC(), nil
+}
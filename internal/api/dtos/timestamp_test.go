@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  TimestampFormat
+		json    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "rfc3339", format: TimestampRFC3339, json: `"2024-05-01T09:30:00Z"`, want: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "rfc3339 with offset", format: TimestampRFC3339, json: `"2024-05-01T11:30:00+02:00"`, want: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "rfc3339 nanoseconds", format: TimestampRFC3339, json: `"2024-05-01T09:30:00.123456789Z"`, want: time.Date(2024, 5, 1, 9, 30, 0, 123456789, time.UTC)},
+		{name: "number in rfc3339 format", format: TimestampRFC3339, json: `1714555800`, wantErr: true},
+		{name: "unix seconds", format: TimestampUnix, json: `1714555800`, want: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "unix fraction", format: TimestampUnix, json: `1714555800.25`, want: time.Date(2024, 5, 1, 9, 30, 0, 250000000, time.UTC)},
+		{name: "unix before the epoch", format: TimestampUnix, json: `-1.5`, want: time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC)},
+		{name: "unix string still rfc3339", format: TimestampUnix, json: `"2024-05-01T09:30:00Z"`, want: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "unix millis", format: TimestampUnixMillis, json: `1714555800123`, want: time.Date(2024, 5, 1, 9, 30, 0, 123000000, time.UTC)},
+		{name: "unix millis fraction", format: TimestampUnixMillis, json: `1714555800123.5`, want: time.Date(2024, 5, 1, 9, 30, 0, 123500000, time.UTC)},
+		{name: "exponent", format: TimestampUnix, json: `1.7e9`, wantErr: true},
+		{name: "out of range", format: TimestampUnixMillis, json: `9223372036854775807`, wantErr: true},
+		{name: "null", format: TimestampUnix, json: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTimestampFormat(tt.format)
+			t.Cleanup(func() { SetTimestampFormat(TimestampRFC3339) })
+
+			var timestamp Timestamp
+			err := json.Unmarshal([]byte(tt.json), &timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %t", err, tt.wantErr)
+			}
+			if !timestamp.Equal(tt.want) {
+				t.Errorf("timestamp = %v, want %v", timestamp.Time, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ValueType tells how the value of an event is to be read.
+type ValueType string
+
+const (
+	// ValueTypeFloat reads the value as a float64, the default.
+	ValueTypeFloat ValueType = "float"
+	// ValueTypeInt reads the value as an exact int64, for counters beyond
+	// the 2^53 a float64 holds without rounding.
+	ValueTypeInt ValueType = "int"
+)
+
+// Value is an event value that keeps integers exact. It decodes from any JSON
+// number and remembers whether the number was an integer within the int64
+// range, so the value_type next to it can decide how it is read.
+type Value struct {
+	float float64
+	int   int64
+	exact bool
+}
+
+func FloatValue(f float64) Value {
+	return Value{float: f}
+}
+
+func IntValue(i int64) Value {
+	return Value{float: float64(i), int: i, exact: true}
+}
+
+// ParseValue parses a decimal number the way JSON numbers are read.
+func ParseValue(s string) (Value, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return IntValue(i), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Value{}, fmt.Errorf("invalid number %q", s)
+	}
+	return FloatValue(f), nil
+}
+
+// Float returns the value as a float64, rounded for large integers.
+func (v Value) Float() float64 {
+	return v.float
+}
+
+// Int returns the value as an int64 and whether it was an integer within the
+// int64 range to begin with.
+func (v Value) Int() (int64, bool) {
+	return v.int, v.exact
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.exact {
+		return strconv.AppendInt(nil, v.int, 10), nil
+	}
+	return json.Marshal(v.float)
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	parsed, err := ParseValue(string(data))
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: jsonKind(data), Type: reflect.TypeFor[float64]()}
+	}
+
+	*v = parsed
+	return nil
+}
+
+// jsonKind names the kind of a JSON value the way encoding/json reports type
+// mismatches.
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	default:
+		return "number " + string(data)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValueUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json      string
+		wantFloat float64
+		wantInt   int64
+		wantExact bool
+		wantJSON  string
+	}{
+		// float32 would round 2^24+1 to 2^24.
+		{json: "16777217", wantFloat: 16777217, wantInt: 16777217, wantExact: true, wantJSON: "16777217"},
+		{json: "0.1", wantFloat: 0.1, wantJSON: "0.1"},
+		{json: "-2.5", wantFloat: -2.5, wantJSON: "-2.5"},
+		// Beyond 2^53 the float rounds while the integer stays exact.
+		{json: "9007199254740993", wantFloat: 9007199254740992, wantInt: 9007199254740993, wantExact: true, wantJSON: "9007199254740993"},
+		// Past the int64 range only the float is kept.
+		{json: "9223372036854775808", wantFloat: 9223372036854775808, wantJSON: "9223372036854776000"},
+		{json: "1e308", wantFloat: 1e308, wantJSON: "1e+308"},
+		{json: "null", wantJSON: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var value Value
+			if err := json.Unmarshal([]byte(tt.json), &value); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			i, exact := value.Int()
+			if value.Float() != tt.wantFloat || i != tt.wantInt || exact != tt.wantExact {
+				t.Errorf("value = %v, %d, %t; want %v, %d, %t", value.Float(), i, exact, tt.wantFloat, tt.wantInt, tt.wantExact)
+			}
+
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(encoded) != tt.wantJSON {
+				t.Errorf("Marshal = %s, want %s", encoded, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestValueUnmarshalJSONErrors(t *testing.T) {
+	for _, input := range []string{`"12"`, "true", "1e400"} {
+		var value Value
+		var typeErr *json.UnmarshalTypeError
+		if err := value.UnmarshalJSON([]byte(input)); !errors.As(err, &typeErr) {
+			t.Errorf("UnmarshalJSON(%s) error = %v, want a type error", input, err)
+		}
+	}
+}
+
+func TestParseValueNonFinite(t *testing.T) {
+	// CSV values are parsed without the JSON grammar, so validation has to
+	// reject what gets through here.
+	for _, input := range []string{"NaN", "Inf", "-Inf"} {
+		value, err := ParseValue(input)
+		if err != nil {
+			t.Fatalf("ParseValue(%s): %v", input, err)
+		}
+		if f := value.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			t.Errorf("ParseValue(%s) = %v", input, f)
+		}
+	}
+}
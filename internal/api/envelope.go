@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Envelope is the body of every JSON response: Data on success, Error on
+// failure, and Meta for what describes the data rather than being part of
+// it, such as pagination.
+type Envelope struct {
+	Data  any        `json:"data,omitempty"`
+	Error *ErrorBody `json:"error,omitempty"`
+	Meta  gin.H      `json:"meta,omitempty"`
+}
+
+// ErrorBody describes a failed request. Code is stable for clients to branch
+// on, Message is for people and may change.
+//
+// @Schema ErrorEnvelope
+// @Property error {}
+// @Property error.code string(enum=invalid_request,validation_failed,unauthorized,forbidden,not_found,conflict,duplicate_event_ids,payload_too_large,unsupported_media_type,rate_limited,unavailable,circuit_open,timeout,internal_error)
+// @Property error.message string
+// @Property error.details object
+// @Property meta object
+// @Required error error.code error.message
+type ErrorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details any       `json:"details,omitempty"`
+}
+
+// ErrorCode is a machine-readable error kind.
+type ErrorCode string
+
+const (
+	// ErrCodeInvalidRequest is a malformed body, parameter or header.
+	ErrCodeInvalidRequest ErrorCode = "invalid_request"
+	// ErrCodeValidationFailed is a well-formed event the pipeline rejects.
+	ErrCodeValidationFailed     ErrorCode = "validation_failed"
+	ErrCodeUnauthorized         ErrorCode = "unauthorized"
+	ErrCodeForbidden            ErrorCode = "forbidden"
+	ErrCodeNotFound             ErrorCode = "not_found"
+	ErrCodeConflict             ErrorCode = "conflict"
+	ErrCodeDuplicateEventIDs    ErrorCode = "duplicate_event_ids"
+	ErrCodePayloadTooLarge      ErrorCode = "payload_too_large"
+	ErrCodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	ErrCodeRateLimited          ErrorCode = "rate_limited"
+	// ErrCodeUnavailable is a pipeline without room for more events, worth
+	// retrying after the Retry-After delay.
+	ErrCodeUnavailable ErrorCode = "unavailable"
+	// ErrCodeCircuitOpen is storage failing fast after repeated errors, worth
+	// retrying after the Retry-After delay.
+	ErrCodeCircuitOpen ErrorCode = "circuit_open"
+	ErrCodeTimeout     ErrorCode = "timeout"
+	ErrCodeInternal    ErrorCode = "internal_error"
+)
+
+// respondOK writes data with status.
+func respondOK(ctx *gin.Context, status int, data any) {
+	ctx.JSON(status, Envelope{Data: data})
+}
+
+// respondOKMeta writes data and meta with status.
+func respondOKMeta(ctx *gin.Context, status int, data any, meta gin.H) {
+	ctx.JSON(status, Envelope{Data: data, Meta: meta})
+}
+
+// respondErr writes an error with status.
+//
+// @Response BadRequest 400 ErrorEnvelope Invalid request
+// @Response Unauthorized 401 ErrorEnvelope Missing API key
+// @Response Forbidden 403 ErrorEnvelope Unknown API key
+// @Response NotFound 404 ErrorEnvelope Not found
+// @Response Conflict 409 ErrorEnvelope Conflicting state
+// @Response PayloadTooLarge 413 ErrorEnvelope Body too large
+// @Response UnsupportedMediaType 415 ErrorEnvelope Unsupported Content-Type or
+// Content-Encoding
+// @Response ValidationFailed 422 ErrorEnvelope Event rejected by validation
+// @Response RateLimited 429 ErrorEnvelope Throttled, retry after Retry-After
+// @Response Unavailable 503 ErrorEnvelope Pipeline full, shutting down or
+// storage circuit open, retry after Retry-After
+// @Response Timeout 504 ErrorEnvelope Processing timed out
+// @Response Internal 500 ErrorEnvelope Internal error
+func respondErr(ctx *gin.Context, status int, code ErrorCode, message string) {
+	ctx.JSON(status, Envelope{Error: &ErrorBody{Code: code, Message: message}})
+}
+
+// respondErrDetails writes an error with details, such as what was done
+// before the request failed.
+func respondErrDetails(ctx *gin.Context, status int, code ErrorCode, message string, details any) {
+	ctx.JSON(status, Envelope{Error: &ErrorBody{Code: code, Message: message, Details: details}})
+}
+
+// abortErr writes an error with status and stops the handler chain, for
+// middleware.
+func abortErr(ctx *gin.Context, status int, code ErrorCode, message string) {
+	ctx.AbortWithStatusJSON(status, Envelope{Error: &ErrorBody{Code: code, Message: message}})
+}
+
+// NoRoute answers requests matching no route with an enveloped 404.
+func NoRoute(ctx *gin.Context) {
+	respondErr(ctx, http.StatusNotFound, ErrCodeNotFound, "no route for "+ctx.Request.Method+" "+ctx.Request.URL.Path)
+}
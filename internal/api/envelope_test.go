@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        []byte
+		contentType string
+		wantStatus  int
+		wantKeys    []string
+		wantCode    ErrorCode
+	}{
+		{name: "created", method: http.MethodPost, target: "/events", body: mustJSON(t, testEventJSON("evt-2", 2)), wantStatus: http.StatusCreated, wantKeys: []string{"data"}},
+		{name: "found", method: http.MethodGet, target: "/events/evt-1", wantStatus: http.StatusOK, wantKeys: []string{"data"}},
+		{name: "list with meta", method: http.MethodGet, target: "/events", wantStatus: http.StatusOK, wantKeys: []string{"data", "meta"}},
+		{name: "metrics", method: http.MethodGet, target: "/metrics", wantStatus: http.StatusOK, wantKeys: []string{"data"}},
+		{name: "event not found", method: http.MethodGet, target: "/events/missing", wantStatus: http.StatusNotFound, wantKeys: []string{"error"}, wantCode: ErrCodeNotFound},
+		{name: "malformed body", method: http.MethodPost, target: "/events", body: []byte("{"), wantStatus: http.StatusBadRequest, wantKeys: []string{"error"}, wantCode: ErrCodeInvalidRequest},
+		{name: "invalid event", method: http.MethodPost, target: "/events", body: []byte(`{"source":"web"}`), wantStatus: http.StatusBadRequest, wantKeys: []string{"error"}, wantCode: ErrCodeValidationFailed},
+		{name: "invalid parameter", method: http.MethodGet, target: "/events?limit=x", wantStatus: http.StatusBadRequest, wantKeys: []string{"error"}, wantCode: ErrCodeInvalidRequest},
+		{name: "unsupported media type", method: http.MethodPost, target: "/events", body: []byte("evt-2"), contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType, wantKeys: []string{"error"}, wantCode: ErrCodeUnsupportedMediaType},
+		{name: "no route", method: http.MethodGet, target: "/nothing", wantStatus: http.StatusNotFound, wantKeys: []string{"error"}, wantCode: ErrCodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+			if recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, testEventJSON("evt-1", 1))); recorder.Code != http.StatusCreated {
+				t.Fatalf("storing evt-1: status %d: %s", recorder.Code, recorder.Body)
+			}
+
+			recorder := s.do(t, tt.method, tt.target, tt.contentType, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, ContentTypeJSON) {
+				t.Errorf("Content-Type = %q, want JSON", got)
+			}
+
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("decode %s: %v", recorder.Body, err)
+			}
+			if keys := slices.Sorted(maps.Keys(envelope)); !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("envelope keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var errBody ErrorBody
+			if err := json.Unmarshal(envelope["error"], &errBody); err != nil {
+				t.Fatalf("decode error %s: %v", envelope["error"], err)
+			}
+			if errBody.Code != tt.wantCode || errBody.Message == "" {
+				t.Errorf("error = %+v, want code %s with a message", errBody, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+)
+
+func TestETag(t *testing.T) {
+	tests := []struct {
+		name string
+		// first is the request whose tag the second sends in If-None-Match.
+		first, second string
+		change        bool
+		gzip          bool
+		wantStatus    int
+	}{
+		{name: "repeated query", first: "/events?type=click", second: "/events?type=click", wantStatus: http.StatusNotModified},
+		{name: "repeated compressed query", first: "/events", second: "/events", gzip: true, wantStatus: http.StatusNotModified},
+		{name: "result changed", first: "/events", second: "/events", change: true, wantStatus: http.StatusOK},
+		{name: "other query", first: "/events?type=click", second: "/events?type=view", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if tt.gzip {
+				router.Use(gzip.Gzip(gzip.DefaultCompression))
+			}
+			body := []string{"evt-1"}
+			router.GET("/events", ETag(), func(ctx *gin.Context) { respondOK(ctx, http.StatusOK, body) })
+
+			get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				if ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				if tt.gzip {
+					req.Header.Set("Accept-Encoding", "gzip")
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			first := get(tt.first, "")
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" {
+				t.Fatalf("first status %d, ETag %q; want 200 with a tag", first.Code, etag)
+			}
+			if tt.gzip && first.Header().Get("Content-Encoding") != "gzip" {
+				t.Errorf("first response not compressed")
+			}
+
+			if tt.change {
+				body = append(body, "evt-2")
+			}
+			second := get(tt.second, etag)
+			if second.Code != tt.wantStatus {
+				t.Fatalf("second status = %d, want %d", second.Code, tt.wantStatus)
+			}
+			switch tt.wantStatus {
+			case http.StatusNotModified:
+				if second.Body.Len() != 0 || second.Header().Get("ETag") != etag {
+					t.Errorf("304 with %d body bytes and ETag %q, want no body and %q", second.Body.Len(), second.Header().Get("ETag"), etag)
+				}
+			case http.StatusOK:
+				if second.Header().Get("ETag") == etag {
+					t.Errorf("different response kept the ETag %s", etag)
+				}
+			}
+		})
+	}
+}
+
+func TestETagSkipsFailuresAndWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ETag())
+	router.GET("/missing", func(ctx *gin.Context) { respondErr(ctx, http.StatusNotFound, ErrCodeNotFound, "not found") })
+	router.POST("/events", func(ctx *gin.Context) { respondOK(ctx, http.StatusOK, "stored") })
+
+	for _, req := range []*http.Request{httptest.NewRequest(http.MethodGet, "/missing", nil), httptest.NewRequest(http.MethodPost, "/events", nil)} {
+		req.Header.Set("If-None-Match", "*")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Header().Get("ETag") != "" || recorder.Code == http.StatusNotModified || recorder.Body.Len() == 0 {
+			t.Errorf("%s %s: status %d, ETag %q, %d body bytes; want the response untagged", req.Method, req.URL, recorder.Code, recorder.Header().Get("ETag"), recorder.Body.Len())
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: `W/"abc"`, want: true},
+		{header: `"abc"`, want: true},
+		{header: `"xyz", W/"abc"`, want: true},
+		{header: "*", want: true},
+		{header: `"xyz"`, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
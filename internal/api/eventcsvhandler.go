@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csvRequiredColumns must appear in the header row. Other columns besides the
+// known event fields become metadata keys.
+var csvRequiredColumns = []string{"type", "source", "timestamp"}
+
+type rowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// HandleEventsCSV ingests a CSV file whose header row names the event field
+// of each column. Rows are validated and enqueued as they are read; rows that
+// fail to parse or validate are reported back by row number, counting data
+// rows from 1.
+//
+// @Router POST /events/csv ingestCSV
+// @Summary Ingest events from CSV
+// @Accept text/csv string
+// @Success 202 IngestReport Queued
+// @Failure 400 415 503
+func (c *eventController) HandleEventsCSV(ctx *gin.Context) {
+	reader := csv.NewReader(ctx.Request.Body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("read header: %v", err))
+		return
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	for _, required := range csvRequiredColumns {
+		if !slices.Contains(columns, required) {
+			respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("header is missing the %q column", required))
+			return
+		}
+	}
+
+	// Events outlive the request, so keep its values but not its cancellation.
+	jobCtx := context.WithoutCancel(ctx.Request.Context())
+
+	accepted, rejected := 0, 0
+	rowErrors := []rowError{}
+	reject := func(row int, err error) {
+		rejected++
+		if len(rowErrors) < maxStreamLineErrors {
+			rowErrors = append(rowErrors, rowError{Row: row, Error: err.Error()})
+		}
+	}
+
+	row := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		row++
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			reject(row, err)
+			continue
+		}
+		if err != nil {
+			respondErrDetails(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), gin.H{"row": row, "accepted": accepted, "rejected": rejected, "errors": rowErrors})
+			return
+		}
+
+		event, err := c.csvEvent(columns, record)
+		if err != nil {
+			reject(row, err)
+			continue
+		}
+
+		c.assignID(&event)
+		if err := c.eventService.Validate(ctx.Request.Context(), event); err != nil {
+			reject(row, err)
+			continue
+		}
+
+		if err := c.eventPipeline.Enqueue(pipeline.Job{Ctx: jobCtx, Event: event}); err != nil {
+			if errors.Is(err, pipeline.ErrPipelineClosed) {
+				logging.FromContext(ctx.Request.Context()).Warn("CSV ingestion stopped", "row", row, "error", err)
+				ctx.Header("Retry-After", retryAfterSeconds)
+				respondErrDetails(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error(), gin.H{"accepted": accepted, "rejected": rejected, "errors": rowErrors})
+				return
+			}
+
+			reject(row, err)
+			continue
+		}
+		accepted++
+	}
+
+	respondOK(ctx, http.StatusAccepted, gin.H{
+		"accepted":         accepted,
+		"rejected":         rejected,
+		"errors":           rowErrors,
+		"errors_truncated": rejected > len(rowErrors),
+	})
+}
+
+// csvEvent maps a record onto an event by column name. Empty optional cells
+// are treated as absent and unknown columns are collected into metadata.
+func (c *eventController) csvEvent(columns, record []string) (api.EventDTO, error) {
+	var event api.EventDTO
+	for i, column := range columns {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		switch column {
+		case "id":
+			event.ID = &value
+		case "type":
+			event.Type = api.EventType(value)
+		case "source":
+			event.Source = api.Source(value)
+		case "timestamp":
+			timestamp, err := time.Parse(c.csvTimestampLayout, value)
+			if err != nil {
+				return api.EventDTO{}, fmt.Errorf("invalid timestamp %q: expected layout %q", value, c.csvTimestampLayout)
+			}
+			event.Timestamp = api.Timestamp{Time: timestamp}
+		case "user_id":
+			event.UserID = &value
+		case "action":
+			event.Data.Action = value
+		case "value":
+			parsed, err := api.ParseValue(value)
+			if err != nil {
+				return api.EventDTO{}, fmt.Errorf("invalid value %q", value)
+			}
+			event.Data.Value = parsed
+		case "value_type":
+			event.Data.ValueType = api.ValueType(value)
+		default:
+			if event.Data.Metadata == nil {
+				event.Data.Metadata = make(map[string]interface{})
+			}
+			event.Data.Metadata[column] = value
+		}
+	}
+
+	return event, nil
+}
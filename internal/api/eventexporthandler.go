@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportFormatNDJSON = "ndjson"
+	exportFormatCSV    = "csv"
+	// exportFlushEvery is how many events are written between flushes, so the
+	// client receives data steadily without a flush per row.
+	exportFlushEvery = 500
+)
+
+// exportCSVColumns are the columns of a CSV export. metadata holds the JSON
+// encoded object.
+var exportCSVColumns = []string{"id", "type", "source", "timestamp", "user_id", "action", "value", "metadata", "value_type"}
+
+// ExportEvents streams every event matching the /events filters as NDJSON or
+// CSV, oldest first. limit and offset are ignored. Once the first event is
+// written the status can no longer change, so later failures end the
+// response early and are only logged.
+//
+// @Router GET /events/export exportEvents
+// @Summary Export matching events
+// @Param type source user_id metadata from to
+// @Param format query string(enum=ndjson,csv;default=ndjson) Export format
+// @Produce 200 application/x-ndjson string Streamed events, not enveloped
+// @Produce 200 text/csv string
+// @Failure 400 500
+func (c *eventController) ExportEvents(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	filter.Limit, filter.Offset = 0, 0
+
+	format := ctx.DefaultQuery("format", exportFormatNDJSON)
+	var writer exportWriter
+	switch format {
+	case exportFormatNDJSON:
+		writer = &ndjsonExportWriter{encoder: json.NewEncoder(ctx.Writer)}
+	case exportFormatCSV:
+		writer = &csvExportWriter{writer: csv.NewWriter(ctx.Writer)}
+	default:
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "format must be ndjson or csv")
+		return
+	}
+
+	started := false
+	start := func() {
+		started = true
+		contentType := ContentTypeNDJSON
+		if format == exportFormatCSV {
+			contentType = ContentTypeCSV
+		}
+		filename := fmt.Sprintf("events-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+		ctx.Header("Content-Type", contentType)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Status(http.StatusOK)
+		writer.begin()
+	}
+
+	exported := 0
+	err = c.eventService.ExportEvents(ctx.Request.Context(), filter, func(event storage.ProcessedEvent) error {
+		if !started {
+			start()
+		}
+		if err := writer.write(event); err != nil {
+			return err
+		}
+
+		exported++
+		if exported%exportFlushEvery == 0 {
+			return writer.flush(ctx.Writer)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Event export failed", "exported", exported, "error", err)
+		if !started {
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to export events")
+		}
+		return
+	}
+
+	if !started {
+		start()
+	}
+	if err := writer.flush(ctx.Writer); err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Event export failed", "exported", exported, "error", err)
+	}
+}
+
+type exportWriter interface {
+	begin()
+	write(event storage.ProcessedEvent) error
+	flush(w http.Flusher) error
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) begin() {}
+
+func (w *ndjsonExportWriter) write(event storage.ProcessedEvent) error {
+	return w.encoder.Encode(pipeline.ToEventDTO(event))
+}
+
+func (w *ndjsonExportWriter) flush(flusher http.Flusher) error {
+	flusher.Flush()
+	return nil
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	err    error
+}
+
+func (w *csvExportWriter) begin() {
+	w.err = w.writer.Write(exportCSVColumns)
+}
+
+func (w *csvExportWriter) write(event storage.ProcessedEvent) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	userID := ""
+	if event.UserID != nil {
+		userID = *event.UserID
+	}
+
+	value, valueType := strconv.FormatFloat(event.Data.Value, 'g', -1, 64), ""
+	if event.Data.IntValue != nil {
+		value, valueType = strconv.FormatInt(*event.Data.IntValue, 10), string(api.ValueTypeInt)
+	}
+
+	metadata := ""
+	if event.Data.Metadata != nil {
+		encoded, err := json.Marshal(event.Data.Metadata)
+		if err != nil {
+			return fmt.Errorf("encode metadata of %s: %w", event.ID, err)
+		}
+		metadata = string(encoded)
+	}
+
+	return w.writer.Write([]string{
+		event.ID,
+		string(event.Type),
+		string(event.Source),
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		userID,
+		event.Data.Action,
+		value,
+		metadata,
+		valueType,
+	})
+}
+
+func (w *csvExportWriter) flush(flusher http.Flusher) error {
+	w.writer.Flush()
+	flusher.Flush()
+	return w.writer.Error()
+}
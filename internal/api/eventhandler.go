@@ -1,101 +1,731 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/api/eventpb"
+	"event-processing-pipeline/internal/idempotency"
+	"event-processing-pipeline/internal/live"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
 	"event-processing-pipeline/internal/pipeline"
+	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
+	"google.golang.org/protobuf/proto"
 )
 
-type EventPipeline struct {
-	ingestionChan chan api.EventDTO
-	workerPool    []*Worker
-	// storage       Storage
-	// metrics       *Metrics
-	ctx *gin.Context
+type eventController struct {
+	eventService       pipeline.EventService
+	deadLetters        pipeline.DeadLetterService
+	eventPipeline      *pipeline.EventPipeline
+	metricsFormat      string
+	requireEventID     bool
+	maxBodyBytes       int64
+	batchDupes         BatchDuplicatePolicy
+	csvTimestampLayout string
+	strictJSON         bool
+	subscribeHeartbeat time.Duration
+	transforms         Transforms
+	producerHeader     string
+	metadataIndexes    []string
+	hub                *live.Hub
+	replayer           *pipeline.Replayer
+	retention          *pipeline.Retention
+	idempotency        *idempotency.Cache[cachedResponse]
+	batchJobs          *idempotency.Cache[*batchJob]
+	metrics            *metrics.Metrics
 }
 
-type Worker struct {
-	Id       int
-	jobChan  chan api.EventDTO
-	pipeline *EventPipeline
+type ControllerConfig struct {
+	MetricsFormat string
+	// MaxBodyBytes caps the size of single and batch request bodies.
+	MaxBodyBytes int64
+	// RequireEventID disables id generation for events submitted without one.
+	RequireEventID bool
+	// BatchDuplicates decides what happens to a batch repeating an event id.
+	BatchDuplicates BatchDuplicatePolicy
+	// CSVTimestampLayout is the Go time layout of CSV timestamp cells.
+	CSVTimestampLayout string
+	// IdempotencyTTL is how long single event responses are replayed for a
+	// repeated idempotency key, zero disables replaying.
+	IdempotencyTTL time.Duration
+	// IdempotencyCacheSize bounds the number of remembered keys.
+	IdempotencyCacheSize int
+	// StrictJSON rejects JSON events with fields EventDTO does not know.
+	StrictJSON bool
+	// SubscribeHeartbeat is the keep-alive interval of live subscriptions.
+	SubscribeHeartbeat time.Duration
+	// Transforms rewrites JSON events per producer before they are decoded.
+	Transforms Transforms
+	// ProducerHeader names the producer of a request for Transforms.
+	ProducerHeader string
+	// BatchJobTTL is how long the results of an async batch can be fetched
+	// after it completes, zero disables tracking async batches.
+	BatchJobTTL time.Duration
+	// BatchJobCacheSize bounds the number of remembered batch jobs.
+	BatchJobCacheSize int
+	// MetadataIndexes are the metadata keys queries can filter on with
+	// meta.<key> parameters.
+	MetadataIndexes []string
 }
 
-type eventController struct {
-	eventService pipeline.EventService
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// cachedResponse is a single event response kept for idempotent replays.
+type cachedResponse struct {
+	Body gin.H
 }
 
+const MetricsFormatPrometheus = "prometheus"
+
+// ContentTypeProtobuf selects the eventpb encoding for request bodies.
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// BatchDuplicatePolicy controls batches that contain the same event id more
+// than once.
+type BatchDuplicatePolicy string
+
+const (
+	// BatchDuplicatesReject fails the whole batch with 409 Conflict.
+	BatchDuplicatesReject BatchDuplicatePolicy = "reject"
+	// BatchDuplicatesKeepFirst drops all but the first occurrence of an id.
+	BatchDuplicatesKeepFirst BatchDuplicatePolicy = "keep_first"
+	// BatchDuplicatesKeepLast drops all but the last occurrence of an id.
+	BatchDuplicatesKeepLast BatchDuplicatePolicy = "keep_last"
+)
+
+// Batch modes selected with ?mode=. Async is the default.
+const (
+	batchModeSync  = "sync"
+	batchModeAsync = "async"
+)
+
+// Per-event statuses reported by synchronous batches.
+const (
+	batchStatusStored           = "stored"
+	batchStatusDuplicate        = "duplicate"
+	batchStatusSampledOut       = "sampled_out"
+	batchStatusSpooled          = "spooled"
+	batchStatusValidationFailed = "validation_failed"
+	batchStatusProcessFailed    = "process_failed"
+	batchStatusStoreFailed      = "store_failed"
+	batchStatusExpired          = "expired"
+	batchStatusRejected         = "rejected"
+)
+
+// batchEventResult is the outcome of one event of a synchronous batch.
+//
+// @Schema BatchResult
+// @Property id string
+// @Property status string(enum=stored,duplicate,sampled_out,spooled,validation_failed,process_failed,store_failed,expired,rejected)
+// @Property error string
+type batchEventResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// retryAfterSeconds is sent with 503 responses when the pipeline sheds load.
+const retryAfterSeconds = "1"
+
 type EventController interface {
 	HandleSingleEvent(ctx *gin.Context)
 	HandleEventsBatch(ctx *gin.Context)
+	GetBatchJob(ctx *gin.Context)
+	HandleEventsStream(ctx *gin.Context)
+	HandleEventsCSV(ctx *gin.Context)
+	ValidateEvent(ctx *gin.Context)
+	ValidateEventsBatch(ctx *gin.Context)
+	ListEvents(ctx *gin.Context)
+	CountEvents(ctx *gin.Context)
+	EventTimeSeries(ctx *gin.Context)
+	ExportEvents(ctx *gin.Context)
+	SubscribeEvents(ctx *gin.Context)
+	ReplayEvents(ctx *gin.Context)
+	PurgeEvents(ctx *gin.Context)
+	GetEvent(ctx *gin.Context)
+	ListDeadLetters(ctx *gin.Context)
+	RetryDeadLetter(ctx *gin.Context)
+	ListRetries(ctx *gin.Context)
 	GetMetrics(ctx *gin.Context)
+	EventStats(ctx *gin.Context)
+	ResetMetrics(ctx *gin.Context)
 }
 
-func NewEventController(db *sqlx.DB) EventController {
-	eventService := pipeline.NewEventService(db)
-
+func NewEventController(eventService pipeline.EventService, deadLetters pipeline.DeadLetterService, eventPipeline *pipeline.EventPipeline, eventMetrics *metrics.Metrics, hub *live.Hub, replayer *pipeline.Replayer, retention *pipeline.Retention, cfg ControllerConfig) EventController {
 	return &eventController{
-		eventService: eventService,
+		eventService:       eventService,
+		deadLetters:        deadLetters,
+		eventPipeline:      eventPipeline,
+		metricsFormat:      cfg.MetricsFormat,
+		requireEventID:     cfg.RequireEventID,
+		maxBodyBytes:       cfg.MaxBodyBytes,
+		batchDupes:         cfg.BatchDuplicates,
+		csvTimestampLayout: cfg.CSVTimestampLayout,
+		strictJSON:         cfg.StrictJSON,
+		subscribeHeartbeat: cfg.SubscribeHeartbeat,
+		transforms:         cfg.Transforms,
+		producerHeader:     cfg.ProducerHeader,
+		metadataIndexes:    cfg.MetadataIndexes,
+		hub:                hub,
+		replayer:           replayer,
+		retention:          retention,
+		idempotency:        idempotency.NewCache[cachedResponse](cfg.IdempotencyTTL, cfg.IdempotencyCacheSize),
+		batchJobs:          idempotency.NewCache[*batchJob](cfg.BatchJobTTL, cfg.BatchJobCacheSize),
+		metrics:            eventMetrics,
 	}
 }
 
+// HandleSingleEvent ingests one event and waits for the pipeline to store it.
+//
+// @Router POST /events ingestEvent
+// @Summary Ingest a single event
+// @Param idempotencyKey producer requestTimeout
+// @Accept application/json Event
+// @Accept application/x-protobuf binary eventpb.Event
+// @Success 201 {id:string} Stored
+// @Success 200 {id:string,duplicate:boolean,sampled_out:boolean} Already stored,
+// sampled out, or replayed for a repeated Idempotency-Key
+// @Success 202 {id:string,spooled:boolean} Written to the write-ahead log while
+// the database is unreachable, stored by a later replay
+// @Failure 400 413 415 422 429 503 504 500
 func (c *eventController) HandleSingleEvent(ctx *gin.Context) {
-	body, _ := io.ReadAll(ctx.Request.Body)
-	var event api.EventDTO
-	if err := json.Unmarshal(body, &event); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	body, ok := c.readBody(ctx)
+	if !ok {
+		return
+	}
+
+	body = c.transform(ctx, body, false)
+	event, err := c.decodeEvent(ctx, body)
+	if err != nil {
+		c.respondDecodeError(ctx, body, err, false)
+		return
+	}
+
+	key := idempotencyKey(ctx, event)
+	if cached, ok := c.idempotency.Get(key); key != "" && ok {
+		ctx.Header(idempotentReplayedHeader, "true")
+		respondOK(ctx, http.StatusOK, cached.Body)
+		return
+	}
+
+	resultChan := make(chan pipeline.JobResult, 1)
+	if err := c.eventPipeline.Enqueue(pipeline.Job{Ctx: ctx.Request.Context(), Event: event, Result: resultChan}); err != nil {
+		c.respondEnqueueError(ctx, err)
+		return
+	}
+
+	result := <-resultChan
+	if result.Err != nil {
+		if errors.Is(result.Err, pipeline.ErrProcessTimeout) {
+			respondErr(ctx, http.StatusGatewayTimeout, ErrCodeTimeout, pipeline.ErrProcessTimeout.Error())
+			return
+		}
+		if errors.Is(result.Err, pipeline.ErrClientDeadline) {
+			respondErr(ctx, http.StatusGatewayTimeout, ErrCodeTimeout, pipeline.ErrClientDeadline.Error())
+			return
+		}
+		switch result.Stage {
+		case metrics.StageValidate:
+			respondValidationError(ctx, result.Err)
+		case metrics.StageProcess:
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to process event")
+		case metrics.StageQueue:
+			respondErr(ctx, http.StatusGatewayTimeout, ErrCodeTimeout, "event expired in the queue")
+		case metrics.StageStore:
+			if errors.Is(result.Err, pipeline.ErrCircuitOpen) {
+				ctx.Header("Retry-After", retryAfterSeconds)
+				respondErr(ctx, http.StatusServiceUnavailable, ErrCodeCircuitOpen, pipeline.ErrCircuitOpen.Error())
+				return
+			}
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to store event")
+		default:
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to store event")
+		}
 		return
 	}
 
-	c.eventService.Validate(*ctx, event)
+	if result.Duplicate {
+		response := gin.H{"id": result.Event.ID, "duplicate": true}
+		c.rememberResponse(key, response)
+		respondOK(ctx, http.StatusOK, response)
+		return
+	}
+
+	if result.SampledOut {
+		response := gin.H{"id": result.Event.ID, "sampled_out": true}
+		c.rememberResponse(key, response)
+		respondOK(ctx, http.StatusOK, response)
+		return
+	}
+
+	if result.Spooled {
+		response := gin.H{"id": result.Event.ID, "spooled": true}
+		c.rememberResponse(key, response)
+		respondOK(ctx, http.StatusAccepted, response)
+		return
+	}
+
+	response := gin.H{"id": result.Event.ID}
+	c.rememberResponse(key, response)
+	respondOK(ctx, http.StatusCreated, response)
 }
 
+// idempotencyKey returns the Idempotency-Key header, falling back to the
+// client supplied event id, scoped to the API key and tenant so tenants
+// cannot replay each other's responses. It is empty when neither is set.
+//
+// @Parameter idempotencyKey Idempotency-Key header string Replays the first
+// response for a repeated key
+func idempotencyKey(ctx *gin.Context, event api.EventDTO) string {
+	key := ctx.GetHeader(IdempotencyKeyHeader)
+	if key == "" && event.ID != nil && *event.ID != "" {
+		key = "id:" + *event.ID
+	}
+	if key == "" {
+		return ""
+	}
+
+	return logging.APIKey(ctx.Request.Context()) + "\x00" + logging.Tenant(ctx.Request.Context()) + "\x00" + key
+}
+
+// rememberResponse caches a successful response. Failures are not cached so
+// a retry after fixing the cause goes through.
+func (c *eventController) rememberResponse(key string, body gin.H) {
+	if key != "" {
+		c.idempotency.Put(key, cachedResponse{Body: body})
+	}
+}
+
+// HandleEventsBatch ingests a batch of events, asynchronously unless mode=sync
+// or upsert=true asks otherwise.
+//
+// @Router POST /events/batch ingestBatch
+// @Summary Ingest a batch of events
+// @Description Async by default: events are queued and tracked as a job.
+// `mode=sync` waits for every event, `upsert=true` writes the batch in one
+// transaction overwriting stored events.
+// @Param mode query string(enum=async,sync;default=async) Batch mode
+// @Param upsert query boolean Overwrite stored events with the same ids
+// @Param Prefer header string `respond-async` asks for the default async mode
+// @Param producer requestTimeout
+// @Accept application/json []Event
+// @Accept application/x-protobuf binary eventpb.EventBatch
+// @Success 202 {status:string,events:integer,ids:[]string,job_id:string} Queued
+// @Header 202 Location string Batch job status URL
+// @Success 200 BatchResults|{events:integer,inserted:integer,updated:integer,ids:[]string}
+// Sync results, or upsert counts
+// @Failure 400 409 413 415 422 429 503 500
 func (c *eventController) HandleEventsBatch(ctx *gin.Context) {
-	body, _ := io.ReadAll(ctx.Request.Body)
-	var events []api.EventDTO
-	if err := json.Unmarshal(body, &events); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	body, ok := c.readBody(ctx)
+	if !ok {
 		return
 	}
 
-	ctx.JSON(http.StatusAccepted, gin.H{"status": "batch processing started"})
+	body = c.transform(ctx, body, true)
+	events, err := c.decodeEvents(ctx, body)
+	if err != nil {
+		c.respondDecodeError(ctx, body, err, true)
+		return
+	}
 
-	for i, _ := range events {
-		worker := &Worker{
-			Id:      i,
-			jobChan: make(chan api.EventDTO),
-			pipeline: &EventPipeline{
-				ingestionChan: make(chan api.EventDTO),
-				ctx:           ctx,
-			}}
+	for i := range events {
+		c.assignID(&events[i])
+	}
 
-		worker.Start(ctx)
+	events, duplicates := dedupBatch(events, c.batchDupes)
+	if len(duplicates) > 0 {
+		respondErrDetails(ctx, http.StatusConflict, ErrCodeDuplicateEventIDs, "batch contains duplicate event ids", gin.H{"duplicate_ids": duplicates})
+		return
 	}
 
+	upsert := false
+	if value := ctx.Query("upsert"); value != "" {
+		if upsert, err = strconv.ParseBool(value); err != nil {
+			respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "upsert must be a boolean")
+			return
+		}
+	}
+	if upsert {
+		c.upsertBatch(ctx, events)
+		return
+	}
+
+	mode, err := batchMode(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if mode == batchModeSync {
+		c.processBatchSync(ctx, events)
+		return
+	}
+
+	ids := make([]string, len(events))
+	for i, event := range events {
+		if event.ID != nil {
+			ids[i] = *event.ID
+		}
+	}
+
+	job, enqueued, err := c.enqueueBatchJob(ctx.Request.Context(), events)
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Warn("Batch enqueue stopped", "enqueued", enqueued, "events", len(events), "error", err)
+		details := gin.H{"enqueued": enqueued, "ids": ids[:enqueued]}
+		if job != nil && enqueued > 0 {
+			details["job_id"] = job.id
+			ctx.Header("Location", ctx.Request.URL.Path+"/"+job.id)
+		}
+		ctx.Header("Retry-After", retryAfterSeconds)
+		respondErrDetails(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error(), details)
+		return
+	}
+
+	response := gin.H{"status": "batch processing started", "events": len(events), "ids": ids}
+	if job != nil {
+		response["job_id"] = job.id
+		ctx.Header("Location", ctx.Request.URL.Path+"/"+job.id)
+	}
+	respondOK(ctx, http.StatusAccepted, response)
 }
 
-func (w *Worker) Start(ctx *gin.Context) {
-	go func() {
-		for {
-			select {
-			case job := <-w.jobChan:
-				w.processJob(ctx, job)
-			case <-ctx.Done():
-				return
-			}
+// batchMode reads the batch mode from the mode query parameter, falling back
+// to the Prefer header (RFC 7240) and then to async. Preferring respond-async
+// is already the default, so it is only acknowledged.
+func batchMode(ctx *gin.Context) (string, error) {
+	switch mode := ctx.Query("mode"); mode {
+	case batchModeSync, batchModeAsync:
+		return mode, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown batch mode %q, expected %q or %q", mode, batchModeSync, batchModeAsync)
+	}
+
+	for _, preference := range strings.Split(ctx.GetHeader("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+			ctx.Header("Preference-Applied", "respond-async")
+			return batchModeAsync, nil
 		}
-	}()
+	}
+
+	return batchModeAsync, nil
 }
 
+// processBatchSync enqueues every event of a batch and responds once all of
+// them are finished, with the outcome of each.
+//
+// @Schema BatchResults
+// @Property events integer
+// @Property counts map[string]integer
+// @Property results []BatchResult
+func (c *eventController) processBatchSync(ctx *gin.Context, events []api.EventDTO) {
+	resultChans := make([]chan pipeline.JobResult, len(events))
+	results := make([]batchEventResult, len(events))
+
+	for i, event := range events {
+		if event.ID != nil {
+			results[i].ID = *event.ID
+		}
+
+		resultChan := make(chan pipeline.JobResult, 1)
+		if err := c.eventPipeline.Enqueue(pipeline.Job{Ctx: ctx.Request.Context(), Event: event, Result: resultChan}); err != nil {
+			results[i].Status = batchStatusRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		resultChans[i] = resultChan
+	}
+
+	counts := make(map[string]int)
+	for i, resultChan := range resultChans {
+		if resultChan != nil {
+			results[i].Status, results[i].Error = batchStatus(<-resultChan)
+		}
+		counts[results[i].Status]++
+	}
+
+	respondOK(ctx, http.StatusOK, gin.H{"events": len(events), "counts": counts, "results": results})
+}
+
+func batchStatus(result pipeline.JobResult) (string, string) {
+	if result.Err == nil {
+		if result.Duplicate {
+			return batchStatusDuplicate, ""
+		}
+		if result.SampledOut {
+			return batchStatusSampledOut, ""
+		}
+		if result.Spooled {
+			return batchStatusSpooled, ""
+		}
+		return batchStatusStored, ""
+	}
+
+	switch result.Stage {
+	case metrics.StageValidate:
+		return batchStatusValidationFailed, result.Err.Error()
+	case metrics.StageProcess:
+		return batchStatusProcessFailed, result.Err.Error()
+	case metrics.StageQueue:
+		return batchStatusExpired, result.Err.Error()
+	default:
+		return batchStatusStoreFailed, result.Err.Error()
+	}
+}
+
+// GetMetrics reports the pipeline metrics, as JSON or in the Prometheus text
+// format.
+//
+// @Router GET /metrics getMetrics
+// @Summary Get pipeline metrics
+// @Description JSON by default, the Prometheus text format with
+// METRICS_FORMAT=prometheus.
+// @Security none
+// @Success 200 Metrics Metrics
+// @Produce 200 text/plain string
 func (c *eventController) GetMetrics(ctx *gin.Context) {
-	// Assuming metrics are not implemented yet
-	ctx.JSON(http.StatusOK, gin.H{"status": "metrics not implemented"})
+	if c.metricsFormat == MetricsFormatPrometheus {
+		c.metrics.Handler().ServeHTTP(ctx.Writer, ctx.Request)
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, c.metrics.Snapshot())
+}
+
+// ResetMetrics zeroes the JSON metrics.
+//
+// @Router POST /admin/metrics/reset resetMetrics
+// @Summary Reset the JSON metrics
+// @Success 200 Metrics Metrics after the reset
+// @Failure 401 403
+func (c *eventController) ResetMetrics(ctx *gin.Context) {
+	c.metrics.Reset()
+	respondOK(ctx, http.StatusOK, c.metrics.Snapshot())
+}
+
+func respondValidationError(ctx *gin.Context, err error) {
+	status, details := validationErrorDetails(err)
+	if details == nil {
+		respondErr(ctx, status, ErrCodeValidationFailed, err.Error())
+		return
+	}
+	respondErrDetails(ctx, status, ErrCodeValidationFailed, err.Error(), details)
+}
+
+// validationErrorDetails returns the status and, when the error has any, the
+// details reporting a failed validation. Several failures are listed under
+// errors, each with its message and details; the status is 400 when any of
+// them is a malformed event and 422 otherwise.
+func validationErrorDetails(err error) (int, gin.H) {
+	var validationErrs *pipeline.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return validationFailure(err)
+	}
+
+	status := http.StatusUnprocessableEntity
+	failures := make([]gin.H, len(validationErrs.Errors))
+	for i, err := range validationErrs.Errors {
+		failureStatus, details := validationFailure(err)
+		if failureStatus == http.StatusBadRequest {
+			status = http.StatusBadRequest
+		}
+		failures[i] = gin.H{"message": err.Error()}
+		for key, value := range details {
+			failures[i][key] = value
+		}
+	}
+
+	return status, gin.H{"errors": failures}
+}
+
+// validationFailure returns the status and details of a single failed check.
+func validationFailure(err error) (int, gin.H) {
+	var schemaErr *pipeline.SchemaValidationError
+	if errors.As(err, &schemaErr) {
+		return http.StatusUnprocessableEntity, gin.H{"fields": schemaErr.Fields}
+	}
+
+	var limitErr *pipeline.LimitError
+	if errors.As(err, &limitErr) {
+		return http.StatusUnprocessableEntity, gin.H{"constraint": limitErr.Constraint}
+	}
+
+	var requirementErr *pipeline.RequirementError
+	if errors.As(err, &requirementErr) {
+		return http.StatusUnprocessableEntity, gin.H{"field": requirementErr.Field}
+	}
+
+	if errors.Is(err, pipeline.ErrNotAllowed) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	return http.StatusBadRequest, nil
+}
+
+// isProtobuf reports whether the request body is a Protobuf message rather
+// than JSON.
+func isProtobuf(ctx *gin.Context) bool {
+	switch ctx.ContentType() {
+	case ContentTypeProtobuf, "application/protobuf":
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeEvent decodes a JSON event or an eventpb.Event depending on the
+// Content-Type.
+func (c *eventController) decodeEvent(ctx *gin.Context, body []byte) (api.EventDTO, error) {
+	if isProtobuf(ctx) {
+		var event eventpb.Event
+		if err := proto.Unmarshal(body, &event); err != nil {
+			return api.EventDTO{}, err
+		}
+		return eventpb.ToEventDTO(&event), nil
+	}
+
+	var event api.EventDTO
+	err := c.unmarshalJSON(body, &event)
+	return event, err
 }
 
-func (w *Worker) processJob(ctx *gin.Context, job api.EventDTO) {
+// decodeEvents decodes a JSON array of events or an eventpb.EventBatch
+// depending on the Content-Type.
+func (c *eventController) decodeEvents(ctx *gin.Context, body []byte) ([]api.EventDTO, error) {
+	if isProtobuf(ctx) {
+		var batch eventpb.EventBatch
+		if err := proto.Unmarshal(body, &batch); err != nil {
+			return nil, err
+		}
+		return eventpb.ToEventDTOs(&batch), nil
+	}
+
+	var events []api.EventDTO
+	err := c.unmarshalJSON(body, &events)
+	return events, err
+}
+
+// unmarshalJSON is json.Unmarshal, rejecting unknown fields in strict mode.
+func (c *eventController) unmarshalJSON(body []byte, v interface{}) error {
+	if !c.strictJSON {
+		return json.Unmarshal(body, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	// Decode stops after the first value where Unmarshal rejects trailing
+	// data; let Unmarshal report it with its usual error.
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return json.Unmarshal(body, new(json.RawMessage))
+	}
+
+	return nil
+}
+
+// readBody reads the request body up to maxBodyBytes. On failure it writes
+// the error response and returns false.
+func (c *eventController) readBody(ctx *gin.Context) ([]byte, bool) {
+	if c.maxBodyBytes > 0 {
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, c.maxBodyBytes)
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondErr(ctx, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+			return nil, false
+		}
+
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "failed to read request body")
+		return nil, false
+	}
+
+	return body, true
+}
+
+// assignID generates an id for events submitted without one, unless ids are
+// required, and returns the event's id. An empty id counts as missing.
+func (c *eventController) assignID(event *api.EventDTO) string {
+	if event.ID != nil && *event.ID == "" {
+		event.ID = nil
+	}
+	if event.ID == nil && !c.requireEventID {
+		id := pipeline.NewEventID()
+		event.ID = &id
+	}
+
+	if event.ID == nil {
+		return ""
+	}
+
+	return *event.ID
+}
+
+// dedupBatch applies policy to events repeating an id. With
+// BatchDuplicatesReject it returns the repeated ids and leaves events as is,
+// otherwise it returns the events with only one occurrence of each id kept.
+// Events without an id are left for validation to reject.
+func dedupBatch(events []api.EventDTO, policy BatchDuplicatePolicy) ([]api.EventDTO, []string) {
+	last := make(map[string]int, len(events))
+	var duplicates []string
+	for i, event := range events {
+		if event.ID == nil {
+			continue
+		}
+		if _, seen := last[*event.ID]; seen && !slices.Contains(duplicates, *event.ID) {
+			duplicates = append(duplicates, *event.ID)
+		}
+		last[*event.ID] = i
+	}
+
+	if len(duplicates) == 0 {
+		return events, nil
+	}
+	if policy == BatchDuplicatesReject {
+		return events, duplicates
+	}
+
+	kept := make([]api.EventDTO, 0, len(last))
+	seen := make(map[string]bool, len(last))
+	for i, event := range events {
+		if event.ID != nil {
+			if policy == BatchDuplicatesKeepLast && last[*event.ID] != i {
+				continue
+			}
+			if policy == BatchDuplicatesKeepFirst && seen[*event.ID] {
+				continue
+			}
+			seen[*event.ID] = true
+		}
+		kept = append(kept, event)
+	}
+
+	return kept, nil
+}
+
+func (c *eventController) respondEnqueueError(ctx *gin.Context, err error) {
+	if errors.Is(err, pipeline.ErrPipelineClosed) || errors.Is(err, pipeline.ErrPipelineFull) {
+		ctx.Header("Retry-After", retryAfterSeconds)
+		respondErr(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error())
+		return
+	}
 
+	respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to enqueue event")
 }
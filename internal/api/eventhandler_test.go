@@ -0,0 +1,798 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// testServer serves the event routes over an in-memory repository.
+type testServer struct {
+	router   *gin.Engine
+	repo     storage.EventRepository
+	metrics  *metrics.Metrics
+	pipeline *pipeline.EventPipeline
+}
+
+// testConfig adjusts the service, pipeline and controller of a testServer.
+type testConfig struct {
+	service    pipeline.ServiceConfig
+	pipeline   pipeline.PipelineConfig
+	controller ControllerConfig
+	// repo replaces the in-memory repository.
+	repo storage.EventRepository
+	// tenant enables multi-tenancy with tenants from source.
+	tenant TenantSource
+}
+
+// testRequestTimeoutMax clamps the X-Request-Timeout of the test server.
+const testRequestTimeoutMax = 100 * time.Millisecond
+
+// newTestServer registers the /events routes the way config.Routers does.
+// The pipeline runs one worker unless cfg says otherwise and stops when the
+// test ends.
+func newTestServer(t *testing.T, cfg testConfig) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	repo := cfg.repo
+	if repo == nil {
+		repo = storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+	}
+	cfg.pipeline.WorkerCount = max(cfg.pipeline.WorkerCount, 1)
+	cfg.pipeline.BufferSize = max(cfg.pipeline.BufferSize, 16)
+	if cfg.pipeline.ScaleInterval == 0 {
+		cfg.pipeline.ScaleInterval = time.Minute
+	}
+	if cfg.controller.MaxBodyBytes == 0 {
+		cfg.controller.MaxBodyBytes = 1 << 20
+	}
+	if cfg.controller.BatchDuplicates == "" {
+		cfg.controller.BatchDuplicates = BatchDuplicatesReject
+	}
+
+	m := metrics.NewMetrics()
+	service := pipeline.NewEventService(repo, cfg.service)
+	deadLetters := pipeline.NewDeadLetterService(storage.NewMemoryDeadLetterRepository())
+	p := pipeline.NewEventPipeline(service, deadLetters, m, nil, cfg.pipeline)
+	p.Start()
+	t.Cleanup(func() { p.Shutdown(context.Background()) })
+
+	retention := pipeline.NewRetention(service, m, pipeline.RetentionConfig{BatchSize: 2})
+	controller := NewEventController(service, deadLetters, p, m, nil, nil, retention, cfg.controller)
+	router := gin.New()
+	router.Use(RequestID(), DecompressRequest())
+	var eventMiddleware []gin.HandlerFunc
+	if cfg.tenant != "" {
+		eventMiddleware = append(eventMiddleware, Tenant(cfg.tenant))
+	}
+	events := router.Group("/events", eventMiddleware...)
+	deadline := RequestDeadline(testRequestTimeoutMax)
+	events.POST("", deadline, RequireContentType(EventContentTypes...), controller.HandleSingleEvent)
+	events.POST("/batch", deadline, RequireContentType(EventContentTypes...), controller.HandleEventsBatch)
+	events.GET("/batch/:jobID", controller.GetBatchJob)
+	events.POST("/stream", RequireContentType(StreamContentTypes...), controller.HandleEventsStream)
+	events.POST("/csv", RequireContentType(CSVContentTypes...), controller.HandleEventsCSV)
+	events.POST("/validate", RequireContentType(EventContentTypes...), controller.ValidateEvent)
+	events.POST("/validate/batch", RequireContentType(EventContentTypes...), controller.ValidateEventsBatch)
+	events.GET("", controller.ListEvents)
+	events.GET("/count", controller.CountEvents)
+	events.GET("/timeseries", controller.EventTimeSeries)
+	events.GET("/export", controller.ExportEvents)
+	events.GET("/stats", controller.EventStats)
+	events.GET("/:id", controller.GetEvent)
+	events.GET("/dead-letter", controller.ListDeadLetters)
+	events.GET("/retries", controller.ListRetries)
+	events.POST("/dead-letter/:id/retry", controller.RetryDeadLetter)
+	events.DELETE("", controller.PurgeEvents)
+	router.GET("/metrics", controller.GetMetrics)
+	router.NoRoute(NoRoute)
+
+	return &testServer{router: router, repo: repo, metrics: m, pipeline: p}
+}
+
+// do serves a request with body, sent as JSON unless contentType is set.
+func (s *testServer) do(t *testing.T, method, target, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if body != nil {
+		if contentType == "" {
+			contentType = ContentTypeJSON
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// data decodes the data of a success envelope into v.
+func data(t *testing.T, recorder *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body, err)
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		t.Fatalf("decode data %s: %v", envelope.Data, err)
+	}
+}
+
+// errorCode returns the code of an error envelope.
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) ErrorCode {
+	t.Helper()
+
+	var envelope Envelope
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body, err)
+	}
+	return envelope.Error.Code
+}
+
+// testEventJSON returns a valid JSON event with id and value.
+func testEventJSON(id string, value float64) map[string]any {
+	return map[string]any{
+		"id":        id,
+		"type":      "user_action",
+		"source":    "web",
+		"timestamp": time.Now().UTC().Add(-time.Minute).Format(time.RFC3339Nano),
+		"data":      map[string]any{"action": "click", "value": value},
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestUpsertBatchRecordsMetrics(t *testing.T) {
+	tests := []struct {
+		name          string
+		events        []map[string]any
+		wantStatus    int
+		wantValidated int64
+		wantStored    int64
+		wantFailed    int64
+	}{
+		{
+			name:          "all valid",
+			events:        []map[string]any{testEventJSON("evt-1", 1), testEventJSON("evt-2", 2)},
+			wantStatus:    http.StatusOK,
+			wantValidated: 2,
+			wantStored:    2,
+		},
+		{
+			name:          "second invalid",
+			events:        []map[string]any{testEventJSON("evt-1", 1), {"id": "evt-2", "source": "web"}},
+			wantStatus:    http.StatusBadRequest,
+			wantValidated: 1,
+			wantFailed:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			recorder := s.do(t, http.MethodPost, "/events/batch?upsert=true", "", mustJSON(t, tt.events))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			snapshot := s.metrics.Snapshot()
+			if snapshot.Received != int64(len(tt.events)) || snapshot.Validated != tt.wantValidated || snapshot.Stored != tt.wantStored {
+				t.Errorf("metrics received %d, validated %d, stored %d; want %d, %d and %d",
+					snapshot.Received, snapshot.Validated, snapshot.Stored, len(tt.events), tt.wantValidated, tt.wantStored)
+			}
+			if failed := snapshot.Failed[metrics.StageValidate]; failed != tt.wantFailed {
+				t.Errorf("validation failures = %d, want %d", failed, tt.wantFailed)
+			}
+			if s.metrics.Outstanding() != 0 {
+				t.Errorf("%d events still outstanding", s.metrics.Outstanding())
+			}
+		})
+	}
+}
+
+func TestUpsertBatchCounts(t *testing.T) {
+	tests := []struct {
+		name         string
+		stored       []string
+		events       []map[string]any
+		wantInserted int
+		wantUpdated  int
+	}{
+		{name: "all new", events: []map[string]any{testEventJSON("evt-1", 10), testEventJSON("evt-2", 20)}, wantInserted: 2},
+		{name: "new and existing", stored: []string{"evt-1"}, events: []map[string]any{testEventJSON("evt-1", 10), testEventJSON("evt-2", 20)}, wantInserted: 1, wantUpdated: 1},
+		{name: "all existing", stored: []string{"evt-1", "evt-2"}, events: []map[string]any{testEventJSON("evt-1", 10), testEventJSON("evt-2", 20)}, wantUpdated: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+			for _, id := range tt.stored {
+				if recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, testEventJSON(id, 1))); recorder.Code != http.StatusCreated {
+					t.Fatalf("storing %s: status %d: %s", id, recorder.Code, recorder.Body)
+				}
+			}
+
+			recorder := s.do(t, http.MethodPost, "/events/batch?upsert=true", "", mustJSON(t, tt.events))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+			var body struct {
+				Inserted int `json:"inserted"`
+				Updated  int `json:"updated"`
+			}
+			data(t, recorder, &body)
+			if body.Inserted != tt.wantInserted || body.Updated != tt.wantUpdated {
+				t.Errorf("inserted %d, updated %d; want %d and %d", body.Inserted, body.Updated, tt.wantInserted, tt.wantUpdated)
+			}
+
+			// Updates overwrite the stored value.
+			for _, event := range tt.events {
+				id := event["id"].(string)
+				stored, err := s.repo.FindEventByID(context.Background(), id)
+				if err != nil {
+					t.Fatalf("FindEventByID(%s): %v", id, err)
+				}
+				if want := event["data"].(map[string]any)["value"]; stored.Data.Value != want {
+					t.Errorf("%s value = %v, want %v", id, stored.Data.Value, want)
+				}
+			}
+		})
+	}
+}
+
+// failingRepository fails every write transaction with err.
+type failingRepository struct {
+	storage.EventRepository
+	err error
+}
+
+func (r failingRepository) WithTransaction(context.Context, func(tx *sqlx.Tx) error) error {
+	return r.err
+}
+
+// slowRepository holds every write transaction until its context ends.
+type slowRepository struct {
+	storage.EventRepository
+}
+
+func (slowRepository) WithTransaction(ctx context.Context, _ func(tx *sqlx.Tx) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandleSingleEventClientDeadline(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    string
+		slow       bool
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{name: "no header", wantStatus: http.StatusCreated},
+		{name: "within budget", timeout: "5s", wantStatus: http.StatusCreated},
+		{name: "budget exhausted", timeout: "20ms", slow: true, wantStatus: http.StatusGatewayTimeout, wantCode: ErrCodeTimeout},
+		{name: "clamped to the server max", timeout: "1h", slow: true, wantStatus: http.StatusGatewayTimeout, wantCode: ErrCodeTimeout},
+		{name: "not a duration", timeout: "soon", wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidRequest},
+		{name: "not positive", timeout: "-1s", wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repo storage.EventRepository = storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			if tt.slow {
+				repo = slowRepository{EventRepository: repo}
+			}
+			s := newTestServer(t, testConfig{repo: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(mustJSON(t, testEventJSON("evt-1", 1))))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.timeout != "" {
+				req.Header.Set(RequestTimeoutHeader, tt.timeout)
+			}
+			recorder := httptest.NewRecorder()
+			start := time.Now()
+			s.router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, recorder); code != tt.wantCode {
+					t.Errorf("error code = %s, want %s", code, tt.wantCode)
+				}
+			}
+			if elapsed := time.Since(start); tt.slow && elapsed > 10*testRequestTimeoutMax {
+				t.Errorf("request took %s, want it cut short by the client deadline", elapsed)
+			}
+		})
+	}
+}
+
+func TestHandleSingleEvent(t *testing.T) {
+	withoutField := func(field string) map[string]any {
+		event := testEventJSON("evt-1", 1)
+		delete(event, field)
+		return event
+	}
+
+	tests := []struct {
+		name       string
+		event      map[string]any
+		repo       storage.EventRepository
+		wantStatus int
+		wantCode   ErrorCode
+		wantStored bool
+	}{
+		{name: "stored", event: testEventJSON("evt-1", 1), wantStatus: http.StatusCreated, wantStored: true},
+		{name: "missing type", event: withoutField("type"), wantStatus: http.StatusBadRequest, wantCode: ErrCodeValidationFailed},
+		{name: "missing source", event: withoutField("source"), wantStatus: http.StatusBadRequest, wantCode: ErrCodeValidationFailed},
+		{
+			name:       "storage failure",
+			event:      testEventJSON("evt-1", 1),
+			repo:       failingRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), err: errors.New("disk full")},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{repo: tt.repo})
+
+			recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, tt.event))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, recorder); code != tt.wantCode {
+					t.Errorf("error code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+
+			var body struct {
+				ID string `json:"id"`
+			}
+			data(t, recorder, &body)
+			if body.ID != "evt-1" {
+				t.Errorf("id = %q, want evt-1", body.ID)
+			}
+			if _, err := s.repo.FindEventByID(context.Background(), body.ID); (err == nil) != tt.wantStored {
+				t.Errorf("FindEventByID error = %v, want stored %t", err, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestHandleSingleEventReportsEveryFailure(t *testing.T) {
+	s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{
+		AllowedSources: pipeline.NewAllowList([]string{"web"}),
+		Limits:         pipeline.Limits{MaxMetadataKeys: 1},
+	}})
+
+	event := testEventJSON("evt-1", 1)
+	delete(event, "type")
+	event["source"] = "mobile"
+	event["data"] = map[string]any{"action": "click", "value": 1, "metadata": map[string]any{"a": 1, "b": 2}}
+	recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event))
+
+	// A missing field makes the whole request malformed.
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+	}
+	var envelope struct {
+		Error struct {
+			Code    ErrorCode `json:"code"`
+			Details struct {
+				Errors []map[string]any `json:"errors"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body, err)
+	}
+	failures := envelope.Error.Details.Errors
+	if envelope.Error.Code != ErrCodeValidationFailed || len(failures) != 3 {
+		t.Fatalf("error %s with failures %v, want %s with 3", envelope.Error.Code, failures, ErrCodeValidationFailed)
+	}
+	if failures[0]["message"] != "event type is required" || failures[2]["constraint"] != "max_metadata_keys" {
+		t.Errorf("failures = %v, want the type, source and metadata failures in order", failures)
+	}
+}
+
+func TestHandleSingleEventNullIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     any
+		userID any
+		absent []string
+		wantID string
+		// wantUserID is the stored user id, empty for NULL.
+		wantUserID string
+	}{
+		{name: "absent id and user_id", absent: []string{"id", "user_id"}},
+		{name: "null id and user_id", id: nil, userID: nil},
+		{name: "null user_id", id: "evt-1", userID: nil, wantID: "evt-1"},
+		{name: "both set", id: "evt-1", userID: "user-1", wantID: "evt-1", wantUserID: "user-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			event := testEventJSON("", 1)
+			event["id"], event["user_id"] = tt.id, tt.userID
+			for _, field := range tt.absent {
+				delete(event, field)
+			}
+
+			recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event))
+			if recorder.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusCreated, recorder.Body)
+			}
+
+			var body struct {
+				ID string `json:"id"`
+			}
+			data(t, recorder, &body)
+			if body.ID == "" || tt.wantID != "" && body.ID != tt.wantID {
+				t.Errorf("id = %q, want %q or a generated one", body.ID, tt.wantID)
+			}
+
+			stored, err := s.repo.FindEventByID(context.Background(), body.ID)
+			if err != nil {
+				t.Fatalf("FindEventByID(%s): %v", body.ID, err)
+			}
+			switch {
+			case tt.wantUserID == "" && stored.UserID != nil:
+				t.Errorf("stored user_id = %q, want NULL", *stored.UserID)
+			case tt.wantUserID != "" && (stored.UserID == nil || *stored.UserID != tt.wantUserID):
+				t.Errorf("stored user_id = %v, want %q", stored.UserID, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestHandleSingleEventNotAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		sources    []string
+		wantStatus int
+	}{
+		{name: "allowed source", sources: []string{"web"}, wantStatus: http.StatusCreated},
+		{name: "disallowed source", sources: []string{"mobile"}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "open ingestion", sources: []string{"*"}, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{AllowedSources: pipeline.NewAllowList(tt.sources)}})
+
+			recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, testEventJSON("evt-1", 1)))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+// endlessBody is a request body of n spaces that counts the bytes read from
+// it.
+type endlessBody struct {
+	n, read int64
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	if b.read >= b.n {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), b.n-b.read))
+	for i := range n {
+		p[i] = ' '
+	}
+	b.read += int64(n)
+	return n, nil
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	const limit = 1 << 10
+
+	tests := []struct {
+		name       string
+		target     string
+		size       int64
+		wantStatus int
+	}{
+		{name: "single event", target: "/events", size: 1 << 30, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "batch", target: "/events/batch", size: 1 << 30, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "validate", target: "/events/validate", size: 1 << 30, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "at the limit", target: "/events", size: limit, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{MaxBodyBytes: limit}})
+
+			body := &endlessBody{n: tt.size}
+			req := httptest.NewRequest(http.MethodPost, tt.target, body)
+			req.Header.Set("Content-Type", ContentTypeJSON)
+			recorder := httptest.NewRecorder()
+			s.router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus == http.StatusRequestEntityTooLarge {
+				if code := errorCode(t, recorder); code != ErrCodePayloadTooLarge {
+					t.Errorf("error code = %s, want %s", code, ErrCodePayloadTooLarge)
+				}
+			}
+			// The handler stops reading just past the limit instead of
+			// buffering the whole body.
+			if body.read > 2*limit+bytes.MinRead {
+				t.Errorf("read %d bytes of a body limited to %d", body.read, limit)
+			}
+		})
+	}
+}
+
+func TestBatchDuplicateIDs(t *testing.T) {
+	tests := []struct {
+		policy     BatchDuplicatePolicy
+		wantStatus int
+		wantValue  float64
+	}{
+		{policy: BatchDuplicatesReject, wantStatus: http.StatusConflict},
+		{policy: BatchDuplicatesKeepFirst, wantStatus: http.StatusOK, wantValue: 1},
+		{policy: BatchDuplicatesKeepLast, wantStatus: http.StatusOK, wantValue: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{BatchDuplicates: tt.policy}})
+
+			batch := []map[string]any{testEventJSON("evt-1", 1), testEventJSON("evt-2", 2), testEventJSON("evt-1", 3)}
+			recorder := s.do(t, http.MethodPost, "/events/batch?mode=sync", "", mustJSON(t, batch))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			if tt.wantStatus == http.StatusConflict {
+				var envelope struct {
+					Error struct {
+						Code    ErrorCode `json:"code"`
+						Details struct {
+							DuplicateIDs []string `json:"duplicate_ids"`
+						} `json:"details"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+					t.Fatal(err)
+				}
+				if envelope.Error.Code != ErrCodeDuplicateEventIDs || fmt.Sprint(envelope.Error.Details.DuplicateIDs) != "[evt-1]" {
+					t.Errorf("error %s with duplicate ids %v, want %s with [evt-1]", envelope.Error.Code, envelope.Error.Details.DuplicateIDs, ErrCodeDuplicateEventIDs)
+				}
+				if count, _ := s.repo.CountEvents(context.Background(), storage.EventFilter{}); count != 0 {
+					t.Errorf("stored %d events of a rejected batch", count)
+				}
+				return
+			}
+
+			var body struct {
+				Events int `json:"events"`
+			}
+			data(t, recorder, &body)
+			if body.Events != 2 {
+				t.Errorf("processed %d events, want 2", body.Events)
+			}
+			event, err := s.repo.FindEventByID(context.Background(), "evt-1")
+			if err != nil {
+				t.Fatalf("FindEventByID: %v", err)
+			}
+			if event.Data.Value != tt.wantValue {
+				t.Errorf("stored value = %v, want %v", event.Data.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestBatchModes(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		prefer         string
+		wantStatus     int
+		wantPreference string
+	}{
+		{name: "default", wantStatus: http.StatusAccepted},
+		{name: "async", query: "?mode=async", wantStatus: http.StatusAccepted},
+		{name: "prefer respond-async", prefer: "respond-async", wantStatus: http.StatusAccepted, wantPreference: "respond-async"},
+		{name: "sync", query: "?mode=sync", wantStatus: http.StatusOK},
+		{name: "mode wins over prefer", query: "?mode=sync", prefer: "respond-async", wantStatus: http.StatusOK},
+		{name: "unknown mode", query: "?mode=later", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{BatchJobTTL: time.Minute, BatchJobCacheSize: 16}})
+
+			// The second event fails validation.
+			batch := []map[string]any{testEventJSON("evt-1", 1), {"id": "evt-2", "source": "web"}}
+			req := httptest.NewRequest(http.MethodPost, "/events/batch"+tt.query, bytes.NewReader(mustJSON(t, batch)))
+			req.Header.Set("Content-Type", ContentTypeJSON)
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			recorder := httptest.NewRecorder()
+			s.router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("Preference-Applied"); got != tt.wantPreference {
+				t.Errorf("Preference-Applied = %q, want %q", got, tt.wantPreference)
+			}
+
+			var results struct {
+				Status  string             `json:"status"`
+				Counts  map[string]int     `json:"counts"`
+				Results []batchEventResult `json:"results"`
+			}
+			switch tt.wantStatus {
+			case http.StatusOK:
+				data(t, recorder, &results)
+			case http.StatusAccepted:
+				location := recorder.Header().Get("Location")
+				if location == "" {
+					t.Fatal("async batch without a Location")
+				}
+				for deadline := time.Now().Add(time.Second); results.Status != batchJobCompleted; time.Sleep(time.Millisecond) {
+					if time.Now().After(deadline) {
+						t.Fatalf("job still %s", results.Status)
+					}
+					data(t, s.do(t, http.MethodGet, location, "", nil), &results)
+				}
+			default:
+				return
+			}
+
+			if len(results.Results) != 2 || results.Results[1].Error == "" {
+				t.Fatalf("results = %+v, want evt-2 to report its error", results.Results)
+			}
+			results.Results[1].Error = ""
+			want := []batchEventResult{{ID: "evt-1", Status: batchStatusStored}, {ID: "evt-2", Status: batchStatusValidationFailed}}
+			if fmt.Sprint(results.Results) != fmt.Sprint(want) || results.Counts[batchStatusStored] != 1 {
+				t.Errorf("results %v with counts %v, want %v", results.Results, results.Counts, want)
+			}
+			if _, err := s.repo.FindEventByID(context.Background(), "evt-1"); err != nil {
+				t.Errorf("FindEventByID(evt-1): %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleSingleEventOverLimit(t *testing.T) {
+	s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{Limits: pipeline.Limits{MaxActionLength: 5}}})
+
+	event := testEventJSON("evt-1", 1)
+	event["data"] = map[string]any{"action": "double-click", "value": 1}
+	recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusUnprocessableEntity, recorder.Body)
+	}
+
+	var envelope struct {
+		Error struct {
+			Details struct {
+				Constraint string `json:"constraint"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if constraint := envelope.Error.Details.Constraint; constraint != "max_action_length" {
+		t.Errorf("constraint = %q, want max_action_length; body %s", constraint, recorder.Body)
+	}
+}
+
+func TestHandleSingleEventIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		firstKey     string
+		secondKey    string
+		secondID     string
+		wantStatus   int
+		wantReplayed string
+		wantStored   int64
+	}{
+		{name: "same key", firstKey: "k1", secondKey: "k1", secondID: "evt-2", wantStatus: http.StatusOK, wantReplayed: "true", wantStored: 1},
+		{name: "other key", firstKey: "k1", secondKey: "k2", secondID: "evt-2", wantStatus: http.StatusCreated, wantStored: 2},
+		{name: "same event id", secondID: "evt-1", wantStatus: http.StatusOK, wantReplayed: "true", wantStored: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{controller: ControllerConfig{IdempotencyTTL: time.Minute, IdempotencyCacheSize: 16}})
+
+			post := func(key, id string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(mustJSON(t, testEventJSON(id, 1))))
+				req.Header.Set("Content-Type", ContentTypeJSON)
+				if key != "" {
+					req.Header.Set(IdempotencyKeyHeader, key)
+				}
+				recorder := httptest.NewRecorder()
+				s.router.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			if first := post(tt.firstKey, "evt-1"); first.Code != http.StatusCreated {
+				t.Fatalf("first status = %d: %s", first.Code, first.Body)
+			}
+			second := post(tt.secondKey, tt.secondID)
+			if second.Code != tt.wantStatus || second.Header().Get(idempotentReplayedHeader) != tt.wantReplayed {
+				t.Errorf("second status %d, replayed %q; want %d and %q", second.Code, second.Header().Get(idempotentReplayedHeader), tt.wantStatus, tt.wantReplayed)
+			}
+			if tt.wantReplayed != "" {
+				var body struct {
+					ID string `json:"id"`
+				}
+				data(t, second, &body)
+				if body.ID != "evt-1" {
+					t.Errorf("replayed id = %q, want evt-1", body.ID)
+				}
+			}
+			if count, _ := s.repo.CountEvents(context.Background(), storage.EventFilter{}); count != tt.wantStored {
+				t.Errorf("stored %d events, want %d", count, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestHandleSingleEventCircuitOpen(t *testing.T) {
+	s := newTestServer(t, testConfig{
+		service: pipeline.ServiceConfig{Breaker: pipeline.BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}},
+		repo:    failingRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), err: sql.ErrConnDone},
+	})
+
+	for i, want := range []struct {
+		status     int
+		code       ErrorCode
+		retryAfter string
+	}{
+		{status: http.StatusInternalServerError, code: ErrCodeInternal},
+		{status: http.StatusServiceUnavailable, code: ErrCodeCircuitOpen, retryAfter: retryAfterSeconds},
+	} {
+		recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, testEventJSON(fmt.Sprintf("evt-%d", i), 1)))
+		if recorder.Code != want.status || errorCode(t, recorder) != want.code || recorder.Header().Get("Retry-After") != want.retryAfter {
+			t.Errorf("request %d: status %d, Retry-After %q: %s; want %d %s", i, recorder.Code, recorder.Header().Get("Retry-After"), recorder.Body, want.status, want.code)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package eventpb
+
+import (
+	"encoding/json"
+	"time"
+
+	api "event-processing-pipeline/internal/api/dtos"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToEventDTO converts a decoded Protobuf event into the DTO the pipeline
+// works with. A missing timestamp becomes the zero time so validation rejects
+// it like a missing JSON timestamp.
+func ToEventDTO(event *Event) api.EventDTO {
+	var timestamp time.Time
+	if event.GetTimestamp() != nil {
+		timestamp = event.GetTimestamp().AsTime()
+	}
+
+	var metadata map[string]interface{}
+	if event.GetData().GetMetadata() != nil {
+		metadata = event.GetData().GetMetadata().AsMap()
+	}
+
+	return api.EventDTO{
+		ID:        event.Id,
+		Type:      api.EventType(event.GetType()),
+		Source:    api.Source(event.GetSource()),
+		Timestamp: api.Timestamp{Time: timestamp},
+		UserID:    event.UserId,
+		Data: api.Data{
+			Action:   event.GetData().GetAction(),
+			Value:    api.FloatValue(float64(event.GetData().GetValue())),
+			Metadata: metadata,
+		},
+	}
+}
+
+func ToEventDTOs(batch *EventBatch) []api.EventDTO {
+	events := make([]api.EventDTO, len(batch.GetEvents()))
+	for i, event := range batch.GetEvents() {
+		events[i] = ToEventDTO(event)
+	}
+
+	return events
+}
+
+// FromEventDTO converts an event into its Protobuf message. It fails when the
+// metadata holds values a Struct cannot represent. The value is narrowed to
+// the float of the message, and so are metadata numbers since a Struct only
+// holds doubles.
+func FromEventDTO(event api.EventDTO) (*Event, error) {
+	var metadata *structpb.Struct
+	if event.Data.Metadata != nil {
+		fields, _ := withFloatNumbers(map[string]interface{}(event.Data.Metadata)).(map[string]interface{})
+		var err error
+		if metadata, err = structpb.NewStruct(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Event{
+		Id:        event.ID,
+		Type:      string(event.Type),
+		Source:    string(event.Source),
+		Timestamp: timestamppb.New(event.Timestamp.Time),
+		UserId:    event.UserID,
+		Data: &Data{
+			Action:   event.Data.Action,
+			Value:    float32(event.Data.Value.Float()),
+			Metadata: metadata,
+		},
+	}, nil
+}
+
+// withFloatNumbers returns value with every json.Number in it, nested ones
+// included, replaced by its float64, which structpb accepts. Numbers that do
+// not parse are left for structpb to reject.
+func withFloatNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = withFloatNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = withFloatNumbers(item)
+		}
+		return converted
+	}
+
+	return value
+}
@@ -0,0 +1,125 @@
+package eventpb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	api "event-processing-pipeline/internal/api/dtos"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestRoundTrip(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		event api.EventDTO
+	}{
+		{
+			name: "all fields",
+			event: api.EventDTO{
+				ID:        ptr("evt-1"),
+				Type:      "user_action",
+				Source:    "web",
+				Timestamp: api.Timestamp{Time: timestamp},
+				UserID:    ptr("user-1"),
+				Data: api.Data{
+					Action: "click",
+					Value:  api.FloatValue(2.5),
+					Metadata: api.Metadata{
+						"session_id": "abc",
+						"count":      float64(3),
+						"flags":      []interface{}{true, "x"},
+						"nested":     map[string]interface{}{"depth": float64(1)},
+					},
+				},
+			},
+		},
+		{
+			name: "optional fields missing",
+			event: api.EventDTO{
+				Type:      "system_event",
+				Source:    "backend",
+				Timestamp: api.Timestamp{Time: timestamp},
+				Data:      api.Data{Action: "boot", Value: api.FloatValue(0)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/protobuf", func(t *testing.T) {
+			message, err := FromEventDTO(tt.event)
+			if err != nil {
+				t.Fatalf("FromEventDTO: %v", err)
+			}
+			body, err := proto.Marshal(&EventBatch{Events: []*Event{message}})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			var batch EventBatch
+			if err := proto.Unmarshal(body, &batch); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			got := ToEventDTOs(&batch)
+			if len(got) != 1 {
+				t.Fatalf("got %d events, want 1", len(got))
+			}
+			assertEqual(t, got[0], tt.event)
+		})
+
+		t.Run(tt.name+"/json", func(t *testing.T) {
+			body, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			api.SetExactMetadataNumbers(false)
+			defer api.SetExactMetadataNumbers(true)
+			var got api.EventDTO
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("Unmarshal %s: %v", body, err)
+			}
+			assertEqual(t, got, tt.event)
+		})
+	}
+}
+
+func TestToEventDTOMissingTimestamp(t *testing.T) {
+	event := ToEventDTO(&Event{Type: "user_action", Source: "web"})
+	if !event.Timestamp.IsZero() {
+		t.Errorf("timestamp = %v, want the zero time", event.Timestamp)
+	}
+}
+
+func TestFromEventDTONarrowsExactNumbers(t *testing.T) {
+	event := api.EventDTO{Data: api.Data{Metadata: api.Metadata{"n": json.Number("42")}}}
+
+	message, err := FromEventDTO(event)
+	if err != nil {
+		t.Fatalf("FromEventDTO: %v", err)
+	}
+	if got := message.GetData().GetMetadata().AsMap()["n"]; got != float64(42) {
+		t.Errorf("metadata n = %#v, want 42.0", got)
+	}
+}
+
+func assertEqual(t *testing.T, got, want api.EventDTO) {
+	t.Helper()
+	if !got.Timestamp.Equal(want.Timestamp.Time) {
+		t.Errorf("timestamp = %v, want %v", got.Timestamp, want.Timestamp)
+	}
+	if got.Data.Value.Float() != want.Data.Value.Float() {
+		t.Errorf("value = %v, want %v", got.Data.Value.Float(), want.Data.Value.Float())
+	}
+	got.Timestamp, want.Timestamp = api.Timestamp{}, api.Timestamp{}
+	got.Data.Value, want.Data.Value = api.Value{}, api.Value{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("event = %+v, want %+v", got, want)
+	}
+}
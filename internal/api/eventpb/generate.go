@@ -0,0 +1,5 @@
+// Package eventpb holds the Protobuf encoding of events, generated from
+// event.proto.
+package eventpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative event.proto
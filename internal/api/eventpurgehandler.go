@@ -0,0 +1,60 @@
+package api
+
+import (
+	"event-processing-pipeline/internal/logging"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PurgeEvents deletes every event matching the filter parameters, and with a
+// timestamp before the before parameter when given, independently of the
+// retention schedule. It only runs with confirm=true, and an empty filter,
+// which would delete every event, also needs confirm_all=true. Who deleted
+// what is logged before the deletion starts.
+//
+// @Router DELETE /events purgeEvents
+// @Summary Purge the events matching a filter
+// @Description Only registered with AUTH_ENABLED. Deletes in batches of
+// RETENTION_BATCH_SIZE and logs the API key and filter.
+// @Param type source user_id metadata from to
+// @Param before query date-time Purge events with a timestamp before this
+// RFC3339 time
+// @Param confirm query boolean required Must be true
+// @Param confirm_all query boolean Must be true to purge without any filter,
+// deleting every event
+// @Success 200 {purged:integer} Purged
+// @Failure 400 401 403 500
+func (c *eventController) PurgeEvents(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if filter.Before, err = parseTimeParam(ctx, "before"); err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	filter.Limit, filter.Offset = 0, 0
+
+	if ctx.Query("confirm") != "true" {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "confirm=true is required to delete events")
+		return
+	}
+	if filter.IsZero() && ctx.Query("confirm_all") != "true" {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "refusing to delete every event without a filter, add confirm_all=true to do so")
+		return
+	}
+
+	logger := logging.FromContext(ctx.Request.Context())
+	logger.Warn("Deleting events", "filter", filter, "all", filter.IsZero(), "client_ip", ctx.ClientIP())
+
+	purged, err := c.retention.Purge(ctx.Request.Context(), filter)
+	if err != nil {
+		logger.Error("Failed to purge events", "error", err)
+		respondErrDetails(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to purge events", gin.H{"purged": purged})
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, gin.H{"purged": purged})
+}
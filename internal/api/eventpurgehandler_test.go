@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestPurgeEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantPurged int64
+	}{
+		{name: "without confirmation", query: "source=mobile", wantStatus: http.StatusBadRequest},
+		{name: "confirmation not true", query: "source=mobile&confirm=yes", wantStatus: http.StatusBadRequest},
+		{name: "filtered", query: "source=mobile&confirm=true", wantStatus: http.StatusOK, wantPurged: 3},
+		{name: "filter matching nothing", query: "source=iot&confirm=true", wantStatus: http.StatusOK},
+		{name: "empty filter", query: "confirm=true", wantStatus: http.StatusBadRequest},
+		{name: "empty filter confirmed", query: "confirm=true&confirm_all=true", wantStatus: http.StatusOK, wantPurged: 5},
+		{name: "invalid filter", query: "before=yesterday&confirm=true", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+			for i, source := range []string{"web", "mobile", "mobile", "web", "mobile"} {
+				event := testEventJSON(fmt.Sprint("evt-", i), 1)
+				event["source"] = source
+				if recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event)); recorder.Code != http.StatusCreated {
+					t.Fatalf("POST /events status = %d: %s", recorder.Code, recorder.Body)
+				}
+			}
+
+			recorder := s.do(t, http.MethodDelete, "/events?"+tt.query, "", nil)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				var body struct {
+					Purged int64 `json:"purged"`
+				}
+				data(t, recorder, &body)
+				if body.Purged != tt.wantPurged {
+					t.Errorf("purged %d, want %d", body.Purged, tt.wantPurged)
+				}
+			} else if code := errorCode(t, recorder); code != ErrCodeInvalidRequest {
+				t.Errorf("error code = %s, want %s", code, ErrCodeInvalidRequest)
+			}
+
+			if count, _ := s.repo.CountEvents(context.Background(), storage.EventFilter{}); count != 5-tt.wantPurged {
+				t.Errorf("%d events left, want %d", count, 5-tt.wantPurged)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 500
+	// maxTimeSeriesBuckets bounds the from/to range of a time series to a day
+	// of minutes, a couple of months of hours or a few years of days.
+	maxTimeSeriesBuckets = 1440
+)
+
+// timeSeriesIntervals maps the interval query parameter to bucket widths.
+var timeSeriesIntervals = map[string]storage.Interval{
+	"1m": storage.IntervalMinute,
+	"1h": storage.IntervalHour,
+	"1d": storage.IntervalDay,
+}
+
+// ListEvents returns a page of the events matching the filters, newest first.
+//
+// @Router GET /events listEvents
+// @Summary List events
+// @Param type source user_id metadata from to limit offset ifNoneMatch
+// @Success 200 []Event meta={total:integer,limit:integer,offset:integer}
+// Matching events, newest first
+// @Failure 304 400 500
+func (c *eventController) ListEvents(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	events, total, err := c.eventService.FindEvents(ctx.Request.Context(), filter)
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to query events", "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to query events")
+		return
+	}
+
+	dtos := make([]api.EventDTO, len(events))
+	for i, event := range events {
+		dtos[i] = pipeline.ToEventDTO(event)
+	}
+
+	respondOKMeta(ctx, http.StatusOK, dtos, gin.H{
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// CountEvents returns the number of events matching the filters, or the count
+// per type or source with group_by.
+//
+// @Router GET /events/count countEvents
+// @Summary Count events
+// @Param type source user_id metadata from to
+// @Param group_by query string(enum=type,source) Count per type or source
+// @Param ifNoneMatch
+// @Success 200 {count:integer,group_by:string,groups:[]{group:string,count:integer}}
+// Count, per group with group_by
+// @Failure 304 400 500
+func (c *eventController) CountEvents(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	groupBy := storage.GroupBy(ctx.Query("group_by"))
+	switch groupBy {
+	case "":
+		count, err := c.eventService.CountEvents(ctx.Request.Context(), filter)
+		if err != nil {
+			logging.FromContext(ctx.Request.Context()).Error("Failed to count events", "error", err)
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to count events")
+			return
+		}
+
+		respondOK(ctx, http.StatusOK, gin.H{"count": count})
+	case storage.GroupByType, storage.GroupBySource:
+		groups, err := c.eventService.CountEventsByGroup(ctx.Request.Context(), filter, groupBy)
+		if err != nil {
+			logging.FromContext(ctx.Request.Context()).Error("Failed to count events", "group_by", groupBy, "error", err)
+			respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to count events")
+			return
+		}
+
+		var total int64
+		for _, group := range groups {
+			total += group.Count
+		}
+
+		respondOK(ctx, http.StatusOK, gin.H{"count": total, "group_by": groupBy, "groups": groups})
+	default:
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("group_by must be %q or %q", storage.GroupByType, storage.GroupBySource))
+	}
+}
+
+// EventTimeSeries returns event counts per time bucket between from and to,
+// optionally split by type or source.
+//
+// @Router GET /events/timeseries eventTimeSeries
+// @Summary Count events per time bucket
+// @Param type source user_id metadata from to
+// @Param interval query string(enum=1m,1h,1d;default=1m) Bucket width
+// @Param group_by query string(enum=type,source) Count per type or source
+// @Param ifNoneMatch
+// @Success 200 {interval:string,from:date-time,to:date-time,group_by:string,buckets:[]{start:date-time,group:string,count:integer}}
+// Buckets
+// @Failure 304 400 500
+func (c *eventController) EventTimeSeries(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	intervalParam := ctx.DefaultQuery("interval", "1m")
+	interval, ok := timeSeriesIntervals[intervalParam]
+	if !ok {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "interval must be one of 1m, 1h or 1d")
+		return
+	}
+
+	groupBy := storage.GroupBy(ctx.Query("group_by"))
+	if groupBy != "" && groupBy != storage.GroupByType && groupBy != storage.GroupBySource {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("group_by must be %q or %q", storage.GroupByType, storage.GroupBySource))
+		return
+	}
+
+	if filter.From.IsZero() {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "from is required")
+		return
+	}
+	if filter.To.IsZero() {
+		filter.To = time.Now().UTC()
+	}
+	if !filter.To.After(filter.From) {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "to must be after from")
+		return
+	}
+	if buckets := filter.To.Sub(filter.From) / interval.Duration(); buckets > maxTimeSeriesBuckets {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("range spans more than %d buckets, use a larger interval or a shorter range", maxTimeSeriesBuckets))
+		return
+	}
+
+	buckets, err := c.eventService.CountEventsByInterval(ctx.Request.Context(), filter, interval, groupBy)
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to aggregate events", "interval", interval, "group_by", groupBy, "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to aggregate events")
+		return
+	}
+
+	response := gin.H{
+		"interval": intervalParam,
+		"from":     filter.From,
+		"to":       filter.To,
+		"buckets":  buckets,
+	}
+	if groupBy != "" {
+		response["group_by"] = groupBy
+	}
+
+	respondOK(ctx, http.StatusOK, response)
+}
+
+// GetEvent returns the event with the id in the path.
+//
+// @Router GET /events/{id} getEvent
+// @Summary Get an event
+// @Param id path string
+// @Param ifNoneMatch
+// @Success 200 Event The event
+// @Failure 304 404 500
+func (c *eventController) GetEvent(ctx *gin.Context) {
+	event, err := c.eventService.FindEvent(ctx.Request.Context(), ctx.Param("id"))
+	if errors.Is(err, storage.ErrEventNotFound) {
+		respondErr(ctx, http.StatusNotFound, ErrCodeNotFound, "event not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to fetch event", "event_id", ctx.Param("id"), "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to fetch event")
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, pipeline.ToEventDTO(*event))
+}
+
+// metadataParamPrefix marks query parameters filtering on a metadata key.
+const metadataParamPrefix = "meta."
+
+// parseEventFilter reads the filter query parameters shared by the routes
+// reading events.
+//
+// @Parameter type type query string Only events of this type
+// @Parameter source source query string Only events from this source
+// @Parameter user_id user_id query string Only events of this user
+// @Parameter metadata meta.<key> query string Only events whose metadata holds
+// this value under <key>, e.g. meta.customer_id=123. The key must be listed
+// in METADATA_INDEX_KEYS, other keys are rejected.
+// @Parameter from from query date-time Only events at or after this RFC3339
+// time
+// @Parameter to to query date-time Only events before this RFC3339 time
+func (c *eventController) parseEventFilter(ctx *gin.Context) (storage.EventFilter, error) {
+	filter := storage.EventFilter{
+		Type:   storage.EventType(ctx.Query("type")),
+		Source: storage.Source(ctx.Query("source")),
+		UserID: ctx.Query("user_id"),
+	}
+
+	for param, values := range ctx.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, metadataParamPrefix)
+		if !ok {
+			continue
+		}
+		if !slices.Contains(c.metadataIndexes, key) {
+			return filter, fmt.Errorf("metadata key %q is not indexed", key)
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = make(map[string]string)
+		}
+		filter.Metadata[key] = values[0]
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(ctx, "from"); err != nil {
+		return filter, err
+	}
+
+	if filter.To, err = parseTimeParam(ctx, "to"); err != nil {
+		return filter, err
+	}
+
+	filter.Limit, filter.Offset, err = parsePagination(ctx)
+	return filter, err
+}
+
+// parsePagination reads limit and offset, capping limit at maxQueryLimit.
+//
+// @Parameter limit limit query integer(min=1;max=500;default=100) Page size,
+// at most 500
+// @Parameter offset offset query integer(min=0;default=0) Events to skip
+func parsePagination(ctx *gin.Context) (int, int, error) {
+	limit, offset := defaultQueryLimit, 0
+
+	var err error
+	if value := ctx.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(limit, maxQueryLimit)
+	}
+
+	if value := ctx.Query("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+func parseTimeParam(ctx *gin.Context, name string) (time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// findFailingRepository fails every lookup by id.
+type findFailingRepository struct {
+	storage.EventRepository
+}
+
+func (findFailingRepository) FindEventByID(context.Context, string) (*storage.ProcessedEvent, error) {
+	return nil, errors.New("connection lost")
+}
+
+func TestGetEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		repo       storage.EventRepository
+		id         string
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{name: "found", id: "evt-1", wantStatus: http.StatusOK},
+		{name: "not found", id: "evt-2", wantStatus: http.StatusNotFound, wantCode: ErrCodeNotFound},
+		{
+			name:       "database error",
+			repo:       findFailingRepository{storage.NewMemoryEventRepository(storage.RepositoryConfig{})},
+			id:         "evt-1",
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{repo: tt.repo})
+			event := testEventJSON("evt-1", 2.5)
+			event["data"].(map[string]any)["metadata"] = map[string]any{"session": map[string]any{"id": "s-1"}}
+			if recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event)); recorder.Code != http.StatusCreated {
+				t.Fatalf("POST /events status = %d: %s", recorder.Code, recorder.Body)
+			}
+
+			recorder := s.do(t, http.MethodGet, "/events/"+tt.id, "", nil)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, recorder); code != tt.wantCode {
+					t.Errorf("error code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+
+			var got map[string]any
+			data(t, recorder, &got)
+			if got["id"] != "evt-1" || got["type"] != "user_action" {
+				t.Errorf("event = %v", got)
+			}
+			metadata := got["data"].(map[string]any)["metadata"]
+			if session, _ := metadata.(map[string]any)["session"].(map[string]any); session["id"] != "s-1" {
+				t.Errorf("metadata = %v, want the nested session", metadata)
+			}
+		})
+	}
+}
+
+func TestEventTimeSeries(t *testing.T) {
+	base := time.Date(2024, 5, 1, 9, 59, 0, 0, time.UTC)
+	stored := []storage.ProcessedEvent{
+		{ID: "evt-1", Type: "user_action", Source: "web", Timestamp: base.Add(30 * time.Second)},
+		{ID: "evt-2", Type: "user_action", Source: "web", Timestamp: base.Add(59*time.Second + 999*time.Millisecond)},
+		{ID: "evt-3", Type: "system_event", Source: "web", Timestamp: base.Add(time.Minute)},
+		{ID: "evt-4", Type: "user_action", Source: "mobile", Timestamp: base.Add(90 * time.Second)},
+	}
+	from := "&from=2024-05-01T09:00:00Z&to=2024-05-01T11:00:00Z"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       string
+	}{
+		{name: "across a minute boundary", query: "interval=1m" + from, wantStatus: http.StatusOK, want: "[09:59 2, 10:00 2]"},
+		{name: "across an hour boundary", query: "interval=1h" + from, wantStatus: http.StatusOK, want: "[09:00 2, 10:00 2]"},
+		{name: "one day", query: "interval=1d" + from, wantStatus: http.StatusOK, want: "[00:00 4]"},
+		{name: "grouped", query: "interval=1m&group_by=type" + from, wantStatus: http.StatusOK, want: "[09:59 user_action 2, 10:00 system_event 1, 10:00 user_action 1]"},
+		{name: "filtered", query: "interval=1m&source=mobile" + from, wantStatus: http.StatusOK, want: "[10:00 1]"},
+		{name: "from required", query: "interval=1m", wantStatus: http.StatusBadRequest},
+		{name: "unknown interval", query: "interval=1w" + from, wantStatus: http.StatusBadRequest},
+		{name: "too many buckets", query: "interval=1m&from=2024-05-01T00:00:00Z&to=2024-05-03T00:00:00Z", wantStatus: http.StatusBadRequest},
+		{name: "to before from", query: "interval=1m&from=2024-05-01T10:00:00Z&to=2024-05-01T09:00:00Z", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+			if _, err := s.repo.InsertEvents(context.Background(), stored); err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+
+			recorder := s.do(t, http.MethodGet, "/events/timeseries?"+tt.query, "", nil)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Buckets []storage.TimeBucket `json:"buckets"`
+			}
+			data(t, recorder, &body)
+			buckets := make([]string, len(body.Buckets))
+			for i, bucket := range body.Buckets {
+				buckets[i] = strings.Join(strings.Fields(fmt.Sprint(bucket.Start.Format("15:04"), " ", bucket.Group, " ", bucket.Count)), " ")
+			}
+			if got := "[" + strings.Join(buckets, ", ") + "]"; got != tt.want {
+				t.Errorf("buckets = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListEventsByMetadata(t *testing.T) {
+	s := newTestServer(t, testConfig{controller: ControllerConfig{MetadataIndexes: []string{"customer_id"}}})
+	for id, customer := range map[string]any{"evt-1": "123", "evt-2": 123, "evt-3": "456", "evt-4": nil} {
+		event := testEventJSON(id, 1)
+		if customer != nil {
+			event["data"].(map[string]any)["metadata"] = map[string]any{"customer_id": customer}
+		}
+		if recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event)); recorder.Code != http.StatusCreated {
+			t.Fatalf("POST /events status = %d: %s", recorder.Code, recorder.Body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    string
+	}{
+		{name: "string and number match", query: "meta.customer_id=123", wantStatus: http.StatusOK, wantIDs: "[evt-1 evt-2]"},
+		{name: "other value", query: "meta.customer_id=456", wantStatus: http.StatusOK, wantIDs: "[evt-3]"},
+		{name: "no match", query: "meta.customer_id=789", wantStatus: http.StatusOK, wantIDs: "[]"},
+		{name: "key not indexed", query: "meta.plan=pro", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := s.do(t, http.MethodGet, "/events?"+tt.query, "", nil)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if code := errorCode(t, recorder); code != ErrCodeInvalidRequest {
+					t.Errorf("error code = %s, want %s", code, ErrCodeInvalidRequest)
+				}
+				return
+			}
+
+			var events []struct {
+				ID string `json:"id"`
+			}
+			data(t, recorder, &events)
+			ids := make([]string, len(events))
+			for i, event := range events {
+				ids[i] = event.ID
+			}
+			slices.Sort(ids)
+			if got := fmt.Sprint(ids); got != tt.wantIDs {
+				t.Errorf("events %s, want %s", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		valueType     string
+		wantStatus    int
+		wantValue     string
+		wantValueType string
+	}{
+		{name: "large integer", value: "9007199254740993", valueType: "int", wantStatus: http.StatusCreated, wantValue: "9007199254740993", wantValueType: "int"},
+		{name: "largest int64", value: "9223372036854775807", valueType: "int", wantStatus: http.StatusCreated, wantValue: "9223372036854775807", wantValueType: "int"},
+		{name: "negative integer", value: "-42", valueType: "int", wantStatus: http.StatusCreated, wantValue: "-42", wantValueType: "int"},
+		{name: "fraction", value: "0.1", wantStatus: http.StatusCreated, wantValue: "0.1"},
+		{name: "explicit float", value: "12.75", valueType: "float", wantStatus: http.StatusCreated, wantValue: "12.75"},
+		{name: "fraction as int", value: "1.5", valueType: "int", wantStatus: http.StatusBadRequest},
+		{name: "int beyond int64", value: "9223372036854775808", valueType: "int", wantStatus: http.StatusBadRequest},
+		{name: "unknown value type", value: "1", valueType: "decimal", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A nil list would hold every source to non-negative values.
+			s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{NonNegativeSources: pipeline.AllowList{}}})
+
+			event := testEventJSON("evt-1", 0)
+			eventData := map[string]any{"action": "count", "value": json.RawMessage(tt.value)}
+			if tt.valueType != "" {
+				eventData["value_type"] = tt.valueType
+			}
+			event["data"] = eventData
+			recorder := s.do(t, http.MethodPost, "/events", "", mustJSON(t, event))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var got struct {
+				Data struct {
+					Value     json.RawMessage `json:"value"`
+					ValueType string          `json:"value_type"`
+				} `json:"data"`
+			}
+			recorder = s.do(t, http.MethodGet, "/events/evt-1", "", nil)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("GET status = %d: %s", recorder.Code, recorder.Body)
+			}
+			data(t, recorder, &got)
+			if string(got.Data.Value) != tt.wantValue || got.Data.ValueType != tt.wantValueType {
+				t.Errorf("value %s of type %q, want %s of type %q", got.Data.Value, got.Data.ValueType, tt.wantValue, tt.wantValueType)
+			}
+		})
+	}
+}
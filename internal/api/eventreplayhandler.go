@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplayEvents reprocesses the stored events matching the /events filters and
+// responds once the replay is done. limit and offset are ignored. With
+// dry_run=true it only reports how many events would be replayed.
+//
+// @Router POST /events/replay replayEvents
+// @Summary Re-run stored events through the pipeline
+// @Param type source user_id metadata from to
+// @Param dry_run query boolean Only count the matching events
+// @Success 200 ReplayResult Replayed
+// @Failure 400 409 500
+func (c *eventController) ReplayEvents(ctx *gin.Context) {
+	filter, err := c.parseEventFilter(ctx)
+	if err != nil {
+		respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	dryRun := false
+	if value := ctx.Query("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			respondErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "dry_run must be a boolean")
+			return
+		}
+	}
+
+	result, err := c.replayer.Replay(ctx.Request.Context(), filter, dryRun)
+	if errors.Is(err, pipeline.ErrReplayRunning) {
+		respondErr(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Replay failed", "replayed", result.Replayed, "error", err)
+		respondErrDetails(ctx, http.StatusInternalServerError, ErrCodeInternal, "replay failed", result)
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, result)
+}
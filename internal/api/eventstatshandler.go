@@ -0,0 +1,47 @@
+package api
+
+import (
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventStats adds the dead-letter backlog to the pipeline's derived stats.
+//
+// @Schema Stats
+// @Property window string Period covered, shorter than 1m0s right after
+// startup
+// @Property ingestion_rate number Events received per second
+// @Property queue_depth integer
+// @Property outstanding integer
+// @Property avg_latency_ms number Mean time from enqueueing an event until it
+// was stored or failed
+// @Property workers integer
+// @Property worker_utilization number(min=0;max=1) Share of the workers' time
+// spent on jobs
+// @Property dead_letters integer
+type eventStats struct {
+	metrics.Stats
+	DeadLetters int64 `json:"dead_letters"`
+}
+
+// EventStats summarizes whether the pipeline keeps up: throughput, backlog,
+// latency and worker utilization over the last minute.
+//
+// @Router GET /events/stats eventStats
+// @Summary Summarize throughput, backlog and latency over the last minute
+// @Param ifNoneMatch
+// @Success 200 Stats Stats
+// @Failure 304 500
+func (c *eventController) EventStats(ctx *gin.Context) {
+	deadLetters, err := c.deadLetters.Count(ctx.Request.Context())
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Failed to count dead letters", "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to count dead letters")
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, eventStats{Stats: c.metrics.Stats(), DeadLetters: deadLetters})
+}
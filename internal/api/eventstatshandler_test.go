@@ -0,0 +1,60 @@
+package api
+
+import (
+	"event-processing-pipeline/internal/pipeline"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventStats(t *testing.T) {
+	s := newTestServer(t, testConfig{
+		service:  pipeline.ServiceConfig{ProcessDelay: 5 * time.Millisecond},
+		pipeline: pipeline.PipelineConfig{WorkerCount: 2},
+	})
+
+	// Four events are stored and one fails validation.
+	batch := []map[string]any{{"id": "bad", "source": "web"}}
+	for i := range 4 {
+		batch = append(batch, testEventJSON(fmt.Sprint("evt-", i), 1))
+	}
+	if recorder := s.do(t, http.MethodPost, "/events/batch?mode=sync", "", mustJSON(t, batch)); recorder.Code != http.StatusOK {
+		t.Fatalf("batch status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// The dead letter is written after the batch responds.
+	var stats struct {
+		Window            string  `json:"window"`
+		IngestionRate     float64 `json:"ingestion_rate"`
+		QueueDepth        int64   `json:"queue_depth"`
+		Outstanding       int64   `json:"outstanding"`
+		AvgLatencyMs      float64 `json:"avg_latency_ms"`
+		Workers           int64   `json:"workers"`
+		WorkerUtilization float64 `json:"worker_utilization"`
+		DeadLetters       int64   `json:"dead_letters"`
+	}
+	for deadline := time.Now().Add(time.Second); stats.DeadLetters == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		recorder := s.do(t, http.MethodGet, "/events/stats", "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+		}
+		data(t, recorder, &stats)
+	}
+
+	if stats.DeadLetters != 1 {
+		t.Errorf("dead_letters = %d, want 1", stats.DeadLetters)
+	}
+	if stats.IngestionRate <= 0 || stats.Window == "" {
+		t.Errorf("ingestion rate %v over %q, want a positive rate", stats.IngestionRate, stats.Window)
+	}
+	if stats.QueueDepth != 0 || stats.Outstanding != 0 {
+		t.Errorf("queue depth %d, outstanding %d after the batch completed", stats.QueueDepth, stats.Outstanding)
+	}
+	if stats.AvgLatencyMs <= 0 {
+		t.Errorf("avg_latency_ms = %v, want a positive latency", stats.AvgLatencyMs)
+	}
+	if stats.Workers != 2 || stats.WorkerUtilization <= 0 || stats.WorkerUtilization > 1 {
+		t.Errorf("%d workers at utilization %v, want 2 workers between 0 and 1", stats.Workers, stats.WorkerUtilization)
+	}
+}
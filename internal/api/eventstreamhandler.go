@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxStreamLineBytes bounds a single NDJSON line.
+	maxStreamLineBytes = 1 << 20
+	// maxStreamLineErrors bounds the per-line errors echoed back to the client.
+	maxStreamLineErrors = 1000
+)
+
+// lineError reports a line of a stream that failed to decode or validate.
+//
+// @Schema IngestReport
+// @Property accepted integer
+// @Property rejected integer
+// @Property errors []object
+// @Property errors_truncated boolean
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// HandleEventsStream ingests newline-delimited JSON, enqueueing each event as
+// soon as its line is read so memory stays flat regardless of upload size.
+//
+// @Router POST /events/stream ingestStream
+// @Summary Ingest newline-delimited JSON events
+// @Accept application/x-ndjson string
+// @Accept application/jsonl string
+// @Success 202 IngestReport Queued
+// @Failure 400 415 503
+func (c *eventController) HandleEventsStream(ctx *gin.Context) {
+	scanner := bufio.NewScanner(ctx.Request.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+
+	// Events outlive the request, so keep its values but not its cancellation.
+	jobCtx := context.WithoutCancel(ctx.Request.Context())
+
+	accepted, rejected := 0, 0
+	lineErrors := []lineError{}
+	reject := func(line int, err error) {
+		rejected++
+		if len(lineErrors) < maxStreamLineErrors {
+			lineErrors = append(lineErrors, lineError{Line: line, Error: err.Error()})
+		}
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event api.EventDTO
+		if err := c.unmarshalJSON(c.transform(ctx, scanner.Bytes(), false), &event); err != nil {
+			reject(line, err)
+			continue
+		}
+
+		c.assignID(&event)
+		if err := c.eventPipeline.Enqueue(pipeline.Job{Ctx: jobCtx, Event: event}); err != nil {
+			if errors.Is(err, pipeline.ErrPipelineClosed) {
+				logging.FromContext(ctx.Request.Context()).Warn("Stream ingestion stopped", "line", line, "error", err)
+				ctx.Header("Retry-After", retryAfterSeconds)
+				respondErrDetails(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error(), gin.H{"accepted": accepted, "rejected": rejected, "errors": lineErrors})
+				return
+			}
+
+			reject(line, err)
+			continue
+		}
+		accepted++
+	}
+
+	if err := scanner.Err(); err != nil {
+		respondErrDetails(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), gin.H{"line": line + 1, "accepted": accepted, "rejected": rejected, "errors": lineErrors})
+		return
+	}
+
+	respondOK(ctx, http.StatusAccepted, gin.H{
+		"accepted":         accepted,
+		"rejected":         rejected,
+		"errors":           lineErrors,
+		"errors_truncated": rejected > len(lineErrors),
+	})
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"event-processing-pipeline/internal/live"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubscribeEvents streams newly stored events as Server-Sent Events,
+// optionally filtered by type and source. A comment line is sent every
+// heartbeat interval so proxies keep the connection open. When the client
+// falls behind, events are dropped and a "dropped" event reports how many.
+//
+// @Router GET /events/subscribe subscribeEvents
+// @Summary Receive newly stored events as server-sent events
+// @Param type source
+// @Produce 200 text/event-stream string Event stream, not enveloped
+func (c *eventController) SubscribeEvents(ctx *gin.Context) {
+	subscription := c.hub.Subscribe(live.Filter{
+		Type:     storage.EventType(ctx.Query("type")),
+		Source:   storage.Source(ctx.Query("source")),
+		TenantID: logging.Tenant(ctx.Request.Context()),
+	})
+	defer c.hub.Unsubscribe(subscription)
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	logger := logging.FromContext(ctx.Request.Context())
+	logger.Info("Subscriber connected", "type", ctx.Query("type"), "source", ctx.Query("source"))
+	defer logger.Info("Subscriber disconnected")
+
+	heartbeat := time.NewTicker(c.subscribeHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if dropped := subscription.TakeDropped(); dropped > 0 {
+				if err := writeServerSentEvent(ctx, "dropped", "", gin.H{"dropped": dropped}); err != nil {
+					return
+				}
+			}
+			if err := writeServerSentEvent(ctx, "event", event.ID, pipeline.ToEventDTO(event)); err != nil {
+				return
+			}
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func writeServerSentEvent(ctx *gin.Context, name, id string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(ctx.Writer, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(ctx.Writer, "event: %s\ndata: %s\n\n", name, encoded)
+	return err
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upsertBatch validates and processes the events in the request and writes
+// them in one transaction, overwriting stored events with the same ids. It
+// bypasses the pipeline so the whole batch succeeds or fails together: the
+// first invalid event fails the request with its index and nothing is
+// written. Sampling and content dedup do not apply, but the events are
+// counted in the metrics like those going through the pipeline.
+func (c *eventController) upsertBatch(ctx *gin.Context, events []api.EventDTO) {
+	logger := logging.FromContext(ctx.Request.Context())
+
+	for _, event := range events {
+		c.metrics.IncReceived(string(event.Type), string(event.Source))
+	}
+	defer func() {
+		for range events {
+			c.metrics.Done()
+		}
+	}()
+
+	processed := make([]storage.ProcessedEvent, len(events))
+	for i, event := range events {
+		if err := c.eventService.Validate(ctx.Request.Context(), event); err != nil {
+			c.metrics.IncFailed(metrics.StageValidate)
+			status, details := validationErrorDetails(err)
+			if details == nil {
+				details = gin.H{}
+			}
+			details["index"] = i
+			respondErrDetails(ctx, status, ErrCodeValidationFailed, err.Error(), details)
+			return
+		}
+		c.metrics.IncValidated()
+
+		start := time.Now()
+		processedEvent, err := c.eventService.Process(ctx.Request.Context(), event)
+		c.metrics.ObserveProcess(time.Since(start))
+		if err != nil {
+			c.metrics.IncFailed(metrics.StageProcess)
+			logger.Error("Failed to process upserted event", "index", i, "error", err)
+			respondErrDetails(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to process event", gin.H{"index": i})
+			return
+		}
+		c.metrics.IncProcessed()
+		processed[i] = *processedEvent
+	}
+
+	start := time.Now()
+	inserted, updated, err := c.eventService.Upsert(ctx.Request.Context(), processed)
+	c.metrics.ObserveStore(time.Since(start))
+	if err != nil {
+		c.metrics.IncFailed(metrics.StageStore)
+	}
+	if errors.Is(err, pipeline.ErrCircuitOpen) {
+		ctx.Header("Retry-After", retryAfterSeconds)
+		respondErr(ctx, http.StatusServiceUnavailable, ErrCodeCircuitOpen, pipeline.ErrCircuitOpen.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to upsert events", "events", len(processed), "error", err)
+		respondErr(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to store events")
+		return
+	}
+
+	c.metrics.AddStored(inserted + updated)
+
+	// Every event was written, so subscribers see updates as well as inserts.
+	for _, event := range processed {
+		c.eventPipeline.Publish(event)
+	}
+
+	ids := make([]string, len(processed))
+	for i, event := range processed {
+		ids[i] = event.ID
+	}
+
+	respondOK(ctx, http.StatusOK, gin.H{"events": len(processed), "inserted": inserted, "updated": updated, "ids": ids})
+}
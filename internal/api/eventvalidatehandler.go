@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateEvent runs the event in the request through the same validation as
+// ingestion, without processing or storing it, so producers can check their
+// payloads against the live rules. The response is 200 whether or not the
+// event is valid; only a body that cannot be decoded fails the request.
+//
+// @Router POST /events/validate validateEvent
+// @Summary Validate an event without storing it
+// @Description Runs the ingestion validation only. Responds 200 whether or not
+// the event is valid.
+// @Accept application/json Event
+// @Accept application/x-protobuf binary eventpb.Event
+// @Success 200 ValidationResult Validation result
+// @Failure 400 413 415 429
+func (c *eventController) ValidateEvent(ctx *gin.Context) {
+	body, ok := c.readBody(ctx)
+	if !ok {
+		return
+	}
+
+	body = c.transform(ctx, body, false)
+	event, err := c.decodeEvent(ctx, body)
+	if err != nil {
+		c.respondDecodeError(ctx, body, err, false)
+		return
+	}
+
+	respondOK(ctx, http.StatusOK, validationResult(c.eventService.Validate(ctx.Request.Context(), event)))
+}
+
+// ValidateEventsBatch validates every event of a batch like ValidateEvent and
+// responds with one result per event, in request order.
+//
+// @Router POST /events/validate/batch validateBatch
+// @Summary Validate a batch of events without storing them
+// @Description Runs the ingestion validation only, one result per event in
+// request order.
+// @Accept application/json []Event
+// @Accept application/x-protobuf binary eventpb.EventBatch
+// @Success 200 {events:integer,valid:integer,invalid:integer,results:[]ValidationResult&{index:integer,id:string}}
+// Validation results
+// @Failure 400 413 415 429
+func (c *eventController) ValidateEventsBatch(ctx *gin.Context) {
+	body, ok := c.readBody(ctx)
+	if !ok {
+		return
+	}
+
+	body = c.transform(ctx, body, true)
+	events, err := c.decodeEvents(ctx, body)
+	if err != nil {
+		c.respondDecodeError(ctx, body, err, true)
+		return
+	}
+
+	valid := 0
+	results := make([]gin.H, len(events))
+	for i, event := range events {
+		err := c.eventService.Validate(ctx.Request.Context(), event)
+		if err == nil {
+			valid++
+		}
+		results[i] = validationResult(err)
+		results[i]["index"] = i
+		if event.ID != nil {
+			results[i]["id"] = *event.ID
+		}
+	}
+
+	respondOK(ctx, http.StatusOK, gin.H{"events": len(events), "valid": valid, "invalid": len(events) - valid, "results": results})
+}
+
+// validationResult reports the outcome of validating one event, listing every
+// failure with the same details as a rejected ingestion.
+//
+// @Schema ValidationResult
+// @Property valid boolean
+// @Property errors []{message:string}(open) Every failed check, with the
+// details a rejected ingestion reports
+// @Required valid
+func validationResult(err error) gin.H {
+	if err == nil {
+		return gin.H{"valid": true}
+	}
+
+	_, details := validationErrorDetails(err)
+	failures, ok := details["errors"].([]gin.H)
+	if !ok {
+		failure := gin.H{"message": err.Error()}
+		for key, value := range details {
+			failure[key] = value
+		}
+		failures = []gin.H{failure}
+	}
+
+	return gin.H{"valid": false, "errors": failures}
+}
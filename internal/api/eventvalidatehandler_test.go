@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// validationResponse is the result of validating one event.
+type validationResponse struct {
+	Valid  bool             `json:"valid"`
+	Errors []map[string]any `json:"errors"`
+	Index  int              `json:"index"`
+	ID     string           `json:"id"`
+}
+
+func TestValidateEvent(t *testing.T) {
+	withSource := func(source string) map[string]any {
+		event := testEventJSON("evt-1", 1)
+		event["source"] = source
+		return event
+	}
+
+	tests := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+		wantValid  bool
+		wantErrors []string
+	}{
+		{name: "valid", body: mustJSON(t, testEventJSON("evt-1", 1)), wantStatus: http.StatusOK, wantValid: true},
+		{name: "missing source", body: mustJSON(t, withSource("")), wantStatus: http.StatusOK, wantErrors: []string{"event source is required"}},
+		{name: "source not allowed", body: mustJSON(t, withSource("mobile")), wantStatus: http.StatusOK, wantErrors: []string{`event source "mobile" is not allowed`}},
+		{name: "malformed", body: []byte(`{"id":`), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{AllowedSources: pipeline.NewAllowList([]string{"web"})}})
+
+			recorder := s.do(t, http.MethodPost, "/events/validate", "", tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result validationResponse
+			data(t, recorder, &result)
+			var messages []string
+			for _, failure := range result.Errors {
+				messages = append(messages, fmt.Sprint(failure["message"]))
+			}
+			if result.Valid != tt.wantValid || fmt.Sprint(messages) != fmt.Sprint(tt.wantErrors) {
+				t.Errorf("valid %t with errors %v, want %t with %v", result.Valid, messages, tt.wantValid, tt.wantErrors)
+			}
+			if count, _ := s.repo.CountEvents(context.Background(), storage.EventFilter{}); count != 0 {
+				t.Errorf("validation stored %d events", count)
+			}
+		})
+	}
+}
+
+func TestValidateEventsBatch(t *testing.T) {
+	s := newTestServer(t, testConfig{})
+
+	batch := []map[string]any{testEventJSON("evt-1", 1), {"id": "evt-2", "source": "web"}, testEventJSON("evt-3", 3)}
+	recorder := s.do(t, http.MethodPost, "/events/validate/batch", "", mustJSON(t, batch))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	var body struct {
+		Events  int                  `json:"events"`
+		Valid   int                  `json:"valid"`
+		Invalid int                  `json:"invalid"`
+		Results []validationResponse `json:"results"`
+	}
+	data(t, recorder, &body)
+	if body.Events != 3 || body.Valid != 2 || body.Invalid != 1 || len(body.Results) != 3 {
+		t.Fatalf("%d events, %d valid, %d invalid, %d results; want 3, 2, 1 and 3", body.Events, body.Valid, body.Invalid, len(body.Results))
+	}
+	for i, result := range body.Results {
+		wantValid := i != 1
+		if result.Index != i || result.ID != fmt.Sprint("evt-", i+1) || result.Valid != wantValid || (len(result.Errors) == 0) != wantValid {
+			t.Errorf("result %d = %+v, want valid %t", i, result, wantValid)
+		}
+	}
+
+	if count, _ := s.repo.CountEvents(context.Background(), storage.EventFilter{}); count != 0 {
+		t.Errorf("validation stored %d events", count)
+	}
+	if snapshot := s.metrics.Snapshot(); snapshot.Received != 0 || snapshot.Stored != 0 {
+		t.Errorf("validation counted %d events received and %d stored", snapshot.Received, snapshot.Stored)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"event-processing-pipeline/internal/pipeline"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health statuses of the readiness probe and of each component it checks.
+//
+// @Schema Health
+// @Property status string(enum=ok,down)
+// @Property components {database:object,workers:object}
+const (
+	healthStatusOK   = "ok"
+	healthStatusDown = "down"
+)
+
+// Pinger checks that a dependency is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type HealthController interface {
+	// Live reports that the process is up, for liveness probes.
+	Live(ctx *gin.Context)
+	// Ready reports whether the database is reachable and the worker pool is
+	// running, for readiness probes.
+	Ready(ctx *gin.Context)
+}
+
+type healthController struct {
+	db            Pinger
+	eventPipeline *pipeline.EventPipeline
+	timeout       time.Duration
+
+	mu       sync.Mutex
+	lastPing time.Time
+}
+
+func NewHealthController(db Pinger, eventPipeline *pipeline.EventPipeline, timeout time.Duration) HealthController {
+	return &healthController{
+		db:            db,
+		eventPipeline: eventPipeline,
+		timeout:       timeout,
+	}
+}
+
+// Live reports that the process is up, for liveness probes.
+//
+// @Router GET /health/live live
+// @Summary Liveness probe
+// @Security none
+// @Success 200 {status:string} Alive
+func (c *healthController) Live(ctx *gin.Context) {
+	respondOK(ctx, http.StatusOK, gin.H{"status": healthStatusOK})
+}
+
+// Ready reports whether the database is reachable and the worker pool is
+// running, for readiness probes.
+//
+// @Router GET /health/ready ready
+// @Router GET /health health
+// @Summary Readiness probe
+// @Security none
+// @Success 200 Health Ready
+// @Success 503 Health Not ready
+func (c *healthController) Ready(ctx *gin.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx.Request.Context(), c.timeout)
+	defer cancel()
+
+	database := gin.H{"status": healthStatusOK}
+	if err := c.db.Ping(pingCtx); err != nil {
+		database = gin.H{"status": healthStatusDown, "error": err.Error()}
+	} else {
+		c.recordPing(time.Now().UTC())
+	}
+	if lastPing := c.lastSuccessfulPing(); !lastPing.IsZero() {
+		database["last_successful_ping"] = lastPing
+	}
+
+	workers := gin.H{"status": healthStatusOK}
+	if !c.eventPipeline.Running() {
+		workers["status"] = healthStatusDown
+	}
+
+	status, code := healthStatusOK, http.StatusOK
+	if database["status"] != healthStatusOK || workers["status"] != healthStatusOK {
+		status, code = healthStatusDown, http.StatusServiceUnavailable
+	}
+
+	respondOK(ctx, code, gin.H{
+		"status": status,
+		"components": gin.H{
+			"database": database,
+			"workers":  workers,
+		},
+	})
+}
+
+func (c *healthController) recordPing(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastPing = at
+}
+
+func (c *healthController) lastSuccessfulPing() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastPing
+}
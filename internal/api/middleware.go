@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID honors an incoming X-Request-ID header or generates one, echoes
+// it back and stores it on the request context for downstream logging.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+
+		ctx.Header(RequestIDHeader, requestID)
+		ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), requestID))
+		ctx.Next()
+	}
+}
+
+// RequestLogger logs one structured line per request.
+func RequestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		logging.FromContext(ctx.Request.Context()).Info("Request handled",
+			"method", ctx.Request.Method,
+			"path", ctx.FullPath(),
+			"status", ctx.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", ctx.ClientIP(),
+		)
+	}
+}
+
+// Recovery turns a handler panic into a 500 with the usual JSON error body and
+// the request id to quote in bug reports. The panic value and stack are only
+// logged, never sent to the client. Panics caused by the client hanging up
+// are logged without a response, since nothing can be written anymore.
+func Recovery(eventMetrics *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			eventMetrics.IncPanic()
+			logger := logging.FromContext(ctx.Request.Context())
+			if err, ok := recovered.(error); ok && (errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)) {
+				logger.Warn("Client connection lost", "method", ctx.Request.Method, "path", ctx.FullPath(), "error", err)
+				ctx.Abort()
+				return
+			}
+
+			logger.Error("Handler panicked",
+				"method", ctx.Request.Method,
+				"path", ctx.FullPath(),
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+			if ctx.Writer.Written() {
+				ctx.Abort()
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, Envelope{
+				Error: &ErrorBody{Code: ErrCodeInternal, Message: "internal server error"},
+				Meta:  gin.H{"request_id": logging.RequestID(ctx.Request.Context())},
+			})
+		}()
+
+		ctx.Next()
+	}
+}
+
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// RequestDeadline bounds the request context by the duration in an
+// X-Request-Timeout header, clamped to max unless max is zero, so the
+// pipeline stops working on an event once the client has given up on it.
+// Requests without the header keep the deadline they came with.
+//
+// @Parameter requestTimeout X-Request-Timeout header string How long the
+// client waits for the response, as a duration such as 500ms, capped at
+// REQUEST_TIMEOUT_MAX.
+func RequestDeadline(max time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value := ctx.GetHeader(RequestTimeoutHeader)
+		if value == "" {
+			ctx.Next()
+			return
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			abortErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("invalid %s %q, expected a positive duration such as 500ms", RequestTimeoutHeader, value))
+			return
+		}
+		if max > 0 {
+			timeout = min(timeout, max)
+		}
+
+		deadlineCtx, cancel := context.WithTimeoutCause(ctx.Request.Context(), timeout, pipeline.ErrClientDeadline)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(deadlineCtx)
+		ctx.Next()
+	}
+}
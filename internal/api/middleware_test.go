@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"event-processing-pipeline/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicsTotal returns the panics_total line of the Prometheus metrics.
+func panicsTotal(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for line := range strings.Lines(recorder.Body.String()) {
+		if strings.HasPrefix(line, "panics_total ") {
+			return strings.TrimSpace(line)
+		}
+	}
+	t.Fatalf("panics_total missing from %s", recorder.Body)
+	return ""
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		wantStatus int
+		wantError  bool
+	}{
+		{
+			name:       "nil dereference",
+			handler:    func(*gin.Context) { var id *string; _ = *id },
+			wantStatus: http.StatusInternalServerError,
+			wantError:  true,
+		},
+		{
+			name:       "panic with a value",
+			handler:    func(*gin.Context) { panic("secret connection string") },
+			wantStatus: http.StatusInternalServerError,
+			wantError:  true,
+		},
+		{
+			name: "panic after the response started",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusAccepted, "partial")
+				panic("late")
+			},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "client hung up",
+			handler:    func(*gin.Context) { panic(syscall.EPIPE) },
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			m := metrics.NewMetrics()
+			router := gin.New()
+			router.Use(RequestID(), Recovery(m))
+			router.GET("/panic", tt.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if got := panicsTotal(t, m); got != "panics_total 1" {
+				t.Errorf("metric %q, want panics_total 1", got)
+			}
+			if !tt.wantError {
+				return
+			}
+
+			var envelope Envelope
+			if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("decode %s: %v", recorder.Body, err)
+			}
+			if envelope.Error == nil || envelope.Error.Code != ErrCodeInternal || envelope.Error.Message != "internal server error" {
+				t.Errorf("error = %+v, want the generic internal error", envelope.Error)
+			}
+			if envelope.Meta["request_id"] != "req-1" {
+				t.Errorf("meta = %v, want request_id req-1", envelope.Meta)
+			}
+			if body := recorder.Body.String(); strings.Contains(body, "secret") || strings.Contains(body, "nil pointer") {
+				t.Errorf("response leaks the panic: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:generate go run event-processing-pipeline/cmd/openapigen -dir .. -out openapi.json
+
+// openAPISpec documents every route. It is generated by go generate from the
+// annotations in the doc comments of the handlers and the types they send,
+// see package openapi; CheckOpenAPI reports routes it misses.
+//
+// @Title Event processing pipeline
+// @Version 1.0.0
+// @Description Ingests, stores and queries events. Every JSON response is
+// wrapped in an envelope carrying `data` on success and `error` on failure.
+// Authentication applies to /events and /admin routes when API keys are
+// configured. With multi-tenancy (TENANT_SOURCE) every /events request acts
+// for the tenant of its API key or X-Tenant-ID header and only sees that
+// tenant's events; the dead-letter and retry routes are then not served.
+// @Security bearer apiKey
+// @SecurityScheme bearer http bearer
+// @SecurityScheme apiKey apiKey header X-API-Key
+// @SecurityScheme tenant apiKey header X-Tenant-ID Tenant of the request when
+// TENANT_SOURCE=header
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// docsPage renders openAPISpec with Swagger UI from a CDN, so the browser
+// needs to reach it.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Event processing pipeline API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// OpenAPI serves the OpenAPI document, not enveloped.
+//
+// @Router GET /openapi.json openAPI
+// @Summary This document
+// @Security none
+// @Produce 200 application/json object OpenAPI document, not enveloped
+func OpenAPI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// Docs serves Swagger UI for the OpenAPI document.
+//
+// @Router GET /docs docs
+// @Summary Swagger UI for this document
+// @Security none
+// @Produce 200 text/html string HTML page
+func Docs(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
+
+// CheckOpenAPI logs a warning for every registered route the OpenAPI
+// document does not describe, so a route added without documenting it shows
+// up at the first start. The profiling routes are not part of the API and
+// are skipped.
+func CheckOpenAPI(routes gin.RoutesInfo) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		slog.Warn("OpenAPI document is not valid JSON", "error", err)
+		return
+	}
+
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, PprofPrefix) {
+			continue
+		}
+		operations := spec.Paths[openAPIPath(route.Path)]
+		if _, ok := operations[strings.ToLower(route.Method)]; !ok {
+			slog.Warn("Route missing from the OpenAPI document", "method", route.Method, "path", route.Path)
+		}
+	}
+}
+
+// openAPIPath turns gin's :name path parameters into OpenAPI's {name}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
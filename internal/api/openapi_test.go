@@ -0,0 +1,34 @@
+package api
+
+import (
+	"bytes"
+	"event-processing-pipeline/internal/openapi"
+	"testing"
+)
+
+func TestOpenAPIUpToDate(t *testing.T) {
+	spec, err := openapi.Generate("..")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !bytes.Equal(spec, openAPISpec) {
+		t.Fatal("openapi.json differs from the annotations, run go generate ./internal/api")
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/events", want: "/events"},
+		{path: "/events/:id", want: "/events/{id}"},
+		{path: "/events/dead-letter/:id/retry", want: "/events/dead-letter/{id}/retry"},
+	}
+
+	for _, tt := range tests {
+		if got := openAPIPath(tt.path); got != tt.want {
+			t.Errorf("openAPIPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PprofPrefix is where the profiling handlers are mounted, the path the pprof
+// tool expects.
+const PprofPrefix = "/debug/pprof"
+
+// pprofProfiles are the runtime profiles served by name.
+var pprofProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// RegisterPprof mounts the net/http/pprof handlers on routes, which must be
+// rooted at PprofPrefix. Their responses are not enveloped since the pprof
+// tool reads them as is.
+func RegisterPprof(routes gin.IRoutes) {
+	routes.GET("/", gin.WrapF(pprof.Index))
+	routes.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	routes.GET("/profile", gin.WrapF(pprof.Profile))
+	routes.GET("/symbol", gin.WrapF(pprof.Symbol))
+	routes.POST("/symbol", gin.WrapF(pprof.Symbol))
+	routes.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range pprofProfiles {
+		routes.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/api/eventpb"
+	"event-processing-pipeline/internal/storage"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func mustProto(t *testing.T, message proto.Message) []byte {
+	t.Helper()
+
+	body, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestProtobufBodies(t *testing.T) {
+	userID := "user-1"
+	timestamp := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	event := func(id string) api.EventDTO {
+		return api.EventDTO{
+			ID:        &id,
+			Type:      "user_action",
+			Source:    "web",
+			Timestamp: api.Timestamp{Time: timestamp},
+			UserID:    &userID,
+			Data:      api.Data{Action: "click", Value: api.FloatValue(2.5), Metadata: api.Metadata{"page": "home", "tags": []any{"a", "b"}}},
+		}
+	}
+	message := func(t *testing.T, id string) *eventpb.Event {
+		t.Helper()
+		message, err := eventpb.FromEventDTO(event(id))
+		if err != nil {
+			t.Fatalf("FromEventDTO: %v", err)
+		}
+		return message
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        func(t *testing.T) []byte
+		wantStatus  int
+		wantIDs     []string
+	}{
+		{
+			name:        "single protobuf",
+			target:      "/events",
+			contentType: ContentTypeProtobuf,
+			body: func(t *testing.T) []byte {
+				return mustProto(t, message(t, "evt-1"))
+			},
+			wantStatus: http.StatusCreated,
+			wantIDs:    []string{"evt-1"},
+		},
+		{
+			name:        "single json",
+			target:      "/events",
+			contentType: ContentTypeJSON,
+			body:        func(t *testing.T) []byte { return mustJSON(t, event("evt-1")) },
+			wantStatus:  http.StatusCreated,
+			wantIDs:     []string{"evt-1"},
+		},
+		{
+			name:        "batch protobuf",
+			target:      "/events/batch?mode=sync",
+			contentType: "application/protobuf",
+			body: func(t *testing.T) []byte {
+				return mustProto(t, &eventpb.EventBatch{Events: []*eventpb.Event{message(t, "evt-1"), message(t, "evt-2")}})
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"evt-1", "evt-2"},
+		},
+		{
+			name:        "malformed protobuf",
+			target:      "/events",
+			contentType: ContentTypeProtobuf,
+			body:        func(*testing.T) []byte { return []byte{0xff, 0xff, 0xff} },
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig{})
+
+			recorder := s.do(t, http.MethodPost, tt.target, tt.contentType, tt.body(t))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			// Both encodings store the same event.
+			for _, id := range tt.wantIDs {
+				stored, err := s.repo.FindEventByID(context.Background(), id)
+				if err != nil {
+					t.Fatalf("FindEventByID(%s): %v", id, err)
+				}
+				if stored.Timestamp.Equal(timestamp) {
+					// JSON and protobuf decode to different locations.
+					stored.Timestamp = timestamp
+				}
+				want := &storage.ProcessedEvent{
+					ID:            id,
+					Type:          "user_action",
+					Source:        "web",
+					Timestamp:     timestamp,
+					UserID:        &userID,
+					Data:          storage.Data{Action: "click", Value: 2.5, Metadata: storage.Metadata{"page": "home", "tags": []any{"a", "b"}}},
+					SchemaVersion: storage.DefaultSchemaVersion,
+				}
+				if !reflect.DeepEqual(stored, want) {
+					t.Errorf("stored %+v, want %+v", stored, want)
+				}
+			}
+		})
+	}
+}
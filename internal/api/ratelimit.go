@@ -0,0 +1,170 @@
+package api
+
+import (
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// globalRateLimitKey labels requests throttled by the global limit.
+const globalRateLimitKey = "global"
+
+// limiterIdleTimeout is how long an unused per-client bucket is kept. A bucket
+// idle this long has refilled anyway, so dropping it loses nothing.
+const limiterIdleTimeout = 10 * time.Minute
+
+type RateLimitConfig struct {
+	// PerClient is the sustained rate per client, zero disables the limit.
+	PerClient      rate.Limit
+	PerClientBurst int
+	// Global is the sustained rate across all clients, zero disables it.
+	Global      rate.Limit
+	GlobalBurst int
+}
+
+// RateLimiter throttles requests with token buckets, one per client and one
+// shared by all clients. Its limits can be changed while it is in use.
+type RateLimiter struct {
+	metrics *metrics.Metrics
+
+	mu        sync.Mutex
+	cfg       RateLimitConfig
+	global    *rate.Limiter
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewRateLimiter(cfg RateLimitConfig, eventMetrics *metrics.Metrics) *RateLimiter {
+	limiter := &RateLimiter{
+		metrics: eventMetrics,
+		clients: make(map[string]*clientLimiter),
+	}
+	limiter.SetConfig(cfg)
+
+	return limiter
+}
+
+// Config returns the limits in effect.
+func (l *RateLimiter) Config() RateLimitConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.cfg
+}
+
+// SetConfig changes the limits. Existing client buckets keep their tokens
+// and refill at the new rate.
+func (l *RateLimiter) SetConfig(cfg RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+	switch {
+	case cfg.Global <= 0:
+		l.global = nil
+	case l.global == nil:
+		l.global = rate.NewLimiter(cfg.Global, cfg.GlobalBurst)
+	default:
+		l.global.SetLimit(cfg.Global)
+		l.global.SetBurst(cfg.GlobalBurst)
+	}
+
+	for _, client := range l.clients {
+		client.limiter.SetLimit(cfg.PerClient)
+		client.limiter.SetBurst(cfg.PerClientBurst)
+	}
+}
+
+// Middleware responds 429 with Retry-After once a bucket is empty. Clients
+// are identified by API key name when auth is enabled and by IP otherwise.
+// It runs before the handlers so throttled bodies are never read.
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := logging.APIKey(ctx.Request.Context())
+		if key == "" {
+			key = ctx.ClientIP()
+		}
+
+		throttledBy, retryAfter := l.allow(key, time.Now())
+		if throttledBy == "" {
+			ctx.Next()
+			return
+		}
+
+		l.metrics.IncThrottled(throttledBy)
+		logging.FromContext(ctx.Request.Context()).Warn("Request throttled", "limit", throttledBy, "client", key)
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		abortErr(ctx, http.StatusTooManyRequests, ErrCodeRateLimited, "rate limit exceeded")
+	}
+}
+
+// allow takes a token for key and the global bucket. When a bucket is empty
+// it returns what throttled the request ("global" or key) and how long until
+// a token is available. A token taken from one bucket is given back when the
+// other one refuses the request.
+func (l *RateLimiter) allow(key string, now time.Time) (string, time.Duration) {
+	clientLimiter, globalLimiter := l.limiters(key, now)
+
+	var client *rate.Reservation
+	if clientLimiter != nil {
+		client = clientLimiter.ReserveN(now, 1)
+		if delay := client.DelayFrom(now); delay > 0 {
+			client.CancelAt(now)
+			return key, delay
+		}
+	}
+
+	if globalLimiter != nil {
+		global := globalLimiter.ReserveN(now, 1)
+		if delay := global.DelayFrom(now); delay > 0 {
+			global.CancelAt(now)
+			if client != nil {
+				client.CancelAt(now)
+			}
+			return globalRateLimitKey, delay
+		}
+	}
+
+	return "", 0
+}
+
+// limiters returns the bucket of key and the global bucket, nil for the
+// limits that are disabled.
+func (l *RateLimiter) limiters(key string, now time.Time) (*rate.Limiter, *rate.Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.PerClient <= 0 {
+		return nil, l.global
+	}
+
+	if now.Sub(l.lastSweep) > limiterIdleTimeout {
+		for clientKey, client := range l.clients {
+			if now.Sub(client.lastSeen) > limiterIdleTimeout {
+				delete(l.clients, clientKey)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.cfg.PerClient, l.cfg.PerClientBurst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+
+	return client.limiter, l.global
+}
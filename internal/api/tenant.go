@@ -0,0 +1,53 @@
+package api
+
+import (
+	"event-processing-pipeline/internal/logging"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader names the tenant of a request with TenantFromHeader.
+const TenantHeader = "X-Tenant-ID"
+
+// TenantSource decides where the tenant of a request comes from.
+type TenantSource string
+
+const (
+	// TenantFromAPIKey uses the name of the API key, which needs auth.
+	TenantFromAPIKey TenantSource = "api_key"
+	// TenantFromHeader uses the X-Tenant-ID header as sent by the client,
+	// for deployments where a gateway in front sets it.
+	TenantFromHeader TenantSource = "header"
+)
+
+// tenantPattern keeps tenants short enough for the tenant_id column.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Tenant resolves the tenant of each request from source and stores it on the
+// request context, where the pipeline picks it up to stamp stored events and
+// scope every query. Requests without a valid tenant get 400.
+func Tenant(source TenantSource) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var tenant string
+		switch source {
+		case TenantFromAPIKey:
+			tenant = logging.APIKey(ctx.Request.Context())
+		case TenantFromHeader:
+			tenant = ctx.GetHeader(TenantHeader)
+		}
+
+		if tenant == "" && source == TenantFromHeader {
+			abortErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "missing "+TenantHeader+" header")
+			return
+		}
+		if !tenantPattern.MatchString(tenant) {
+			abortErr(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "tenant must be 1 to 64 letters, digits, dots, dashes or underscores")
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(logging.WithTenant(ctx.Request.Context(), tenant))
+		ctx.Next()
+	}
+}
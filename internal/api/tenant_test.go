@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// doAs serves a request with a JSON body on behalf of tenant.
+func (s *testServer) doAs(t *testing.T, tenant, method, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if body != nil {
+		req.Header.Set("Content-Type", ContentTypeJSON)
+	}
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     TenantSource
+		header     string
+		apiKey     string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "header", source: TenantFromHeader, header: "acme", wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "missing header", source: TenantFromHeader, wantStatus: http.StatusBadRequest},
+		{name: "invalid header", source: TenantFromHeader, header: "acme/../globex", wantStatus: http.StatusBadRequest},
+		{name: "api key", source: TenantFromAPIKey, apiKey: "acme", wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "api key ignores the header", source: TenantFromAPIKey, apiKey: "acme", header: "globex", wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "without api key", source: TenantFromAPIKey, header: "globex", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				if tt.apiKey != "" {
+					ctx.Request = ctx.Request.WithContext(logging.WithAPIKey(ctx.Request.Context(), tt.apiKey))
+				}
+			}, Tenant(tt.source))
+			router.GET("/tenant", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, logging.Tenant(ctx.Request.Context()))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/tenant", nil)
+			if tt.header != "" {
+				req.Header.Set(TenantHeader, tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if code := errorCode(t, recorder); code != ErrCodeInvalidRequest {
+					t.Errorf("error code = %s, want %s", code, ErrCodeInvalidRequest)
+				}
+				return
+			}
+			if recorder.Body.String() != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", recorder.Body, tt.wantTenant)
+			}
+		})
+	}
+}
+
+// newTenantServer returns a multi-tenant test server holding two events of
+// acme and one of globex.
+func newTenantServer(t *testing.T) *testServer {
+	t.Helper()
+
+	s := newTestServer(t, testConfig{service: pipeline.ServiceConfig{RequireTenant: true}, tenant: TenantFromHeader})
+	for _, event := range []struct{ tenant, id string }{{"acme", "evt-a1"}, {"acme", "evt-a2"}, {"globex", "evt-g1"}} {
+		if recorder := s.doAs(t, event.tenant, http.MethodPost, "/events", mustJSON(t, testEventJSON(event.id, 1))); recorder.Code != http.StatusCreated {
+			t.Fatalf("POST /events as %s status = %d: %s", event.tenant, recorder.Code, recorder.Body)
+		}
+	}
+	return s
+}
+
+func TestTenantIsolationOnReads(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+		target string
+		// want is what the response data prints as, or the error code.
+		want       string
+		wantStatus int
+	}{
+		{name: "list", tenant: "acme", target: "/events", want: "[evt-a1 evt-a2]", wantStatus: http.StatusOK},
+		{name: "list other tenant", tenant: "globex", target: "/events", want: "[evt-g1]", wantStatus: http.StatusOK},
+		{name: "own event", tenant: "acme", target: "/events/evt-a1", want: "evt-a1", wantStatus: http.StatusOK},
+		{name: "other tenant's event", tenant: "acme", target: "/events/evt-g1", want: string(ErrCodeNotFound), wantStatus: http.StatusNotFound},
+		{name: "count", tenant: "acme", target: "/events/count", want: "2", wantStatus: http.StatusOK},
+		{name: "without tenant", target: "/events", want: string(ErrCodeInvalidRequest), wantStatus: http.StatusBadRequest},
+	}
+
+	s := newTenantServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := s.doAs(t, tt.tenant, http.MethodGet, tt.target, nil)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			var got string
+			switch {
+			case tt.wantStatus != http.StatusOK:
+				got = string(errorCode(t, recorder))
+			case tt.target == "/events":
+				var events []storage.ProcessedEvent
+				data(t, recorder, &events)
+				var ids []string
+				for _, event := range events {
+					ids = append(ids, event.ID)
+				}
+				slices.Sort(ids)
+				got = fmt.Sprint(ids)
+			case tt.target == "/events/count":
+				var body struct {
+					Count int64 `json:"count"`
+				}
+				data(t, recorder, &body)
+				got = fmt.Sprint(body.Count)
+			default:
+				var event storage.ProcessedEvent
+				data(t, recorder, &event)
+				got = event.ID
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantIsolationOnWrites(t *testing.T) {
+	s := newTenantServer(t)
+
+	// Reusing another tenant's id leaves that tenant's event alone.
+	event := testEventJSON("evt-g1", 2)
+	if recorder := s.doAs(t, "acme", http.MethodPost, "/events", mustJSON(t, event)); recorder.Code != http.StatusOK {
+		t.Fatalf("POST /events status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	if stored, err := s.repo.FindEventByID(context.Background(), "evt-g1"); err != nil || stored.TenantID != "globex" {
+		t.Fatalf("evt-g1 = %+v, %v; want globex's event", stored, err)
+	}
+
+	recorder := s.doAs(t, "acme", http.MethodDelete, "/events?confirm=true&confirm_all=true", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("DELETE /events status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var body struct {
+		Purged int64 `json:"purged"`
+	}
+	data(t, recorder, &body)
+	if body.Purged != 2 {
+		t.Errorf("purged %d, want acme's 2 events", body.Purged)
+	}
+
+	var left []string
+	for _, id := range []string{"evt-a1", "evt-a2", "evt-g1"} {
+		if _, err := s.repo.FindEventByID(context.Background(), id); err == nil {
+			left = append(left, id)
+		}
+	}
+	if fmt.Sprint(left) != "[evt-g1]" {
+		t.Errorf("events left %v, want [evt-g1]", left)
+	}
+}
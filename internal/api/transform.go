@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"event-processing-pipeline/internal/logging"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultProducerHeader is the default header naming the producer whose
+// transform rules apply to a request.
+//
+// @Parameter producer X-Producer header string Selects the field mapping
+// rules, TRANSFORM_PRODUCER_HEADER renames it
+const DefaultProducerHeader = "X-Producer"
+
+// TransformOp is what a TransformRule does to an event.
+type TransformOp string
+
+const (
+	// TransformRename moves the value at From to To.
+	TransformRename TransformOp = "rename"
+	// TransformCopy copies the value at From to To.
+	TransformCopy TransformOp = "copy"
+	// TransformDefault sets To to Value when it is missing or null.
+	TransformDefault TransformOp = "default"
+)
+
+// TransformRule rewrites one field of a JSON event. Fields are dotted paths
+// such as "data.action". Rename and copy do nothing when From is missing and
+// overwrite To otherwise.
+type TransformRule struct {
+	Op    TransformOp `json:"op"`
+	From  string      `json:"from,omitempty"`
+	To    string      `json:"to"`
+	Value any         `json:"value,omitempty"`
+}
+
+// Transforms maps producer identifiers to the rules applied, in order, to
+// their JSON events before they are decoded. It lets producers naming fields
+// differently share the ingestion endpoints without changing their payloads.
+type Transforms map[string][]TransformRule
+
+// LoadTransforms reads the rules from a JSON file holding an object of rule
+// arrays keyed by producer.
+func LoadTransforms(path string) (Transforms, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+
+	var transforms Transforms
+	if err := decoder.Decode(&transforms); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	for producer, rules := range transforms {
+		for i, rule := range rules {
+			if err := rule.validate(); err != nil {
+				return nil, fmt.Errorf("%s: rule %d of %q: %w", path, i, producer, err)
+			}
+		}
+	}
+
+	return transforms, nil
+}
+
+func (r TransformRule) validate() error {
+	if !validFieldPath(r.To) {
+		return fmt.Errorf("invalid to %q", r.To)
+	}
+
+	switch r.Op {
+	case TransformRename, TransformCopy:
+		if !validFieldPath(r.From) {
+			return fmt.Errorf("invalid from %q", r.From)
+		}
+	case TransformDefault:
+		if r.Value == nil {
+			return fmt.Errorf("%s needs a value", r.Op)
+		}
+	default:
+		return fmt.Errorf("op must be %q, %q or %q", TransformRename, TransformCopy, TransformDefault)
+	}
+
+	return nil
+}
+
+func validFieldPath(path string) bool {
+	return path != "" && !strings.HasPrefix(path, ".") && !strings.HasSuffix(path, ".") && !strings.Contains(path, "..")
+}
+
+// transform applies the rules of the request's producer to a JSON body, an
+// event or an array of events when batch is set. The producer is named by
+// the producer header, falling back to the API key name. Bodies that are
+// not JSON objects are returned as they are for decoding to reject.
+func (c *eventController) transform(ctx *gin.Context, body []byte, batch bool) []byte {
+	if len(c.transforms) == 0 || isProtobuf(ctx) {
+		return body
+	}
+
+	producer := ctx.GetHeader(c.producerHeader)
+	if producer == "" {
+		producer = logging.APIKey(ctx.Request.Context())
+	}
+	rules := c.transforms[producer]
+	if len(rules) == 0 {
+		return body
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return body
+	}
+
+	events := []any{value}
+	if batch {
+		if events, _ = value.([]any); events == nil {
+			return body
+		}
+	}
+	for _, event := range events {
+		if object, ok := event.(map[string]any); ok {
+			applyTransforms(object, rules)
+		}
+	}
+
+	transformed, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+
+	return transformed
+}
+
+func applyTransforms(event map[string]any, rules []TransformRule) {
+	for _, rule := range rules {
+		switch rule.Op {
+		case TransformRename, TransformCopy:
+			value, ok := lookupField(event, rule.From)
+			if !ok {
+				continue
+			}
+			if rule.Op == TransformRename {
+				deleteField(event, rule.From)
+			}
+			setField(event, rule.To, value)
+		case TransformDefault:
+			if value, ok := lookupField(event, rule.To); !ok || value == nil {
+				setField(event, rule.To, rule.Value)
+			}
+		}
+	}
+}
+
+func lookupField(object map[string]any, path string) (any, bool) {
+	parent, name := fieldParent(object, path, false)
+	if parent == nil {
+		return nil, false
+	}
+
+	value, ok := parent[name]
+	return value, ok
+}
+
+func setField(object map[string]any, path string, value any) {
+	if parent, name := fieldParent(object, path, true); parent != nil {
+		parent[name] = value
+	}
+}
+
+func deleteField(object map[string]any, path string) {
+	if parent, name := fieldParent(object, path, false); parent != nil {
+		delete(parent, name)
+	}
+}
+
+// fieldParent walks path down to the object holding its last segment,
+// creating missing objects along the way when create is set. It returns nil
+// when an intermediate value is not an object.
+func fieldParent(object map[string]any, path string, create bool) (map[string]any, string) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := object[segment].(map[string]any)
+		if !ok {
+			if !create || object[segment] != nil {
+				return nil, ""
+			}
+			next = map[string]any{}
+			object[segment] = next
+		}
+		object = next
+	}
+
+	return object, segments[len(segments)-1]
+}
@@ -1,24 +1,194 @@
 package config
 
 import (
-	"log"
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/migrations"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 )
 
-func NewMySQLDB() *sqlx.DB {
-	db, err := Connect()
+const maxConnectBackoff = 30 * time.Second
 
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Storage holds the repositories of the configured backend.
+type Storage struct {
+	Events      storage.EventRepository
+	DeadLetters storage.DeadLetterRepository
+	db          *sqlx.DB
+}
+
+// NewStorage builds the repositories for DB_DRIVER, reporting writes to
+// eventMetrics. The memory driver needs no database and keeps everything in
+// process.
+func NewStorage(eventMetrics *metrics.Metrics) (*Storage, error) {
+	if DBDriver() == storage.DriverMemory {
+		slog.Warn("Using in-memory storage, events are lost on restart")
+		if ShardCount() > 1 {
+			slog.Warn("SHARD_COUNT is ignored by in-memory storage")
+		}
+		return &Storage{
+			Events:      storage.NewMemoryEventRepository(RepositoryConfig(eventMetrics)),
+			DeadLetters: storage.NewMemoryDeadLetterRepository(),
+		}, nil
+	}
+
+	db, err := NewDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if envBool("AUTO_MIGRATE", false) {
+		if _, err := migrations.Up(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("auto-migrate: %w", err)
+		}
+	}
+
+	var events storage.EventRepository
+	if shards := ShardCount(); shards > 1 {
+		events, err = storage.NewShardedEventRepository(context.Background(), db, RepositoryConfig(eventMetrics), shards)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		slog.Info("Sharding events by source", "shards", shards)
+	} else {
+		events = storage.NewEventRepository(db, RepositoryConfig(eventMetrics))
+	}
+
+	if !envBool("SKIP_SCHEMA_CHECK", false) {
+		if err := storage.CheckEventsSchema(context.Background(), db, ShardCount()); err != nil {
+			events.Close()
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if keys := MetadataIndexKeys(); len(keys) > 0 {
+		if err := storage.IndexMetadataKeys(context.Background(), db, keys, ShardCount()); err != nil {
+			events.Close()
+			db.Close()
+			return nil, err
+		}
+		slog.Info("Indexing metadata keys", "keys", keys)
+	}
+
+	return &Storage{
+		Events:      events,
+		DeadLetters: storage.NewDeadLetterRepository(db, RepositoryConfig(eventMetrics)),
+		db:          db,
+	}, nil
+}
+
+// Ping checks the database connection. The memory backend is always up.
+func (s *Storage) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the repositories and the database connection, if any.
+func (s *Storage) Close() error {
+	err := s.Events.Close()
+	if s.db == nil {
+		return err
+	}
+
+	return errors.Join(err, s.db.Close())
+}
+
+// NewDB connects to the database selected by DB_DRIVER, retrying with
+// exponential backoff so the service can start before the database is ready.
+// It gives up after DB_CONNECT_RETRIES retries and returns the last error.
+func NewDB() (*sqlx.DB, error) {
+	return connectWithRetry(Connect, envInt("DB_CONNECT_RETRIES", 10), envDuration("DB_CONNECT_BACKOFF", time.Second))
+}
+
+// connectWithRetry calls connect until it succeeds or retries retries are
+// used up, sleeping backoff before the first retry and twice as long before
+// each following one, up to maxConnectBackoff.
+func connectWithRetry(connect func() (*sqlx.DB, error), retries int, backoff time.Duration) (*sqlx.DB, error) {
+	db, err := connect()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		slog.Warn("Database not ready, retrying", "attempt", attempt, "retries", retries, "backoff", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxConnectBackoff)
+
+		db, err = connect()
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, fmt.Errorf("connect to database after %d retries: %w", retries, err)
 	}
 
-	return db
+	return db, nil
+}
+
+// DBDriver returns the storage driver from DB_DRIVER: mysql (default),
+// postgres or memory.
+func DBDriver() string {
+	return envString("DB_DRIVER", storage.DriverMySQL)
 }
 
 func Connect() (*sqlx.DB, error) {
+	driver := DBDriver()
+
+	var dsn, addr string
+	switch driver {
+	case storage.DriverMySQL:
+		dsn, addr = mysqlDSN()
+	case storage.DriverPostgres:
+		dsn, addr = postgresDSN()
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", driver)
+	}
+
+	db, err := sqlx.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := DBPoolConfig()
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	slog.Info("Connected to database",
+		"driver", driver,
+		"addr", addr,
+		"max_open_conns", pool.MaxOpenConns,
+		"max_idle_conns", pool.MaxIdleConns,
+		"conn_max_lifetime", pool.ConnMaxLifetime.String(),
+		"conn_max_idle_time", pool.ConnMaxIdleTime.String(),
+	)
+
+	return db, nil
+}
+
+func mysqlDSN() (string, string) {
 	config := mysql.Config{
 		User:                 os.Getenv("MYSQL_ROOT_USER"),
 		Passwd:               os.Getenv("MYSQL_ROOT_PASSWORD"),
@@ -28,6 +198,26 @@ func Connect() (*sqlx.DB, error) {
 		ParseTime:            true,
 	}
 
-	db, err := sqlx.Connect("mysql", config.FormatDSN())
-	return db, err
+	return config.FormatDSN(), config.Addr
+}
+
+func postgresDSN() (string, string) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD")),
+		Host:     os.Getenv("POSTGRES_HOST"),
+		Path:     "/" + os.Getenv("POSTGRES_DB"),
+		RawQuery: url.Values{"sslmode": {envString("POSTGRES_SSLMODE", "disable")}}.Encode(),
+	}
+
+	return dsn.String(), dsn.Host
+}
+
+func DBPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: envDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		ConnMaxIdleTime: envDuration("DB_CONN_MAX_IDLE_TIME", time.Minute),
+	}
 }
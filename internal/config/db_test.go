@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var errNotReady = errors.New("connection refused")
+
+func TestConnectWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		readyAfter   int
+		retries      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "ready at once", retries: 3, wantAttempts: 1},
+		{name: "ready after two failures", readyAfter: 2, retries: 3, wantAttempts: 3},
+		{name: "never ready", readyAfter: 10, retries: 3, wantAttempts: 4, wantErr: true},
+		{name: "no retries", readyAfter: 1, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			ready := &sqlx.DB{}
+			connect := func() (*sqlx.DB, error) {
+				attempts++
+				if attempts <= tt.readyAfter {
+					return nil, errNotReady
+				}
+				return ready, nil
+			}
+
+			db, err := connectWithRetry(connect, tt.retries, time.Millisecond)
+			if tt.wantErr {
+				if !errors.Is(err, errNotReady) || db != nil {
+					t.Errorf("connectWithRetry = %v, %v; want the last connect error", db, err)
+				}
+			} else if err != nil || db != ready {
+				t.Errorf("connectWithRetry = %v, %v; want the connected database", db, err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func envString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid integer, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid duration, using default", "key", key, "value", value, "default", fallback.String())
+		return fallback
+	}
+
+	return parsed
+}
+
+// envPositiveDuration is envDuration for settings where zero or less makes no
+// sense, such as ticker intervals.
+func envPositiveDuration(key string, fallback time.Duration) time.Duration {
+	value := envDuration(key, fallback)
+	if value <= 0 {
+		slog.Warn("Duration must be positive, using default", "key", key, "value", value.String(), "default", fallback.String())
+		return fallback
+	}
+
+	return value
+}
+
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid boolean, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// envList splits a comma-separated variable, dropping empty entries.
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// envListOr is envList with a fallback for an unset or empty variable.
+func envListOr(key string, fallback []string) []string {
+	if values := envList(key); len(values) > 0 {
+		return values
+	}
+
+	return fallback
+}
+
+// envFloat returns nil when the variable is unset or invalid.
+func envFloat(key string) *float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Invalid number, ignoring", "key", key, "value", value)
+		return nil
+	}
+
+	return &parsed
+}
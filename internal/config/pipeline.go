@@ -0,0 +1,682 @@
+package config
+
+import (
+	"event-processing-pipeline/internal/api"
+	dtos "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/ingest"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/sink"
+	"event-processing-pipeline/internal/storage"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultWorkerCount         = 4
+	defaultIngestionBufferSize = 1000
+	defaultInsertBatchSize     = 500
+	defaultFlushInterval       = 100 * time.Millisecond
+	defaultMaxBodyBytes        = 10 << 20
+)
+
+// WorkerCount is the minimum size of the worker pool, read from WORKER_MIN
+// and falling back to WORKER_COUNT.
+func WorkerCount() int {
+	count := envInt("WORKER_MIN", envInt("WORKER_COUNT", defaultWorkerCount))
+	if count < 1 {
+		return defaultWorkerCount
+	}
+
+	return count
+}
+
+// MaxWorkers is the size the pool may grow to under load. It defaults to the
+// minimum, which keeps the pool fixed.
+func MaxWorkers(minWorkers int) int {
+	count := envInt("WORKER_MAX", minWorkers)
+	if count < minWorkers {
+		slog.Warn("WORKER_MAX is below the minimum worker count, scaling disabled", "value", count, "min", minWorkers)
+		return minWorkers
+	}
+
+	return count
+}
+
+// IngestionBufferSize is the capacity of the channel feeding the worker pool.
+func IngestionBufferSize() int {
+	size := envInt("INGESTION_BUFFER_SIZE", defaultIngestionBufferSize)
+	if size < 0 {
+		return defaultIngestionBufferSize
+	}
+
+	return size
+}
+
+// ProcessDelay is an artificial delay added to every Process call, useful for
+// exercising backpressure. PROCESS_DELAY takes a Go duration such as "50ms".
+func ProcessDelay() time.Duration {
+	return envDuration("PROCESS_DELAY", 0)
+}
+
+// InsertBatchSize is the number of rows written per multi-row INSERT. It is
+// capped at storage.MaxInsertBatchSize.
+func InsertBatchSize() int {
+	size := envInt("INSERT_BATCH_SIZE", defaultInsertBatchSize)
+	if size < 1 {
+		return defaultInsertBatchSize
+	}
+
+	return min(size, storage.MaxInsertBatchSize)
+}
+
+// DedupMode selects how inserts treat an event id that is already stored:
+// "ignore" (default), "update" or "error".
+func DedupMode() storage.DedupMode {
+	mode := storage.DedupMode(strings.ToLower(os.Getenv("DEDUP_MODE")))
+	switch mode {
+	case "":
+		return storage.DedupIgnore
+	case storage.DedupIgnore, storage.DedupUpdate, storage.DedupError:
+		return mode
+	default:
+		slog.Warn("Unknown DEDUP_MODE, using default", "value", mode, "default", storage.DedupIgnore)
+		return storage.DedupIgnore
+	}
+}
+
+// Schemas loads the per-type JSON Schemas from SCHEMA_DIR, if set, on the
+// first call and returns the same registry afterwards. A broken schema stops
+// the service rather than silently disabling validation.
+var Schemas = sync.OnceValue(func() *pipeline.SchemaRegistry {
+	dir := os.Getenv("SCHEMA_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	schemas, err := pipeline.LoadSchemas(dir)
+	if err != nil {
+		slog.Error("Failed to load event schemas", "dir", dir, "error", err)
+		os.Exit(1)
+	}
+
+	return schemas
+})
+
+// Upgrades loads the schema upgrades applied to incoming events from
+// UPGRADE_FILE, if set. Like a broken schema, a broken upgrade file stops the
+// service.
+func Upgrades() *pipeline.Upgrades {
+	path := os.Getenv("UPGRADE_FILE")
+	if path == "" {
+		return nil
+	}
+
+	upgrades, err := pipeline.LoadUpgrades(path)
+	if err != nil {
+		slog.Error("Failed to load schema upgrades", "file", path, "error", err)
+		os.Exit(1)
+	}
+
+	return upgrades
+}
+
+// Enrichers builds the enrichers enabled through the environment. Like broken
+// schemas, an unreadable GeoIP table stops the service.
+func Enrichers() []pipeline.Enricher {
+	var enrichers []pipeline.Enricher
+
+	if path := os.Getenv("GEOIP_FILE"); path != "" {
+		geoIP, err := pipeline.LoadGeoIPEnricher(path, envString("GEOIP_IP_KEY", "ip"), envString("GEOIP_COUNTRY_KEY", "country"))
+		if err != nil {
+			slog.Error("Failed to load GeoIP table", "file", path, "error", err)
+			os.Exit(1)
+		}
+		enrichers = append(enrichers, geoIP)
+	}
+
+	return enrichers
+}
+
+// Redaction reads REDACT_METADATA_KEYS, a list of "key:strategy" entries, and
+// REDACT_USER_ID, the strategy for the user id. An invalid entry is fatal
+// rather than skipped, since it would store the field in plain text.
+func Redaction() pipeline.Redaction {
+	redaction := pipeline.Redaction{Metadata: map[string]pipeline.RedactStrategy{}}
+	for _, entry := range envList("REDACT_METADATA_KEYS") {
+		key, name, ok := strings.Cut(entry, ":")
+		if !ok || key == "" {
+			slog.Error("Invalid REDACT_METADATA_KEYS entry, expected key:strategy", "value", entry)
+			os.Exit(1)
+		}
+
+		strategy, err := pipeline.ParseRedactStrategy(name)
+		if err != nil {
+			slog.Error("Invalid REDACT_METADATA_KEYS entry", "value", entry, "error", err)
+			os.Exit(1)
+		}
+		redaction.Metadata[key] = strategy
+	}
+
+	if name := os.Getenv("REDACT_USER_ID"); name != "" {
+		strategy, err := pipeline.ParseRedactStrategy(name)
+		if err != nil {
+			slog.Error("Invalid REDACT_USER_ID", "error", err)
+			os.Exit(1)
+		}
+		redaction.UserID = strategy
+	}
+
+	return redaction
+}
+
+// EnrichFailurePolicy is "skip" (default) or "dead_letter".
+func EnrichFailurePolicy() pipeline.EnrichFailurePolicy {
+	policy := pipeline.EnrichFailurePolicy(strings.ToLower(os.Getenv("ENRICH_FAILURE_POLICY")))
+	switch policy {
+	case "":
+		return pipeline.EnrichFailureSkip
+	case pipeline.EnrichFailureSkip, pipeline.EnrichFailureDeadLetter:
+		return policy
+	default:
+		slog.Warn("Unknown ENRICH_FAILURE_POLICY, using default", "value", policy, "default", pipeline.EnrichFailureSkip)
+		return pipeline.EnrichFailureSkip
+	}
+}
+
+// MetricsFormat selects how GET /metrics is served: "json" (default) or
+// "prometheus".
+func MetricsFormat() string {
+	format := strings.ToLower(os.Getenv("METRICS_FORMAT"))
+	switch format {
+	case "", "json":
+		return "json"
+	case api.MetricsFormatPrometheus:
+		return format
+	default:
+		slog.Warn("Unknown METRICS_FORMAT, using default", "value", format, "default", "json")
+		return "json"
+	}
+}
+
+func EventControllerConfig() api.ControllerConfig {
+	return api.ControllerConfig{
+		MetricsFormat:        MetricsFormat(),
+		MaxBodyBytes:         int64(envInt("MAX_BODY_BYTES", defaultMaxBodyBytes)),
+		RequireEventID:       RequireEventID(),
+		BatchDuplicates:      BatchDuplicatePolicy(),
+		CSVTimestampLayout:   envString("CSV_TIMESTAMP_LAYOUT", time.RFC3339),
+		IdempotencyTTL:       envDuration("IDEMPOTENCY_TTL", 10*time.Minute),
+		IdempotencyCacheSize: envInt("IDEMPOTENCY_CACHE_SIZE", 10000),
+		StrictJSON:           envBool("STRICT_JSON", false),
+		SubscribeHeartbeat:   SubscribeHeartbeat(),
+		Transforms:           Transforms(),
+		ProducerHeader:       envString("TRANSFORM_PRODUCER_HEADER", api.DefaultProducerHeader),
+		BatchJobTTL:          envDuration("BATCH_JOB_TTL", time.Hour),
+		BatchJobCacheSize:    envInt("BATCH_JOB_CACHE_SIZE", 1000),
+		MetadataIndexes:      MetadataIndexKeys(),
+	}
+}
+
+// Transforms loads the per-producer field mapping rules from TRANSFORM_FILE,
+// if set. Like a broken schema, a broken rule file stops the service.
+func Transforms() api.Transforms {
+	path := os.Getenv("TRANSFORM_FILE")
+	if path == "" {
+		return nil
+	}
+
+	transforms, err := api.LoadTransforms(path)
+	if err != nil {
+		slog.Error("Failed to load transform rules", "file", path, "error", err)
+		os.Exit(1)
+	}
+
+	return transforms
+}
+
+// SubscribeHeartbeat is how often idle live subscriptions get a keep-alive.
+func SubscribeHeartbeat() time.Duration {
+	interval := envDuration("SUBSCRIBE_HEARTBEAT", 15*time.Second)
+	if interval <= 0 {
+		slog.Warn("SUBSCRIBE_HEARTBEAT must be positive, using default", "value", interval.String(), "default", "15s")
+		return 15 * time.Second
+	}
+
+	return interval
+}
+
+// SubscriberBuffer is the number of events buffered per live subscriber
+// before further events are dropped for it.
+func SubscriberBuffer() int {
+	return envInt("SUBSCRIBER_BUFFER", 256)
+}
+
+// BatchDuplicatePolicy is one of "reject" (default), "keep_first" or
+// "keep_last".
+func BatchDuplicatePolicy() api.BatchDuplicatePolicy {
+	policy := api.BatchDuplicatePolicy(strings.ToLower(os.Getenv("BATCH_DUPLICATE_IDS")))
+	switch policy {
+	case "":
+		return api.BatchDuplicatesReject
+	case api.BatchDuplicatesReject, api.BatchDuplicatesKeepFirst, api.BatchDuplicatesKeepLast:
+		return policy
+	default:
+		slog.Warn("Unknown BATCH_DUPLICATE_IDS, using default", "value", policy, "default", api.BatchDuplicatesReject)
+		return api.BatchDuplicatesReject
+	}
+}
+
+func PipelineConfig() pipeline.PipelineConfig {
+	workers := WorkerCount()
+	bufferSize := IngestionBufferSize()
+
+	return pipeline.PipelineConfig{
+		WorkerCount:    workers,
+		MaxWorkers:     MaxWorkers(workers),
+		ScaleHighWater: envInt("WORKER_SCALE_HIGH_WATER", bufferSize/2),
+		ScaleInterval:  envPositiveDuration("WORKER_SCALE_INTERVAL", time.Second),
+		IdleTimeout:    envPositiveDuration("WORKER_IDLE_TIMEOUT", 30*time.Second),
+		BufferSize:     bufferSize,
+		EnqueueTimeout: envDuration("ENQUEUE_TIMEOUT", 0),
+		ProcessTimeout: envDuration("PROCESS_TIMEOUT", 30*time.Second),
+		FlushSize:      min(envInt("FLUSH_SIZE", 0), storage.MaxInsertBatchSize),
+		FlushInterval:  FlushInterval(),
+		ContentDedup:   ContentDedupConfig(),
+		Sampling:       SamplingRules(),
+		Retries:        RetryQueueConfig(),
+	}
+}
+
+// RetryQueueConfig reads RETRY_MAX_ATTEMPTS, RETRY_QUEUE_SIZE,
+// RETRY_BASE_BACKOFF and RETRY_MAX_BACKOFF.
+func RetryQueueConfig() pipeline.RetryQueueConfig {
+	return pipeline.RetryQueueConfig{
+		MaxAttempts: envInt("RETRY_MAX_ATTEMPTS", 5),
+		MaxSize:     envInt("RETRY_QUEUE_SIZE", 10000),
+		BaseBackoff: envPositiveDuration("RETRY_BASE_BACKOFF", time.Second),
+		MaxBackoff:  envPositiveDuration("RETRY_MAX_BACKOFF", time.Minute),
+	}
+}
+
+// SamplingRules reads SAMPLING_RULES, a list of "type:<type>=<rate>" and
+// "source:<source>=<rate>" entries giving the share of those events to store.
+func SamplingRules() pipeline.SamplingRules {
+	rules := pipeline.SamplingRules{Types: map[string]float64{}, Sources: map[string]float64{}}
+	for _, entry := range envList("SAMPLING_RULES") {
+		key, value, _ := strings.Cut(entry, "=")
+		kind, name, ok := strings.Cut(key, ":")
+		sampleRate, err := strconv.ParseFloat(value, 64)
+		if !ok || (kind != "type" && kind != "source") || name == "" || err != nil || !(sampleRate >= 0 && sampleRate <= 1) {
+			slog.Warn("Invalid SAMPLING_RULES entry, expected type:<type>=<rate> or source:<source>=<rate> with a rate between 0 and 1", "value", entry)
+			continue
+		}
+
+		if kind == "type" {
+			rules.Types[name] = sampleRate
+		} else {
+			rules.Sources[name] = sampleRate
+		}
+	}
+
+	return rules
+}
+
+// ContentDedupConfig reads CONTENT_DEDUP_WINDOW, CONTENT_DEDUP_CACHE_SIZE and
+// CONTENT_DEDUP_FIELDS. Content dedup is off until the window is set.
+func ContentDedupConfig() pipeline.ContentDedupConfig {
+	var fields []pipeline.ContentField
+	for _, name := range envList("CONTENT_DEDUP_FIELDS") {
+		field := pipeline.ContentField(name)
+		if !slices.Contains(pipeline.ContentFields, field) {
+			slog.Warn("Unknown CONTENT_DEDUP_FIELDS entry, ignoring it", "value", name, "known", pipeline.ContentFields)
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return pipeline.ContentDedupConfig{
+		Window:    envDuration("CONTENT_DEDUP_WINDOW", 0),
+		CacheSize: envInt("CONTENT_DEDUP_CACHE_SIZE", 100000),
+		Fields:    fields,
+	}
+}
+
+// RetentionConfig reads RETENTION_DAYS, RETENTION_INTERVAL and
+// RETENTION_BATCH_SIZE. Retention is off until RETENTION_DAYS is set.
+func RetentionConfig() pipeline.RetentionConfig {
+	days := envInt("RETENTION_DAYS", 0)
+	if days < 0 {
+		slog.Warn("RETENTION_DAYS must not be negative, retention disabled", "value", days)
+		days = 0
+	}
+
+	batchSize := envInt("RETENTION_BATCH_SIZE", 1000)
+	if batchSize < 1 {
+		slog.Warn("RETENTION_BATCH_SIZE must be positive, using default", "value", batchSize, "default", 1000)
+		batchSize = 1000
+	}
+
+	return pipeline.RetentionConfig{
+		MaxAge:    time.Duration(days) * 24 * time.Hour,
+		Interval:  envPositiveDuration("RETENTION_INTERVAL", time.Hour),
+		BatchSize: batchSize,
+	}
+}
+
+// TypeRequirements reads REQUIRE_ACTION_TYPES, the event types that need an
+// action, and REQUIRED_METADATA_KEYS, a list of "type:key" entries naming the
+// metadata keys a type needs.
+func TypeRequirements() pipeline.TypeRequirements {
+	requirements := pipeline.TypeRequirements{}
+	for _, eventType := range envList("REQUIRE_ACTION_TYPES") {
+		requirement := requirements[dtos.EventType(eventType)]
+		requirement.Action = true
+		requirements[dtos.EventType(eventType)] = requirement
+	}
+
+	for _, entry := range envList("REQUIRED_METADATA_KEYS") {
+		eventType, key, ok := strings.Cut(entry, ":")
+		if !ok || eventType == "" || key == "" {
+			slog.Warn("Invalid REQUIRED_METADATA_KEYS entry, expected type:key", "value", entry)
+			continue
+		}
+
+		requirement := requirements[dtos.EventType(eventType)]
+		requirement.MetadataKeys = append(requirement.MetadataKeys, key)
+		requirements[dtos.EventType(eventType)] = requirement
+	}
+
+	return requirements
+}
+
+// ReplayConfig reads REPLAY_SINK and REPLAY_RATE, in events per second.
+// Replays write INSERT_BATCH_SIZE events per transaction.
+func ReplayConfig() pipeline.ReplayConfig {
+	return pipeline.ReplayConfig{
+		Sink:      ReplaySink(),
+		Rate:      rate.Limit(envInt("REPLAY_RATE", 500)),
+		BatchSize: InsertBatchSize(),
+	}
+}
+
+// ReplaySink selects where replayed events go: "store" (default) or "publish".
+func ReplaySink() pipeline.ReplaySink {
+	sink := pipeline.ReplaySink(strings.ToLower(os.Getenv("REPLAY_SINK")))
+	switch sink {
+	case "":
+		return pipeline.ReplaySinkStore
+	case pipeline.ReplaySinkStore, pipeline.ReplaySinkPublish:
+		return sink
+	default:
+		slog.Warn("Unknown REPLAY_SINK, using default", "value", sink, "default", pipeline.ReplaySinkStore)
+		return pipeline.ReplaySinkStore
+	}
+}
+
+// FlushInterval is the longest a buffered event waits before being stored.
+func FlushInterval() time.Duration {
+	interval := envDuration("FLUSH_INTERVAL", defaultFlushInterval)
+	if interval <= 0 {
+		slog.Warn("FLUSH_INTERVAL must be positive, using default", "value", interval.String(), "default", defaultFlushInterval.String())
+		return defaultFlushInterval
+	}
+
+	return interval
+}
+
+// TimestampFormat decides how numeric event timestamps are read: "rfc3339"
+// (default, numbers rejected), "unix" or "unix_ms".
+func TimestampFormat() dtos.TimestampFormat {
+	format := dtos.TimestampFormat(strings.ToLower(os.Getenv("TIMESTAMP_FORMAT")))
+	switch format {
+	case "":
+		return dtos.TimestampRFC3339
+	case dtos.TimestampRFC3339, dtos.TimestampUnix, dtos.TimestampUnixMillis:
+		return format
+	default:
+		slog.Warn("Unknown TIMESTAMP_FORMAT, using default", "value", format, "default", dtos.TimestampRFC3339)
+		return dtos.TimestampRFC3339
+	}
+}
+
+// ExactMetadataNumbers decides whether metadata numbers keep their exact
+// digits, see dtos.SetExactMetadataNumbers.
+func ExactMetadataNumbers() bool {
+	return envBool("EXACT_METADATA_NUMBERS", true)
+}
+
+// ValidationMode is "all" (default) to report every failed check of an
+// event or "fail_fast" to stop at the first.
+func ValidationMode() pipeline.ValidationMode {
+	mode := pipeline.ValidationMode(strings.ToLower(os.Getenv("VALIDATION_MODE")))
+	switch mode {
+	case "":
+		return pipeline.ValidationCollectAll
+	case pipeline.ValidationCollectAll, pipeline.ValidationFailFast:
+		return mode
+	default:
+		slog.Warn("Unknown VALIDATION_MODE, using default", "value", mode, "default", pipeline.ValidationCollectAll)
+		return pipeline.ValidationCollectAll
+	}
+}
+
+// RequireEventID rejects events without an id instead of generating one.
+func RequireEventID() bool {
+	return envBool("REQUIRE_EVENT_ID", false)
+}
+
+func ServiceConfig(eventMetrics *metrics.Metrics) pipeline.ServiceConfig {
+	return pipeline.ServiceConfig{
+		ProcessDelay:   ProcessDelay(),
+		RequireEventID: RequireEventID(),
+		MaxClockSkew:   envDuration("MAX_CLOCK_SKEW", 5*time.Minute),
+		MaxEventAge:    envDuration("MAX_EVENT_AGE", 0),
+		DefaultType:    dtos.EventType(os.Getenv("DEFAULT_TYPE")),
+		DefaultSource:  dtos.Source(os.Getenv("DEFAULT_SOURCE")),
+		AllowedTypes:   pipeline.NewAllowList(envList("ALLOWED_EVENT_TYPES")),
+		AllowedSources: pipeline.NewAllowList(envList("ALLOWED_SOURCES")),
+		Limits: pipeline.Limits{
+			MaxMetadataKeys:  envInt("MAX_METADATA_KEYS", 100),
+			MaxMetadataBytes: envInt("MAX_METADATA_BYTES", 64<<10),
+			MaxActionLength:  envInt("MAX_ACTION_LENGTH", 255),
+			MinValue:         envFloat("MIN_EVENT_VALUE"),
+			MaxValue:         envFloat("MAX_EVENT_VALUE"),
+		},
+		Requirements:       TypeRequirements(),
+		NonNegativeSources: NonNegativeSources(),
+		Enrichers:          Enrichers(),
+		EnrichFailures:     EnrichFailurePolicy(),
+		Redaction:          Redaction(),
+		Schemas:            Schemas(),
+		Upgrades:           Upgrades(),
+		ValidationMode:     ValidationMode(),
+		StoreRetry: pipeline.RetryPolicy{
+			MaxRetries:  envInt("STORE_MAX_RETRIES", 3),
+			BaseBackoff: envDuration("STORE_BASE_BACKOFF", 100*time.Millisecond),
+		},
+		Breaker: pipeline.BreakerConfig{
+			FailureThreshold: envInt("BREAKER_FAILURE_THRESHOLD", 5),
+			Cooldown:         envDuration("BREAKER_COOLDOWN", 30*time.Second),
+			OnStateChange: func(state pipeline.BreakerState) {
+				eventMetrics.SetBreakerState(string(state))
+			},
+		},
+		WAL:           WAL(),
+		RequireTenant: TenantSource() != "",
+	}
+}
+
+// WAL opens the write-ahead log at WAL_PATH, nil when it is unset.
+func WAL() *pipeline.WAL {
+	maxBytes := envInt("WAL_MAX_BYTES", 100<<20)
+	if maxBytes < 0 {
+		slog.Warn("WAL_MAX_BYTES must not be negative, using default", "value", maxBytes, "default", 100<<20)
+		maxBytes = 100 << 20
+	}
+
+	wal, err := pipeline.NewWAL(pipeline.WALConfig{
+		Path:           os.Getenv("WAL_PATH"),
+		MaxBytes:       int64(maxBytes),
+		ReplayInterval: envPositiveDuration("WAL_REPLAY_INTERVAL", 10*time.Second),
+	})
+	if err != nil {
+		slog.Error("Failed to open write-ahead log", "path", os.Getenv("WAL_PATH"), "error", err)
+		os.Exit(1)
+	}
+
+	return wal
+}
+
+// NonNegativeSources lists the sources whose events may not carry a negative
+// value. "*" applies the rule to every source; unset applies it to none.
+func NonNegativeSources() pipeline.AllowList {
+	sources := envList("NON_NEGATIVE_VALUE_SOURCES")
+	if len(sources) == 0 {
+		return pipeline.AllowList{}
+	}
+
+	return pipeline.NewAllowList(sources)
+}
+
+func RepositoryConfig(eventMetrics *metrics.Metrics) storage.RepositoryConfig {
+	return storage.RepositoryConfig{
+		InsertBatchSize:         InsertBatchSize(),
+		DedupMode:               DedupMode(),
+		ObserveWrite:            eventMetrics.ObserveWrite,
+		SlowWriteThreshold:      envDuration("SLOW_WRITE_THRESHOLD", 0),
+		PreparedInserts:         envInt("PREPARED_INSERTS", 32),
+		StatementTimeout:        envDuration("DB_STATEMENT_TIMEOUT", 0),
+		ObserveStatementTimeout: eventMetrics.IncStatementTimeout,
+	}
+}
+
+// ShardCount is the number of tables events are spread over by source, from
+// SHARD_COUNT. 1 (default) keeps every event in the events table.
+func ShardCount() int {
+	shards := envInt("SHARD_COUNT", 1)
+	if shards < 1 {
+		slog.Warn("SHARD_COUNT must be at least 1, not sharding", "value", shards)
+		return 1
+	}
+	return shards
+}
+
+// MetadataIndexKeys lists the metadata keys from METADATA_INDEX_KEYS to
+// promote to indexed columns. Like a broken schema, a key that cannot be a
+// column name, or that no schema declares when SCHEMA_DIR is set, stops the
+// service.
+func MetadataIndexKeys() []string {
+	keys := envList("METADATA_INDEX_KEYS")
+	if len(keys) == 0 {
+		return nil
+	}
+
+	schemas := Schemas()
+	for _, key := range keys {
+		if !storage.ValidMetadataIndexKey(key) {
+			slog.Error("Invalid METADATA_INDEX_KEYS key, use up to 40 letters, digits and underscores", "key", key)
+			os.Exit(1)
+		}
+		if schemas != nil && !schemas.DeclaresMetadataKey(key) {
+			slog.Error("METADATA_INDEX_KEYS key is not declared by any event schema", "key", key, "dir", os.Getenv("SCHEMA_DIR"))
+			os.Exit(1)
+		}
+	}
+
+	return keys
+}
+
+// LogLevel is one of "debug", "info" (default), "warn" or "error".
+func LogLevel() string {
+	return os.Getenv("LOG_LEVEL")
+}
+
+func KafkaConfig() ingest.KafkaConfig {
+	return ingest.KafkaConfig{
+		Enabled: envBool("KAFKA_ENABLED", false),
+		Brokers: envList("KAFKA_BROKERS"),
+		Topic:   os.Getenv("KAFKA_TOPIC"),
+		GroupID: envString("KAFKA_GROUP_ID", "event-pipeline"),
+	}
+}
+
+// KafkaProducerConfig reads the KAFKA_SINK_* variables. The producer is
+// enabled when KAFKA_SINK_TOPIC is set and shares KAFKA_BROKERS with the
+// consumer unless KAFKA_SINK_BROKERS is set.
+func KafkaProducerConfig() sink.KafkaProducerConfig {
+	return sink.KafkaProducerConfig{
+		Brokers:   envListOr("KAFKA_SINK_BROKERS", envList("KAFKA_BROKERS")),
+		Topic:     os.Getenv("KAFKA_SINK_TOPIC"),
+		Key:       KafkaSinkKey(),
+		Format:    KafkaSinkFormat(),
+		QueueSize: max(envInt("KAFKA_SINK_QUEUE_SIZE", 1000), 1),
+		BatchSize: max(envInt("KAFKA_SINK_BATCH_SIZE", 100), 1),
+	}
+}
+
+// KafkaSinkKey is "id" (default) or "user_id".
+func KafkaSinkKey() sink.KafkaKey {
+	switch key := sink.KafkaKey(os.Getenv("KAFKA_SINK_KEY")); key {
+	case "":
+		return sink.KafkaKeyEventID
+	case sink.KafkaKeyEventID, sink.KafkaKeyUserID:
+		return key
+	default:
+		slog.Warn("Unknown KAFKA_SINK_KEY, using default", "value", key, "default", sink.KafkaKeyEventID)
+		return sink.KafkaKeyEventID
+	}
+}
+
+// KafkaSinkFormat is "json" (default) or "protobuf".
+func KafkaSinkFormat() sink.KafkaFormat {
+	switch format := sink.KafkaFormat(os.Getenv("KAFKA_SINK_FORMAT")); format {
+	case "":
+		return sink.KafkaFormatJSON
+	case sink.KafkaFormatJSON, sink.KafkaFormatProtobuf:
+		return format
+	default:
+		slog.Warn("Unknown KAFKA_SINK_FORMAT, using default", "value", format, "default", sink.KafkaFormatJSON)
+		return sink.KafkaFormatJSON
+	}
+}
+
+// WebhookConfig reads the WEBHOOK_* variables. The webhook is enabled when
+// WEBHOOK_URL is set.
+func WebhookConfig() sink.WebhookConfig {
+	return sink.WebhookConfig{
+		URL:         os.Getenv("WEBHOOK_URL"),
+		Secret:      os.Getenv("WEBHOOK_SECRET"),
+		Timeout:     envPositiveDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+		QueueSize:   max(envInt("WEBHOOK_QUEUE_SIZE", 1000), 1),
+		BatchSize:   max(envInt("WEBHOOK_BATCH_SIZE", 1), 1),
+		MaxRetries:  max(envInt("WEBHOOK_MAX_RETRIES", 3), 0),
+		BaseBackoff: envDuration("WEBHOOK_RETRY_BACKOFF", 500*time.Millisecond),
+	}
+}
+
+func RedisConfig() ingest.RedisConfig {
+	consumer := os.Getenv("REDIS_CONSUMER")
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+
+	return ingest.RedisConfig{
+		Enabled:          envBool("REDIS_ENABLED", false),
+		Addr:             envString("REDIS_ADDR", "localhost:6379"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		DB:               envInt("REDIS_DB", 0),
+		Stream:           envString("REDIS_STREAM", "events"),
+		Group:            envString("REDIS_GROUP", "event-pipeline"),
+		Consumer:         consumer,
+		ClaimMinIdle:     envDuration("REDIS_CLAIM_MIN_IDLE", time.Minute),
+		DeadLetterStream: os.Getenv("REDIS_DEAD_LETTER_STREAM"),
+	}
+}
@@ -2,26 +2,266 @@ package config
 
 import (
 	"event-processing-pipeline/internal/api"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/tracing"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"golang.org/x/time/rate"
 )
 
-func Engine() *gin.Engine {
-	return gin.Default()
+func Engine(eventMetrics *metrics.Metrics) *gin.Engine {
+	engine := gin.New()
+
+	// The tracing middleware goes first so the request span covers the rest
+	// and continues any incoming traceparent.
+	if tracingConfig := TracingConfig(); tracingConfig.Enabled {
+		engine.Use(otelgin.Middleware(tracingConfig.ServiceName))
+	}
+	engine.Use(api.RequestID(), api.RequestLogger(), api.Recovery(eventMetrics))
+
+	// The Prometheus handler negotiates compression itself.
+	engine.Use(api.DecompressRequest())
+	if level := ResponseCompressionLevel(); level != gzip.NoCompression {
+		engine.Use(gzip.Gzip(level, gzip.WithExcludedPaths([]string{"/metrics", "/events/subscribe", api.PprofPrefix})))
+	}
+
+	return engine
 }
 
-func Routers(router *gin.Engine) *gin.Engine {
-	db := NewMySQLDB()
-	eventController := api.NewEventController(db)
+// Routers registers the routes. eventMiddleware applies to /events routes
+// only, so health checks and metrics stay reachable without credentials. The
+// /admin routes, the metrics reset among them, and DELETE /events are only
+// registered when auth is enabled, and so are the /debug/pprof routes, which
+// also need ENABLE_PPROF. The dead-letter and retry routes are left out with
+// multi-tenancy.
+func Routers(router *gin.Engine, eventController api.EventController, healthController api.HealthController, adminController api.AdminController, auth gin.HandlerFunc, eventMiddleware ...gin.HandlerFunc) *gin.Engine {
+	// CORS goes first so preflights are answered before authentication.
+	if cors := CORSConfig(); len(cors.AllowedOrigins) > 0 {
+		router.Use(api.CORS(cors))
+	}
 
-	router.POST("/events", eventController.HandleSingleEvent)
-	router.POST("/events/batch", eventController.HandleEventsBatch)
+	// cached adds ETags to the read endpoints that do not stream.
+	cached := func(handler gin.HandlerFunc) []gin.HandlerFunc { return []gin.HandlerFunc{handler} }
+	if envBool("ETAG_ENABLED", true) {
+		cached = func(handler gin.HandlerFunc) []gin.HandlerFunc { return []gin.HandlerFunc{api.ETag(), handler} }
+	}
+
+	events := router.Group("/events", eventMiddleware...)
+	deadline := api.RequestDeadline(envDuration("REQUEST_TIMEOUT_MAX", 30*time.Second))
+	events.POST("", deadline, api.RequireContentType(api.EventContentTypes...), eventController.HandleSingleEvent)
+	events.POST("/batch", deadline, api.RequireContentType(api.EventContentTypes...), eventController.HandleEventsBatch)
+	events.GET("/batch/:jobID", cached(eventController.GetBatchJob)...)
+	events.POST("/stream", api.RequireContentType(api.StreamContentTypes...), eventController.HandleEventsStream)
+	events.POST("/csv", api.RequireContentType(api.CSVContentTypes...), eventController.HandleEventsCSV)
+	events.POST("/validate", api.RequireContentType(api.EventContentTypes...), eventController.ValidateEvent)
+	events.POST("/validate/batch", api.RequireContentType(api.EventContentTypes...), eventController.ValidateEventsBatch)
+	events.GET("", cached(eventController.ListEvents)...)
+	events.GET("/count", cached(eventController.CountEvents)...)
+	events.GET("/timeseries", cached(eventController.EventTimeSeries)...)
+	events.GET("/export", eventController.ExportEvents)
+	events.GET("/stats", cached(eventController.EventStats)...)
+	events.GET("/subscribe", eventController.SubscribeEvents)
+	events.POST("/replay", eventController.ReplayEvents)
+	events.GET("/:id", cached(eventController.GetEvent)...)
+	// Dead letters and retries are not kept per tenant, so tenants cannot
+	// be shown them.
+	if TenantSource() == "" {
+		events.GET("/dead-letter", cached(eventController.ListDeadLetters)...)
+		events.GET("/retries", eventController.ListRetries)
+		events.POST("/dead-letter/:id/retry", eventController.RetryDeadLetter)
+	}
 	router.GET("/metrics", eventController.GetMetrics)
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	if auth != nil {
+		events.DELETE("", eventController.PurgeEvents)
+		admin := router.Group("/admin", auth)
+		admin.GET("/config", adminController.GetConfig)
+		admin.PATCH("/config", api.RequireContentType(api.ContentTypeJSON), adminController.PatchConfig)
+		admin.POST("/metrics/reset", eventController.ResetMetrics)
+	}
+
+	if envBool("ENABLE_PPROF", false) {
+		if auth != nil {
+			api.RegisterPprof(router.Group(api.PprofPrefix, auth))
+			slog.Warn("Profiling enabled", "path", api.PprofPrefix)
+		} else {
+			slog.Warn("ENABLE_PPROF needs AUTH_ENABLED to protect the profiling routes, not mounting them")
+		}
+	}
 
+	router.GET("/openapi.json", api.OpenAPI)
+	router.GET("/docs", api.Docs)
+	router.NoRoute(api.NoRoute)
+
+	router.GET("/health/live", healthController.Live)
+	router.GET("/health/ready", healthController.Ready)
+	router.GET("/health", healthController.Ready)
+
+	api.CheckOpenAPI(router.Routes())
 	return router
 }
+
+// ResponseCompressionLevel is the gzip level of responses to clients
+// accepting it, from RESPONSE_COMPRESSION_LEVEL: 1 (fastest) to 9 (smallest),
+// -1 for the library default or 0 to turn compression off.
+func ResponseCompressionLevel() int {
+	level := envInt("RESPONSE_COMPRESSION_LEVEL", gzip.DefaultCompression)
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		slog.Warn("RESPONSE_COMPRESSION_LEVEL must be between -1 and 9, using default", "value", level, "default", gzip.DefaultCompression)
+		return gzip.DefaultCompression
+	}
+	return level
+}
+
+// CORSConfig reads CORS_ALLOWED_ORIGINS and friends. CORS stays disabled
+// until origins are configured.
+func CORSConfig() api.CORSConfig {
+	return api.CORSConfig{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS"),
+		AllowedMethods: envListOr("CORS_ALLOWED_METHODS", []string{http.MethodGet, http.MethodPost}),
+		AllowedHeaders: envListOr("CORS_ALLOWED_HEADERS", []string{
+			"Authorization", "Content-Type", "Content-Encoding", api.APIKeyHeader, api.IdempotencyKeyHeader, "Prefer", "If-None-Match", api.RequestTimeoutHeader, api.TenantHeader,
+		}),
+		ExposedHeaders: envListOr("CORS_EXPOSED_HEADERS", []string{"Retry-After", api.RequestIDHeader, "Idempotent-Replayed", "ETag"}),
+		MaxAge:         envDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+}
+
+// EventMiddleware returns the middleware guarding the /events routes. The
+// limiter is installed even without limits so they can be set at runtime.
+func EventMiddleware(auth gin.HandlerFunc, limiter *api.RateLimiter) []gin.HandlerFunc {
+	var middleware []gin.HandlerFunc
+	if auth != nil {
+		middleware = append(middleware, auth)
+	}
+
+	if source := TenantSource(); source != "" {
+		if source == api.TenantFromAPIKey && auth == nil {
+			slog.Error("TENANT_SOURCE=api_key needs AUTH_ENABLED")
+			os.Exit(1)
+		}
+		middleware = append(middleware, api.Tenant(source))
+	}
+
+	// Limiting after auth lets the limiter key clients by API key name.
+	return append(middleware, limiter.Middleware())
+}
+
+// TenantSource reads TENANT_SOURCE, which enables multi-tenancy: "api_key"
+// takes the tenant from the API key name, "header" from the X-Tenant-ID
+// header. Unset leaves it disabled. An unknown source is fatal rather than
+// silently mixing the events of every tenant.
+func TenantSource() api.TenantSource {
+	source := api.TenantSource(strings.ToLower(os.Getenv("TENANT_SOURCE")))
+	switch source {
+	case "", api.TenantFromAPIKey, api.TenantFromHeader:
+		return source
+	default:
+		slog.Error("Unknown TENANT_SOURCE, expected api_key or header", "value", source)
+		os.Exit(1)
+		return ""
+	}
+}
+
+// Auth returns the API key middleware, or nil when AUTH_ENABLED is not set.
+func Auth(eventMetrics *metrics.Metrics) gin.HandlerFunc {
+	if !envBool("AUTH_ENABLED", false) {
+		return nil
+	}
+
+	return api.APIKeyAuth(APIKeys(), eventMetrics)
+}
+
+// APIKeys parses API_KEYS, a comma-separated list of "name:key" or bare
+// "key" entries. Bare keys are named key-1, key-2 and so on by position.
+// Enabling auth without keys would lock everyone out, so it is fatal.
+func APIKeys() []api.APIKey {
+	entries := envList("API_KEYS")
+	if len(entries) == 0 {
+		slog.Error("AUTH_ENABLED is set but API_KEYS is empty")
+		os.Exit(1)
+	}
+
+	keys := make([]api.APIKey, len(entries))
+	for i, entry := range entries {
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, key = fmt.Sprintf("key-%d", i+1), entry
+		}
+		keys[i] = api.APIKey{Name: name, Key: key}
+	}
+
+	return keys
+}
+
+// RateLimitConfig reads the limits in requests per second. Bursts default to
+// one second worth of requests and are at least one.
+func RateLimitConfig() api.RateLimitConfig {
+	perClient := envInt("RATE_LIMIT_RPS", 0)
+	global := envInt("RATE_LIMIT_GLOBAL_RPS", 0)
+
+	return api.RateLimitConfig{
+		PerClient:      rate.Limit(perClient),
+		PerClientBurst: max(envInt("RATE_LIMIT_BURST", perClient), 1),
+		Global:         rate.Limit(global),
+		GlobalBurst:    max(envInt("RATE_LIMIT_GLOBAL_BURST", global), 1),
+	}
+}
+
+// TracingConfig enables tracing when an OTLP endpoint is configured through
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT.
+func TracingConfig() tracing.Config {
+	return tracing.Config{
+		Enabled:     os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "",
+		ServiceName: envString("OTEL_SERVICE_NAME", "event-pipeline"),
+	}
+}
+
+// HealthCheckTimeout bounds the database ping of the readiness check.
+func HealthCheckTimeout() time.Duration {
+	return envDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+}
+
+// ShutdownTimeout bounds how long the server waits for in-flight requests and
+// queued events on shutdown before abandoning them.
+func ShutdownTimeout() time.Duration {
+	return envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+}
+
+const defaultHTTPAddr = ":9000"
+
+// HTTPAddr returns the listen address from HTTP_ADDR, or from PORT when only
+// a port is injected, defaulting to :9000.
+func HTTPAddr() (string, error) {
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		if port := os.Getenv("PORT"); port != "" {
+			addr = ":" + port
+		}
+	}
+	if addr == "" {
+		return defaultHTTPAddr, nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", fmt.Errorf("invalid listen port %q", port)
+	}
+
+	return addr, nil
+}
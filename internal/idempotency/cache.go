@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache remembers results by idempotency key for TTL, evicting the least
+// recently used entry once it holds Size entries. It is safe for concurrent
+// use. A nil *Cache never hits and stores nothing.
+type Cache[V any] struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func NewCache[V any](ttl time.Duration, size int) *Cache[V] {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+
+	return &Cache[V]{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for key unless it has expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	cached := element.Value.(*entry[V])
+	if c.now().After(cached.expires) {
+		c.remove(element)
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return cached.value, true
+}
+
+// Put stores value for key, replacing any previous value and restarting its
+// TTL.
+func (c *Cache[V]) Put(key string, value V) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		cached := element.Value.(*entry[V])
+		cached.value, cached.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// PutIfAbsent stores value for key unless it holds a value that has not
+// expired yet. It returns the value in effect and whether it was stored, so
+// concurrent callers racing for a key agree on a single winner.
+func (c *Cache[V]) PutIfAbsent(key string, value V) (V, bool) {
+	if c == nil {
+		return value, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		cached := element.Value.(*entry[V])
+		if !c.now().After(cached.expires) {
+			c.order.MoveToFront(element)
+			return cached.value, false
+		}
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return value, true
+}
+
+// Delete forgets key.
+func (c *Cache[V]) Delete(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *Cache[V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[V]).key)
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache whose clock only moves when the test advances
+// it.
+func newTestCache(ttl time.Duration, size int) (*Cache[int], func(time.Duration)) {
+	cache := NewCache[int](ttl, size)
+	now := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCacheGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		want    int
+		wantHit bool
+	}{
+		{name: "hit", key: "a", want: 1, wantHit: true},
+		{name: "miss", key: "b"},
+		{name: "hit at the ttl", advance: time.Minute, key: "a", want: 1, wantHit: true},
+		{name: "expired", advance: time.Minute + time.Nanosecond, key: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, advance := newTestCache(time.Minute, 4)
+			cache.Put("a", 1)
+			advance(tt.advance)
+
+			got, hit := cache.Get(tt.key)
+			if got != tt.want || hit != tt.wantHit {
+				t.Errorf("Get(%s) = %d, %t; want %d, %t", tt.key, got, hit, tt.want, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, _ := newTestCache(time.Minute, 2)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Get("a")
+	cache.Put("c", 3)
+
+	var kept []string
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok := cache.Get(key); ok {
+			kept = append(kept, key)
+		}
+	}
+	if fmt.Sprint(kept) != "[a c]" {
+		t.Errorf("kept %v, want [a c]", kept)
+	}
+}
+
+func TestCachePutIfAbsent(t *testing.T) {
+	cache, advance := newTestCache(time.Minute, 4)
+
+	for _, step := range []struct {
+		advance    time.Duration
+		value      int
+		want       int
+		wantStored bool
+	}{
+		{value: 1, want: 1, wantStored: true},
+		{value: 2, want: 1},
+		{advance: 2 * time.Minute, value: 3, want: 3, wantStored: true},
+	} {
+		advance(step.advance)
+		if got, stored := cache.PutIfAbsent("a", step.value); got != step.want || stored != step.wantStored {
+			t.Errorf("PutIfAbsent(a, %d) = %d, %t; want %d, %t", step.value, got, stored, step.want, step.wantStored)
+		}
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	if cache := NewCache[int](0, 10); cache != nil {
+		t.Fatal("NewCache with no TTL != nil")
+	}
+
+	var cache *Cache[int]
+	cache.Put("a", 1)
+	cache.Delete("a")
+	if _, ok := cache.Get("a"); ok {
+		t.Error("nil cache hit")
+	}
+	if got, stored := cache.PutIfAbsent("a", 2); got != 2 || !stored {
+		t.Errorf("PutIfAbsent = %d, %t; want 2, true", got, stored)
+	}
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// enqueueRetryDelay is how long consumers wait before retrying a message the
+// pipeline had no room for.
+const enqueueRetryDelay = 100 * time.Millisecond
+
+type KafkaConfig struct {
+	Enabled bool
+	Brokers []string
+	Topic   string
+	GroupID string
+}
+
+// KafkaConsumer feeds events from a Kafka topic into the pipeline. Offsets are
+// committed only once the pipeline is done with a message, so delivery is
+// at-least-once: an event is either stored or dead-lettered before its offset
+// moves on.
+type KafkaConsumer struct {
+	reader        *kafka.Reader
+	eventPipeline *pipeline.EventPipeline
+	deadLetters   pipeline.DeadLetterService
+}
+
+func NewKafkaConsumer(cfg KafkaConfig, eventPipeline *pipeline.EventPipeline, deadLetters pipeline.DeadLetterService) *KafkaConsumer {
+	return &KafkaConsumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.Brokers,
+			Topic:   cfg.Topic,
+			GroupID: cfg.GroupID,
+		}),
+		eventPipeline: eventPipeline,
+		deadLetters:   deadLetters,
+	}
+}
+
+// Run consumes until ctx is cancelled or the pipeline shuts down.
+func (c *KafkaConsumer) Run(ctx context.Context) error {
+	for {
+		message, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch kafka message: %w", err)
+		}
+
+		if err := c.handle(ctx, message); err != nil {
+			if errors.Is(err, pipeline.ErrPipelineClosed) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := c.reader.CommitMessages(ctx, message); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit kafka offset %d: %w", message.Offset, err)
+		}
+	}
+}
+
+func (c *KafkaConsumer) Close() error {
+	return c.reader.Close()
+}
+
+// handle returns once the message is stored or dead-lettered.
+func (c *KafkaConsumer) handle(ctx context.Context, message kafka.Message) error {
+	var event api.EventDTO
+	if err := json.Unmarshal(message.Value, &event); err != nil {
+		c.deadLetters.SendRaw(ctx, message.Value, metrics.StageDecode, err)
+		return nil
+	}
+
+	_, err := enqueueAndWait(ctx, c.eventPipeline, event, slog.With("topic", message.Topic, "partition", message.Partition, "offset", message.Offset))
+	return err
+}
+
+// enqueueAndWait pushes the event into the pipeline, retrying while it is
+// full, and waits for the worker to finish with it.
+func enqueueAndWait(ctx context.Context, eventPipeline *pipeline.EventPipeline, event api.EventDTO, logger *slog.Logger) (pipeline.JobResult, error) {
+	resultChan := make(chan pipeline.JobResult, 1)
+	job := pipeline.Job{Ctx: context.WithoutCancel(ctx), Event: event, Result: resultChan}
+
+	for {
+		err := eventPipeline.Enqueue(job)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, pipeline.ErrPipelineFull) {
+			return pipeline.JobResult{}, err
+		}
+
+		logger.Debug("Pipeline full, retrying enqueue")
+		select {
+		case <-ctx.Done():
+			return pipeline.JobResult{}, ctx.Err()
+		case <-time.After(enqueueRetryDelay):
+		}
+	}
+
+	return <-resultChan, nil
+}
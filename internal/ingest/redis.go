@@ -0,0 +1,261 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisEventField is the stream entry field holding the JSON encoded event.
+const RedisEventField = "event"
+
+const (
+	redisReadCount    = 100
+	redisReadBlock    = 5 * time.Second
+	redisRetryBackoff = time.Second
+	maxRedisBackoff   = 30 * time.Second
+)
+
+type RedisConfig struct {
+	Enabled  bool
+	Addr     string
+	Password string
+	DB       int
+	Stream   string
+	Group    string
+	// Consumer names this instance within the group. It must be stable across
+	// restarts so the instance picks up its own pending entries again.
+	Consumer string
+	// ClaimMinIdle is how long an entry of another consumer must sit pending
+	// before this one reclaims it on startup.
+	ClaimMinIdle time.Duration
+	// DeadLetterStream also publishes every dead-lettered event to this
+	// stream when set.
+	DeadLetterStream string
+}
+
+func NewRedisClient(cfg RedisConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+}
+
+// RedisConsumer feeds events from a Redis Stream into the pipeline through a
+// consumer group. Entries are acknowledged only once they are stored or
+// dead-lettered; anything left pending by a crash is picked up again on the
+// next start.
+type RedisConsumer struct {
+	client        *redis.Client
+	cfg           RedisConfig
+	eventPipeline *pipeline.EventPipeline
+	deadLetters   pipeline.DeadLetterService
+}
+
+func NewRedisConsumer(client *redis.Client, cfg RedisConfig, eventPipeline *pipeline.EventPipeline, deadLetters pipeline.DeadLetterService) *RedisConsumer {
+	return &RedisConsumer{
+		client:        client,
+		cfg:           cfg,
+		eventPipeline: eventPipeline,
+		deadLetters:   deadLetters,
+	}
+}
+
+// Run consumes until ctx is cancelled or the pipeline shuts down. Connection
+// errors are retried with backoff, the client reconnects on its own.
+func (c *RedisConsumer) Run(ctx context.Context) error {
+	backoff := redisRetryBackoff
+	// "0" replays this consumer's own pending entries, ">" reads new ones.
+	start := "0"
+	reclaimed := false
+
+	for ctx.Err() == nil {
+		err := c.ensureGroup(ctx)
+		if err == nil && !reclaimed {
+			err = c.reclaim(ctx)
+			reclaimed = err == nil
+		}
+		if err == nil {
+			var drained bool
+			drained, err = c.read(ctx, start)
+			if drained {
+				start = ">"
+			}
+		}
+
+		if err == nil {
+			backoff = redisRetryBackoff
+			continue
+		}
+		if errors.Is(err, pipeline.ErrPipelineClosed) || ctx.Err() != nil {
+			return nil
+		}
+
+		slog.Warn("Redis consumer error, retrying", "stream", c.cfg.Stream, "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRedisBackoff)
+	}
+
+	return nil
+}
+
+// ensureGroup creates the stream and consumer group if they do not exist yet.
+func (c *RedisConsumer) ensureGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.cfg.Stream, c.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group %s: %w", c.cfg.Group, err)
+	}
+
+	return nil
+}
+
+// reclaim takes over entries other consumers left pending for longer than
+// ClaimMinIdle, e.g. because they crashed.
+func (c *RedisConsumer) reclaim(ctx context.Context) error {
+	cursor := "0-0"
+	for {
+		messages, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.cfg.Stream,
+			Group:    c.cfg.Group,
+			Consumer: c.cfg.Consumer,
+			MinIdle:  c.cfg.ClaimMinIdle,
+			Start:    cursor,
+			Count:    redisReadCount,
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("reclaim pending entries: %w", err)
+		}
+
+		if len(messages) > 0 {
+			slog.Info("Reclaimed pending stream entries", "stream", c.cfg.Stream, "entries", len(messages))
+		}
+		for _, message := range messages {
+			if err := c.handle(ctx, message); err != nil {
+				return err
+			}
+		}
+
+		if next == "0-0" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// read handles one batch of entries starting at start. It reports whether
+// there was nothing left to read, which ends the replay of pending entries.
+func (c *RedisConsumer) read(ctx context.Context, start string) (bool, error) {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.cfg.Group,
+		Consumer: c.cfg.Consumer,
+		Streams:  []string{c.cfg.Stream, start},
+		Count:    redisReadCount,
+		Block:    redisReadBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read stream %s: %w", c.cfg.Stream, err)
+	}
+
+	drained := true
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			drained = false
+			if err := c.handle(ctx, message); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return drained, nil
+}
+
+// handle returns once the entry is stored or dead-lettered and acknowledged.
+func (c *RedisConsumer) handle(ctx context.Context, message redis.XMessage) error {
+	logger := slog.With("stream", c.cfg.Stream, "entry_id", message.ID)
+
+	raw, _ := message.Values[RedisEventField].(string)
+
+	var event api.EventDTO
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		c.deadLetters.SendRaw(ctx, []byte(raw), metrics.StageDecode, err)
+	} else if _, err := enqueueAndWait(ctx, c.eventPipeline, event, logger); err != nil {
+		return err
+	}
+
+	if err := c.client.XAck(ctx, c.cfg.Stream, c.cfg.Group, message.ID).Err(); err != nil {
+		return fmt.Errorf("ack entry %s: %w", message.ID, err)
+	}
+
+	return nil
+}
+
+// redisDeadLetterSink publishes dead letters to a Redis Stream on top of
+// recording them with the wrapped service, which still backs List and Take.
+type redisDeadLetterSink struct {
+	pipeline.DeadLetterService
+	client *redis.Client
+	stream string
+}
+
+func NewRedisDeadLetterSink(client *redis.Client, stream string, next pipeline.DeadLetterService) pipeline.DeadLetterService {
+	return &redisDeadLetterSink{
+		DeadLetterService: next,
+		client:            client,
+		stream:            stream,
+	}
+}
+
+func (s *redisDeadLetterSink) Send(ctx context.Context, event api.EventDTO, stage metrics.Stage, cause error) {
+	s.DeadLetterService.Send(ctx, event, stage, cause)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to encode dead letter", "stage", stage, "error", err)
+		return
+	}
+
+	eventID := ""
+	if event.ID != nil {
+		eventID = *event.ID
+	}
+	s.publish(ctx, eventID, payload, stage, cause)
+}
+
+func (s *redisDeadLetterSink) SendRaw(ctx context.Context, payload []byte, stage metrics.Stage, cause error) {
+	s.DeadLetterService.SendRaw(ctx, payload, stage, cause)
+	s.publish(ctx, "", payload, stage, cause)
+}
+
+func (s *redisDeadLetterSink) publish(ctx context.Context, eventID string, payload []byte, stage metrics.Stage, cause error) {
+	err := s.client.XAdd(context.WithoutCancel(ctx), &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]interface{}{
+			"event_id":      eventID,
+			"stage":         string(stage),
+			"error":         cause.Error(),
+			RedisEventField: payload,
+			"created_at":    time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}).Err()
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to publish dead letter", "stream", s.stream, "stage", stage, "error", err)
+	}
+}
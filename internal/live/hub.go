@@ -0,0 +1,129 @@
+package live
+
+import (
+	"event-processing-pipeline/internal/storage"
+	"sync"
+	"sync/atomic"
+)
+
+// Filter narrows a subscription down. Empty fields match everything.
+type Filter struct {
+	Type   storage.EventType
+	Source storage.Source
+	// TenantID restricts the subscription to the events of one tenant.
+	TenantID string
+}
+
+func (f Filter) matches(event storage.ProcessedEvent) bool {
+	return (f.Type == "" || f.Type == event.Type) && (f.Source == "" || f.Source == event.Source) &&
+		(f.TenantID == "" || f.TenantID == event.TenantID)
+}
+
+// Subscription receives the stored events matching its filter. Events that
+// arrive while its buffer is full are dropped and counted instead of slowing
+// down the pipeline.
+type Subscription struct {
+	events  chan storage.ProcessedEvent
+	filter  Filter
+	dropped atomic.Int64
+}
+
+// Events is closed when the subscription ends, either through Unsubscribe or
+// because the hub closed.
+func (s *Subscription) Events() <-chan storage.ProcessedEvent {
+	return s.events
+}
+
+// TakeDropped returns the number of events dropped since the last call.
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Hub fans stored events out to live subscribers.
+type Hub struct {
+	bufferSize int
+
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+// NewHub creates a hub giving every subscriber a buffer of bufferSize events.
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:    max(bufferSize, 1),
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a new subscription. On a closed hub the returned
+// subscription's channel is already closed.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	subscription := &Subscription{
+		events: make(chan storage.ProcessedEvent, h.bufferSize),
+		filter: filter,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(subscription.events)
+		return subscription
+	}
+	h.subscriptions[subscription] = struct{}{}
+
+	return subscription
+}
+
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscriptions[subscription]; ok {
+		delete(h.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// Publish hands event to every matching subscriber without blocking.
+func (h *Hub) Publish(event storage.ProcessedEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for subscription := range h.subscriptions {
+		if !subscription.filter.matches(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subscriptions)
+}
+
+// Close ends every subscription. Later Publish calls are no-ops.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for subscription := range h.subscriptions {
+		delete(h.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
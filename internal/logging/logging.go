@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type requestIDKey struct{}
+
+type apiKeyKey struct{}
+
+type tenantKey struct{}
+
+// Setup installs a JSON slog handler at the given level ("debug", "info",
+// "warn" or "error") as the process-wide default logger.
+func Setup(level string) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: ParseLevel(level)})
+	slog.SetDefault(slog.New(handler))
+}
+
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithAPIKey stores the name of the API key that authenticated the request.
+func WithAPIKey(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, name)
+}
+
+func APIKey(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyKey{}).(string)
+	return name
+}
+
+// WithTenant stores the tenant the request acts for.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant the request acts for, empty without
+// multi-tenancy.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// FromContext returns the default logger annotated with the request ID, API
+// key name and tenant carried by ctx, if any.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if requestID := RequestID(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	if apiKey := APIKey(ctx); apiKey != "" {
+		logger = logger.With("api_key", apiKey)
+	}
+	if tenant := Tenant(ctx); tenant != "" {
+		logger = logger.With("tenant", tenant)
+	}
+
+	return logger
+}
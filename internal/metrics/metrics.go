@@ -0,0 +1,493 @@
+package metrics
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Stage string
+
+const (
+	StageValidate Stage = "validate"
+	StageProcess  Stage = "process"
+	StageStore    Stage = "store"
+	// StageEnqueue marks events that never made it into the worker pool.
+	StageEnqueue Stage = "enqueue"
+	// StageQueue marks events whose request ended or timed out while they
+	// waited in the worker queue.
+	StageQueue Stage = "queue"
+	// StageDecode marks payloads that could not be decoded into an event.
+	StageDecode Stage = "decode"
+	// StageWebhook marks stored events the webhook failed to deliver.
+	StageWebhook Stage = "webhook"
+)
+
+// Delivery results of events forwarded to a sink.
+const (
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+	// DeliveryDropped counts events discarded because the sink's queue was
+	// full or closed.
+	DeliveryDropped = "dropped"
+)
+
+// latencySampleSize bounds the number of recent samples kept per stage for
+// percentile calculation.
+const latencySampleSize = 1024
+
+type Metrics struct {
+	received    atomic.Int64
+	validated   atomic.Int64
+	processed   atomic.Int64
+	stored      atomic.Int64
+	duplicates  atomic.Int64
+	contentDups atomic.Int64
+	sampledOut  atomic.Int64
+	purged      atomic.Int64
+	spooled     atomic.Int64
+	rejected    atomic.Int64
+	outstanding atomic.Int64
+	buffered    atomic.Int64
+	workers     atomic.Int64
+	queueDepth  atomic.Int64
+	breaker     atomic.Value
+
+	failedValidate atomic.Int64
+	failedProcess  atomic.Int64
+	failedStore    atomic.Int64
+
+	processLatency *latencyRecorder
+	storeLatency   *latencyRecorder
+
+	// The windows feed Stats: events received, end-to-end latencies in
+	// nanoseconds and worker busy time in nanoseconds.
+	receivedWindow *window
+	latencyWindow  *window
+	busyWindow     *window
+	started        time.Time
+
+	prometheus *prometheusMetrics
+
+	mu    sync.RWMutex
+	since time.Time
+}
+
+// Snapshot is the state of the JSON metrics at one point in time.
+//
+// @Schema Metrics
+// @Property since date-time
+// @Property received integer
+// @Property validated integer
+// @Property processed integer
+// @Property stored integer
+// @Property duplicates integer
+// @Property content_duplicates integer
+// @Property sampled_out integer
+// @Property purged integer
+// @Property spooled integer Events written to the write-ahead log while the
+// database was unreachable
+// @Property rejected integer
+// @Property outstanding integer
+// @Property buffered integer
+// @Property workers integer
+// @Property goroutines integer
+// @Property queue_depth integer
+// @Property breaker string
+// @Property failed map[string]integer Failures per stage
+// @Property latency map[string]Latency Latency per stage
+type Snapshot struct {
+	Since       time.Time                 `json:"since"`
+	Received    int64                     `json:"received"`
+	Validated   int64                     `json:"validated"`
+	Processed   int64                     `json:"processed"`
+	Stored      int64                     `json:"stored"`
+	Duplicates  int64                     `json:"duplicates"`
+	ContentDups int64                     `json:"content_duplicates"`
+	SampledOut  int64                     `json:"sampled_out"`
+	Purged      int64                     `json:"purged"`
+	Spooled     int64                     `json:"spooled"`
+	Rejected    int64                     `json:"rejected"`
+	Outstanding int64                     `json:"outstanding"`
+	Buffered    int64                     `json:"buffered"`
+	Workers     int64                     `json:"workers"`
+	Goroutines  int                       `json:"goroutines"`
+	QueueDepth  int64                     `json:"queue_depth"`
+	Breaker     string                    `json:"breaker,omitempty"`
+	Failed      map[Stage]int64           `json:"failed"`
+	Latency     map[Stage]LatencySnapshot `json:"latency"`
+}
+
+// LatencySnapshot summarizes the latencies recorded for a stage.
+//
+// @Schema Latency
+// @Property count integer
+// @Property p50_ms number
+// @Property p95_ms number
+// @Property p99_ms number
+type LatencySnapshot struct {
+	Count int64   `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		processLatency: newLatencyRecorder(latencySampleSize),
+		storeLatency:   newLatencyRecorder(latencySampleSize),
+		receivedWindow: newWindow(statsWindow),
+		latencyWindow:  newWindow(statsWindow),
+		busyWindow:     newWindow(statsWindow),
+		started:        time.Now(),
+		prometheus:     newPrometheusMetrics(),
+		since:          time.Now().UTC(),
+	}
+}
+
+func (m *Metrics) IncReceived(eventType, source string) {
+	m.received.Add(1)
+	m.outstanding.Add(1)
+	m.receivedWindow.add(1)
+	m.prometheus.received.WithLabelValues(m.prometheus.sources.value(source), m.prometheus.types.value(eventType)).Inc()
+}
+
+func (m *Metrics) IncValidated() {
+	m.validated.Add(1)
+}
+
+func (m *Metrics) IncProcessed() {
+	m.processed.Add(1)
+}
+
+func (m *Metrics) AddStored(n int) {
+	m.stored.Add(int64(n))
+}
+
+func (m *Metrics) AddDuplicates(n int) {
+	m.duplicates.Add(int64(n))
+}
+
+// IncContentDuplicate counts an event skipped because one with the same
+// content was stored within the content dedup window.
+func (m *Metrics) IncContentDuplicate() {
+	m.contentDups.Add(1)
+	m.prometheus.contentDuplicates.Inc()
+}
+
+// IncSampledOut counts a valid event dropped by the sampling rules.
+func (m *Metrics) IncSampledOut(eventType, source string) {
+	m.sampledOut.Add(1)
+	m.prometheus.sampledOut.WithLabelValues(m.prometheus.sources.value(source), m.prometheus.types.value(eventType)).Inc()
+}
+
+// IncRejected counts an event that was received but dropped because the
+// pipeline had no room for it.
+func (m *Metrics) IncRejected() {
+	m.rejected.Add(1)
+	m.outstanding.Add(-1)
+	m.prometheus.rejected.Inc()
+}
+
+// IncAPIKeyRequest counts an authenticated request. Key names come from
+// configuration, so the label is bounded without a limiter.
+func (m *Metrics) IncAPIKeyRequest(name string) {
+	m.prometheus.apiKeyRequests.WithLabelValues(name).Inc()
+}
+
+// IncThrottled counts a request rejected by the rate limiter. client is an
+// API key name, a client IP or "global".
+func (m *Metrics) IncThrottled(client string) {
+	m.prometheus.throttled.WithLabelValues(m.prometheus.clients.value(client)).Inc()
+}
+
+// AddSpooled counts events written to the write-ahead log instead of the
+// database.
+func (m *Metrics) AddSpooled(n int) {
+	m.spooled.Add(int64(n))
+	m.prometheus.spooled.Add(float64(n))
+}
+
+// AddPurged counts events deleted by retention purges.
+func (m *Metrics) AddPurged(n int64) {
+	m.purged.Add(n)
+	m.prometheus.purged.Add(float64(n))
+}
+
+// AddDeliveries counts n events forwarded to sink with result, one of the
+// Delivery constants.
+func (m *Metrics) AddDeliveries(sink, result string, n int) {
+	m.prometheus.deliveries.WithLabelValues(sink, result).Add(float64(n))
+}
+
+// IncPanic counts a panic recovered in an HTTP handler.
+func (m *Metrics) IncPanic() {
+	m.prometheus.panics.Inc()
+}
+
+func (m *Metrics) IncFailed(stage Stage) {
+	switch stage {
+	case StageValidate:
+		m.failedValidate.Add(1)
+	case StageProcess:
+		m.failedProcess.Add(1)
+	case StageStore:
+		m.failedStore.Add(1)
+	}
+	m.prometheus.failed.WithLabelValues(string(stage)).Inc()
+}
+
+// Done marks an event received through IncReceived as no longer in flight.
+func (m *Metrics) Done() {
+	m.outstanding.Add(-1)
+}
+
+func (m *Metrics) Outstanding() int64 {
+	return m.outstanding.Load()
+}
+
+func (m *Metrics) ObserveProcess(duration time.Duration) {
+	m.processLatency.observe(duration)
+	m.prometheus.processDuration.Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveStore(duration time.Duration) {
+	m.storeLatency.observe(duration)
+	m.prometheus.storeDuration.Observe(duration.Seconds())
+}
+
+// ObserveWrite records one INSERT statement carrying rows events. It matches
+// storage.RepositoryConfig.ObserveWrite.
+func (m *Metrics) ObserveWrite(rows int, duration time.Duration, err error) {
+	m.prometheus.writeDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.prometheus.writeErrors.Inc()
+		return
+	}
+	m.prometheus.writtenRows.Add(float64(rows))
+}
+
+// IncStatementTimeout counts a database statement cancelled for exceeding
+// the statement timeout.
+func (m *Metrics) IncStatementTimeout(operation string) {
+	m.prometheus.statementTimeouts.WithLabelValues(operation).Inc()
+}
+
+// ObserveEndToEnd records the time from enqueueing an event until it was
+// stored or failed.
+func (m *Metrics) ObserveEndToEnd(duration time.Duration) {
+	m.latencyWindow.add(int64(duration))
+}
+
+// ObserveBusy records the time a worker spent on a job.
+func (m *Metrics) ObserveBusy(duration time.Duration) {
+	m.busyWindow.add(int64(duration))
+}
+
+// SetBreakerState records the storage circuit breaker state, one of
+// "closed", "open" or "half_open".
+func (m *Metrics) SetBreakerState(state string) {
+	m.breaker.Store(state)
+	for _, known := range []string{"closed", "open", "half_open"} {
+		value := 0.0
+		if known == state {
+			value = 1
+		}
+		m.prometheus.breakerState.WithLabelValues(known).Set(value)
+	}
+}
+
+// AddBuffered tracks processed events waiting in the flush buffer. Negative n
+// removes flushed events.
+func (m *Metrics) AddBuffered(n int) {
+	m.buffered.Add(int64(n))
+	m.prometheus.buffered.Add(float64(n))
+}
+
+// SetWorkers reports the current size of the worker pool.
+func (m *Metrics) SetWorkers(n int) {
+	m.workers.Store(int64(n))
+	m.prometheus.workers.Set(float64(n))
+}
+
+// SetQueueDepth reports the number of jobs waiting for a worker.
+func (m *Metrics) SetQueueDepth(n int) {
+	m.queueDepth.Store(int64(n))
+	m.prometheus.queueDepth.Set(float64(n))
+}
+
+// Reset zeroes every counter except the gauges tracking live work, and moves
+// the since timestamp to now so callers can compute rates. Prometheus counters
+// are left untouched since scrapers expect them to be monotonic.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.received.Store(0)
+	m.validated.Store(0)
+	m.processed.Store(0)
+	m.stored.Store(0)
+	m.duplicates.Store(0)
+	m.contentDups.Store(0)
+	m.sampledOut.Store(0)
+	m.purged.Store(0)
+	m.spooled.Store(0)
+	m.rejected.Store(0)
+	m.failedValidate.Store(0)
+	m.failedProcess.Store(0)
+	m.failedStore.Store(0)
+	m.processLatency.reset()
+	m.storeLatency.reset()
+	m.since = time.Now().UTC()
+}
+
+func (m *Metrics) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	breaker, _ := m.breaker.Load().(string)
+	return Snapshot{
+		Since:       m.since,
+		Received:    m.received.Load(),
+		Validated:   m.validated.Load(),
+		Processed:   m.processed.Load(),
+		Stored:      m.stored.Load(),
+		Duplicates:  m.duplicates.Load(),
+		ContentDups: m.contentDups.Load(),
+		SampledOut:  m.sampledOut.Load(),
+		Purged:      m.purged.Load(),
+		Spooled:     m.spooled.Load(),
+		Rejected:    m.rejected.Load(),
+		Outstanding: m.outstanding.Load(),
+		Buffered:    m.buffered.Load(),
+		Workers:     m.workers.Load(),
+		Goroutines:  runtime.NumGoroutine(),
+		QueueDepth:  m.queueDepth.Load(),
+		Breaker:     breaker,
+		Failed: map[Stage]int64{
+			StageValidate: m.failedValidate.Load(),
+			StageProcess:  m.failedProcess.Load(),
+			StageStore:    m.failedStore.Load(),
+		},
+		Latency: map[Stage]LatencySnapshot{
+			StageProcess: m.processLatency.snapshot(),
+			StageStore:   m.storeLatency.snapshot(),
+		},
+	}
+}
+
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64
+}
+
+func newLatencyRecorder(size int) *latencyRecorder {
+	return &latencyRecorder{
+		samples: make([]time.Duration, 0, size),
+	}
+}
+
+func (r *latencyRecorder) observe(duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, duration)
+		return
+	}
+
+	r.samples[r.next] = duration
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+func (r *latencyRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples = r.samples[:0]
+	r.next = 0
+	r.count = 0
+}
+
+func (r *latencyRecorder) snapshot() LatencySnapshot {
+	r.mu.Lock()
+	sorted := make([]time.Duration, len(r.samples))
+	copy(sorted, r.samples)
+	count := r.count
+	r.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return LatencySnapshot{
+		Count: count,
+		P50Ms: percentileMs(sorted, 0.50),
+		P95Ms: percentileMs(sorted, 0.95),
+		P99Ms: percentileMs(sorted, 0.99),
+	}
+}
+
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	index := int(p*float64(len(sorted))+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+
+	return float64(sorted[index]) / float64(time.Millisecond)
+}
+
+// Stats are signals derived from the last minute of work, telling whether the
+// pipeline keeps up.
+type Stats struct {
+	// Window is the period the rates and averages cover, shorter than a
+	// minute right after startup.
+	Window string `json:"window"`
+	// IngestionRate is the events received per second.
+	IngestionRate float64 `json:"ingestion_rate"`
+	QueueDepth    int64   `json:"queue_depth"`
+	Outstanding   int64   `json:"outstanding"`
+	// AvgLatencyMs is the mean time from enqueueing an event until it was
+	// stored or failed.
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	Workers      int64   `json:"workers"`
+	// WorkerUtilization is the share of the workers' time spent on jobs,
+	// from 0 to 1, against the current pool size.
+	WorkerUtilization float64 `json:"worker_utilization"`
+}
+
+func (m *Metrics) Stats() Stats {
+	elapsed := min(time.Since(m.started), statsWindow)
+	received, _ := m.receivedWindow.totals()
+	completed, latency := m.latencyWindow.totals()
+	_, busy := m.busyWindow.totals()
+	workers := m.workers.Load()
+
+	stats := Stats{
+		Window:      elapsed.Round(time.Second).String(),
+		QueueDepth:  m.queueDepth.Load(),
+		Outstanding: m.outstanding.Load(),
+		Workers:     workers,
+	}
+	if elapsed > 0 {
+		stats.IngestionRate = float64(received) / elapsed.Seconds()
+	}
+	if completed > 0 {
+		stats.AvgLatencyMs = float64(latency) / float64(completed) / float64(time.Millisecond)
+	}
+	if workers > 0 && elapsed > 0 {
+		stats.WorkerUtilization = min(float64(busy)/(float64(workers)*float64(elapsed)), 1)
+	}
+
+	return stats
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// maxLabelValues caps the number of distinct values a label may take. Values
+// seen after the cap is reached are reported as otherLabelValue.
+const (
+	maxLabelValues  = 100
+	otherLabelValue = "other"
+)
+
+type prometheusMetrics struct {
+	registry          *prometheus.Registry
+	received          *prometheus.CounterVec
+	failed            *prometheus.CounterVec
+	rejected          prometheus.Counter
+	processDuration   prometheus.Histogram
+	storeDuration     prometheus.Histogram
+	apiKeyRequests    *prometheus.CounterVec
+	throttled         *prometheus.CounterVec
+	buffered          prometheus.Gauge
+	writeDuration     prometheus.Histogram
+	writtenRows       prometheus.Counter
+	writeErrors       prometheus.Counter
+	breakerState      *prometheus.GaugeVec
+	panics            prometheus.Counter
+	purged            prometheus.Counter
+	spooled           prometheus.Counter
+	workers           prometheus.Gauge
+	queueDepth        prometheus.Gauge
+	deliveries        *prometheus.CounterVec
+	contentDuplicates prometheus.Counter
+	sampledOut        *prometheus.CounterVec
+	goroutines        prometheus.GaugeFunc
+	statementTimeouts *prometheus.CounterVec
+	clients           *labelLimiter
+	sources           *labelLimiter
+	types             *labelLimiter
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	p := &prometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "events_received_total",
+			Help: "Total number of events received.",
+		}, []string{"source", "type"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "events_failed_total",
+			Help: "Total number of events that failed, by pipeline stage.",
+		}, []string{"stage"}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "events_rejected_total",
+			Help: "Total number of events rejected because the pipeline was full.",
+		}),
+		processDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "event_process_duration_seconds",
+			Help:    "Time spent processing a single event.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		storeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "event_store_duration_seconds",
+			Help:    "Time spent storing a single event.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		apiKeyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_key_requests_total",
+			Help: "Total number of authenticated requests, by API key name.",
+		}, []string{"api_key"}),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "requests_throttled_total",
+			Help: "Total number of requests rejected by the rate limiter, by client or \"global\".",
+		}, []string{"client"}),
+		buffered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "events_buffered",
+			Help: "Number of processed events waiting in the flush buffer.",
+		}),
+		writeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "storage_write_duration_seconds",
+			Help:    "Time spent executing a single INSERT statement.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		writtenRows: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "storage_write_rows_total",
+			Help: "Total number of events sent to the database in INSERT statements.",
+		}),
+		writeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "storage_write_errors_total",
+			Help: "Total number of INSERT statements that failed.",
+		}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "storage_circuit_breaker_state",
+			Help: "1 for the current state of the storage circuit breaker, 0 for the others.",
+		}, []string{"state"}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "panics_total",
+			Help: "Total number of panics recovered in HTTP handlers.",
+		}),
+		purged: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "events_purged_total",
+			Help: "Total number of events deleted by retention purges.",
+		}),
+		spooled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "events_spooled_total",
+			Help: "Total number of events written to the write-ahead log while the database was unreachable.",
+		}),
+		workers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pipeline_workers",
+			Help: "Number of workers in the pipeline pool.",
+		}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pipeline_queue_depth",
+			Help: "Number of events queued for a worker.",
+		}),
+		deliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sink_deliveries_total",
+			Help: "Total number of stored events forwarded to a sink, by sink and result.",
+		}, []string{"sink", "result"}),
+		contentDuplicates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "events_content_duplicates_total",
+			Help: "Total number of events skipped for repeating the content of a recently stored event.",
+		}),
+		sampledOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "events_sampled_out_total",
+			Help: "Total number of valid events dropped by the sampling rules.",
+		}, []string{"source", "type"}),
+		goroutines: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "goroutines_active",
+			Help: "Number of goroutines currently running, which keeps growing when they leak.",
+		}, func() float64 { return float64(runtime.NumGoroutine()) }),
+		statementTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "storage_statement_timeouts_total",
+			Help: "Total number of database statements cancelled for exceeding DB_STATEMENT_TIMEOUT, by operation.",
+		}, []string{"operation"}),
+		clients: newLabelLimiter(maxLabelValues),
+		sources: newLabelLimiter(maxLabelValues),
+		types:   newLabelLimiter(maxLabelValues),
+	}
+
+	p.registry.MustRegister(p.received, p.failed, p.rejected, p.processDuration, p.storeDuration, p.apiKeyRequests, p.throttled, p.buffered,
+		p.writeDuration, p.writtenRows, p.writeErrors, p.breakerState, p.panics,
+		p.workers, p.queueDepth, p.purged, p.spooled, p.deliveries, p.contentDuplicates, p.sampledOut, p.goroutines, p.statementTimeouts)
+
+	return p
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.prometheus.registry, promhttp.HandlerOpts{})
+}
+
+type labelLimiter struct {
+	mu     sync.Mutex
+	max    int
+	values map[string]struct{}
+}
+
+func newLabelLimiter(max int) *labelLimiter {
+	return &labelLimiter{
+		max:    max,
+		values: make(map[string]struct{}),
+	}
+}
+
+func (l *labelLimiter) value(value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.values[value]; ok {
+		return value
+	}
+
+	if len(l.values) >= l.max {
+		return otherLabelValue
+	}
+
+	l.values[value] = struct{}{}
+	return value
+}
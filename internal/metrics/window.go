@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// statsWindow is the period Stats derives its rates and averages from.
+const statsWindow = time.Minute
+
+// window sums observations into one bucket per second over a rolling period,
+// so old observations age out without being stored one by one. It is safe
+// for concurrent use.
+type window struct {
+	mu      sync.Mutex
+	buckets []windowBucket
+	now     func() time.Time
+}
+
+type windowBucket struct {
+	second int64
+	count  int64
+	sum    int64
+}
+
+func newWindow(period time.Duration) *window {
+	return &window{
+		buckets: make([]windowBucket, int(period/time.Second)),
+		now:     time.Now,
+	}
+}
+
+// add records an observation of value.
+func (w *window) add(value int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	second := w.now().Unix()
+	bucket := &w.buckets[second%int64(len(w.buckets))]
+	if bucket.second != second {
+		*bucket = windowBucket{second: second}
+	}
+	bucket.count++
+	bucket.sum += value
+}
+
+// totals returns the number and sum of the observations within the period.
+func (w *window) totals() (count, sum int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	oldest := w.now().Unix() - int64(len(w.buckets)) + 1
+	for _, bucket := range w.buckets {
+		if bucket.second >= oldest {
+			count += bucket.count
+			sum += bucket.sum
+		}
+	}
+
+	return count, sum
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowTotals(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		offsets   []time.Duration
+		at        time.Duration
+		wantCount int64
+		wantSum   int64
+	}{
+		{name: "empty"},
+		{name: "same second", offsets: []time.Duration{0, 100 * time.Millisecond, 900 * time.Millisecond}, wantCount: 3, wantSum: 3},
+		{name: "spread over the period", offsets: []time.Duration{0, 30 * time.Second, 59 * time.Second}, at: 59 * time.Second, wantCount: 3, wantSum: 3},
+		{name: "oldest aged out", offsets: []time.Duration{0, 30 * time.Second, 59 * time.Second}, at: 60 * time.Second, wantCount: 2, wantSum: 2},
+		{name: "all aged out", offsets: []time.Duration{0, time.Second}, at: 10 * time.Minute},
+		{name: "bucket reused after a full period", offsets: []time.Duration{0, time.Minute}, at: time.Minute, wantCount: 1, wantSum: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWindow(statsWindow)
+			for _, offset := range tt.offsets {
+				w.now = func() time.Time { return start.Add(offset) }
+				w.add(1)
+			}
+
+			w.now = func() time.Time { return start.Add(tt.at) }
+			if count, sum := w.totals(); count != tt.wantCount || sum != tt.wantSum {
+				t.Errorf("totals = %d, %d; want %d, %d", count, sum, tt.wantCount, tt.wantSum)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Package migrations applies the embedded SQL schema migrations. Each driver
+// has its own directory of NNNN_name.up.sql and NNNN_name.down.sql files,
+// applied in version order and recorded in the schema_migrations table.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed mysql/*.sql postgres/*.sql
+var files embed.FS
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL
+)`
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// Up applies every migration newer than the current schema version and
+// returns how many were applied.
+func Up(db *sqlx.DB) (int, error) {
+	migrations, err := load(db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if err := apply(db, m.up); err != nil {
+			return count, fmt.Errorf("apply migration %d %s: %w", m.version, m.name, err)
+		}
+		if _, err := db.Exec(db.Rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), m.version, time.Now().UTC()); err != nil {
+			return count, fmt.Errorf("record migration %d: %w", m.version, err)
+		}
+
+		slog.Info("Applied migration", "version", m.version, "name", m.name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the latest steps applied migrations and returns how many were
+// reverted.
+func Down(db *sqlx.DB, steps int) (int, error) {
+	migrations, err := load(db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if !applied[m.version] {
+			continue
+		}
+
+		if err := apply(db, m.down); err != nil {
+			return count, fmt.Errorf("revert migration %d %s: %w", m.version, m.name, err)
+		}
+		if _, err := db.Exec(db.Rebind("DELETE FROM schema_migrations WHERE version = ?"), m.version); err != nil {
+			return count, fmt.Errorf("unrecord migration %d: %w", m.version, err)
+		}
+
+		slog.Info("Reverted migration", "version", m.version, "name", m.name)
+		count++
+	}
+
+	return count, nil
+}
+
+func appliedVersions(db *sqlx.DB) (map[int64]bool, error) {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var versions []int64
+	if err := db.Select(&versions, "SELECT version FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	return applied, nil
+}
+
+// apply runs the statements of a migration file one by one, since the MySQL
+// driver rejects multi-statement queries by default.
+func apply(db *sqlx.DB, script string) error {
+	for _, statement := range strings.Split(script, ";") {
+		if statement = strings.TrimSpace(statement); statement == "" {
+			continue
+		}
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load reads the migrations of driver sorted by version.
+func load(driver string) ([]migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		prefix, title, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has no numeric version", name)
+		}
+
+		content, err := files.ReadFile(path.Join(driver, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return migrations, nil
+}
@@ -0,0 +1,154 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB is a database/sql driver that records the statements it runs and
+// keeps the versions of schema_migrations apart from them, for testing migrations without a
+// database.
+type fakeDB struct {
+	statements []string
+	versions   []int64
+}
+
+func newFakeDB(t *testing.T, driverName string) (*sqlx.DB, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{}
+	db := sqlx.NewDb(sql.OpenDB(fake), driverName)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch {
+	case query == createMigrationsTable:
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		c.db.versions = append(c.db.versions, args[0].Value.(int64))
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		c.db.versions = slices.DeleteFunc(c.db.versions, func(v int64) bool { return v == args[0].Value.(int64) })
+	default:
+		c.db.statements = append(c.db.statements, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if query != "SELECT version FROM schema_migrations" {
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	return &versionRows{versions: slices.Clone(c.db.versions)}, nil
+}
+
+type versionRows struct{ versions []int64 }
+
+func (r *versionRows) Columns() []string { return []string{"version"} }
+func (r *versionRows) Close() error      { return nil }
+
+func (r *versionRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0], r.versions = r.versions[0], r.versions[1:]
+	return nil
+}
+
+func TestUpCreatesSchema(t *testing.T) {
+	// The columns the repositories read and write.
+	columns := map[string][]string{
+		"events":       {"id", "type", "source", "timestamp", "user_id", "action", "value", "value_int", "metadata", "schema_version", "tenant_id"},
+		"dead_letters": {"id", "event_id", "stage", "error", "payload", "created_at"},
+	}
+
+	for _, driverName := range []string{"mysql", "postgres"} {
+		t.Run(driverName, func(t *testing.T) {
+			db, fake := newFakeDB(t, driverName)
+
+			applied, err := Up(db)
+			if err != nil {
+				t.Fatalf("Up: %v", err)
+			}
+			if applied != 6 || fmt.Sprint(fake.versions) != "[1 2 3 4 5 6]" {
+				t.Fatalf("applied %d migrations recording %v, want 6", applied, fake.versions)
+			}
+
+			schema := strings.Join(fake.statements, ";\n")
+			for table, names := range columns {
+				if !strings.Contains(schema, "CREATE TABLE IF NOT EXISTS "+table+" (") {
+					t.Errorf("no CREATE TABLE for %s", table)
+				}
+				for _, name := range names {
+					if !strings.Contains(schema, "\n    "+name+" ") && !strings.Contains(schema, "COLUMN "+name+" ") {
+						t.Errorf("column %s.%s is never created", table, name)
+					}
+				}
+			}
+
+			if applied, err := Up(db); err != nil || applied != 0 {
+				t.Errorf("second Up = %d, %v; want nothing applied", applied, err)
+			}
+		})
+	}
+}
+
+func TestDownRevertsLatest(t *testing.T) {
+	db, fake := newFakeDB(t, "mysql")
+	if _, err := Up(db); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	fake.statements = nil
+
+	reverted, err := Down(db, 2)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if reverted != 2 || fmt.Sprint(fake.versions) != "[1 2 3 4]" {
+		t.Errorf("reverted %d leaving %v, want 2 leaving [1 2 3 4]", reverted, fake.versions)
+	}
+	if len(fake.statements) == 0 || !strings.Contains(fake.statements[0], "idx_events_tenant_timestamp") {
+		t.Errorf("first statement %q, want the tenant migration reverted first", fake.statements)
+	}
+}
+
+func TestLoadPairsMigrations(t *testing.T) {
+	var versions [2][]int64
+	for i, driverName := range []string{"mysql", "postgres"} {
+		migrations, err := load(driverName)
+		if err != nil {
+			t.Fatalf("load(%s): %v", driverName, err)
+		}
+		for _, m := range migrations {
+			if m.up == "" || m.down == "" {
+				t.Errorf("%s migration %d %s lacks an up or down script", driverName, m.version, m.name)
+			}
+			versions[i] = append(versions[i], m.version)
+		}
+	}
+
+	// Both drivers must reach the same schema version.
+	if !slices.Equal(versions[0], versions[1]) {
+		t.Errorf("mysql versions %v, postgres versions %v", versions[0], versions[1])
+	}
+	if _, err := load("sqlite"); err == nil {
+		t.Error("load(sqlite) found migrations")
+	}
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS events (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    source VARCHAR(100) NOT NULL,
+    timestamp DATETIME(6) NOT NULL,
+    user_id VARCHAR(255) NULL,
+    action VARCHAR(255) NOT NULL DEFAULT '',
+    value FLOAT NOT NULL DEFAULT 0,
+    metadata JSON NULL,
+
+    INDEX idx_events_timestamp (timestamp),
+    INDEX idx_events_type_timestamp (type, timestamp),
+    INDEX idx_events_source_timestamp (source, timestamp),
+    INDEX idx_events_user_timestamp (user_id, timestamp)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(255) NULL,
+    stage VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP(3) NOT NULL,
+
+    INDEX idx_dead_letters_event_id (event_id)
+);
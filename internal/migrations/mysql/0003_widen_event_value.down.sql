@@ -0,0 +1 @@
+ALTER TABLE events MODIFY value FLOAT NOT NULL DEFAULT 0;
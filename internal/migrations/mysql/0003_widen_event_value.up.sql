@@ -0,0 +1 @@
+ALTER TABLE events MODIFY value DOUBLE NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN value_int BIGINT NULL;
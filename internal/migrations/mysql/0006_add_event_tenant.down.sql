@@ -0,0 +1,2 @@
+DROP INDEX idx_events_tenant_timestamp ON events;
+ALTER TABLE events DROP COLUMN tenant_id;
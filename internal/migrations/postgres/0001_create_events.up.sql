@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS events (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    source VARCHAR(100) NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    user_id VARCHAR(255) NULL,
+    action VARCHAR(255) NOT NULL DEFAULT '',
+    value REAL NOT NULL DEFAULT 0,
+    metadata JSONB NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events (timestamp);
+CREATE INDEX IF NOT EXISTS idx_events_type_timestamp ON events (type, timestamp);
+CREATE INDEX IF NOT EXISTS idx_events_source_timestamp ON events (source, timestamp);
+CREATE INDEX IF NOT EXISTS idx_events_user_timestamp ON events (user_id, timestamp);
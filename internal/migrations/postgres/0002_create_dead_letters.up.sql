@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(255) NULL,
+    stage VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ(3) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_event_id ON dead_letters (event_id);
@@ -0,0 +1 @@
+ALTER TABLE events ALTER COLUMN value TYPE REAL;
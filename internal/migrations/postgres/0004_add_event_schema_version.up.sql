@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN schema_version INT NOT NULL DEFAULT 1;
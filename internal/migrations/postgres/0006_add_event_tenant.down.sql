@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_events_tenant_timestamp;
+ALTER TABLE events DROP COLUMN tenant_id;
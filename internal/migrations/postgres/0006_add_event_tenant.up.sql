@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_events_tenant_timestamp ON events (tenant_id, timestamp);
@@ -0,0 +1,898 @@
+// Package openapi builds an OpenAPI 3.0 document from annotations in the doc
+// comments of a Go package and its subpackages, so the document is kept next
+// to the handlers it describes.
+//
+// Annotations are doc comment lines starting with @. Prose comes first; from
+// the first annotation on, a line not starting with @ continues the previous
+// annotation and an empty line ends it. The first annotation of a comment
+// decides what the comment declares:
+//
+//	@Title            the document info: @Version, @Description, @Security
+//	                  and @SecurityScheme
+//	@Router           an operation, see below
+//	@Schema           a schema under components/schemas
+//	@Parameter        parameters under components/parameters
+//	@Response         responses under components/responses
+//
+// An operation is declared by one or more @Router lines, "METHOD PATH
+// operationId", and described by:
+//
+//	@Summary text
+//	@Description text
+//	@Security none                      served without authentication
+//	@Param ref...                       shared parameters by name
+//	@Param name in schema [required] description
+//	@Accept content-type schema [description]
+//	@Success status schema [meta=schema] description
+//	@Produce status content-type schema [description]
+//	@Header status name schema [description]
+//	@Failure status...                  shared responses by status
+//
+// @Success responses are JSON wrapped in the response envelope, with the
+// schema under data and the optional meta schema under meta; @Produce
+// responses are sent as is.
+//
+// A schema is either given on the @Schema line, "@Schema Name schema", or
+// built from "@Property name schema [description]" lines, where a dotted name
+// declares a property of a nested object, "@Required name..." and "@Closed".
+//
+// Shared parameters are declared as "@Parameter ref name in schema
+// description" and shared responses as "@Response Name status schema
+// description", with a schema of - for responses without a body and
+// "@Header name schema description" adding a header to the last response.
+//
+// Schemas are written without spaces:
+//
+//	string integer number boolean         primitive types
+//	date-time binary                      strings in that format
+//	object                                an object of any properties
+//	Name                                  a reference to a declared schema
+//	[]S                                   an array of S
+//	map[string]S                          an object of S values
+//	{a:S,b!:S}                            an object, ! marks required properties
+//	S|T S&T                               oneOf and allOf, inside []S and
+//	                                      map[string]S: []S|T is an array of
+//	                                      S|T
+//	S(nullable;enum=a,b;default=a;min=1;max=9;format=f;open;closed)
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the generated document.
+const Version = "3.0.3"
+
+// object is a JSON object of the document. encoding/json writes its keys
+// sorted, which keeps the output stable.
+type object = map[string]any
+
+// document collects the annotations of a package.
+type document struct {
+	info       object
+	security   []any
+	schemes    object
+	paths      map[string]object
+	schemas    object
+	parameters object
+	responses  object
+	// statuses maps the status of each shared response to its name, for
+	// @Failure.
+	statuses map[string]string
+	// failures lists the @Failure responses, resolved once all shared
+	// responses are declared.
+	failures []failure
+	// refs lists every reference made, checked once all are declared.
+	refs []reference
+}
+
+type reference struct {
+	kind, name, at string
+}
+
+type failure struct {
+	a         annotation
+	responses object
+	status    string
+}
+
+// annotation is one @ line of a doc comment with its continuation lines.
+type annotation struct {
+	key  string
+	args string
+	pos  token.Position
+}
+
+func (a annotation) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: @%s: %s", a.pos, a.key, fmt.Sprintf(format, args...))
+}
+
+// Generate returns the OpenAPI document annotated in the non-test Go files of
+// dir and its subdirectories, indented and ending with a newline.
+func Generate(dir string) ([]byte, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	doc := &document{
+		info:       object{},
+		schemes:    object{},
+		paths:      map[string]object{},
+		schemas:    object{},
+		parameters: object{},
+		responses:  object{},
+		statuses:   map[string]string{},
+	}
+
+	fset := token.NewFileSet()
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, filepath.ToSlash(name), src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range docComments(file) {
+			if err := doc.add(annotations(fset, comment)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return doc.encode()
+}
+
+// docComments returns the doc comments of the declarations of file.
+func docComments(file *ast.File) []*ast.CommentGroup {
+	var comments []*ast.CommentGroup
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			comments = append(comments, decl.Doc)
+		case *ast.GenDecl:
+			comments = append(comments, decl.Doc)
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					comments = append(comments, spec.Doc)
+				case *ast.ValueSpec:
+					comments = append(comments, spec.Doc)
+				}
+			}
+		}
+	}
+	return comments
+}
+
+// annotations splits the annotations out of a doc comment.
+func annotations(fset *token.FileSet, comment *ast.CommentGroup) []annotation {
+	if comment == nil {
+		return nil
+	}
+
+	var result []annotation
+	open := false
+	for _, c := range comment.List {
+		line := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		switch {
+		case strings.HasPrefix(line, "@"):
+			key, args, _ := strings.Cut(line[1:], " ")
+			result = append(result, annotation{key: key, args: strings.TrimSpace(args), pos: fset.Position(c.Pos())})
+			open = true
+		case line == "":
+			open = false
+		case open:
+			last := &result[len(result)-1]
+			last.args = strings.TrimSpace(last.args + " " + line)
+		}
+	}
+	return result
+}
+
+// add records the declaration made by the annotations of one doc comment.
+func (d *document) add(annotations []annotation) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	switch first := annotations[0]; first.key {
+	case "Title":
+		return d.addInfo(annotations)
+	case "Router":
+		return d.addOperation(annotations)
+	case "Schema":
+		return d.addSchema(annotations)
+	case "Parameter":
+		return d.addParameters(annotations)
+	case "Response":
+		return d.addResponses(annotations)
+	default:
+		return first.errorf("a doc comment must start with @Title, @Router, @Schema, @Parameter or @Response")
+	}
+}
+
+func (d *document) addInfo(annotations []annotation) error {
+	for _, a := range annotations {
+		switch a.key {
+		case "Title":
+			d.info["title"] = a.args
+		case "Version":
+			d.info["version"] = a.args
+		case "Description":
+			d.info["description"] = a.args
+		case "Security":
+			for _, name := range strings.Fields(a.args) {
+				d.security = append(d.security, object{name: []string{}})
+				d.refs = append(d.refs, reference{kind: "securitySchemes", name: name, at: a.pos.String()})
+			}
+		case "SecurityScheme":
+			name, scheme, err := securityScheme(a)
+			if err != nil {
+				return err
+			}
+			d.schemes[name] = scheme
+		default:
+			return a.errorf("not allowed in the @Title comment")
+		}
+	}
+	return nil
+}
+
+// securityScheme parses "name http scheme" or "name apiKey in header
+// [description]".
+func securityScheme(a annotation) (string, object, error) {
+	fields := strings.Fields(a.args)
+	switch {
+	case len(fields) == 3 && fields[1] == "http":
+		return fields[0], object{"type": "http", "scheme": fields[2]}, nil
+	case len(fields) >= 4 && fields[1] == "apiKey":
+		scheme := object{"type": "apiKey", "in": fields[2], "name": fields[3]}
+		if description := strings.Join(fields[4:], " "); description != "" {
+			scheme["description"] = description
+		}
+		return fields[0], scheme, nil
+	default:
+		return "", nil, a.errorf("expected \"name http scheme\" or \"name apiKey in header [description]\"")
+	}
+}
+
+func (d *document) addOperation(annotations []annotation) error {
+	type route struct{ method, path, id string }
+	var routes []route
+	operation := object{}
+	var parameters []any
+	responses := object{}
+	var bodies object
+
+	for _, a := range annotations {
+		fields := strings.Fields(a.args)
+		switch a.key {
+		case "Router":
+			if len(fields) != 3 {
+				return a.errorf("expected \"METHOD PATH operationId\"")
+			}
+			routes = append(routes, route{method: strings.ToLower(fields[0]), path: fields[1], id: fields[2]})
+		case "Summary":
+			operation["summary"] = a.args
+		case "Description":
+			operation["description"] = a.args
+		case "Security":
+			if a.args != "none" {
+				return a.errorf("only none is supported")
+			}
+			operation["security"] = []any{}
+		case "Param":
+			if len(fields) >= 3 && isParameterLocation(fields[1]) {
+				parameter, err := d.parameter(a, fields)
+				if err != nil {
+					return err
+				}
+				parameters = append(parameters, parameter)
+				continue
+			}
+			for _, name := range fields {
+				parameters = append(parameters, d.ref(a, "parameters", name))
+			}
+		case "Accept":
+			if len(fields) < 2 {
+				return a.errorf("expected \"content-type schema [description]\"")
+			}
+			schema, err := d.schema(a, fields[1])
+			if err != nil {
+				return err
+			}
+			if description := strings.Join(fields[2:], " "); description != "" {
+				schema["description"] = description
+			}
+			if bodies == nil {
+				bodies = object{}
+			}
+			bodies[fields[0]] = object{"schema": schema}
+		case "Success":
+			if len(fields) < 2 {
+				return a.errorf("expected \"status schema [meta=schema] description\"")
+			}
+			data, err := d.schema(a, fields[1])
+			if err != nil {
+				return err
+			}
+			properties := object{"data": data}
+			rest := fields[2:]
+			if len(rest) > 0 && strings.HasPrefix(rest[0], "meta=") {
+				meta, err := d.schema(a, strings.TrimPrefix(rest[0], "meta="))
+				if err != nil {
+					return err
+				}
+				properties["meta"] = meta
+				rest = rest[1:]
+			}
+			envelope := object{"type": "object", "properties": properties}
+			if err := addContent(a, responses, fields[0], "application/json", envelope, rest); err != nil {
+				return err
+			}
+		case "Produce":
+			if len(fields) < 3 {
+				return a.errorf("expected \"status content-type schema [description]\"")
+			}
+			schema, err := d.schema(a, fields[2])
+			if err != nil {
+				return err
+			}
+			if err := addContent(a, responses, fields[0], fields[1], schema, fields[3:]); err != nil {
+				return err
+			}
+		case "Header":
+			if len(fields) < 3 {
+				return a.errorf("expected \"status name schema [description]\"")
+			}
+			response, ok := responses[fields[0]].(object)
+			if !ok {
+				return a.errorf("no %s response declared before the header", fields[0])
+			}
+			if err := d.addHeader(a, response, fields[1:]); err != nil {
+				return err
+			}
+		case "Failure":
+			if len(fields) == 0 {
+				return a.errorf("expected statuses")
+			}
+			for _, status := range fields {
+				d.failures = append(d.failures, failure{a: a, responses: responses, status: status})
+			}
+		default:
+			return a.errorf("not allowed in an @Router comment")
+		}
+	}
+
+	if len(routes) == 0 {
+		return annotations[0].errorf("missing @Router")
+	}
+	if len(responses) == 0 && !slices.ContainsFunc(annotations, func(a annotation) bool { return a.key == "Failure" }) {
+		return annotations[0].errorf("no responses declared")
+	}
+	if parameters != nil {
+		operation["parameters"] = parameters
+	}
+	if bodies != nil {
+		operation["requestBody"] = object{"required": true, "content": bodies}
+	}
+	operation["responses"] = responses
+
+	for _, r := range routes {
+		operations := d.paths[r.path]
+		if operations == nil {
+			operations = object{}
+			d.paths[r.path] = operations
+		}
+		if _, ok := operations[r.method]; ok {
+			return annotations[0].errorf("%s %s declared twice", strings.ToUpper(r.method), r.path)
+		}
+
+		op := object{"operationId": r.id}
+		for key, value := range operation {
+			op[key] = value
+		}
+		operations[r.method] = op
+	}
+	return nil
+}
+
+// addContent adds a content type to the response for status, declaring the
+// response with the description in words if this is its first content type.
+func addContent(a annotation, responses object, status, contentType string, schema object, words []string) error {
+	if _, err := strconv.Atoi(status); err != nil {
+		return a.errorf("invalid status %q", status)
+	}
+
+	response, ok := responses[status].(object)
+	if !ok {
+		if len(words) == 0 {
+			return a.errorf("the first content of the %s response needs a description", status)
+		}
+		response = object{"description": strings.Join(words, " "), "content": object{}}
+		responses[status] = response
+	}
+	response["content"].(object)[contentType] = object{"schema": schema}
+	return nil
+}
+
+// addHeader adds the header "name schema [description]" in fields to
+// response.
+func (d *document) addHeader(a annotation, response object, fields []string) error {
+	schema, err := d.schema(a, fields[1])
+	if err != nil {
+		return err
+	}
+	header := object{"schema": schema}
+	if description := strings.Join(fields[2:], " "); description != "" {
+		header["description"] = description
+	}
+
+	headers, _ := response["headers"].(object)
+	if headers == nil {
+		headers = object{}
+		response["headers"] = headers
+	}
+	headers[fields[0]] = header
+	return nil
+}
+
+func isParameterLocation(in string) bool {
+	switch in {
+	case "query", "header", "path", "cookie":
+		return true
+	default:
+		return false
+	}
+}
+
+// parameter parses "name in schema [required] description" in fields. Path
+// parameters are always required.
+func (d *document) parameter(a annotation, fields []string) (object, error) {
+	schema, err := d.schema(a, fields[2])
+	if err != nil {
+		return nil, err
+	}
+	parameter := object{"name": fields[0], "in": fields[1], "schema": schema}
+
+	rest := fields[3:]
+	if len(rest) > 0 && rest[0] == "required" {
+		rest = rest[1:]
+		parameter["required"] = true
+	}
+	if fields[1] == "path" {
+		parameter["required"] = true
+	}
+	if description := strings.Join(rest, " "); description != "" {
+		parameter["description"] = description
+	}
+	return parameter, nil
+}
+
+func (d *document) addParameters(annotations []annotation) error {
+	for _, a := range annotations {
+		fields := strings.Fields(a.args)
+		if a.key != "Parameter" || len(fields) < 4 || !isParameterLocation(fields[2]) {
+			return a.errorf("expected \"@Parameter ref name in schema description\"")
+		}
+		if _, ok := d.parameters[fields[0]]; ok {
+			return a.errorf("parameter %s declared twice", fields[0])
+		}
+
+		parameter, err := d.parameter(a, fields[1:])
+		if err != nil {
+			return err
+		}
+		d.parameters[fields[0]] = parameter
+	}
+	return nil
+}
+
+func (d *document) addResponses(annotations []annotation) error {
+	var last object
+	for _, a := range annotations {
+		fields := strings.Fields(a.args)
+		switch a.key {
+		case "Response":
+			if len(fields) < 4 {
+				return a.errorf("expected \"Name status schema description\"")
+			}
+			name, status := fields[0], fields[1]
+			if _, ok := d.responses[name]; ok {
+				return a.errorf("response %s declared twice", name)
+			}
+			if other, ok := d.statuses[status]; ok {
+				return a.errorf("status %s already used by response %s", status, other)
+			}
+
+			last = object{"description": strings.Join(fields[3:], " ")}
+			if fields[2] != "-" {
+				schema, err := d.schema(a, fields[2])
+				if err != nil {
+					return err
+				}
+				last["content"] = object{"application/json": object{"schema": schema}}
+			}
+			d.responses[name] = last
+			d.statuses[status] = name
+		case "Header":
+			if last == nil || len(fields) < 2 {
+				return a.errorf("expected \"name schema description\" after an @Response")
+			}
+			if err := d.addHeader(a, last, fields); err != nil {
+				return err
+			}
+		default:
+			return a.errorf("not allowed in an @Response comment")
+		}
+	}
+	return nil
+}
+
+func (d *document) addSchema(annotations []annotation) error {
+	head := annotations[0]
+	fields := strings.Fields(head.args)
+	if len(fields) == 0 {
+		return head.errorf("missing the schema name")
+	}
+	name := fields[0]
+	if _, ok := d.schemas[name]; ok {
+		return head.errorf("schema %s declared twice", name)
+	}
+
+	if len(fields) > 1 {
+		if len(annotations) > 1 {
+			return annotations[1].errorf("not allowed after a schema given on the @Schema line")
+		}
+		schema, err := d.schema(head, fields[1])
+		if err != nil {
+			return err
+		}
+		if description := strings.Join(fields[2:], " "); description != "" {
+			schema["description"] = description
+		}
+		d.schemas[name] = schema
+		return nil
+	}
+
+	schema := object{"type": "object", "properties": object{}}
+	for _, a := range annotations[1:] {
+		fields := strings.Fields(a.args)
+		switch a.key {
+		case "Property":
+			if len(fields) < 2 {
+				return a.errorf("expected \"name schema [description]\"")
+			}
+			property, err := d.schema(a, fields[1])
+			if err != nil {
+				return err
+			}
+			if description := strings.Join(fields[2:], " "); description != "" {
+				property["description"] = description
+			}
+			parent, key, err := nested(a, schema, fields[0])
+			if err != nil {
+				return err
+			}
+			parent["properties"].(object)[key] = property
+		case "Required":
+			for _, field := range fields {
+				parent, key, err := nested(a, schema, field)
+				if err != nil {
+					return err
+				}
+				required, _ := parent["required"].([]string)
+				parent["required"] = append(required, key)
+			}
+		case "Closed":
+			schema["additionalProperties"] = false
+		default:
+			return a.errorf("not allowed in an @Schema comment")
+		}
+	}
+	d.schemas[name] = schema
+	return nil
+}
+
+// nested returns the object holding the property at the dotted path and the
+// last name of the path. The objects on the way must have been declared by
+// earlier @Property lines.
+func nested(a annotation, schema object, path string) (object, string, error) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		properties, _ := schema["properties"].(object)
+		child, ok := properties[name].(object)
+		if !ok {
+			return nil, "", a.errorf("property %s of %s is not declared", name, path)
+		}
+		if child["properties"] == nil {
+			child["properties"] = object{}
+		}
+		schema = child
+	}
+	return schema, names[len(names)-1], nil
+}
+
+// ref returns a reference to a component, checked once the whole package is
+// read.
+func (d *document) ref(a annotation, kind, name string) object {
+	d.refs = append(d.refs, reference{kind: kind, name: name, at: a.pos.String()})
+	return object{"$ref": "#/components/" + kind + "/" + name}
+}
+
+// schema parses a schema expression, see the package doc.
+func (d *document) schema(a annotation, expr string) (object, error) {
+	schema, err := d.parseSchema(a, expr)
+	if err != nil {
+		return nil, a.errorf("schema %q: %v", expr, err)
+	}
+	return schema, nil
+}
+
+func (d *document) parseSchema(a annotation, expr string) (object, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty schema")
+	}
+	if rest, ok := strings.CutPrefix(expr, "[]"); ok {
+		items, err := d.parseSchema(a, rest)
+		if err != nil {
+			return nil, err
+		}
+		return object{"type": "array", "items": items}, nil
+	}
+	if rest, ok := strings.CutPrefix(expr, "map[string]"); ok {
+		values, err := d.parseSchema(a, rest)
+		if err != nil {
+			return nil, err
+		}
+		return object{"type": "object", "additionalProperties": values}, nil
+	}
+
+	if parts := splitTop(expr, '|'); len(parts) > 1 {
+		return d.combine(a, "oneOf", parts)
+	}
+	if parts := splitTop(expr, '&'); len(parts) > 1 {
+		return d.combine(a, "allOf", parts)
+	}
+
+	base, options, err := cutOptions(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema object
+	switch {
+	case strings.HasPrefix(base, "{"):
+		if !strings.HasSuffix(base, "}") {
+			return nil, fmt.Errorf("unclosed {")
+		}
+		schema, err = d.objectSchema(a, base[1:len(base)-1])
+		if err != nil {
+			return nil, err
+		}
+	case base == "string", base == "integer", base == "number", base == "boolean":
+		schema = object{"type": base}
+	case base == "date-time", base == "binary":
+		schema = object{"type": "string", "format": base}
+	case base == "object":
+		schema = object{"type": "object", "additionalProperties": true}
+	case base != "" && base[0] >= 'A' && base[0] <= 'Z':
+		if len(options) > 0 {
+			return nil, fmt.Errorf("a reference takes no options")
+		}
+		return d.ref(a, "schemas", base), nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", base)
+	}
+
+	for _, option := range options {
+		if err := applyOption(schema, option); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+func (d *document) combine(a annotation, keyword string, parts []string) (object, error) {
+	schemas := make([]any, 0, len(parts))
+	for _, part := range parts {
+		schema, err := d.parseSchema(a, part)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return object{keyword: schemas}, nil
+}
+
+// objectSchema parses the a:S,b!:S properties of an inline object.
+func (d *document) objectSchema(a annotation, fields string) (object, error) {
+	properties := object{}
+	var required []string
+	for _, field := range splitTop(fields, ',') {
+		if field == "" && fields == "" {
+			break
+		}
+		name, expr, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("property %q has no schema", field)
+		}
+		if trimmed, ok := strings.CutSuffix(name, "!"); ok {
+			name = trimmed
+			required = append(required, name)
+		}
+		property, err := d.parseSchema(a, expr)
+		if err != nil {
+			return nil, err
+		}
+		properties[name] = property
+	}
+
+	schema := object{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// cutOptions splits "base(a;b=c)" into base and its options.
+func cutOptions(expr string) (string, []string, error) {
+	if !strings.HasSuffix(expr, ")") {
+		return expr, nil, nil
+	}
+	depth := 0
+	for i := len(expr) - 1; i >= 0; i-- {
+		switch expr[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				return expr[:i], strings.Split(expr[i+1:len(expr)-1], ";"), nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("unbalanced parentheses")
+}
+
+func applyOption(schema object, option string) error {
+	key, value, hasValue := strings.Cut(option, "=")
+	switch {
+	case key == "nullable" && !hasValue:
+		schema["nullable"] = true
+	case key == "open" && !hasValue:
+		schema["additionalProperties"] = true
+	case key == "closed" && !hasValue:
+		schema["additionalProperties"] = false
+	case key == "format" && hasValue:
+		schema["format"] = value
+	case key == "enum" && hasValue:
+		var values []any
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, literal(schema, v))
+		}
+		schema["enum"] = values
+	case key == "default" && hasValue:
+		schema["default"] = literal(schema, value)
+	case (key == "min" || key == "max") && hasValue:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		schema[map[string]string{"min": "minimum", "max": "maximum"}[key]] = n
+	default:
+		return fmt.Errorf("unknown option %q", option)
+	}
+	return nil
+}
+
+// literal reads an enum or default value as the type of schema.
+func literal(schema object, value string) any {
+	switch schema["type"] {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// splitTop splits s at the separators outside of brackets and parentheses.
+func splitTop(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// encode resolves the @Failure responses, checks the references and writes
+// the document.
+func (d *document) encode() ([]byte, error) {
+	if d.info["title"] == nil || d.info["version"] == nil {
+		return nil, fmt.Errorf("missing @Title or @Version")
+	}
+
+	for _, f := range d.failures {
+		name, ok := d.statuses[f.status]
+		if !ok {
+			return nil, f.a.errorf("no shared response declared for status %s", f.status)
+		}
+		if _, ok := f.responses[f.status]; ok {
+			return nil, f.a.errorf("response %s declared twice", f.status)
+		}
+		f.responses[f.status] = d.ref(f.a, "responses", name)
+	}
+
+	components := object{
+		"securitySchemes": d.schemes,
+		"schemas":         d.schemas,
+		"parameters":      d.parameters,
+		"responses":       d.responses,
+	}
+	for _, ref := range d.refs {
+		if _, ok := components[ref.kind].(object)[ref.name]; !ok {
+			return nil, fmt.Errorf("%s: %s %s is not declared", ref.at, ref.kind, ref.name)
+		}
+	}
+
+	spec := object{
+		"openapi":    Version,
+		"info":       d.info,
+		"paths":      d.paths,
+		"components": components,
+	}
+	if d.security != nil {
+		spec["security"] = d.security
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(spec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,209 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// header declares what every generated document needs.
+const header = `package p
+
+// @Title Test
+// @Version 1.0.0
+var info int
+
+// @Schema Thing
+// @Property name string
+var thing int
+
+// @Response BadRequest 400 object Invalid request
+var responses int
+`
+
+// generate writes src to a file of a temporary package and returns the
+// document generated from it.
+func generate(t *testing.T, src string) (map[string]any, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(header+src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Generate(dir)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("generated document is not JSON: %v", err)
+	}
+	return spec, nil
+}
+
+func TestSchemaExpressions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "string", want: `{"type":"string"}`},
+		{expr: "date-time", want: `{"type":"string","format":"date-time"}`},
+		{expr: "object", want: `{"type":"object","additionalProperties":true}`},
+		{expr: "Thing", want: `{"$ref":"#/components/schemas/Thing"}`},
+		{expr: "[]integer", want: `{"type":"array","items":{"type":"integer"}}`},
+		{expr: "map[string]Thing", want: `{"type":"object","additionalProperties":{"$ref":"#/components/schemas/Thing"}}`},
+		{expr: "{a!:string,b:[]number}", want: `{"type":"object","properties":{"a":{"type":"string"},"b":{"type":"array","items":{"type":"number"}}},"required":["a"]}`},
+		{expr: "Thing|{n:integer}", want: `{"oneOf":[{"$ref":"#/components/schemas/Thing"},{"type":"object","properties":{"n":{"type":"integer"}}}]}`},
+		{expr: "[]Thing&{i:integer}", want: `{"type":"array","items":{"allOf":[{"$ref":"#/components/schemas/Thing"},{"type":"object","properties":{"i":{"type":"integer"}}}]}}`},
+		{expr: "integer(min=1;max=500;default=100)", want: `{"type":"integer","minimum":1,"maximum":500,"default":100}`},
+		{expr: "string(enum=a,b;nullable)", want: `{"type":"string","enum":["a","b"],"nullable":true}`},
+		{expr: "{m:string}(open)", want: `{"type":"object","properties":{"m":{"type":"string"}},"additionalProperties":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			spec, err := generate(t, "\n// @Schema Under "+tt.expr+"\nvar under int\n")
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			got := spec["components"].(map[string]any)["schemas"].(map[string]any)["Under"]
+			if !reflect.DeepEqual(got, want) {
+				data, _ := json.Marshal(got)
+				t.Errorf("schema %s = %s, want %s", tt.expr, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperation(t *testing.T) {
+	spec, err := generate(t, `
+// @Parameter limit limit query integer Page size
+var params int
+
+// Handle serves two routes.
+//
+// @Router GET /things listThings
+// @Router GET /things/all listAllThings
+// @Summary List things
+// @Description A longer
+// description.
+// @Security none
+// @Param limit
+// @Param id path string
+// @Accept application/json Thing
+// @Success 200 []Thing meta={total:integer} The
+// things
+// @Header 200 ETag string Tag
+// @Produce 200 text/csv string
+// @Failure 400
+func Handle() {}
+`)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	want := `{
+		"operationId": "listThings",
+		"summary": "List things",
+		"description": "A longer description.",
+		"security": [],
+		"parameters": [
+			{"$ref": "#/components/parameters/limit"},
+			{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+		],
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Thing"}}}},
+		"responses": {
+			"200": {
+				"description": "The things",
+				"headers": {"ETag": {"description": "Tag", "schema": {"type": "string"}}},
+				"content": {
+					"application/json": {"schema": {"type": "object", "properties": {
+						"data": {"type": "array", "items": {"$ref": "#/components/schemas/Thing"}},
+						"meta": {"type": "object", "properties": {"total": {"type": "integer"}}}
+					}}},
+					"text/csv": {"schema": {"type": "string"}}
+				}
+			},
+			"400": {"$ref": "#/components/responses/BadRequest"}
+		}
+	}`
+	var wantOp map[string]any
+	if err := json.Unmarshal([]byte(want), &wantOp); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := spec["paths"].(map[string]any)
+	for path, id := range map[string]string{"/things": "listThings", "/things/all": "listAllThings"} {
+		got, ok := paths[path].(map[string]any)["get"].(map[string]any)
+		if !ok {
+			t.Fatalf("GET %s missing", path)
+		}
+		wantOp["operationId"] = id
+		if !reflect.DeepEqual(got, wantOp) {
+			data, _ := json.MarshalIndent(got, "", "  ")
+			t.Errorf("GET %s = %s", path, data)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "unknown schema",
+			src:  "// @Router GET /x x\n// @Success 200 Missing OK\nfunc X() {}\n",
+			want: "schemas Missing is not declared",
+		},
+		{
+			name: "unknown failure status",
+			src:  "// @Router GET /x x\n// @Failure 418\nfunc X() {}\n",
+			want: "no shared response declared for status 418",
+		},
+		{
+			name: "unknown type",
+			src:  "// @Schema Bad strin\nvar bad int\n",
+			want: `unknown type "strin"`,
+		},
+		{
+			name: "operation declared twice",
+			src:  "// @Router GET /x x\n// @Failure 400\nfunc X() {}\n\n// @Router GET /x y\n// @Failure 400\nfunc Y() {}\n",
+			want: "GET /x declared twice",
+		},
+		{
+			name: "response without description",
+			src:  "// @Router GET /x x\n// @Success 200 string\nfunc X() {}\n",
+			want: "needs a description",
+		},
+		{
+			name: "unknown annotation",
+			src:  "// @Router GET /x x\n// @Tags x\nfunc X() {}\n",
+			want: "@Tags: not allowed",
+		},
+		{
+			name: "nested property of undeclared object",
+			src:  "// @Schema Nested\n// @Property a.b string\nvar nested int\n",
+			want: "property a of a.b is not declared",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, "\n"+tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
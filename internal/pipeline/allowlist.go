@@ -0,0 +1,31 @@
+package pipeline
+
+// AllowList is a set of accepted values. A nil AllowList accepts anything.
+type AllowList map[string]struct{}
+
+// NewAllowList builds an AllowList from values. An empty list or one
+// containing the "*" wildcard disables the check and returns nil.
+func NewAllowList(values []string) AllowList {
+	if len(values) == 0 {
+		return nil
+	}
+
+	allowList := make(AllowList, len(values))
+	for _, value := range values {
+		if value == "*" {
+			return nil
+		}
+		allowList[value] = struct{}{}
+	}
+
+	return allowList
+}
+
+func (a AllowList) Allows(value string) bool {
+	if a == nil {
+		return true
+	}
+
+	_, ok := a[value]
+	return ok
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/storage"
+	"testing"
+)
+
+func TestNewAllowList(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		value   string
+		allowed bool
+	}{
+		{name: "allowed value", values: []string{"click", "view"}, value: "view", allowed: true},
+		{name: "disallowed value", values: []string{"click", "view"}, value: "purchase"},
+		{name: "wildcard", values: []string{"click", "*"}, value: "purchase", allowed: true},
+		{name: "empty", value: "purchase", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAllowList(tt.values).Allows(tt.value); got != tt.allowed {
+				t.Errorf("Allows(%q) = %t, want %t", tt.value, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestValidateAllowLists(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []string
+		sources []string
+		wantErr bool
+	}{
+		{name: "allowed", types: []string{"user_action"}, sources: []string{"web"}},
+		{name: "type not allowed", types: []string{"purchase"}, sources: []string{"web"}, wantErr: true},
+		{name: "source not allowed", types: []string{"user_action"}, sources: []string{"mobile"}, wantErr: true},
+		{name: "wildcards", types: []string{"*"}, sources: []string{"*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{
+				AllowedTypes:   NewAllowList(tt.types),
+				AllowedSources: NewAllowList(tt.sources),
+			})
+
+			err := service.Validate(context.Background(), testEvent("evt-1"))
+			if (err != nil) != tt.wantErr || err != nil && !errors.Is(err, ErrNotAllowed) {
+				t.Errorf("Validate error = %v, want %v: %t", err, ErrNotAllowed, tt.wantErr)
+			}
+		})
+	}
+}
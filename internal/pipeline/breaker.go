@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrCircuitOpen is returned for writes rejected while the circuit breaker
+// is open.
+var ErrCircuitOpen = errors.New("storage circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive outage errors that opens
+	// the circuit. Zero disables the breaker.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe is let
+	// through.
+	Cooldown time.Duration
+	// OnStateChange, when set, is called with every new state.
+	OnStateChange func(state BreakerState)
+}
+
+// CircuitBreaker fails storage writes fast while the database is down
+// instead of letting every write wait for a connection timeout. After
+// FailureThreshold consecutive outage errors it opens for Cooldown, then
+// lets a single probe through: success closes it, failure reopens it.
+type CircuitBreaker struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns nil when the breaker is disabled. A nil
+// *CircuitBreaker allows everything.
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+
+	breaker := &CircuitBreaker{cfg: cfg, state: BreakerClosed}
+	if cfg.OnStateChange != nil {
+		cfg.OnStateChange(BreakerClosed)
+	}
+
+	return breaker
+}
+
+// Allow returns ErrCircuitOpen when a write should not be attempted. Every
+// allowed write must be followed by Record or Release.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Release ends an allowed write whose outcome says nothing about the
+// database, such as one its client gave up on, in place of Record.
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Record reports the outcome of an allowed write. Errors that show the
+// database answering, such as constraint violations, count as successes.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil || !isOutage(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			slog.Info("Storage circuit breaker closed")
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		if b.state != BreakerOpen {
+			slog.Warn("Storage circuit breaker opened", "failures", b.failures, "cooldown", b.cfg.Cooldown.String(), "error", err)
+		}
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// State returns the current state, closed for a disabled breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+
+	b.state = state
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(state)
+	}
+}
+
+// isOutage reports whether err means the database could not be reached, as
+// opposed to the database rejecting the statement.
+func isOutage(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn)
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	var states []BreakerState
+	breaker := NewCircuitBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		Cooldown:         cooldown,
+		OnStateChange:    func(state BreakerState) { states = append(states, state) },
+	})
+
+	// write runs one write through the breaker failing with err, and
+	// returns whether the breaker allowed it.
+	write := func(err error) bool {
+		if breaker.Allow() != nil {
+			return false
+		}
+		breaker.Record(err)
+		return true
+	}
+
+	steps := []struct {
+		name        string
+		wait        time.Duration
+		err         error
+		wantAllowed bool
+		wantState   BreakerState
+	}{
+		{name: "first outage", err: sql.ErrConnDone, wantAllowed: true, wantState: BreakerClosed},
+		{name: "query error resets the count", err: errDuplicate, wantAllowed: true, wantState: BreakerClosed},
+		{name: "outage after the reset", err: sql.ErrConnDone, wantAllowed: true, wantState: BreakerClosed},
+		{name: "threshold reached", err: sql.ErrConnDone, wantAllowed: true, wantState: BreakerOpen},
+		{name: "rejected while open", wantState: BreakerOpen},
+		{name: "failed probe reopens", wait: cooldown, err: sql.ErrConnDone, wantAllowed: true, wantState: BreakerOpen},
+		{name: "rejected after the failed probe", wantState: BreakerOpen},
+		{name: "successful probe closes", wait: cooldown, wantAllowed: true, wantState: BreakerClosed},
+		{name: "allowed once closed", wantAllowed: true, wantState: BreakerClosed},
+	}
+
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		if allowed := write(step.err); allowed != step.wantAllowed {
+			t.Fatalf("%s: allowed = %t, want %t", step.name, allowed, step.wantAllowed)
+		}
+		if state := breaker.State(); state != step.wantState {
+			t.Fatalf("%s: state = %s, want %s", step.name, state, step.wantState)
+		}
+	}
+
+	want := "[closed open half_open open half_open closed]"
+	if fmt.Sprint(states) != want {
+		t.Errorf("state changes = %v, want %s", states, want)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Millisecond})
+	breaker.Allow()
+	breaker.Record(sql.ErrConnDone)
+	time.Sleep(time.Millisecond)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second write during the probe: %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A probe whose client gave up tells nothing, so the next write probes.
+	breaker.Release()
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("probe after a release: %v", err)
+	}
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Errorf("state = %s, want %s", state, BreakerHalfOpen)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{})
+	if breaker != nil {
+		t.Fatal("NewCircuitBreaker without a threshold != nil")
+	}
+	for range 10 {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		breaker.Record(sql.ErrConnDone)
+	}
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("state = %s, want %s", state, BreakerClosed)
+	}
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"event-processing-pipeline/internal/idempotency"
+	"event-processing-pipeline/internal/storage"
+	"time"
+)
+
+// ContentField is an event field hashed by content dedup.
+type ContentField string
+
+const (
+	ContentFieldType     ContentField = "type"
+	ContentFieldSource   ContentField = "source"
+	ContentFieldUserID   ContentField = "user_id"
+	ContentFieldAction   ContentField = "action"
+	ContentFieldValue    ContentField = "value"
+	ContentFieldMetadata ContentField = "metadata"
+)
+
+// ContentFields lists every hashable field, the default selection.
+var ContentFields = []ContentField{
+	ContentFieldType,
+	ContentFieldSource,
+	ContentFieldUserID,
+	ContentFieldAction,
+	ContentFieldValue,
+	ContentFieldMetadata,
+}
+
+type ContentDedupConfig struct {
+	// Window is how long an event's content hash is remembered. Zero
+	// disables content dedup.
+	Window time.Duration
+	// CacheSize bounds the remembered hashes, the least recently seen are
+	// forgotten first.
+	CacheSize int
+	// Fields are the fields hashed, ContentFields when empty.
+	Fields []ContentField
+}
+
+// contentDedup skips events whose content was already stored within the
+// window, for producers resending identical payloads without stable ids. The
+// timestamp and id are never hashed. Hashes live in memory, so each instance
+// deduplicates on its own.
+type contentDedup struct {
+	fields []ContentField
+	// seen maps content hashes to the id of the event first stored with them.
+	seen *idempotency.Cache[string]
+}
+
+// newContentDedup returns nil when cfg disables content dedup.
+func newContentDedup(cfg ContentDedupConfig) *contentDedup {
+	if cfg.Window <= 0 || cfg.CacheSize <= 0 {
+		return nil
+	}
+
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = ContentFields
+	}
+
+	return &contentDedup{
+		fields: fields,
+		seen:   idempotency.NewCache[string](cfg.Window, cfg.CacheSize),
+	}
+}
+
+// claim records the event's content and returns "", false, or when the same
+// content was claimed within the window, the id of that event and true.
+func (d *contentDedup) claim(event *storage.ProcessedEvent) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	id, stored := d.seen.PutIfAbsent(d.hash(event), event.ID)
+	if stored {
+		return "", false
+	}
+	return id, true
+}
+
+// release forgets the event's content after it failed to be stored, so a
+// resend is not skipped.
+func (d *contentDedup) release(event *storage.ProcessedEvent) {
+	if d == nil {
+		return
+	}
+
+	d.seen.Delete(d.hash(event))
+}
+
+// hash is the SHA-256 of the tenant and the selected fields encoded as JSON,
+// which sorts metadata keys and so does not depend on their order in the
+// payload. Tenants never repeat each other's content.
+func (d *contentDedup) hash(event *storage.ProcessedEvent) string {
+	values := make([]any, len(d.fields))
+	for i, field := range d.fields {
+		switch field {
+		case ContentFieldType:
+			values[i] = event.Type
+		case ContentFieldSource:
+			values[i] = event.Source
+		case ContentFieldUserID:
+			values[i] = event.UserID
+		case ContentFieldAction:
+			values[i] = event.Data.Action
+		case ContentFieldValue:
+			values[i] = event.Data.Value
+			if event.Data.IntValue != nil {
+				values[i] = *event.Data.IntValue
+			}
+		case ContentFieldMetadata:
+			values[i] = event.Data.Metadata
+		}
+	}
+
+	// Validation rejects the NaN and infinite values JSON cannot encode.
+	encoded, _ := json.Marshal([]any{event.TenantID, values})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"testing"
+	"time"
+)
+
+func TestContentDedup(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        []ContentField
+		change        func(event *api.EventDTO)
+		wantDuplicate bool
+	}{
+		{
+			name:          "differing only by timestamp",
+			change:        func(event *api.EventDTO) { event.Timestamp.Time = event.Timestamp.Add(-time.Second) },
+			wantDuplicate: true,
+		},
+		{
+			name:   "differing by value",
+			change: func(event *api.EventDTO) { event.Data.Value = api.FloatValue(2) },
+		},
+		{
+			name: "differing by metadata",
+			change: func(event *api.EventDTO) {
+				event.Data.Metadata = map[string]any{"page": "/pricing"}
+			},
+		},
+		{
+			name:          "differing by a field not hashed",
+			fields:        []ContentField{ContentFieldType, ContentFieldSource, ContentFieldAction},
+			change:        func(event *api.EventDTO) { event.Data.Value = api.FloatValue(2) },
+			wantDuplicate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			service := NewEventService(repo, ServiceConfig{MaxClockSkew: time.Minute})
+			p, m := newTestPipeline(t, service, nil, PipelineConfig{
+				ContentDedup: ContentDedupConfig{Window: time.Minute, CacheSize: 16, Fields: tt.fields},
+			})
+
+			// Producers without stable ids leave the id for the pipeline to
+			// generate.
+			first := testEvent("")
+			first.ID = nil
+			firstResult := process(t, p, context.Background(), first)
+			if firstResult.Err != nil || firstResult.Duplicate {
+				t.Fatalf("first result error %v, duplicate %t", firstResult.Err, firstResult.Duplicate)
+			}
+
+			second := first
+			tt.change(&second)
+			result := process(t, p, context.Background(), second)
+			if result.Err != nil || result.Duplicate != tt.wantDuplicate {
+				t.Fatalf("second result error %v, duplicate %t; want duplicate %t", result.Err, result.Duplicate, tt.wantDuplicate)
+			}
+			if tt.wantDuplicate && result.Event.ID != firstResult.Event.ID {
+				t.Errorf("duplicate reported id %s, want the first event's %s", result.Event.ID, firstResult.Event.ID)
+			}
+
+			wantStored, wantDups := int64(2), int64(0)
+			if tt.wantDuplicate {
+				wantStored, wantDups = 1, 1
+			}
+			if stored, _ := repo.CountEvents(context.Background(), storage.EventFilter{}); stored != wantStored {
+				t.Errorf("stored %d events, want %d", stored, wantStored)
+			}
+			if dups := m.Snapshot().ContentDups; dups != wantDups {
+				t.Errorf("content duplicates = %d, want %d", dups, wantDups)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"time"
+)
+
+type deadLetterService struct {
+	deadLetterRepository storage.DeadLetterRepository
+}
+
+type DeadLetterService interface {
+	Send(ctx context.Context, event api.EventDTO, stage metrics.Stage, cause error)
+	// SendRaw records a payload that could not be decoded into an event.
+	SendRaw(ctx context.Context, payload []byte, stage metrics.Stage, cause error)
+	List(ctx context.Context, limit, offset int) ([]storage.DeadLetter, error)
+	// Take removes a dead letter and returns its original event for retrying.
+	Take(ctx context.Context, id int64) (api.EventDTO, error)
+	Count(ctx context.Context) (int64, error)
+}
+
+func NewDeadLetterService(deadLetterRepository storage.DeadLetterRepository) DeadLetterService {
+	return &deadLetterService{
+		deadLetterRepository: deadLetterRepository,
+	}
+}
+
+// Send records a failed event. Failures to record it are only logged, since
+// there is nowhere left to route the event to.
+func (s *deadLetterService) Send(ctx context.Context, event api.EventDTO, stage metrics.Stage, cause error) {
+	logger := logging.FromContext(ctx)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode dead letter", "stage", stage, "error", err)
+		return
+	}
+
+	s.insert(ctx, event.ID, payload, stage, cause)
+}
+
+// SendRaw stores the payload as a JSON string since it is not valid JSON
+// itself.
+func (s *deadLetterService) SendRaw(ctx context.Context, payload []byte, stage metrics.Stage, cause error) {
+	encoded, err := json.Marshal(string(payload))
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to encode dead letter", "stage", stage, "error", err)
+		return
+	}
+
+	s.insert(ctx, nil, encoded, stage, cause)
+}
+
+func (s *deadLetterService) insert(ctx context.Context, eventID *string, payload []byte, stage metrics.Stage, cause error) {
+	_, err := s.deadLetterRepository.InsertDeadLetter(storage.DeadLetter{
+		EventID:   eventID,
+		Stage:     string(stage),
+		Error:     cause.Error(),
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to store dead letter", "stage", stage, "error", err, "cause", cause)
+	}
+}
+
+func (s *deadLetterService) List(ctx context.Context, limit, offset int) ([]storage.DeadLetter, error) {
+	return s.deadLetterRepository.FindDeadLetters(limit, offset)
+}
+
+func (s *deadLetterService) Count(ctx context.Context) (int64, error) {
+	return s.deadLetterRepository.CountDeadLetters()
+}
+
+func (s *deadLetterService) Take(ctx context.Context, id int64) (api.EventDTO, error) {
+	deadLetter, err := s.deadLetterRepository.FindDeadLetterByID(id)
+	if err != nil {
+		return api.EventDTO{}, err
+	}
+
+	var event api.EventDTO
+	if err := json.Unmarshal(deadLetter.Payload, &event); err != nil {
+		return api.EventDTO{}, fmt.Errorf("decode dead letter %d: %w", id, err)
+	}
+
+	if err := s.deadLetterRepository.DeleteDeadLetter(id); err != nil {
+		return api.EventDTO{}, fmt.Errorf("delete dead letter %d: %w", id, err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"context"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"maps"
+)
+
+// Enricher augments an event between processing and storage, typically by
+// adding keys to Data.Metadata.
+type Enricher interface {
+	Enrich(ctx context.Context, event *storage.ProcessedEvent) error
+}
+
+// EnrichFailurePolicy decides what happens to an event when an enricher
+// fails: "skip" (default) stores it without that enricher's additions,
+// "dead_letter" fails processing so the event is dead-lettered.
+type EnrichFailurePolicy string
+
+const (
+	EnrichFailureSkip       EnrichFailurePolicy = "skip"
+	EnrichFailureDeadLetter EnrichFailurePolicy = "dead_letter"
+)
+
+// enrich runs the configured enrichers in order. The metadata map is copied
+// first so enrichers never write into the caller's event.
+func (s *eventService) enrich(ctx context.Context, event *storage.ProcessedEvent) error {
+	if len(s.cfg.Enrichers) == 0 {
+		return nil
+	}
+
+	event.Data.Metadata = maps.Clone(event.Data.Metadata)
+	for i, enricher := range s.cfg.Enrichers {
+		err := enricher.Enrich(ctx, event)
+		if err == nil {
+			continue
+		}
+
+		if s.cfg.EnrichFailures == EnrichFailureDeadLetter {
+			return fmt.Errorf("enricher %d (%T): %w", i, enricher, err)
+		}
+		logging.FromContext(ctx).Warn("Enricher failed, skipping", "event_id", event.ID, "enricher", fmt.Sprintf("%T", enricher), "error", err)
+	}
+
+	return nil
+}
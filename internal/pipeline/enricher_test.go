@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// enricherFunc is an Enricher calling itself.
+type enricherFunc func(event *storage.ProcessedEvent) error
+
+func (f enricherFunc) Enrich(_ context.Context, event *storage.ProcessedEvent) error {
+	return f(event)
+}
+
+// setMetadata returns an enricher appending name to the "trail" metadata key.
+func setMetadata(name string) enricherFunc {
+	return func(event *storage.ProcessedEvent) error {
+		trail, _ := event.Data.Metadata["trail"].(string)
+		event.Data.Metadata["trail"] = trail + name
+		return nil
+	}
+}
+
+func TestProcessRunsEnrichers(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	failing := enricherFunc(func(*storage.ProcessedEvent) error { return errLookup })
+
+	tests := []struct {
+		name      string
+		enrichers []Enricher
+		policy    EnrichFailurePolicy
+		wantTrail string
+		wantErr   error
+	}{
+		{name: "in order", enrichers: []Enricher{setMetadata("a"), setMetadata("b")}, wantTrail: "ab"},
+		{name: "failure skipped", enrichers: []Enricher{setMetadata("a"), failing, setMetadata("c")}, policy: EnrichFailureSkip, wantTrail: "ac"},
+		{name: "failure dead-lettered", enrichers: []Enricher{setMetadata("a"), failing, setMetadata("c")}, policy: EnrichFailureDeadLetter, wantErr: errLookup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{Enrichers: tt.enrichers, EnrichFailures: tt.policy})
+
+			event := testEvent("evt-1")
+			event.Data.Metadata = api.Metadata{"page": "home"}
+			processed, err := service.Process(context.Background(), event)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Process error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if trail := processed.Data.Metadata["trail"]; trail != tt.wantTrail {
+				t.Errorf("trail = %v, want %s", trail, tt.wantTrail)
+			}
+			if _, ok := event.Data.Metadata["trail"]; ok {
+				t.Error("enrichers wrote into the caller's metadata")
+			}
+		})
+	}
+}
+
+func TestGeoIPEnricher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	table := "# cidr,country\n203.0.0.0/8,AU\n203.0.113.0/24, NZ\n2001:db8::/32,DE\n"
+	if err := os.WriteFile(path, []byte(table), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	enricher, err := LoadGeoIPEnricher(path, "ip", "country")
+	if err != nil {
+		t.Fatalf("LoadGeoIPEnricher: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		metadata    storage.Metadata
+		wantCountry any
+		wantErr     bool
+	}{
+		{name: "most specific range", metadata: storage.Metadata{"ip": "203.0.113.7"}, wantCountry: "NZ"},
+		{name: "wider range", metadata: storage.Metadata{"ip": "203.1.2.3"}, wantCountry: "AU"},
+		{name: "IPv4-mapped address", metadata: storage.Metadata{"ip": "::ffff:203.0.113.7"}, wantCountry: "NZ"},
+		{name: "IPv6", metadata: storage.Metadata{"ip": "2001:db8::1"}, wantCountry: "DE"},
+		{name: "outside every range", metadata: storage.Metadata{"ip": "192.0.2.1"}},
+		{name: "no address", metadata: storage.Metadata{}},
+		{name: "invalid address", metadata: storage.Metadata{"ip": "not an ip"}, wantErr: true},
+		{name: "not a string", metadata: storage.Metadata{"ip": 42}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &storage.ProcessedEvent{Data: storage.Data{Metadata: tt.metadata}}
+			if err := enricher.Enrich(context.Background(), event); (err != nil) != tt.wantErr {
+				t.Fatalf("Enrich error = %v, want error %t", err, tt.wantErr)
+			}
+			if country := event.Data.Metadata["country"]; country != tt.wantCountry {
+				t.Errorf("country = %v, want %v", country, tt.wantCountry)
+			}
+		})
+	}
+}
+
+func TestLoadGeoIPEnricherErrors(t *testing.T) {
+	for _, table := range []string{"203.0.113.0/24\n", "not a prefix,NZ\n"} {
+		path := filepath.Join(t.TempDir(), "geoip.csv")
+		if err := os.WriteFile(path, []byte(table), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadGeoIPEnricher(path, "ip", "country"); err == nil {
+			t.Errorf("LoadGeoIPEnricher accepted %q", table)
+		}
+	}
+	if _, err := LoadGeoIPEnricher(filepath.Join(t.TempDir(), "missing.csv"), "ip", "country"); err == nil {
+		t.Error("LoadGeoIPEnricher accepted a missing file")
+	}
+}
@@ -0,0 +1,581 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"event-processing-pipeline/internal/tracing"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrPipelineClosed = errors.New("pipeline is shutting down")
+	ErrPipelineFull   = errors.New("pipeline is at capacity")
+	ErrProcessTimeout = errors.New("event processing timed out")
+	// ErrClientDeadline cancels jobs whose request ran out of the time its
+	// client allowed for it.
+	ErrClientDeadline = errors.New("client deadline exceeded")
+	// ErrPipelineAbandoned cancels the jobs still in flight when Shutdown
+	// gives up waiting for them.
+	ErrPipelineAbandoned = errors.New("pipeline shutdown abandoned in-flight events")
+)
+
+// Job is a single event queued for the worker pool. When Result is set the
+// worker reports the outcome on it, which lets callers wait synchronously.
+type Job struct {
+	Ctx    context.Context
+	Event  api.EventDTO
+	Result chan<- JobResult
+	// Retryable lets the retry queue take the job when its event fails to
+	// store, delaying the result until the last attempt. Only set it for
+	// jobs nobody waits on.
+	Retryable bool
+	// Index is copied to the job's result, so jobs sharing one Result
+	// channel can tell their results apart.
+	Index int
+	// enqueued is when Enqueue accepted the job, for end-to-end latency.
+	enqueued time.Time
+	// attempts counts the failed attempts to store the event so far.
+	attempts int
+}
+
+type JobResult struct {
+	Event     *storage.ProcessedEvent
+	Duplicate bool
+	// SampledOut is set for valid events dropped by the sampling rules.
+	SampledOut bool
+	// Spooled is set for events written to the write-ahead log because the
+	// database could not be reached. They are stored by a later replay.
+	Spooled bool
+	// Stage is the stage that failed, empty on success.
+	Stage metrics.Stage
+	Err   error
+	// Index is the Index of the job.
+	Index int
+}
+
+// Publisher is told about every newly stored event. Publish must not block.
+type Publisher interface {
+	Publish(event storage.ProcessedEvent)
+}
+
+// Publishers tells every publisher in turn.
+type Publishers []Publisher
+
+func (p Publishers) Publish(event storage.ProcessedEvent) {
+	for _, publisher := range p {
+		publisher.Publish(event)
+	}
+}
+
+type PipelineConfig struct {
+	// WorkerCount is the number of workers always running.
+	WorkerCount int
+	// MaxWorkers enables scaling when above WorkerCount: every ScaleInterval
+	// another worker is started while more than ScaleHighWater jobs are
+	// queued, and workers idle for IdleTimeout are retired down to
+	// WorkerCount. Both can be changed at runtime with Resize.
+	MaxWorkers     int
+	ScaleHighWater int
+	ScaleInterval  time.Duration
+	IdleTimeout    time.Duration
+	BufferSize     int
+	// EnqueueTimeout is how long Enqueue waits for room in a full buffer.
+	// Zero rejects immediately.
+	EnqueueTimeout time.Duration
+	// ProcessTimeout bounds validating, processing and storing a single event.
+	// Zero disables it.
+	ProcessTimeout time.Duration
+	// FlushSize enables write buffering when above one: processed events are
+	// collected across jobs and stored together once FlushSize are waiting or
+	// FlushInterval has passed.
+	FlushSize     int
+	FlushInterval time.Duration
+	// ContentDedup skips events repeating the content of one stored shortly
+	// before.
+	ContentDedup ContentDedupConfig
+	// Sampling stores only a share of the valid events of some types and
+	// sources.
+	Sampling SamplingRules
+	// Retries retries retryable jobs whose event failed to store.
+	Retries RetryQueueConfig
+}
+
+// EventPipeline is a long-lived worker pool fed through a buffered channel.
+type EventPipeline struct {
+	ingestionChan chan Job
+	workerPool    []*Worker
+	eventService  EventService
+	deadLetters   DeadLetterService
+	metrics       *metrics.Metrics
+	publisher     Publisher
+	cfg           PipelineConfig
+	wg            sync.WaitGroup
+	buffer        *flushBuffer
+	scaler        *scaler
+	contentDedup  *contentDedup
+	retries       *retryQueue
+	// ctx is cancelled once Shutdown gives up, stopping the workers and
+	// their in-flight jobs instead of leaving them running.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+}
+
+type Worker struct {
+	Id       int
+	jobChan  <-chan Job
+	pipeline *EventPipeline
+	// idleTimeout retires the worker after that long without a job, if the
+	// pool is above its minimum. Zero only retires it when the pool shrinks.
+	idleTimeout time.Duration
+}
+
+// NewEventPipeline creates a stopped pipeline. publisher may be nil.
+func NewEventPipeline(eventService EventService, deadLetters DeadLetterService, m *metrics.Metrics, publisher Publisher, cfg PipelineConfig) *EventPipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	eventPipeline := &EventPipeline{
+		ctx:           ctx,
+		cancel:        cancel,
+		ingestionChan: make(chan Job, cfg.BufferSize),
+		eventService:  eventService,
+		deadLetters:   deadLetters,
+		metrics:       m,
+		publisher:     publisher,
+		cfg:           cfg,
+		contentDedup:  newContentDedup(cfg.ContentDedup),
+	}
+
+	if cfg.FlushSize > 1 {
+		eventPipeline.buffer = newFlushBuffer(eventPipeline, cfg.FlushSize, cfg.FlushInterval)
+	}
+
+	eventPipeline.retries = newRetryQueue(eventPipeline, cfg.Retries)
+	eventPipeline.scaler = newScaler(eventPipeline, cfg.WorkerCount, max(cfg.MaxWorkers, cfg.WorkerCount))
+	for i := 0; i < cfg.WorkerCount; i++ {
+		eventPipeline.workerPool = append(eventPipeline.workerPool, eventPipeline.newWorker(i))
+	}
+
+	return eventPipeline
+}
+
+func (p *EventPipeline) newWorker(id int) *Worker {
+	return &Worker{
+		Id:          id,
+		jobChan:     p.ingestionChan,
+		pipeline:    p,
+		idleTimeout: p.cfg.IdleTimeout,
+	}
+}
+
+func (p *EventPipeline) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, worker := range p.workerPool {
+		worker.Start()
+	}
+	p.metrics.SetWorkers(len(p.workerPool))
+	if p.buffer != nil {
+		p.buffer.start()
+	}
+	p.scaler.start(len(p.workerPool))
+	p.retries.start()
+	p.started = true
+}
+
+// Resize changes the minimum and maximum number of workers while running.
+// Queued and in-flight events are unaffected: missing workers start right
+// away and surplus ones exit after their current event.
+func (p *EventPipeline) Resize(minWorkers, maxWorkers int) error {
+	return p.scaler.resize(minWorkers, maxWorkers)
+}
+
+// ErrFlushDisabled is returned when changing the flush size of a pipeline
+// started without write buffering.
+var ErrFlushDisabled = errors.New("write buffering is disabled")
+
+// SetFlushSize changes the number of events stored together. It takes effect
+// with the next event added to the buffer.
+func (p *EventPipeline) SetFlushSize(size int) error {
+	if p.buffer == nil {
+		return ErrFlushDisabled
+	}
+	if size < 2 || size > storage.MaxInsertBatchSize {
+		return fmt.Errorf("flush size must be between 2 and %d", storage.MaxInsertBatchSize)
+	}
+
+	p.buffer.size.Store(int64(size))
+	return nil
+}
+
+// Config returns the configuration in effect, including runtime changes, and
+// the current number of workers.
+func (p *EventPipeline) Config() (PipelineConfig, int) {
+	cfg := p.cfg
+	var workers int
+	cfg.WorkerCount, cfg.MaxWorkers, workers = p.scaler.bounds()
+	if p.buffer != nil {
+		cfg.FlushSize = int(p.buffer.size.Load())
+	}
+
+	return cfg, workers
+}
+
+// Publish tells the publisher about an event stored outside the pipeline.
+func (p *EventPipeline) Publish(event storage.ProcessedEvent) {
+	if p.publisher != nil {
+		p.publisher.Publish(event)
+	}
+}
+
+// Running reports whether the workers are started and still accepting jobs.
+func (p *EventPipeline) Running() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.started && !p.closed
+}
+
+// Enqueue hands the job to the worker pool. When the buffer is full it waits
+// up to EnqueueTimeout for room and then gives up with ErrPipelineFull.
+func (p *EventPipeline) Enqueue(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPipelineClosed
+	}
+
+	p.metrics.IncReceived(string(job.Event.Type), string(job.Event.Source))
+	job.enqueued = time.Now()
+
+	select {
+	case p.ingestionChan <- job:
+		p.metrics.SetQueueDepth(len(p.ingestionChan))
+		return nil
+	default:
+	}
+
+	if p.cfg.EnqueueTimeout > 0 {
+		timer := time.NewTimer(p.cfg.EnqueueTimeout)
+		defer timer.Stop()
+
+		select {
+		case p.ingestionChan <- job:
+			p.metrics.SetQueueDepth(len(p.ingestionChan))
+			return nil
+		case <-timer.C:
+		}
+	}
+
+	p.metrics.IncRejected()
+	return ErrPipelineFull
+}
+
+// resubmit hands a job from the retry queue back to the workers without
+// waiting for room or counting it as received again.
+func (p *EventPipeline) resubmit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPipelineClosed
+	}
+
+	select {
+	case p.ingestionChan <- job:
+		p.metrics.SetQueueDepth(len(p.ingestionChan))
+		return nil
+	default:
+		return ErrPipelineFull
+	}
+}
+
+// PendingRetries lists the events waiting in the retry queue, the next due
+// first.
+func (p *EventPipeline) PendingRetries() []PendingRetry {
+	return p.retries.pending()
+}
+
+// Shutdown stops accepting jobs and waits for the workers to drain the queue.
+// Events waiting in the retry queue are dead-lettered. When ctx expires
+// first, in-flight jobs are cancelled with ErrPipelineAbandoned, queued ones
+// are dropped and the workers exit.
+func (p *EventPipeline) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ingestionChan)
+		p.scaler.stop()
+	}
+	p.mu.Unlock()
+	p.retries.close()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		// The workers are done adding to the buffer, flush what is left.
+		if p.buffer != nil {
+			p.buffer.close()
+		}
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		outstanding := p.metrics.Outstanding()
+		p.cancel()
+		return fmt.Errorf("abandoned %d outstanding events: %w", outstanding, ctx.Err())
+	}
+}
+
+// Start runs the worker until jobChan is closed and drained, or the pipeline
+// is abandoned, or until the scaler retires it, either because the pool
+// shrank below it or because it went idleTimeout without work. A worker only
+// retires between jobs, so queued jobs are left for the others.
+func (w *Worker) Start() {
+	w.pipeline.wg.Add(1)
+	go func() {
+		defer w.pipeline.wg.Done()
+
+		// A nil channel never fires, which disables idle retirement.
+		var idle <-chan time.Time
+		var timer *time.Timer
+		if w.idleTimeout > 0 {
+			timer = time.NewTimer(w.idleTimeout)
+			defer timer.Stop()
+			idle = timer.C
+		}
+
+		scaler := w.pipeline.scaler
+		for {
+			retire := false
+			select {
+			case job, ok := <-w.jobChan:
+				if !ok {
+					return
+				}
+				start := time.Now()
+				w.processJob(job)
+				w.pipeline.metrics.ObserveBusy(time.Since(start))
+				retire = scaler.retire(w.Id, false)
+			case <-idle:
+				retire = scaler.retire(w.Id, true)
+			case <-scaler.shrink:
+				retire = scaler.retire(w.Id, false)
+			case <-w.pipeline.ctx.Done():
+				return
+			}
+			if retire {
+				return
+			}
+			if timer != nil {
+				timer.Reset(w.idleTimeout)
+			}
+		}
+	}()
+}
+
+// pendingJob is a job between processing and storing.
+type pendingJob struct {
+	job    Job
+	ctx    context.Context
+	cancel context.CancelFunc
+	span   trace.Span
+	worker int
+	start  time.Time
+}
+
+func (w *Worker) processJob(job Job) {
+	w.pipeline.metrics.SetQueueDepth(len(w.jobChan))
+	pending := pendingJob{job: job, worker: w.Id, start: time.Now()}
+	pending.ctx, pending.span = tracing.Start(job.Ctx, "pipeline.event", dtoID(job.Event))
+	pending.span.SetAttributes(attribute.Int("worker", w.Id))
+
+	// Jobs carry their request context, so tie them to the pipeline's too.
+	ctx, cancel := context.WithCancelCause(pending.ctx)
+	stop := context.AfterFunc(w.pipeline.ctx, func() { cancel(ErrPipelineAbandoned) })
+	pending.ctx, pending.cancel = ctx, func() { stop(); cancel(nil) }
+	if timeout := w.pipeline.cfg.ProcessTimeout; timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		pending.ctx, cancelTimeout = context.WithTimeoutCause(pending.ctx, timeout, ErrProcessTimeout)
+		pending.cancel = func() { cancelTimeout(); stop(); cancel(nil) }
+	}
+
+	result := w.pipeline.prepareEvent(pending.ctx, job.Event)
+	if result.Err != nil {
+		w.pipeline.complete(pending, result)
+		return
+	}
+
+	if !w.pipeline.cfg.Sampling.sample(result.Event) {
+		w.pipeline.metrics.IncSampledOut(string(result.Event.Type), string(result.Event.Source))
+		w.pipeline.complete(pending, JobResult{Event: result.Event, SampledOut: true})
+		return
+	}
+
+	// Report the event stored first, so callers get an id they can look up.
+	if id, seen := w.pipeline.contentDedup.claim(result.Event); seen {
+		w.pipeline.metrics.IncContentDuplicate()
+		result.Event.ID = id
+		w.pipeline.complete(pending, JobResult{Event: result.Event, Duplicate: true})
+		return
+	}
+
+	// With buffering the flusher completes the job once the event is written.
+	if w.pipeline.buffer != nil {
+		w.pipeline.buffer.add(pending, result.Event)
+		return
+	}
+
+	w.pipeline.complete(pending, w.pipeline.storeEvent(pending.ctx, result.Event))
+}
+
+// complete reports the outcome of a job and dead-letters failed events.
+// Failures after ProcessTimeout are reported as ErrProcessTimeout, those
+// after the client deadline as ErrClientDeadline and those caused by an
+// abandoned shutdown as ErrPipelineAbandoned.
+func (p *EventPipeline) complete(pending pendingJob, result JobResult) {
+	job := pending.job
+	if result.Err != nil {
+		switch cause := context.Cause(pending.ctx); {
+		case errors.Is(cause, ErrProcessTimeout):
+			result.Err = fmt.Errorf("%w after %s: %w", ErrProcessTimeout, p.cfg.ProcessTimeout, result.Err)
+		case errors.Is(cause, ErrClientDeadline):
+			result.Err = fmt.Errorf("%w: %w", ErrClientDeadline, result.Err)
+		case errors.Is(cause, ErrPipelineAbandoned):
+			result.Err = fmt.Errorf("%w: %w", ErrPipelineAbandoned, result.Err)
+		}
+	}
+	if result.Stage == metrics.StageStore {
+		p.contentDedup.release(result.Event)
+	}
+	pending.cancel()
+	tracing.End(pending.span, result.Err)
+
+	logger := logging.FromContext(job.Ctx).With(
+		"worker", pending.worker,
+		"event_id", eventID(job.Event, result.Event),
+		"latency_ms", time.Since(pending.start).Milliseconds(),
+	)
+
+	if result.Stage == metrics.StageStore && p.retries.schedule(job, result) {
+		logger.Warn("Event failed to store, retrying later", "attempts", job.attempts+1, "error", result.Err)
+		return
+	}
+	if result.Err != nil && job.attempts > 0 {
+		result.Err = fmt.Errorf("gave up after %d attempts: %w", job.attempts+1, result.Err)
+	}
+	p.finish(job, result, logger)
+}
+
+// finish reports the final outcome of a job, dead-letters its event when it
+// failed and publishes it when it was stored.
+func (p *EventPipeline) finish(job Job, result JobResult, logger *slog.Logger) {
+	p.metrics.Done()
+	p.metrics.ObserveEndToEnd(time.Since(job.enqueued))
+	if job.Result != nil {
+		result.Index = job.Index
+		job.Result <- result
+	}
+
+	if result.Err == nil {
+		if result.SampledOut {
+			logger.Debug("Event sampled out")
+			return
+		}
+		if result.Spooled {
+			// Not stored yet, so not published either.
+			logger.Debug("Event spooled")
+			return
+		}
+		logger.Debug("Event stored", "duplicate", result.Duplicate)
+		if !result.Duplicate && p.publisher != nil {
+			p.publisher.Publish(*result.Event)
+		}
+		return
+	}
+
+	p.deadLetters.Send(job.Ctx, job.Event, result.Stage, result.Err)
+
+	switch result.Stage {
+	case metrics.StageValidate:
+		logger.Info("Event rejected", "stage", result.Stage, "error", result.Err)
+	default:
+		logger.Error("Event failed", "stage", result.Stage, "error", result.Err)
+	}
+}
+
+func eventID(event api.EventDTO, processedEvent *storage.ProcessedEvent) string {
+	if processedEvent != nil {
+		return processedEvent.ID
+	}
+	if event.ID != nil {
+		return *event.ID
+	}
+
+	return ""
+}
+
+// prepareEvent runs a single event through Validate and Process, recording
+// metrics along the way. On success the result holds the processed event.
+func (p *EventPipeline) prepareEvent(ctx context.Context, event api.EventDTO) JobResult {
+	// The job may have run out of time waiting in the queue, complete tells
+	// why from the context's cause.
+	if err := ctx.Err(); err != nil {
+		p.metrics.IncFailed(metrics.StageQueue)
+		return JobResult{Stage: metrics.StageQueue, Err: err}
+	}
+
+	if err := p.eventService.Validate(ctx, event); err != nil {
+		p.metrics.IncFailed(metrics.StageValidate)
+		return JobResult{Stage: metrics.StageValidate, Err: err}
+	}
+	p.metrics.IncValidated()
+
+	start := time.Now()
+	processedEvent, err := p.eventService.Process(ctx, event)
+	p.metrics.ObserveProcess(time.Since(start))
+	if err == nil {
+		// Out of time already, storing would only fail on the database.
+		err = ctx.Err()
+	}
+	if err != nil {
+		p.metrics.IncFailed(metrics.StageProcess)
+		return JobResult{Stage: metrics.StageProcess, Err: err}
+	}
+	p.metrics.IncProcessed()
+
+	return JobResult{Event: processedEvent}
+}
+
+// storeEvent stores a single processed event, recording metrics.
+func (p *EventPipeline) storeEvent(ctx context.Context, processedEvent *storage.ProcessedEvent) JobResult {
+	start := time.Now()
+	result, err := p.eventService.Store(ctx, []storage.ProcessedEvent{*processedEvent}, true)
+	p.metrics.ObserveStore(time.Since(start))
+	if err != nil {
+		p.metrics.IncFailed(metrics.StageStore)
+		return JobResult{Event: processedEvent, Stage: metrics.StageStore, Err: err}
+	}
+	p.metrics.AddStored(result.Inserted)
+	p.metrics.AddDuplicates(result.Duplicates)
+	p.metrics.AddSpooled(result.Spooled)
+
+	return JobResult{Event: processedEvent, Duplicate: result.Duplicates > 0, Spooled: result.Spooled > 0}
+}
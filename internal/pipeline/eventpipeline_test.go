@@ -0,0 +1,232 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// newTestPipeline starts a pipeline of one worker over service, stopped when
+// the test ends. cfg may leave the worker settings zero.
+func newTestPipeline(t *testing.T, service EventService, publisher Publisher, cfg PipelineConfig) (*EventPipeline, *metrics.Metrics) {
+	t.Helper()
+
+	cfg.WorkerCount = max(cfg.WorkerCount, 1)
+	cfg.BufferSize = max(cfg.BufferSize, 16)
+	if cfg.ScaleInterval == 0 {
+		cfg.ScaleInterval = time.Minute
+	}
+
+	m := metrics.NewMetrics()
+	p := NewEventPipeline(service, NewDeadLetterService(storage.NewMemoryDeadLetterRepository()), m, publisher, cfg)
+	p.Start()
+	t.Cleanup(func() { p.Shutdown(context.Background()) })
+	return p, m
+}
+
+// testEvent returns a valid event with id.
+func testEvent(id string) api.EventDTO {
+	return api.EventDTO{
+		ID:        &id,
+		Type:      "user_action",
+		Source:    "web",
+		Timestamp: api.Timestamp{Time: time.Now().UTC()},
+		Data:      api.Data{Action: "click", Value: api.FloatValue(1)},
+	}
+}
+
+// process runs event through p and waits for its result.
+func process(t *testing.T, p *EventPipeline, ctx context.Context, event api.EventDTO) JobResult {
+	t.Helper()
+
+	results := make(chan JobResult, 1)
+	if err := p.Enqueue(Job{Ctx: ctx, Event: event, Result: results}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return <-results
+}
+
+func TestPrepareEventExpiredInQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() context.Context
+		timeout time.Duration
+		want    error
+	}{
+		{
+			name: "request cancelled",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			want: context.Canceled,
+		},
+		{
+			name:    "process timeout",
+			ctx:     context.Background,
+			timeout: time.Nanosecond,
+			want:    ErrProcessTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{})
+			p, m := newTestPipeline(t, service, nil, PipelineConfig{ProcessTimeout: tt.timeout})
+
+			result := process(t, p, tt.ctx(), testEvent("evt-1"))
+			if result.Stage != metrics.StageQueue || !errors.Is(result.Err, tt.want) {
+				t.Fatalf("result stage %q, error %v; want stage %q, error %v", result.Stage, result.Err, metrics.StageQueue, tt.want)
+			}
+			if failed := m.Snapshot().Failed[metrics.StageValidate]; failed != 0 {
+				t.Errorf("counted %d validation failures", failed)
+			}
+		})
+	}
+}
+
+func TestShutdownStopsGoroutines(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{name: "drained", timeout: 10 * time.Second},
+		{name: "abandoned", timeout: 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{ProcessDelay: 10 * time.Millisecond})
+			p, _ := newTestPipeline(t, service, nil, PipelineConfig{WorkerCount: 4})
+			for i := range 8 {
+				if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent(fmt.Sprint("evt-", i))}); err != nil {
+					t.Fatalf("Enqueue: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			p.Shutdown(ctx)
+
+			// Workers abandoned by the shutdown stop once their job gives up.
+			running := runtime.NumGoroutine()
+			for deadline := time.Now().Add(time.Second); running > baseline && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				running = runtime.NumGoroutine()
+			}
+			if running > baseline {
+				t.Errorf("%d goroutines running after shutdown, %d before the pipeline started", running, baseline)
+			}
+		})
+	}
+}
+
+// slowRepository takes delay to run a transaction, or until its context is
+// done, like a database that stopped answering.
+type slowRepository struct {
+	storage.EventRepository
+	delay time.Duration
+}
+
+func (r *slowRepository) WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	select {
+	case <-time.After(r.delay):
+		return r.EventRepository.WithTransaction(ctx, fn)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestProcessTimeoutDeadLettersSlowStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		wantErr bool
+	}{
+		{name: "within the timeout", delay: time.Millisecond},
+		{name: "beyond the timeout", delay: time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &slowRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), delay: tt.delay}
+			service := NewEventService(repo, ServiceConfig{})
+			p, _ := newTestPipeline(t, service, nil, PipelineConfig{ProcessTimeout: 50 * time.Millisecond})
+
+			result := process(t, p, context.Background(), testEvent("evt-1"))
+			if !tt.wantErr {
+				if result.Err != nil {
+					t.Fatalf("result error = %v", result.Err)
+				}
+				return
+			}
+			if result.Stage != metrics.StageStore || !errors.Is(result.Err, ErrProcessTimeout) {
+				t.Fatalf("result stage %q, error %v; want stage %q, error %v", result.Stage, result.Err, metrics.StageStore, ErrProcessTimeout)
+			}
+
+			// The result is sent before the worker dead-letters the event.
+			var deadLetters []storage.DeadLetter
+			for deadline := time.Now().Add(time.Second); len(deadLetters) == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				deadLetters, _ = p.deadLetters.List(context.Background(), 10, 0)
+			}
+			if len(deadLetters) != 1 || !strings.Contains(deadLetters[0].Error, ErrProcessTimeout.Error()) {
+				t.Errorf("dead letters = %+v, want one with the timeout as reason", deadLetters)
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsQueuedEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		wantErr     bool
+		wantAllKept bool
+	}{
+		{name: "drained", timeout: 10 * time.Second, wantAllKept: true},
+		{name: "abandoned", timeout: 30 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			service := NewEventService(repo, ServiceConfig{ProcessDelay: 20 * time.Millisecond})
+			p, _ := newTestPipeline(t, service, nil, PipelineConfig{})
+
+			const events = 5
+			for i := range events {
+				if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent(fmt.Sprint("evt-", i))}); err != nil {
+					t.Fatalf("Enqueue: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := p.Shutdown(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Shutdown error = %v, want error %t", err, tt.wantErr)
+			}
+			if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent("late")}); !errors.Is(err, ErrPipelineClosed) {
+				t.Errorf("Enqueue after Shutdown error = %v, want %v", err, ErrPipelineClosed)
+			}
+
+			stored, err := repo.CountEvents(context.Background(), storage.EventFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allKept := stored == events; allKept != tt.wantAllKept {
+				t.Errorf("stored %d of %d events", stored, events)
+			}
+		})
+	}
+}
@@ -1,96 +1,548 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
 	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
 	"event-processing-pipeline/internal/storage"
-	"log"
+	"event-processing-pipeline/internal/tracing"
+	"fmt"
+	"math"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ErrNotAllowed marks validation failures caused by a value outside the
+// configured allow-lists rather than a malformed event.
+var ErrNotAllowed = errors.New("not allowed")
+
 type eventService struct {
 	eventRepository storage.EventRepository
+	cfg             ServiceConfig
+	breaker         *CircuitBreaker
 }
 
 type Validator interface {
-	Validate(ctx gin.Context, event api.EventDTO) error
+	Validate(ctx context.Context, event api.EventDTO) error
 }
 
 type Processor interface {
-	Process(ctx gin.Context, event api.EventDTO) (*storage.ProcessedEvent, error)
+	Process(ctx context.Context, event api.EventDTO) (*storage.ProcessedEvent, error)
 }
 
 type Storage interface {
-	Store(ctx gin.Context, events []storage.ProcessedEvent) error
+	Store(ctx context.Context, events []storage.ProcessedEvent, stopOnError bool) (storage.InsertResult, error)
+	// Upsert overwrites stored events with the same ids and returns how many
+	// events were new and how many replaced stored ones.
+	Upsert(ctx context.Context, events []storage.ProcessedEvent) (inserted, updated int, err error)
+	// PurgeEvents deletes the events matching filter.
+	PurgeEvents(ctx context.Context, filter storage.EventFilter, batchSize int) (int64, error)
+}
+
+type Finder interface {
+	FindEvent(ctx context.Context, id string) (*storage.ProcessedEvent, error)
+	FindEvents(ctx context.Context, filter storage.EventFilter) ([]storage.ProcessedEvent, int64, error)
+	CountEvents(ctx context.Context, filter storage.EventFilter) (int64, error)
+	ExportEvents(ctx context.Context, filter storage.EventFilter, fn func(storage.ProcessedEvent) error) error
+	CountEventsByGroup(ctx context.Context, filter storage.EventFilter, groupBy storage.GroupBy) ([]storage.GroupCount, error)
+	CountEventsByInterval(ctx context.Context, filter storage.EventFilter, interval storage.Interval, groupBy storage.GroupBy) ([]storage.TimeBucket, error)
 }
 
 type EventService interface {
 	Validator
 	Processor
 	Storage
+	Finder
 }
 
-func NewEventService(db *sqlx.DB) EventService {
-	eventRepository := storage.NewEventRepository(db)
+type ServiceConfig struct {
+	ProcessDelay time.Duration
+	// RequireEventID rejects events without an id instead of generating one.
+	RequireEventID bool
+	// MaxClockSkew is how far in the future an event timestamp may be.
+	MaxClockSkew time.Duration
+	// MaxEventAge rejects events older than this. Zero accepts any age.
+	MaxEventAge time.Duration
+	// DefaultType and DefaultSource replace an empty type or source before
+	// validation. Empty defaults keep both fields required.
+	DefaultType   api.EventType
+	DefaultSource api.Source
+	// AllowedTypes and AllowedSources restrict the accepted values, nil
+	// accepts any non-empty value.
+	AllowedTypes   AllowList
+	AllowedSources AllowList
+	// Limits bounds the size of the data fields.
+	Limits Limits
+	// Requirements lists the data fields each event type must set.
+	Requirements TypeRequirements
+	// NonNegativeSources lists the sources whose values may not be negative.
+	// Unlike the allow-lists, nil matches every source; use an empty
+	// AllowList to disable the check.
+	NonNegativeSources AllowList
+	// Enrichers run in order on every processed event before it is stored.
+	Enrichers      []Enricher
+	EnrichFailures EnrichFailurePolicy
+	// Redaction masks or hashes fields after enrichment, so enrichers still
+	// see the original values.
+	Redaction Redaction
+	// Schemas validates the data object per event type, nil skips the check.
+	Schemas *SchemaRegistry
+	// Upgrades bring events of older schema versions to the current shape
+	// before validation. Nil keeps every event at version 1.
+	Upgrades *Upgrades
+	// ValidationMode decides whether Validate collects every failure,
+	// the default, or returns the first.
+	ValidationMode ValidationMode
+	// StoreRetry controls retries of transient storage failures.
+	StoreRetry RetryPolicy
+	// Breaker fails writes fast while the database is unreachable.
+	Breaker BreakerConfig
+	// WAL keeps events whose write failed because the database could not be
+	// reached, for a later replay. Nil fails those writes.
+	WAL *WAL
+	// RequireTenant rejects events processed without a tenant in their
+	// context. Every event is stamped with the tenant of its context, and
+	// every query is scoped to it, either way.
+	RequireTenant bool
+}
 
+func NewEventService(eventRepository storage.EventRepository, cfg ServiceConfig) EventService {
 	return &eventService{
 		eventRepository: eventRepository,
+		cfg:             cfg,
+		breaker:         NewCircuitBreaker(cfg.Breaker),
 	}
 }
 
-func (s *eventService) Validate(ctx gin.Context, event api.EventDTO) error {
-	if event.Type == "" {
-		return errors.New("event type is required")
+// NewEventID returns a time-ordered UUID for events submitted without an id.
+func NewEventID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+
+	return id.String()
+}
+
+func (s *eventService) Validate(ctx context.Context, event api.EventDTO) (err error) {
+	_, span := tracing.Start(ctx, "validate", dtoID(event))
+	defer func() { tracing.End(span, err) }()
+
+	event = s.withDefaults(event)
+	if event, err = s.cfg.Upgrades.Upgrade(event); err != nil {
+		return err
+	}
+
+	checks := []func() error{
+		func() error {
+			if s.cfg.RequireTenant && logging.Tenant(ctx) == "" {
+				return errors.New("event tenant is required")
+			}
+			return nil
+		},
+		func() error {
+			if optional(event.ID) == nil && s.cfg.RequireEventID {
+				return errors.New("event id is required")
+			}
+			return nil
+		},
+		func() error {
+			if event.Type == "" {
+				return errors.New("event type is required")
+			}
+			if !s.cfg.AllowedTypes.Allows(string(event.Type)) {
+				return fmt.Errorf("event type %q is %w", event.Type, ErrNotAllowed)
+			}
+			return nil
+		},
+		func() error {
+			if event.Source == "" {
+				return errors.New("event source is required")
+			}
+			if !s.cfg.AllowedSources.Allows(string(event.Source)) {
+				return fmt.Errorf("event source %q is %w", event.Source, ErrNotAllowed)
+			}
+			return nil
+		},
+		func() error { return s.validateTimestamp(event.Timestamp.Time) },
+		func() error { return s.validateValue(event.Source, event.Data.Value.Float()) },
+		func() error { return validateValueType(event.Data) },
+		func() error { return s.cfg.Limits.Check(event.Data) },
+		func() error { return s.cfg.Requirements.Check(event.Type, event.Data) },
+		func() error {
+			// The schema cannot be checked on a value JSON cannot encode,
+			// which validateValue already reports.
+			if value := event.Data.Value.Float(); math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil
+			}
+			return s.cfg.Schemas.Validate(event.Type, event.Data)
+		},
+	}
+
+	var errs []error
+	for _, check := range checks {
+		if err := check(); err != nil {
+			if s.cfg.ValidationMode == ValidationFailFast {
+				return err
+			}
+			errs = append(errs, err)
+		}
 	}
 
+	return joinValidationErrors(errs)
+}
+
+// withDefaults fills in the configured type and source where the event
+// leaves them empty. Validate and Process both apply it, and the schema
+// upgrades after it, so every entry point sees the same event.
+func (s *eventService) withDefaults(event api.EventDTO) api.EventDTO {
+	if event.Type == "" {
+		event.Type = s.cfg.DefaultType
+	}
 	if event.Source == "" {
-		return errors.New("event source is required")
+		event.Source = s.cfg.DefaultSource
+	}
+	return event
+}
+
+// validateValue rejects NaN and infinities, which JSON cannot carry and the
+// databases refuse, but which still arrive through CSV and protobuf.
+func (s *eventService) validateValue(source api.Source, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("event value must be a finite number, got %v", value)
+	}
+
+	if value < 0 && s.cfg.NonNegativeSources.Allows(string(source)) {
+		return &LimitError{Constraint: "non_negative_value", Limit: 0, Actual: value}
 	}
 
 	return nil
 }
 
-func (s *eventService) Process(ctx gin.Context, event api.EventDTO) (*storage.ProcessedEvent, error) {
-	time.Sleep(10)
+// validateValueType checks that the value can be read as its value type.
+func validateValueType(data api.Data) error {
+	switch data.ValueType {
+	case "", api.ValueTypeFloat:
+		return nil
+	case api.ValueTypeInt:
+		if _, ok := data.Value.Int(); !ok {
+			return fmt.Errorf("event value must be an integer within the int64 range for value_type %q", api.ValueTypeInt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown value_type %q, expected %q or %q", data.ValueType, api.ValueTypeFloat, api.ValueTypeInt)
+	}
+}
+
+func (s *eventService) validateTimestamp(timestamp time.Time) error {
+	if timestamp.IsZero() {
+		return errors.New("event timestamp is required")
+	}
+
+	now := time.Now()
+	if timestamp.After(now.Add(s.cfg.MaxClockSkew)) {
+		return fmt.Errorf("event timestamp is more than %s in the future", s.cfg.MaxClockSkew)
+	}
+
+	if s.cfg.MaxEventAge > 0 && timestamp.Before(now.Add(-s.cfg.MaxEventAge)) {
+		return fmt.Errorf("event timestamp is older than %s", s.cfg.MaxEventAge)
+	}
+
+	return nil
+}
+
+func (s *eventService) Process(ctx context.Context, event api.EventDTO) (_ *storage.ProcessedEvent, err error) {
+	ctx, span := tracing.Start(ctx, "process", dtoID(event))
+	defer func() { tracing.End(span, err) }()
+
+	if s.cfg.ProcessDelay > 0 {
+		select {
+		case <-time.After(s.cfg.ProcessDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	event = s.withDefaults(event)
+	if event, err = s.cfg.Upgrades.Upgrade(event); err != nil {
+		return nil, err
+	}
 
-	return &storage.ProcessedEvent{
-		ID:        *event.ID,
+	id := NewEventID()
+	if eventID := optional(event.ID); eventID != nil {
+		id = *eventID
+	}
+
+	processed := &storage.ProcessedEvent{
+		ID:        id,
 		Type:      storage.EventType(event.Type),
 		Source:    storage.Source(event.Source),
-		Timestamp: event.Timestamp,
-		UserID:    event.UserID,
+		Timestamp: event.Timestamp.UTC(),
+		UserID:    optional(event.UserID),
 		Data: storage.Data{
 			Action:   event.Data.Action,
-			Value:    event.Data.Value,
-			Metadata: event.Data.Metadata,
+			Value:    event.Data.Value.Float(),
+			Metadata: storage.Metadata(event.Data.Metadata),
 		},
-	}, nil
-}
-
-func (s *eventService) Store(ctx gin.Context, events []storage.ProcessedEvent) error {
-	for _, event := range events {
-		savedEvent, err := s.eventRepository.InsertEvent(
-			event.ID,
-			storage.EventType(event.Type),
-			storage.Source(event.Source),
-			event.Timestamp,
-			event.UserID,
-			storage.Data{
-				Action:   event.Data.Action,
-				Value:    event.Data.Value,
-				Metadata: event.Data.Metadata,
-			})
+		SchemaVersion: event.SchemaVersion,
+		TenantID:      logging.Tenant(ctx),
+	}
+	if value, ok := event.Data.Value.Int(); ok && event.Data.ValueType == api.ValueTypeInt {
+		processed.Data.IntValue = &value
+	}
+
+	if err := s.enrich(ctx, processed); err != nil {
+		return nil, err
+	}
+	// Stored events were redacted when first processed; redacting them again
+	// would hash the hashes and lose the values they are joined on.
+	if !reprocessing(ctx) {
+		s.cfg.Redaction.redact(processed)
+	}
+
+	return processed, nil
+}
+
+// Store inserts the events in a single transaction, so either all of them are
+// written or none are. When stopOnError is set they are written as one
+// multi-row batch and the first failure aborts it, otherwise every event is
+// attempted and all failures are joined before rolling back. Transient
+// database errors retry the whole transaction per the StoreRetry policy. When
+// the database cannot be reached and a WAL is configured, the events are
+// appended to it instead and reported as spooled.
+func (s *eventService) Store(ctx context.Context, events []storage.ProcessedEvent, stopOnError bool) (storage.InsertResult, error) {
+	ctx, span := tracing.Start(ctx, "store", batchID(events))
+	span.SetAttributes(attribute.Int("events", len(events)))
+	defer span.End()
+
+	var result storage.InsertResult
+	err := s.breaker.Allow()
+	if err == nil {
+		err = s.cfg.StoreRetry.Do(ctx, func() error {
+			result = storage.InsertResult{}
+			return s.storeTx(ctx, events, stopOnError, &result)
+		})
+		s.recordWrite(ctx, err)
+	}
+	if err != nil && s.spool(ctx, events, err) {
+		return storage.InsertResult{Spooled: len(events)}, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("store %d events: %w", len(events), err)
+		tracing.End(span, err)
+		return storage.InsertResult{}, err
+	}
 
+	logging.FromContext(ctx).Debug("Events saved", "stage", "store", "inserted", result.Inserted, "duplicates", result.Duplicates)
+	return result, nil
+}
+
+// spool appends events to the write-ahead log when their write failed with
+// err because the database could not be reached, and reports whether it did.
+// Writes whose client is gone and writes of a replay are not spooled.
+func (s *eventService) spool(ctx context.Context, events []storage.ProcessedEvent, err error) bool {
+	if s.cfg.WAL == nil || ctx.Err() != nil || replaying(ctx) || !(errors.Is(err, ErrCircuitOpen) || isOutage(err)) {
+		return false
+	}
+
+	logger := logging.FromContext(ctx)
+	if walErr := s.cfg.WAL.Append(events); walErr != nil {
+		logger.Error("Failed to write events to the write-ahead log", "events", len(events), "error", walErr)
+		return false
+	}
+
+	logger.Warn("Database unavailable, events written to the write-ahead log", "events", len(events), "error", err)
+	return true
+}
+
+// recordWrite reports a write to the circuit breaker, unless it failed
+// because its client ran out of time, which tells nothing about the database.
+func (s *eventService) recordWrite(ctx context.Context, err error) {
+	if err != nil && errors.Is(context.Cause(ctx), ErrClientDeadline) {
+		s.breaker.Release()
+		return
+	}
+	s.breaker.Record(err)
+}
+
+// Upsert writes the events in a single transaction, overwriting stored events
+// with the same ids. It shares the retry policy and circuit breaker of Store.
+func (s *eventService) Upsert(ctx context.Context, events []storage.ProcessedEvent) (inserted, updated int, err error) {
+	ctx, span := tracing.Start(ctx, "upsert", batchID(events))
+	span.SetAttributes(attribute.Int("events", len(events)))
+
+	err = s.breaker.Allow()
+	if err == nil {
+		err = s.cfg.StoreRetry.Do(ctx, func() error {
+			var err error
+			inserted, updated, err = s.eventRepository.UpsertEvents(ctx, events)
+			return err
+		})
+		s.recordWrite(ctx, err)
+	}
+	if err != nil {
+		err = fmt.Errorf("upsert %d events: %w", len(events), err)
+		tracing.End(span, err)
+		return 0, 0, err
+	}
+	tracing.End(span, nil)
+
+	logging.FromContext(ctx).Debug("Events upserted", "stage", "store", "inserted", inserted, "updated", updated)
+	return inserted, updated, nil
+}
+
+// PurgeEvents deletes batchSize events per statement until none matching
+// filter are left, so no statement holds its locks for long. On failure it
+// returns the number already deleted along with the error.
+func (s *eventService) PurgeEvents(ctx context.Context, filter storage.EventFilter, batchSize int) (int64, error) {
+	filter = scoped(ctx, filter)
+	var purged int64
+	for {
+		deleted, err := s.eventRepository.DeleteEvents(ctx, filter, batchSize)
+		purged += deleted
 		if err != nil {
-			log.Println("Event saved:", savedEvent)
-			continue
+			return purged, fmt.Errorf("purge events: %w", err)
+		}
+		if deleted < int64(batchSize) {
+			return purged, nil
+		}
+	}
+}
+
+func (s *eventService) storeTx(ctx context.Context, events []storage.ProcessedEvent, stopOnError bool, result *storage.InsertResult) error {
+	return s.eventRepository.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		if stopOnError {
+			var err error
+			*result, err = s.insert(ctx, tx, events)
+			return err
 		}
 
-		return err
+		var errs []error
+		for _, event := range events {
+			inserted, err := s.insert(ctx, tx, []storage.ProcessedEvent{event})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("store event %s: %w", event.ID, err))
+				continue
+			}
+			*result = result.Add(inserted)
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// insert runs a single insert statement group in its own span.
+func (s *eventService) insert(ctx context.Context, tx *sqlx.Tx, events []storage.ProcessedEvent) (storage.InsertResult, error) {
+	ctx, span := tracing.Start(ctx, "insert", batchID(events))
+	span.SetAttributes(attribute.Int("events", len(events)))
+
+	result, err := s.eventRepository.InsertEventsTx(ctx, tx, events)
+	tracing.End(span, err)
+	return result, err
+}
+
+// optional treats an empty string like an absent one, so "id": "" gets a
+// generated id and "user_id": "" is stored as NULL.
+func optional(value *string) *string {
+	if value == nil || *value == "" {
+		return nil
 	}
+	return value
+}
 
-	return nil
+// ToEventDTO converts a stored event back into its API representation.
+func ToEventDTO(event storage.ProcessedEvent) api.EventDTO {
+	id := event.ID
+
+	value, valueType := api.FloatValue(event.Data.Value), api.ValueType("")
+	if event.Data.IntValue != nil {
+		value, valueType = api.IntValue(*event.Data.IntValue), api.ValueTypeInt
+	}
+
+	return api.EventDTO{
+		ID:        &id,
+		Type:      api.EventType(event.Type),
+		Source:    api.Source(event.Source),
+		Timestamp: api.Timestamp{Time: event.Timestamp},
+		UserID:    event.UserID,
+		Data: api.Data{
+			Action:    event.Data.Action,
+			Value:     value,
+			ValueType: valueType,
+			Metadata:  api.Metadata(event.Data.Metadata),
+		},
+		SchemaVersion: event.SchemaVersion,
+	}
+}
+
+// dtoID returns the event's id, empty when it has none yet.
+func dtoID(event api.EventDTO) string {
+	if event.ID == nil {
+		return ""
+	}
+	return *event.ID
+}
+
+// batchID returns the id of a single event batch, empty for larger ones.
+func batchID(events []storage.ProcessedEvent) string {
+	if len(events) != 1 {
+		return ""
+	}
+	return events[0].ID
+}
+
+// scoped restricts filter to the tenant of ctx, if any, so tenants only ever
+// read and delete their own events.
+func scoped(ctx context.Context, filter storage.EventFilter) storage.EventFilter {
+	filter.TenantID = logging.Tenant(ctx)
+	return filter
+}
+
+// FindEvent reports the events of other tenants as not found.
+func (s *eventService) FindEvent(ctx context.Context, id string) (*storage.ProcessedEvent, error) {
+	event, err := s.eventRepository.FindEventByID(ctx, id)
+	if tenant := logging.Tenant(ctx); err == nil && tenant != "" && event.TenantID != tenant {
+		return nil, storage.ErrEventNotFound
+	}
+	return event, err
+}
+
+// FindEvents returns the page of events matching filter along with the total
+// number of matching events.
+func (s *eventService) FindEvents(ctx context.Context, filter storage.EventFilter) ([]storage.ProcessedEvent, int64, error) {
+	filter = scoped(ctx, filter)
+	total, err := s.eventRepository.CountEvents(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count events: %w", err)
+	}
+
+	events, err := s.eventRepository.FindEvents(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("find events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+// ExportEvents streams every event matching filter to fn, oldest first. It
+// stops early once ctx is done.
+func (s *eventService) ExportEvents(ctx context.Context, filter storage.EventFilter, fn func(storage.ProcessedEvent) error) error {
+	return s.eventRepository.ExportEvents(ctx, scoped(ctx, filter), fn)
+}
+
+// CountEvents counts the events matching filter, ignoring Limit and Offset.
+func (s *eventService) CountEvents(ctx context.Context, filter storage.EventFilter) (int64, error) {
+	return s.eventRepository.CountEvents(ctx, scoped(ctx, filter))
+}
+
+func (s *eventService) CountEventsByGroup(ctx context.Context, filter storage.EventFilter, groupBy storage.GroupBy) ([]storage.GroupCount, error) {
+	return s.eventRepository.CountEventsByGroup(ctx, scoped(ctx, filter), groupBy)
+}
+
+func (s *eventService) CountEventsByInterval(ctx context.Context, filter storage.EventFilter, interval storage.Interval, groupBy storage.GroupBy) ([]storage.TimeBucket, error) {
+	return s.eventRepository.CountEventsByInterval(ctx, scoped(ctx, filter), interval, groupBy)
 }
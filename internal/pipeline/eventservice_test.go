@@ -0,0 +1,263 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var errInsertFailed = errors.New("insert failed")
+
+// failingInsertRepository fails inserts of the events with the ids in fail
+// and records the ids of every insert attempted.
+type failingInsertRepository struct {
+	storage.EventRepository
+	fail      map[string]bool
+	attempted []string
+}
+
+func (r *failingInsertRepository) InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []storage.ProcessedEvent) (storage.InsertResult, error) {
+	for _, event := range events {
+		r.attempted = append(r.attempted, event.ID)
+		if r.fail[event.ID] {
+			return storage.InsertResult{}, fmt.Errorf("%w: %s", errInsertFailed, event.ID)
+		}
+	}
+	return r.EventRepository.InsertEventsTx(ctx, tx, events)
+}
+
+func TestStoreMiddleEventFails(t *testing.T) {
+	tests := []struct {
+		name          string
+		stopOnError   bool
+		wantAttempted string
+	}{
+		// Atomic: one insert of all three fails as a whole.
+		{name: "atomic", stopOnError: true, wantAttempted: "[evt-0 evt-1]"},
+		// Partial: every event is tried on its own and the failures joined.
+		{name: "partial", stopOnError: false, wantAttempted: "[evt-0 evt-1 evt-2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &failingInsertRepository{
+				EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}),
+				fail:            map[string]bool{"evt-1": true},
+			}
+			service := NewEventService(repo, ServiceConfig{})
+
+			result, err := service.Store(context.Background(), walEvents("evt-", 3), tt.stopOnError)
+			if !errors.Is(err, errInsertFailed) || !strings.Contains(err.Error(), "evt-1") {
+				t.Fatalf("Store error = %v, want the failure of evt-1", err)
+			}
+			if result.Inserted != 0 {
+				t.Errorf("Store reported %d events inserted", result.Inserted)
+			}
+			if got := fmt.Sprint(repo.attempted); got != tt.wantAttempted {
+				t.Errorf("attempted %s, want %s", got, tt.wantAttempted)
+			}
+
+			// The transaction rolls back whatever was written before the
+			// failure.
+			for _, id := range []string{"evt-0", "evt-2"} {
+				if _, err := repo.FindEventByID(context.Background(), id); err == nil {
+					t.Errorf("%s stored after a failed transaction", id)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessAndStoreWithoutHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{name: "client id", id: "evt-1"},
+		{name: "generated id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			service := NewEventService(repo, ServiceConfig{})
+			ctx := context.Background()
+
+			event := testEvent(tt.id)
+			if tt.id == "" {
+				event.ID = nil
+			}
+			if err := service.Validate(ctx, event); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			processed, err := service.Process(ctx, event)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if processed.ID == "" || tt.id != "" && processed.ID != tt.id {
+				t.Errorf("processed id = %q, want %q or a generated one", processed.ID, tt.id)
+			}
+
+			result, err := service.Store(ctx, []storage.ProcessedEvent{*processed}, true)
+			if err != nil || result.Inserted != 1 {
+				t.Fatalf("Store = %+v, %v; want one event inserted", result, err)
+			}
+			if _, err := repo.FindEventByID(ctx, processed.ID); err != nil {
+				t.Errorf("FindEventByID(%s): %v", processed.ID, err)
+			}
+		})
+	}
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	const skew, maxAge = 5 * time.Minute, time.Hour
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		zero    bool
+		maxAge  time.Duration
+		wantErr string
+	}{
+		{name: "missing", zero: true, wantErr: "event timestamp is required"},
+		{name: "now", offset: 0},
+		{name: "just within the skew", offset: skew - time.Second},
+		{name: "just beyond the skew", offset: skew + time.Second, wantErr: "event timestamp is more than 5m0s in the future"},
+		{name: "old without a maximum age", offset: -24 * time.Hour},
+		{name: "just within the maximum age", offset: -maxAge + time.Second, maxAge: maxAge},
+		{name: "just beyond the maximum age", offset: -maxAge - time.Second, maxAge: maxAge, wantErr: "event timestamp is older than 1h0m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{MaxClockSkew: skew, MaxEventAge: tt.maxAge})
+
+			event := testEvent("evt-1")
+			event.Timestamp = api.Timestamp{Time: time.Now().Add(tt.offset)}
+			if tt.zero {
+				event.Timestamp = api.Timestamp{}
+			}
+
+			err := service.Validate(context.Background(), event)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultTypeAndSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        ServiceConfig
+		eventType  api.EventType
+		source     api.Source
+		wantErr    string
+		wantType   storage.EventType
+		wantSource storage.Source
+	}{
+		{name: "defaults applied", cfg: ServiceConfig{DefaultType: "page_view", DefaultSource: "web"}, wantType: "page_view", wantSource: "web"},
+		{name: "event fields win", cfg: ServiceConfig{DefaultType: "page_view", DefaultSource: "web"}, eventType: "click", source: "mobile", wantType: "click", wantSource: "mobile"},
+		{name: "no default type", cfg: ServiceConfig{DefaultSource: "web"}, wantErr: "event type is required"},
+		{name: "no default source", cfg: ServiceConfig{DefaultType: "page_view"}, eventType: "click", wantErr: "event source is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.MaxClockSkew = time.Minute
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), tt.cfg)
+
+			event := testEvent("evt-1")
+			event.Type, event.Source = tt.eventType, tt.source
+			err := service.Validate(context.Background(), event)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Validate error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+
+			processed, err := service.Process(context.Background(), event)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if processed.Type != tt.wantType || processed.Source != tt.wantSource {
+				t.Errorf("processed type %q, source %q; want %q and %q", processed.Type, processed.Source, tt.wantType, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestProcessNormalizesTimestampToUTC(t *testing.T) {
+	service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{})
+
+	want := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	event := testEvent("evt-1")
+	event.Timestamp = api.Timestamp{Time: want.In(time.FixedZone("CEST", 2*60*60))}
+
+	processed, err := service.Process(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if processed.Timestamp != want {
+		t.Errorf("processed timestamp = %v, want %v", processed.Timestamp, want)
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         api.Source
+		value          float64
+		wantErr        bool
+		wantConstraint string
+	}{
+		{name: "NaN", source: "web", value: math.NaN(), wantErr: true},
+		{name: "positive infinity", source: "web", value: math.Inf(1), wantErr: true},
+		{name: "negative infinity", source: "web", value: math.Inf(-1), wantErr: true},
+		{name: "largest float", source: "web", value: math.MaxFloat64},
+		{name: "smallest float", source: "web", value: math.SmallestNonzeroFloat64},
+		{name: "negative", source: "web", value: -1},
+		{name: "zero from a non-negative source", source: "billing", value: 0},
+		{name: "negative from a non-negative source", source: "billing", value: -0.01, wantErr: true, wantConstraint: "non_negative_value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{
+				MaxClockSkew:       time.Minute,
+				NonNegativeSources: NewAllowList([]string{"billing"}),
+			})
+
+			event := testEvent("evt-1")
+			event.Source = tt.source
+			event.Data.Value = api.FloatValue(tt.value)
+			err := service.Validate(context.Background(), event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate error = %v, want error %t", err, tt.wantErr)
+			}
+
+			var limitErr *LimitError
+			if errors.As(err, &limitErr) != (tt.wantConstraint != "") || (limitErr != nil && limitErr.Constraint != tt.wantConstraint) {
+				t.Errorf("Validate error = %v, want constraint %q", err, tt.wantConstraint)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"event-processing-pipeline/internal/storage"
+	"event-processing-pipeline/internal/tracing"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// flushBuffer collects processed events from all workers and stores them with
+// one multi-row insert once size events are waiting or interval has passed,
+// whichever comes first. A single goroutine owns the batch, so concurrent
+// workers only ever touch the channel.
+type flushBuffer struct {
+	pipeline *EventPipeline
+	size     atomic.Int64
+	interval time.Duration
+	pending  chan bufferedEvent
+	done     chan struct{}
+}
+
+type bufferedEvent struct {
+	pending pendingJob
+	event   *storage.ProcessedEvent
+}
+
+func newFlushBuffer(eventPipeline *EventPipeline, size int, interval time.Duration) *flushBuffer {
+	buffer := &flushBuffer{
+		pipeline: eventPipeline,
+		interval: interval,
+		pending:  make(chan bufferedEvent, size),
+		done:     make(chan struct{}),
+	}
+	buffer.size.Store(int64(size))
+
+	return buffer
+}
+
+func (b *flushBuffer) start() {
+	go b.run()
+}
+
+// add blocks while a full batch is waiting to be flushed, which pushes back
+// on the workers.
+func (b *flushBuffer) add(pending pendingJob, event *storage.ProcessedEvent) {
+	b.pipeline.metrics.AddBuffered(1)
+	b.pending <- bufferedEvent{pending: pending, event: event}
+}
+
+// close flushes the remaining events and waits for the flush to finish. No
+// add may happen after close.
+func (b *flushBuffer) close() {
+	close(b.pending)
+	<-b.done
+}
+
+func (b *flushBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]bufferedEvent, 0, b.size.Load())
+	for {
+		select {
+		case buffered, ok := <-b.pending:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+
+			batch = append(batch, buffered)
+			if int64(len(batch)) >= b.size.Load() {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush stores the batch in one transaction. A single bad event fails the
+// whole insert, so on failure every event is retried on its own to find out
+// which ones to dead-letter.
+func (b *flushBuffer) flush(batch []bufferedEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	p := b.pipeline
+	p.metrics.AddBuffered(-len(batch))
+
+	events := make([]storage.ProcessedEvent, len(batch))
+	for i, buffered := range batch {
+		events[i] = *buffered.event
+	}
+
+	ctx, span := tracing.Start(context.Background(), "flush", "")
+	span.SetAttributes(attribute.Int("events", len(events)))
+
+	start := time.Now()
+	result, err := p.eventService.Store(ctx, events, true)
+	p.metrics.ObserveStore(time.Since(start))
+	tracing.End(span, err)
+
+	if err != nil {
+		for _, buffered := range batch {
+			p.complete(buffered.pending, p.storeEvent(buffered.pending.ctx, buffered.event))
+		}
+		return
+	}
+
+	p.metrics.AddStored(result.Inserted)
+	p.metrics.AddDuplicates(result.Duplicates)
+	p.metrics.AddSpooled(result.Spooled)
+
+	// Of an id repeated within the batch the first occurrence was stored, so
+	// hand out the duplicates from the back.
+	duplicates := make(map[string]int, len(result.DuplicateIDs))
+	for _, id := range result.DuplicateIDs {
+		duplicates[id]++
+	}
+	duplicate := make([]bool, len(batch))
+	for i := len(batch) - 1; i >= 0; i-- {
+		if id := batch[i].event.ID; duplicates[id] > 0 {
+			duplicates[id]--
+			duplicate[i] = true
+		}
+	}
+
+	for i, buffered := range batch {
+		p.complete(buffered.pending, JobResult{Event: buffered.event, Duplicate: duplicate[i], Spooled: result.Spooled > 0})
+	}
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"context"
+	"event-processing-pipeline/internal/storage"
+	"testing"
+	"time"
+)
+
+func TestFlushReportsDuplicatesPerEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		stored        []string
+		ids           []string
+		wantDuplicate []bool
+	}{
+		{name: "none stored", ids: []string{"a", "b", "c"}, wantDuplicate: []bool{false, false, false}},
+		{name: "one stored", stored: []string{"b"}, ids: []string{"a", "b", "c"}, wantDuplicate: []bool{false, true, false}},
+		{name: "all stored", stored: []string{"a", "b", "c"}, ids: []string{"a", "b", "c"}, wantDuplicate: []bool{true, true, true}},
+		{name: "repeated within the batch", ids: []string{"a", "b", "a"}, wantDuplicate: []bool{false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			for _, id := range tt.stored {
+				if _, err := repo.InsertEvents(context.Background(), walEvents(id, 1)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			service := NewEventService(repo, ServiceConfig{})
+			p, m := newTestPipeline(t, service, nil, PipelineConfig{FlushSize: len(tt.ids), FlushInterval: time.Hour})
+
+			// The buffer only flushes once every event is in, so wait for the
+			// results after enqueueing all of them.
+			results := make([]chan JobResult, len(tt.ids))
+			for i, id := range tt.ids {
+				results[i] = make(chan JobResult, 1)
+				if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent(id + "0"), Result: results[i]}); err != nil {
+					t.Fatalf("Enqueue: %v", err)
+				}
+			}
+
+			var wantDuplicates int64
+			for i, want := range tt.wantDuplicate {
+				result := <-results[i]
+				if result.Err != nil || result.Duplicate != want {
+					t.Errorf("event %d (%s): error %v, duplicate %t; want duplicate %t", i, tt.ids[i], result.Err, result.Duplicate, want)
+				}
+				if want {
+					wantDuplicates++
+				}
+			}
+			if got := m.Snapshot().Duplicates; got != wantDuplicates {
+				t.Errorf("metrics duplicates = %d, want %d", got, wantDuplicates)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// GeoIPEnricher resolves the IP address in one metadata key to a country code
+// stored in another, using a static table of network ranges. Events without
+// the IP key, or with an address outside every range, are left untouched.
+type GeoIPEnricher struct {
+	ranges     []geoIPRange
+	ipKey      string
+	countryKey string
+}
+
+type geoIPRange struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// LoadGeoIPEnricher reads a CSV file of "cidr,country" rows, such as
+// "203.0.113.0/24,NZ". Lines starting with "#" are ignored.
+func LoadGeoIPEnricher(path, ipKey, countryKey string) (*GeoIPEnricher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	enricher := &GeoIPEnricher{ipKey: ipKey, countryKey: countryKey}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		enricher.ranges = append(enricher.ranges, geoIPRange{prefix: prefix.Masked(), country: strings.TrimSpace(record[1])})
+	}
+
+	// Most specific ranges first, so the first match wins.
+	slices.SortStableFunc(enricher.ranges, func(a, b geoIPRange) int {
+		return cmp.Compare(b.prefix.Bits(), a.prefix.Bits())
+	})
+
+	return enricher, nil
+}
+
+func (e *GeoIPEnricher) Enrich(_ context.Context, event *storage.ProcessedEvent) error {
+	raw, ok := event.Data.Metadata[e.ipKey]
+	if !ok {
+		return nil
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("metadata %q is not a string", e.ipKey)
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return fmt.Errorf("metadata %q: %w", e.ipKey, err)
+	}
+	addr = addr.Unmap()
+
+	for _, r := range e.ranges {
+		if r.prefix.Contains(addr) {
+			event.Data.Metadata[e.countryKey] = r.country
+			return nil
+		}
+	}
+
+	return nil
+}
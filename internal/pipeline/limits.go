@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	api "event-processing-pipeline/internal/api/dtos"
+)
+
+// Limits bounds the size of event fields. Zero or nil fields are unlimited.
+type Limits struct {
+	MaxMetadataKeys  int
+	MaxMetadataBytes int
+	// MaxActionLength counts characters, not bytes.
+	MaxActionLength int
+	MinValue        *float64
+	MaxValue        *float64
+}
+
+// LimitError reports the constraint an event violated.
+type LimitError struct {
+	Constraint string
+	Limit      interface{}
+	Actual     interface{}
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s is %v, got %v", e.Constraint, e.Limit, e.Actual)
+}
+
+// Check returns a *LimitError for the first limit data exceeds.
+func (l Limits) Check(data api.Data) error {
+	if l.MaxActionLength > 0 {
+		if length := utf8.RuneCountInString(data.Action); length > l.MaxActionLength {
+			return &LimitError{Constraint: "max_action_length", Limit: l.MaxActionLength, Actual: length}
+		}
+	}
+
+	value := data.Value.Float()
+	if l.MinValue != nil && value < *l.MinValue {
+		return &LimitError{Constraint: "min_value", Limit: *l.MinValue, Actual: value}
+	}
+	if l.MaxValue != nil && value > *l.MaxValue {
+		return &LimitError{Constraint: "max_value", Limit: *l.MaxValue, Actual: value}
+	}
+
+	if l.MaxMetadataKeys > 0 && len(data.Metadata) > l.MaxMetadataKeys {
+		return &LimitError{Constraint: "max_metadata_keys", Limit: l.MaxMetadataKeys, Actual: len(data.Metadata)}
+	}
+
+	if l.MaxMetadataBytes > 0 && data.Metadata != nil {
+		encoded, err := json.Marshal(data.Metadata)
+		if err != nil {
+			return fmt.Errorf("encode metadata: %w", err)
+		}
+		if len(encoded) > l.MaxMetadataBytes {
+			return &LimitError{Constraint: "max_metadata_bytes", Limit: l.MaxMetadataBytes, Actual: len(encoded)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"strings"
+	"testing"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	minValue, maxValue := -1.0, 100.0
+	limits := Limits{
+		MaxMetadataKeys: 2,
+		// {"k":"xxxxx"} is 13 bytes, as is {"a":1,"b":2}.
+		MaxMetadataBytes: 13,
+		MaxActionLength:  5,
+		MinValue:         &minValue,
+		MaxValue:         &maxValue,
+	}
+
+	tests := []struct {
+		name           string
+		data           api.Data
+		wantConstraint string
+	}{
+		{name: "action at the limit", data: api.Data{Action: "héllo"}},
+		{name: "action over the limit", data: api.Data{Action: "héllo!"}, wantConstraint: "max_action_length"},
+		{name: "value at the minimum", data: api.Data{Value: api.FloatValue(-1)}},
+		{name: "value under the minimum", data: api.Data{Value: api.FloatValue(-1.5)}, wantConstraint: "min_value"},
+		{name: "value at the maximum", data: api.Data{Value: api.FloatValue(100)}},
+		{name: "value over the maximum", data: api.Data{Value: api.FloatValue(100.5)}, wantConstraint: "max_value"},
+		{name: "keys at the limit", data: api.Data{Metadata: api.Metadata{"a": 1, "b": 2}}},
+		{name: "keys over the limit", data: api.Data{Metadata: api.Metadata{"a": 1, "b": 2, "c": 3}}, wantConstraint: "max_metadata_keys"},
+		{name: "bytes at the limit", data: api.Data{Metadata: api.Metadata{"k": "xxxxx"}}},
+		{name: "bytes over the limit", data: api.Data{Metadata: api.Metadata{"k": "xxxxxx"}}, wantConstraint: "max_metadata_bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.Check(tt.data)
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				if tt.wantConstraint != "" || err != nil {
+					t.Fatalf("Check error = %v, want constraint %q", err, tt.wantConstraint)
+				}
+				return
+			}
+			if limitErr.Constraint != tt.wantConstraint {
+				t.Errorf("constraint = %s, want %q", limitErr.Constraint, tt.wantConstraint)
+			}
+		})
+	}
+}
+
+func TestLimitsZeroIsUnlimited(t *testing.T) {
+	data := api.Data{
+		Action:   strings.Repeat("a", 1000),
+		Value:    api.FloatValue(-1e9),
+		Metadata: api.Metadata{"a": 1, "b": 2, "c": strings.Repeat("x", 1000)},
+	}
+	if err := (Limits{}).Check(data); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
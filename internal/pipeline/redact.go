@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// RedactStrategy decides how a redacted value is stored.
+type RedactStrategy string
+
+const (
+	// RedactMask replaces the value with a fixed mask, hiding its length.
+	RedactMask RedactStrategy = "mask"
+	// RedactPartial masks all but the last few characters of the value.
+	RedactPartial RedactStrategy = "partial"
+	// RedactHash replaces the value with its hex SHA-256, so equal values
+	// still match each other.
+	RedactHash RedactStrategy = "hash"
+)
+
+const (
+	redactedMask = "****"
+	// partialVisible is the number of trailing characters RedactPartial
+	// keeps. Values shorter than twice that are masked in full.
+	partialVisible = 4
+)
+
+// ParseRedactStrategy returns the strategy named s.
+func ParseRedactStrategy(s string) (RedactStrategy, error) {
+	switch strategy := RedactStrategy(strings.ToLower(s)); strategy {
+	case RedactMask, RedactPartial, RedactHash:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown redaction strategy %q, expected mask, partial or hash", s)
+	}
+}
+
+// Redaction lists the fields masked or hashed before events are stored. The
+// zero value redacts nothing.
+type Redaction struct {
+	// Metadata maps metadata keys to the strategy applied to their values.
+	Metadata map[string]RedactStrategy
+	// UserID is the strategy applied to the user id, empty keeps it.
+	UserID RedactStrategy
+}
+
+// redact applies the configured strategies to event. The metadata map is
+// copied before the first change so the caller's event is never written.
+// Null values are left alone, other non-string values are redacted in their
+// JSON form.
+func (r Redaction) redact(event *storage.ProcessedEvent) {
+	if r.UserID != "" && event.UserID != nil {
+		userID := r.UserID.apply(*event.UserID)
+		event.UserID = &userID
+	}
+
+	cloned := false
+	for key, strategy := range r.Metadata {
+		value, ok := event.Data.Metadata[key]
+		if !ok || value == nil {
+			continue
+		}
+		if !cloned {
+			event.Data.Metadata = maps.Clone(event.Data.Metadata)
+			cloned = true
+		}
+		event.Data.Metadata[key] = strategy.apply(redactInput(value))
+	}
+}
+
+func (s RedactStrategy) apply(value string) string {
+	switch s {
+	case RedactHash:
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	case RedactPartial:
+		runes := []rune(value)
+		if len(runes) < 2*partialVisible {
+			return strings.Repeat("*", len(runes))
+		}
+		return strings.Repeat("*", len(runes)-partialVisible) + string(runes[len(runes)-partialVisible:])
+	default:
+		return redactedMask
+	}
+}
+
+// redactInput returns the text a metadata value is redacted from.
+func redactInput(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"reflect"
+	"testing"
+)
+
+func TestRedactStrategies(t *testing.T) {
+	tests := []struct {
+		strategy RedactStrategy
+		value    string
+		want     string
+	}{
+		{strategy: RedactMask, value: "jane@example.com", want: "****"},
+		{strategy: RedactMask, value: "", want: "****"},
+		{strategy: RedactPartial, value: "4111111111111111", want: "************1111"},
+		{strategy: RedactPartial, value: "ümlautsß", want: "****utsß"},
+		{strategy: RedactPartial, value: "1234567", want: "*******"},
+		{strategy: RedactHash, value: "jane@example.com", want: "8c87b489ce35cf2e2f39f80e282cb2e804932a56a213983eeeb428407d43b52d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy)+" "+tt.value, func(t *testing.T) {
+			if got := tt.strategy.apply(tt.value); got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRedactStrategy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    RedactStrategy
+		wantErr bool
+	}{
+		{name: "mask", want: RedactMask},
+		{name: "Partial", want: RedactPartial},
+		{name: "HASH", want: RedactHash},
+		{name: "drop", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRedactStrategy(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRedactStrategy error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRedactStrategy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredEventIsRedacted(t *testing.T) {
+	userID := "user-12345678"
+	tests := []struct {
+		name         string
+		redaction    Redaction
+		wantUserID   string
+		wantMetadata storage.Metadata
+	}{
+		{
+			name:         "nothing configured",
+			wantUserID:   "user-12345678",
+			wantMetadata: storage.Metadata{"email": "jane@example.com", "card": json.Number("4111111111111111"), "plan": "pro", "ip": nil},
+		},
+		{
+			name: "metadata keys",
+			redaction: Redaction{Metadata: map[string]RedactStrategy{
+				"email":   RedactHash,
+				"card":    RedactPartial,
+				"ip":      RedactMask,
+				"missing": RedactMask,
+			}},
+			wantUserID: "user-12345678",
+			wantMetadata: storage.Metadata{
+				"email": "8c87b489ce35cf2e2f39f80e282cb2e804932a56a213983eeeb428407d43b52d",
+				"card":  "************1111",
+				"plan":  "pro",
+				"ip":    nil,
+			},
+		},
+		{
+			name:         "user id",
+			redaction:    Redaction{UserID: RedactPartial},
+			wantUserID:   "*********5678",
+			wantMetadata: storage.Metadata{"email": "jane@example.com", "card": json.Number("4111111111111111"), "plan": "pro", "ip": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+			service := NewEventService(repo, ServiceConfig{Redaction: tt.redaction})
+			p, _ := newTestPipeline(t, service, nil, PipelineConfig{})
+
+			event := testEvent("evt-1")
+			event.UserID = &userID
+			event.Data.Metadata = api.Metadata{"email": "jane@example.com", "card": json.Number("4111111111111111"), "plan": "pro", "ip": nil}
+			if result := process(t, p, context.Background(), event); result.Err != nil {
+				t.Fatalf("process: %v", result.Err)
+			}
+
+			stored, err := repo.FindEventByID(context.Background(), "evt-1")
+			if err != nil {
+				t.Fatalf("FindEventByID: %v", err)
+			}
+			if stored.UserID == nil || *stored.UserID != tt.wantUserID {
+				t.Errorf("stored user id = %v, want %s", stored.UserID, tt.wantUserID)
+			}
+			if !reflect.DeepEqual(stored.Data.Metadata, tt.wantMetadata) {
+				t.Errorf("stored metadata = %#v, want %#v", stored.Data.Metadata, tt.wantMetadata)
+			}
+			if stored.Type != "user_action" || stored.Source != "web" || stored.Data.Action != "click" || stored.Data.Value != 1 {
+				t.Errorf("stored event %+v, want the other fields intact", stored)
+			}
+			if event.Data.Metadata["email"] != "jane@example.com" {
+				t.Errorf("redaction changed the caller's metadata to %v", event.Data.Metadata)
+			}
+		})
+	}
+}
+
+func TestReplayKeepsRedactedValues(t *testing.T) {
+	repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{})
+	service := NewEventService(repo, ServiceConfig{Redaction: Redaction{
+		Metadata: map[string]RedactStrategy{"email": RedactHash, "card": RedactPartial},
+		UserID:   RedactHash,
+	}})
+	p, _ := newTestPipeline(t, service, nil, PipelineConfig{})
+
+	userID := "user-12345678"
+	event := testEvent("evt-1")
+	event.UserID = &userID
+	event.Data.Metadata = api.Metadata{"email": "jane@example.com", "card": "4111111111111111"}
+	if result := process(t, p, context.Background(), event); result.Err != nil {
+		t.Fatalf("process: %v", result.Err)
+	}
+	before, err := repo.FindEventByID(context.Background(), "evt-1")
+	if err != nil {
+		t.Fatalf("FindEventByID: %v", err)
+	}
+
+	replayer := NewReplayer(service, nil, ReplayConfig{Sink: ReplaySinkStore, BatchSize: 10})
+	if result, err := replayer.Replay(context.Background(), storage.EventFilter{}, false); err != nil || result.Replayed != 1 {
+		t.Fatalf("Replay = %+v, %v; want 1 event replayed", result, err)
+	}
+
+	after, err := repo.FindEventByID(context.Background(), "evt-1")
+	if err != nil {
+		t.Fatalf("FindEventByID: %v", err)
+	}
+	if *after.UserID != *before.UserID || !reflect.DeepEqual(after.Data.Metadata, before.Data.Metadata) {
+		t.Errorf("replay changed the stored event from user %s, metadata %v to user %s, metadata %v",
+			*before.UserID, before.Data.Metadata, *after.UserID, after.Data.Metadata)
+	}
+}
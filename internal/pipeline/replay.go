@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrReplayRunning is returned while another replay is in progress.
+var ErrReplayRunning = errors.New("a replay is already running")
+
+// ReplaySink is where reprocessed events go.
+type ReplaySink string
+
+const (
+	// ReplaySinkStore overwrites the stored events with the reprocessed ones.
+	ReplaySinkStore ReplaySink = "store"
+	// ReplaySinkPublish only sends the reprocessed events to the publisher,
+	// leaving storage untouched.
+	ReplaySinkPublish ReplaySink = "publish"
+)
+
+type ReplayConfig struct {
+	Sink ReplaySink
+	// Rate caps the events replayed per second, zero means unlimited.
+	Rate rate.Limit
+	// BatchSize is the number of events written per transaction.
+	BatchSize int
+}
+
+// ReplayResult reports a replay. Matched is the number of stored events the
+// filter selected; for a dry run nothing else is set.
+//
+// @Schema ReplayResult
+// @Property matched integer
+// @Property replayed integer
+// @Property failed integer
+// @Property dry_run boolean
+type ReplayResult struct {
+	Matched  int64 `json:"matched"`
+	Replayed int   `json:"replayed"`
+	Failed   int   `json:"failed"`
+	DryRun   bool  `json:"dry_run"`
+}
+
+type replayContextKey struct{}
+
+// reprocessing reports whether ctx belongs to a Replayer reading stored
+// events back through Process.
+func reprocessing(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayContextKey{}).(bool)
+	return replay
+}
+
+// Replayer reads stored events back through Process, so a fixed enricher can
+// be applied to history. Replays run one at a time and are rate limited, so
+// they cannot starve live ingestion of the database.
+type Replayer struct {
+	eventService EventService
+	publisher    Publisher
+	cfg          ReplayConfig
+	limiter      *rate.Limiter
+	running      atomic.Bool
+}
+
+// NewReplayer creates a replayer. publisher is required for
+// ReplaySinkPublish only.
+func NewReplayer(eventService EventService, publisher Publisher, cfg ReplayConfig) *Replayer {
+	limit := cfg.Rate
+	if limit <= 0 {
+		limit = rate.Inf
+	}
+
+	return &Replayer{
+		eventService: eventService,
+		publisher:    publisher,
+		cfg:          cfg,
+		limiter:      rate.NewLimiter(limit, max(int(cfg.Rate), 1)),
+	}
+}
+
+// Replay reprocesses every stored event matching filter, oldest first.
+// Events failing Process are counted and logged but do not stop the replay;
+// a write failure does, returning the partial result with the error. With
+// dryRun the matching events are only counted.
+func (r *Replayer) Replay(ctx context.Context, filter storage.EventFilter, dryRun bool) (ReplayResult, error) {
+	if !r.running.CompareAndSwap(false, true) {
+		return ReplayResult{}, ErrReplayRunning
+	}
+	defer r.running.Store(false)
+
+	filter.Limit, filter.Offset = 0, 0
+	if dryRun {
+		matched, err := r.eventService.CountEvents(ctx, filter)
+		return ReplayResult{Matched: matched, DryRun: true}, err
+	}
+
+	ctx = context.WithValue(ctx, replayContextKey{}, true)
+	logger := logging.FromContext(ctx)
+	var result ReplayResult
+	batch := make([]storage.ProcessedEvent, 0, r.cfg.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := r.write(ctx, batch); err != nil {
+			return err
+		}
+		result.Replayed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := r.eventService.ExportEvents(ctx, filter, func(event storage.ProcessedEvent) error {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		result.Matched++
+
+		processed, err := r.eventService.Process(ctx, ToEventDTO(event))
+		if err != nil {
+			result.Failed++
+			logger.Warn("Replay failed to process event", "event_id", event.ID, "error", err)
+			return nil
+		}
+
+		batch = append(batch, *processed)
+		if len(batch) >= r.cfg.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return result, fmt.Errorf("replay: %w", err)
+	}
+
+	logger.Info("Replay finished", "sink", r.cfg.Sink, "matched", result.Matched, "replayed", result.Replayed, "failed", result.Failed)
+	return result, nil
+}
+
+func (r *Replayer) write(ctx context.Context, events []storage.ProcessedEvent) error {
+	if r.cfg.Sink == ReplaySinkPublish {
+		for _, event := range events {
+			r.publisher.Publish(event)
+		}
+		return nil
+	}
+
+	_, _, err := r.eventService.Upsert(ctx, events)
+	return err
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"fmt"
+
+	api "event-processing-pipeline/internal/api/dtos"
+)
+
+// Requirement lists the data fields an event type must set.
+type Requirement struct {
+	// Action requires a non-empty action.
+	Action bool
+	// MetadataKeys must be present in the metadata and not null.
+	MetadataKeys []string
+}
+
+// TypeRequirements maps event types to the fields they require. Types without
+// an entry require nothing beyond the usual validation. It is a lighter
+// alternative to per-type JSON Schemas.
+type TypeRequirements map[api.EventType]Requirement
+
+// RequirementError reports a field required by the event type that the event
+// does not set.
+type RequirementError struct {
+	Type  api.EventType
+	Field string
+}
+
+func (e *RequirementError) Error() string {
+	return fmt.Sprintf("events of type %q require %s", e.Type, e.Field)
+}
+
+// Check returns a *RequirementError for the first required field data lacks.
+func (r TypeRequirements) Check(eventType api.EventType, data api.Data) error {
+	requirement, ok := r[eventType]
+	if !ok {
+		return nil
+	}
+
+	if requirement.Action && data.Action == "" {
+		return &RequirementError{Type: eventType, Field: "data.action"}
+	}
+
+	for _, key := range requirement.MetadataKeys {
+		if data.Metadata[key] == nil {
+			return &RequirementError{Type: eventType, Field: "data.metadata." + key}
+		}
+	}
+
+	return nil
+}
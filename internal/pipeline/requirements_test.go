@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"testing"
+	"time"
+)
+
+func TestValidateTypeRequirements(t *testing.T) {
+	requirements := TypeRequirements{
+		"click":    {Action: true},
+		"purchase": {MetadataKeys: []string{"order_id", "currency"}},
+	}
+
+	tests := []struct {
+		name      string
+		eventType api.EventType
+		action    string
+		metadata  map[string]any
+		wantField string
+	}{
+		{name: "click with an action", eventType: "click", action: "button"},
+		{name: "click without an action", eventType: "click", wantField: "data.action"},
+		{name: "purchase with its keys", eventType: "purchase", metadata: map[string]any{"order_id": "o-1", "currency": "EUR"}},
+		{name: "purchase missing a key", eventType: "purchase", metadata: map[string]any{"order_id": "o-1"}, wantField: "data.metadata.currency"},
+		{name: "purchase with a null key", eventType: "purchase", metadata: map[string]any{"order_id": nil, "currency": "EUR"}, wantField: "data.metadata.order_id"},
+		{name: "purchase without metadata", eventType: "purchase", wantField: "data.metadata.order_id"},
+		{name: "type without requirements", eventType: "user_action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{
+				MaxClockSkew: time.Minute,
+				Requirements: requirements,
+			})
+
+			event := testEvent("evt-1")
+			event.Type = tt.eventType
+			event.Data.Action = tt.action
+			event.Data.Metadata = tt.metadata
+			err := service.Validate(context.Background(), event)
+
+			var requirementErr *RequirementError
+			if errors.As(err, &requirementErr) != (tt.wantField != "") {
+				t.Fatalf("Validate error = %v, want a requirement error %t", err, tt.wantField != "")
+			}
+			if requirementErr == nil {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if requirementErr.Field != tt.wantField || requirementErr.Type != tt.eventType {
+				t.Errorf("requirement error for %s %s, want %s %s", requirementErr.Type, requirementErr.Field, tt.eventType, tt.wantField)
+			}
+		})
+	}
+}
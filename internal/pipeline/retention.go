@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"event-processing-pipeline/internal/logging"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"log/slog"
+	"time"
+)
+
+type RetentionConfig struct {
+	// MaxAge is how long events are kept. Zero keeps them forever, leaving
+	// only manual purges.
+	MaxAge time.Duration
+	// Interval is the time between automatic purges.
+	Interval time.Duration
+	// BatchSize is the number of events deleted per statement.
+	BatchSize int
+}
+
+// Retention deletes old events, on a schedule through Run and on demand
+// through Purge.
+type Retention struct {
+	eventService EventService
+	metrics      *metrics.Metrics
+	cfg          RetentionConfig
+}
+
+func NewRetention(eventService EventService, m *metrics.Metrics, cfg RetentionConfig) *Retention {
+	return &Retention{
+		eventService: eventService,
+		metrics:      m,
+		cfg:          cfg,
+	}
+}
+
+// Purge deletes every event matching filter and returns how many were
+// deleted, including those deleted before a failure.
+func (r *Retention) Purge(ctx context.Context, filter storage.EventFilter) (int64, error) {
+	start := time.Now()
+	purged, err := r.eventService.PurgeEvents(ctx, filter, r.cfg.BatchSize)
+	r.metrics.AddPurged(purged)
+
+	logger := logging.FromContext(ctx)
+	if err != nil {
+		logger.Error("Purge failed", "filter", filter, "purged", purged, "error", err)
+		return purged, err
+	}
+	logger.Info("Purged events", "filter", filter, "purged", purged, "duration", time.Since(start).String())
+
+	return purged, nil
+}
+
+// Run purges events older than MaxAge every Interval, starting right away,
+// until ctx is done. It returns immediately when MaxAge is zero.
+func (r *Retention) Run(ctx context.Context) {
+	if r.cfg.MaxAge <= 0 {
+		return
+	}
+
+	slog.Info("Retention enabled", "max_age", r.cfg.MaxAge.String(), "interval", r.cfg.Interval.String())
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Failures are logged by Purge and retried on the next tick.
+		r.Purge(ctx, storage.EventFilter{Before: time.Now().Add(-r.cfg.MaxAge)})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
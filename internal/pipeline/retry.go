@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"event-processing-pipeline/internal/storage"
+	"math/rand/v2"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+const (
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+const (
+	postgresErrUniqueViolation      = "23505"
+	postgresErrSerializationFailure = "40001"
+	postgresErrDeadlock             = "40P01"
+	postgresErrLockNotAvailable     = "55P03"
+)
+
+type RetryPolicy struct {
+	MaxRetries  int
+	BaseBackoff time.Duration
+}
+
+// Do runs fn until it succeeds, returns a non-transient error, or MaxRetries
+// retries are used up. Retries back off exponentially with full jitter.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := 0; attempt < p.MaxRetries && err != nil && isTransient(err); attempt++ {
+		backoff := p.BaseBackoff << attempt
+		if backoff > 0 {
+			backoff = rand.N(backoff) + 1
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+
+		err = fn()
+	}
+
+	return err
+}
+
+// isTransient reports whether err is worth retrying: lost or refused
+// connections, deadlocks, lock wait timeouts and statement timeouts.
+// Constraint violations and other query errors are not.
+func isTransient(err error) bool {
+	if errors.Is(err, storage.ErrStatementTimeout) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+
+	var postgresErr *pq.Error
+	if errors.As(err, &postgresErr) {
+		switch postgresErr.Code {
+		case postgresErrSerializationFailure, postgresErrDeadlock, postgresErrLockNotAvailable:
+			return true
+		}
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// isDuplicate reports whether err is the duplicate key error of an insert
+// under storage.DedupError.
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDuplicateEntry
+	}
+
+	var postgresErr *pq.Error
+	if errors.As(err, &postgresErr) {
+		return postgresErr.Code == postgresErrUniqueViolation
+	}
+
+	return errors.Is(err, storage.ErrDuplicateEvent)
+}
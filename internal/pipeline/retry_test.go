@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	errDeadlock  = &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+	errDuplicate = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+)
+
+// failingTxRepository fails its first failures transactions with err.
+type failingTxRepository struct {
+	storage.EventRepository
+	err      error
+	failures int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (r *failingTxRepository) WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	r.mu.Lock()
+	r.attempts++
+	fail := r.attempts <= r.failures
+	r.mu.Unlock()
+	if fail {
+		return r.err
+	}
+	return r.EventRepository.WithTransaction(ctx, fn)
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds at once", wantAttempts: 1},
+		{name: "deadlock twice", err: errDeadlock, failures: 2, wantAttempts: 3},
+		{name: "lock wait timeout", err: &mysql.MySQLError{Number: mysqlErrLockWaitTimeout}, failures: 1, wantAttempts: 2},
+		{name: "statement timeout", err: storage.ErrStatementTimeout, failures: 1, wantAttempts: 2},
+		{name: "retries exhausted", err: errDeadlock, failures: 5, wantAttempts: 4, wantErr: true},
+		{name: "constraint violation", err: errDuplicate, failures: 1, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxRetries: 3, BaseBackoff: time.Millisecond}
+
+			attempts := 0
+			err := policy.Do(context.Background(), func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do error = %v, want error %t", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	policy := RetryPolicy{MaxRetries: 3, BaseBackoff: time.Hour}
+	err := policy.Do(ctx, func() error { return errDeadlock })
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errDeadlock) {
+		t.Errorf("Do error = %v, want the deadlock and the cancellation", err)
+	}
+}
+
+func TestStoreRetriesTransientFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		failures       int
+		wantAttempts   int
+		wantDeadLetter bool
+	}{
+		{name: "fails twice then succeeds", err: errDeadlock, failures: 2, wantAttempts: 3},
+		{name: "retries exhausted", err: errDeadlock, failures: 10, wantAttempts: 3, wantDeadLetter: true},
+		{name: "constraint violation", err: errDuplicate, failures: 1, wantAttempts: 1, wantDeadLetter: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &failingTxRepository{
+				EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}),
+				err:             tt.err,
+				failures:        tt.failures,
+			}
+			service := NewEventService(repo, ServiceConfig{StoreRetry: RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond}})
+			p, _ := newTestPipeline(t, service, nil, PipelineConfig{})
+
+			result := process(t, p, context.Background(), testEvent("evt-1"))
+			if (result.Err != nil) != tt.wantDeadLetter {
+				t.Fatalf("result error = %v, want error %t", result.Err, tt.wantDeadLetter)
+			}
+			if result.Err != nil && result.Stage != metrics.StageStore {
+				t.Errorf("failed stage = %s, want %s", result.Stage, metrics.StageStore)
+			}
+			if repo.attempts != tt.wantAttempts {
+				t.Errorf("transactions = %d, want %d", repo.attempts, tt.wantAttempts)
+			}
+
+			// The result is sent before the worker dead-letters the event.
+			wantDeadLetters := int64(0)
+			if tt.wantDeadLetter {
+				wantDeadLetters = 1
+			}
+			var count int64
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				if count, _ = p.deadLetters.Count(context.Background()); count == wantDeadLetters {
+					break
+				}
+			}
+			if count != wantDeadLetters {
+				t.Errorf("dead letters = %d, want %d", count, wantDeadLetters)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package pipeline
+
+import (
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/logging"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RetryQueueConfig controls the retries of retryable jobs whose event failed
+// to store. Unlike RetryPolicy, which retries a statement on the spot, the
+// queue gives the job back to the workers later, so an outage of minutes does
+// not dead-letter every event it hits.
+type RetryQueueConfig struct {
+	// MaxAttempts is how often storing an event is attempted in total before
+	// it is dead-lettered. Below 2 the queue is disabled.
+	MaxAttempts int
+	// MaxSize bounds the events waiting for a retry. Failures finding the
+	// queue full are dead-lettered right away.
+	MaxSize int
+	// BaseBackoff is the wait before the first retry, doubled for every
+	// further one up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// PendingRetry describes an event waiting in the retry queue.
+//
+// @Schema PendingRetry
+// @Property event_id string
+// @Property type string
+// @Property source string
+// @Property attempts integer Failed attempts to store the event so far
+// @Property next_retry date-time
+// @Property last_error string
+type PendingRetry struct {
+	EventID string        `json:"event_id"`
+	Type    api.EventType `json:"type"`
+	Source  api.Source    `json:"source"`
+	// Attempts is the number of failed attempts to store the event so far.
+	Attempts  int       `json:"attempts"`
+	NextRetry time.Time `json:"next_retry"`
+	LastError string    `json:"last_error"`
+}
+
+type retryItem struct {
+	job    Job
+	result JobResult
+	next   time.Time
+}
+
+// retryQueue holds failed jobs until their next attempt is due and hands them
+// back to the workers from a single scheduler goroutine. A nil queue retries
+// nothing.
+type retryQueue struct {
+	pipeline *EventPipeline
+	cfg      RetryQueueConfig
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+
+	mu sync.Mutex
+	// items is ordered by next attempt.
+	items   []*retryItem
+	started bool
+	closed  bool
+}
+
+func newRetryQueue(eventPipeline *EventPipeline, cfg RetryQueueConfig) *retryQueue {
+	if cfg.MaxAttempts < 2 || cfg.MaxSize <= 0 {
+		return nil
+	}
+
+	return &retryQueue{
+		pipeline: eventPipeline,
+		cfg:      cfg,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (q *retryQueue) start() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.started && !q.closed {
+		q.started = true
+		go q.run()
+	}
+}
+
+// schedule queues job for another attempt after its store failed with
+// result. It reports false when the job is not retryable, has used up its
+// attempts, was abandoned or finds the queue full or closed; the caller then
+// finishes the job as failed.
+func (q *retryQueue) schedule(job Job, result JobResult) bool {
+	if q == nil || !job.Retryable || errors.Is(result.Err, ErrPipelineAbandoned) {
+		return false
+	}
+
+	failed := job.attempts + 1
+	if failed >= q.cfg.MaxAttempts {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || len(q.items) >= q.cfg.MaxSize {
+		return false
+	}
+
+	job.attempts = failed
+	q.insert(&retryItem{job: job, result: result, next: time.Now().Add(q.backoff(failed))})
+	return true
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (q *retryQueue) backoff(failed int) time.Duration {
+	backoff := q.cfg.BaseBackoff << (failed - 1)
+	if backoff <= 0 || (q.cfg.MaxBackoff > 0 && backoff > q.cfg.MaxBackoff) {
+		backoff = q.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// insert adds item in order of next attempt and wakes the scheduler. q.mu
+// must be held.
+func (q *retryQueue) insert(item *retryItem) {
+	i, _ := slices.BinarySearchFunc(q.items, item.next, func(queued *retryItem, next time.Time) int {
+		return queued.next.Compare(next)
+	})
+	q.items = slices.Insert(q.items, i, item)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *retryQueue) run() {
+	defer close(q.stopped)
+
+	timer := time.NewTimer(q.untilNext())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		case <-timer.C:
+			q.resubmitDue()
+		}
+		timer.Reset(q.untilNext())
+	}
+}
+
+// untilNext returns how long the scheduler may sleep before an item is due.
+func (q *retryQueue) untilNext() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return time.Hour
+	}
+	return max(time.Until(q.items[0].next), 0)
+}
+
+// resubmitDue hands the due items back to the workers. Items finding the
+// ingestion buffer full wait another BaseBackoff without using up an attempt,
+// those finding the pipeline closed are finished as failed.
+func (q *retryQueue) resubmitDue() {
+	now := time.Now()
+
+	q.mu.Lock()
+	due := 0
+	for due < len(q.items) && !q.items[due].next.After(now) {
+		due++
+	}
+	items := slices.Clone(q.items[:due])
+	q.items = slices.Delete(q.items, 0, due)
+	q.mu.Unlock()
+
+	for _, item := range items {
+		switch err := q.pipeline.resubmit(item.job); {
+		case err == nil:
+		case errors.Is(err, ErrPipelineFull) && q.requeue(item, now.Add(q.cfg.BaseBackoff)):
+		default:
+			q.finish(item)
+		}
+	}
+}
+
+// requeue puts item back for another try at next unless the queue was closed
+// in the meantime.
+func (q *retryQueue) requeue(item *retryItem, next time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	item.next = next
+	q.insert(item)
+	return true
+}
+
+// finish gives up on item once the pipeline is closing, reporting its last
+// failure.
+func (q *retryQueue) finish(item *retryItem) {
+	result := item.result
+	result.Err = fmt.Errorf("%w after %d attempts: %w", ErrPipelineClosed, item.job.attempts, result.Err)
+	logger := logging.FromContext(item.job.Ctx).With("event_id", eventID(item.job.Event, result.Event))
+	q.pipeline.finish(item.job, result, logger)
+}
+
+// pending lists the queued items in order of next attempt.
+func (q *retryQueue) pending() []PendingRetry {
+	if q == nil {
+		return []PendingRetry{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	retries := make([]PendingRetry, len(q.items))
+	for i, item := range q.items {
+		retries[i] = PendingRetry{
+			EventID:   eventID(item.job.Event, item.result.Event),
+			Type:      item.job.Event.Type,
+			Source:    item.job.Event.Source,
+			Attempts:  item.job.attempts,
+			NextRetry: item.next,
+			LastError: item.result.Err.Error(),
+		}
+	}
+
+	return retries
+}
+
+// close stops the scheduler and finishes every queued item as failed, so
+// events waiting for a retry are dead-lettered rather than lost. Later
+// schedule calls report false.
+func (q *retryQueue) close() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	started := q.started
+	q.mu.Unlock()
+
+	close(q.done)
+	if started {
+		<-q.stopped
+	}
+
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+
+	for _, item := range items {
+		q.finish(item)
+	}
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"event-processing-pipeline/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enqueueRetryable hands event to p as the job of an async batch.
+func enqueueRetryable(t *testing.T, p *EventPipeline, id string) <-chan JobResult {
+	t.Helper()
+
+	results := make(chan JobResult, 1)
+	if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent(id), Result: results, Retryable: true}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return results
+}
+
+// waitResult waits for the result of a job.
+func waitResult(t *testing.T, results <-chan JobResult) JobResult {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("no result within a second")
+		return JobResult{}
+	}
+}
+
+// waitPending waits until p has n events waiting for a retry.
+func waitPending(t *testing.T, p *EventPipeline, n int) []PendingRetry {
+	t.Helper()
+
+	var pending []PendingRetry
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if pending = p.PendingRetries(); len(pending) == n {
+			break
+		}
+	}
+	if len(pending) != n {
+		t.Fatalf("%d pending retries, want %d", len(pending), n)
+	}
+	return pending
+}
+
+// waitDeadLetters waits until p has dead-lettered n events, which happens
+// after their result is delivered.
+func waitDeadLetters(t *testing.T, p *EventPipeline, n int64) {
+	t.Helper()
+
+	var count int64
+	for deadline := time.Now().Add(time.Second); count != n && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		count, _ = p.deadLetters.Count(context.Background())
+	}
+	if count != n {
+		t.Errorf("dead letters = %d, want %d", count, n)
+	}
+}
+
+func TestRetryQueueBackoff(t *testing.T) {
+	tests := []struct {
+		failed int
+		want   time.Duration
+	}{
+		{failed: 1, want: time.Second},
+		{failed: 2, want: 2 * time.Second},
+		{failed: 3, want: 4 * time.Second},
+		{failed: 4, want: 5 * time.Second},
+		{failed: 80, want: 5 * time.Second},
+	}
+
+	q := newRetryQueue(nil, RetryQueueConfig{MaxAttempts: 5, MaxSize: 1, BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for _, tt := range tests {
+		if got := q.backoff(tt.failed); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failed, got, tt.want)
+		}
+	}
+}
+
+func TestRetryQueueSchedulesFailedStores(t *testing.T) {
+	repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+	p, _ := newTestPipeline(t, NewEventService(repo, ServiceConfig{}), nil, PipelineConfig{
+		Retries: RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: time.Hour},
+	})
+
+	start := time.Now()
+	results := enqueueRetryable(t, p, "evt-1")
+	pending := waitPending(t, p, 1)[0]
+
+	if pending.EventID != "evt-1" || pending.Attempts != 1 || !strings.Contains(pending.LastError, "connection is already closed") {
+		t.Errorf("pending retry = %+v, want evt-1 after 1 attempt with the store error", pending)
+	}
+	if next := pending.NextRetry.Sub(start); next < time.Hour || next > time.Hour+time.Second {
+		t.Errorf("next retry in %s, want an hour", next)
+	}
+	select {
+	case result := <-results:
+		t.Errorf("result %+v delivered before the last attempt", result)
+	default:
+	}
+}
+
+func TestRetryQueueRecovers(t *testing.T) {
+	repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+	p, _ := newTestPipeline(t, NewEventService(repo, ServiceConfig{}), nil, PipelineConfig{
+		Retries: RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: 50 * time.Millisecond},
+	})
+
+	results := enqueueRetryable(t, p, "evt-1")
+	waitPending(t, p, 1)
+	repo.setDown(false)
+
+	if result := waitResult(t, results); result.Err != nil {
+		t.Fatalf("result error = %v, want the retry to store the event", result.Err)
+	}
+	if _, err := repo.FindEventByID(context.Background(), "evt-1"); err != nil {
+		t.Errorf("FindEventByID: %v", err)
+	}
+	if count, _ := p.deadLetters.Count(context.Background()); count != 0 {
+		t.Errorf("dead letters = %d, want 0", count)
+	}
+}
+
+func TestRetryQueueExhaustion(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable bool
+		wantErr   string
+	}{
+		{name: "attempts used up", retryable: true, wantErr: "gave up after 3 attempts"},
+		{name: "not retryable", wantErr: "connection is already closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+			p, _ := newTestPipeline(t, NewEventService(repo, ServiceConfig{}), nil, PipelineConfig{
+				Retries: RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: time.Millisecond},
+			})
+
+			results := make(chan JobResult, 1)
+			if err := p.Enqueue(Job{Ctx: context.Background(), Event: testEvent("evt-1"), Result: results, Retryable: tt.retryable}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			result := waitResult(t, results)
+			if result.Err == nil || !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("result error = %v, want one containing %q", result.Err, tt.wantErr)
+			}
+			waitDeadLetters(t, p, 1)
+			if pending := p.PendingRetries(); len(pending) != 0 {
+				t.Errorf("pending retries = %+v, want none", pending)
+			}
+		})
+	}
+}
+
+func TestRetryQueueFull(t *testing.T) {
+	repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+	p, _ := newTestPipeline(t, NewEventService(repo, ServiceConfig{}), nil, PipelineConfig{
+		Retries: RetryQueueConfig{MaxAttempts: 3, MaxSize: 1, BaseBackoff: time.Hour},
+	})
+
+	enqueueRetryable(t, p, "evt-1")
+	waitPending(t, p, 1)
+
+	result := waitResult(t, enqueueRetryable(t, p, "evt-2"))
+	if !errors.Is(result.Err, sql.ErrConnDone) {
+		t.Fatalf("result error = %v, want the store error", result.Err)
+	}
+	if pending := p.PendingRetries(); len(pending) != 1 || pending[0].EventID != "evt-1" {
+		t.Errorf("pending retries = %+v, want evt-1 only", pending)
+	}
+}
+
+func TestShutdownDeadLettersPendingRetries(t *testing.T) {
+	repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+	p, _ := newTestPipeline(t, NewEventService(repo, ServiceConfig{}), nil, PipelineConfig{
+		Retries: RetryQueueConfig{MaxAttempts: 3, MaxSize: 10, BaseBackoff: time.Hour},
+	})
+
+	results := enqueueRetryable(t, p, "evt-1")
+	waitPending(t, p, 1)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if result := waitResult(t, results); !errors.Is(result.Err, ErrPipelineClosed) {
+		t.Errorf("result error = %v, want %v", result.Err, ErrPipelineClosed)
+	}
+	waitDeadLetters(t, p, 1)
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"event-processing-pipeline/internal/storage"
+	"maps"
+)
+
+// SampleRateKey is the metadata key kept events of a sampled type or source
+// are stamped with, holding the share of those events that is stored.
+const SampleRateKey = "sample_rate"
+
+// SamplingRules map event types and sources to the share of their events to
+// store, between 0 and 1. When both the type and the source of an event have
+// a rule, the lower rate applies. Events without a rule are all stored.
+type SamplingRules struct {
+	Types   map[string]float64
+	Sources map[string]float64
+}
+
+// rate returns the share of events like event to store and whether a rule
+// matched at all.
+func (r SamplingRules) rate(event *storage.ProcessedEvent) (float64, bool) {
+	typeRate, typeOK := r.Types[string(event.Type)]
+	sourceRate, sourceOK := r.Sources[string(event.Source)]
+	switch {
+	case typeOK && sourceOK:
+		return min(typeRate, sourceRate), true
+	case typeOK:
+		return typeRate, true
+	case sourceOK:
+		return sourceRate, true
+	default:
+		return 1, false
+	}
+}
+
+// sample decides whether to store event, stamping it with the sample rate
+// when it is kept. The decision only depends on the event id and the rate, so
+// a resent event is kept or dropped the same way every time.
+func (r SamplingRules) sample(event *storage.ProcessedEvent) bool {
+	rate, ok := r.rate(event)
+	if !ok {
+		return true
+	}
+	if sampleFraction(event.ID) >= rate {
+		return false
+	}
+
+	metadata := maps.Clone(event.Data.Metadata)
+	if metadata == nil {
+		metadata = storage.Metadata{}
+	}
+	metadata[SampleRateKey] = rate
+	event.Data.Metadata = metadata
+	return true
+}
+
+// sampleFraction maps id uniformly onto [0, 1). A cryptographic hash keeps
+// sequential ids from clustering the way they do with FNV.
+func sampleFraction(id string) float64 {
+	sum := sha256.Sum256([]byte(id))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// scaler sizes the worker pool between its minimum and maximum. It grows the
+// pool while the ingestion queue stays above the high water mark, lets idle
+// workers retire down to the minimum and applies Resize.
+type scaler struct {
+	pipeline *EventPipeline
+	done     chan struct{}
+	// shrink wakes idle workers so they notice the pool shrank.
+	shrink chan struct{}
+
+	mu      sync.Mutex
+	min     int
+	max     int
+	workers int
+	nextID  int
+}
+
+func newScaler(eventPipeline *EventPipeline, minWorkers, maxWorkers int) *scaler {
+	return &scaler{
+		pipeline: eventPipeline,
+		done:     make(chan struct{}),
+		shrink:   make(chan struct{}),
+		min:      minWorkers,
+		max:      maxWorkers,
+	}
+}
+
+// start begins sampling with workers already running. It is called with the
+// pipeline lock held.
+func (s *scaler) start(workers int) {
+	s.workers = workers
+	s.nextID = workers
+	go s.run()
+}
+
+// stop ends sampling. It is called with the pipeline lock held once the
+// pipeline is closed, so no worker is spawned afterwards.
+func (s *scaler) stop() {
+	close(s.done)
+}
+
+func (s *scaler) run() {
+	ticker := time.NewTicker(s.pipeline.cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if depth := len(s.pipeline.ingestionChan); depth > s.pipeline.cfg.ScaleHighWater {
+				s.grow(depth)
+			}
+		}
+	}
+}
+
+// grow starts one more worker unless the pool is at its maximum.
+func (s *scaler) grow(depth int) {
+	s.pipeline.mu.RLock()
+	defer s.pipeline.mu.RUnlock()
+	if s.pipeline.closed {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workers >= s.max {
+		return
+	}
+
+	s.spawn()
+	slog.Info("Worker started", "workers", s.workers, "queue_depth", depth)
+}
+
+// spawn starts a worker. The caller holds both locks and has checked that the
+// pipeline is still open.
+func (s *scaler) spawn() {
+	worker := s.pipeline.newWorker(s.nextID)
+	s.nextID++
+	s.workers++
+	worker.Start()
+
+	s.pipeline.metrics.SetWorkers(s.workers)
+}
+
+// retire reports whether the worker may exit: always while the pool is above
+// its maximum, and when idle while it is above its minimum.
+func (s *scaler) retire(id int, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workers <= s.max && (!idle || s.workers <= s.min) {
+		return false
+	}
+
+	s.workers--
+	s.pipeline.metrics.SetWorkers(s.workers)
+	slog.Info("Worker retired", "worker", id, "workers", s.workers)
+	return true
+}
+
+// resize changes the pool bounds. Missing workers are started right away;
+// surplus ones finish their current job before they exit.
+func (s *scaler) resize(minWorkers, maxWorkers int) error {
+	if minWorkers < 1 || maxWorkers < minWorkers {
+		return fmt.Errorf("invalid worker bounds %d..%d", minWorkers, maxWorkers)
+	}
+
+	s.pipeline.mu.RLock()
+	defer s.pipeline.mu.RUnlock()
+	if !s.pipeline.started || s.pipeline.closed {
+		return ErrPipelineClosed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.min, s.max = minWorkers, maxWorkers
+	for s.workers < s.min {
+		s.spawn()
+	}
+
+	// Wake idle workers; busy ones check the bounds after their job.
+	for surplus := s.workers - s.max; surplus > 0; surplus-- {
+		select {
+		case s.shrink <- struct{}{}:
+		default:
+		}
+	}
+
+	slog.Info("Worker pool resized", "min", s.min, "max", s.max, "workers", s.workers)
+	return nil
+}
+
+// bounds returns the current minimum, maximum and size of the pool.
+func (s *scaler) bounds() (int, int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.min, s.max, s.workers
+}
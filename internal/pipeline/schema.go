@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"encoding/json"
+	api "event-processing-pipeline/internal/api/dtos"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaRegistry holds the JSON Schemas used to validate the data object of
+// each event type. Types without a schema are not checked.
+type SchemaRegistry struct {
+	schemas map[api.EventType]*jsonschema.Schema
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// SchemaValidationError lists every field of an event's data that does not
+// match the schema registered for its type.
+type SchemaValidationError struct {
+	EventType api.EventType
+	Fields    []FieldError
+}
+
+func (e *SchemaValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+
+	return fmt.Sprintf("event data does not match schema for %s: %s", e.EventType, strings.Join(messages, "; "))
+}
+
+// LoadSchemas compiles every <event type>.json file in dir.
+func LoadSchemas(dir string) (*SchemaRegistry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &SchemaRegistry{schemas: make(map[api.EventType]*jsonschema.Schema, len(paths))}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		compiler := jsonschema.NewCompiler()
+		err = compiler.AddResource(path, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("load schema %s: %w", path, err)
+		}
+
+		schema, err := compiler.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("compile schema %s: %w", path, err)
+		}
+
+		eventType := api.EventType(strings.TrimSuffix(filepath.Base(path), ".json"))
+		registry.schemas[eventType] = schema
+	}
+
+	return registry, nil
+}
+
+// Validate checks data against the schema registered for eventType.
+func (r *SchemaRegistry) Validate(eventType api.EventType, data api.Data) error {
+	if r == nil {
+		return nil
+	}
+
+	schema, ok := r.schemas[eventType]
+	if !ok {
+		return nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encode event data: %w", err)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return fmt.Errorf("decode event data: %w", err)
+	}
+
+	err = schema.Validate(document)
+	if validationErr, ok := err.(*jsonschema.ValidationError); ok {
+		return &SchemaValidationError{EventType: eventType, Fields: collectFieldErrors(validationErr, nil)}
+	}
+
+	return err
+}
+
+// DeclaresMetadataKey reports whether the schema of any event type lists key
+// among the properties of the metadata object.
+func (r *SchemaRegistry) DeclaresMetadataKey(key string) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, schema := range r.schemas {
+		metadata := resolveSchema(schema).Properties["metadata"]
+		if metadata == nil {
+			continue
+		}
+		if _, ok := resolveSchema(metadata).Properties[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveSchema follows $ref to the schema that declares the properties.
+func resolveSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	for schema.Ref != nil {
+		schema = schema.Ref
+	}
+	return schema
+}
+
+func collectFieldErrors(err *jsonschema.ValidationError, fields []FieldError) []FieldError {
+	if len(err.Causes) == 0 {
+		field := err.InstanceLocation
+		if field == "" {
+			field = "/"
+		}
+		return append(fields, FieldError{Field: field, Message: err.Message})
+	}
+
+	for _, cause := range err.Causes {
+		fields = collectFieldErrors(cause, fields)
+	}
+
+	return fields
+}
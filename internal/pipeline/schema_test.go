@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSchemaRegistryValidate(t *testing.T) {
+	schemas, err := LoadSchemas("../../schemas")
+	if err != nil {
+		t.Fatalf("LoadSchemas: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		eventType  api.EventType
+		data       api.Data
+		wantFields string
+	}{
+		{
+			name:      "valid",
+			eventType: "user_action",
+			data:      api.Data{Action: "click", Metadata: api.Metadata{"session_id": "s-1"}},
+		},
+		{
+			name:       "missing required metadata field",
+			eventType:  "user_action",
+			data:       api.Data{Action: "click", Metadata: api.Metadata{"page": "home"}},
+			wantFields: "[{/metadata missing properties: 'session_id'}]",
+		},
+		{
+			name:       "several fields",
+			eventType:  "user_action",
+			data:       api.Data{Metadata: api.Metadata{"session_id": 7}},
+			wantFields: "[{/action length must be >= 1, but got 0} {/metadata/session_id expected string, but got number}]",
+		},
+		{
+			name:      "type without a schema",
+			eventType: "purchase",
+			data:      api.Data{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schemas.Validate(tt.eventType, tt.data)
+			if tt.wantFields == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+
+			var schemaErr *SchemaValidationError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("Validate error = %v, want a SchemaValidationError", err)
+			}
+			// The validator reports sibling failures in no fixed order.
+			fields := slices.SortedFunc(slices.Values(schemaErr.Fields), func(a, b FieldError) int {
+				return strings.Compare(a.Field, b.Field)
+			})
+			if got := fmt.Sprint(fields); got != tt.wantFields {
+				t.Errorf("fields = %s, want %s", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestSchemaRegistryDeclaresMetadataKey(t *testing.T) {
+	schemas, err := LoadSchemas("../../schemas")
+	if err != nil {
+		t.Fatalf("LoadSchemas: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		registry *SchemaRegistry
+		key      string
+		want     bool
+	}{
+		{name: "declared", registry: schemas, key: "session_id", want: true},
+		{name: "not declared", registry: schemas, key: "customer_id"},
+		{name: "top-level property", registry: schemas, key: "action"},
+		{name: "no schemas", key: "session_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.registry.DeclaresMetadataKey(tt.key); got != tt.want {
+				t.Errorf("DeclaresMetadataKey(%s) = %t, want %t", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+)
+
+// UpgradeFunc rewrites an event of one schema version into the shape of the
+// next one. It gets its own copy of the metadata map and may change it, but
+// the map is nil when the event carries no metadata.
+type UpgradeFunc func(event api.EventDTO) (api.EventDTO, error)
+
+// Upgrades holds the upgrade steps of each event type, so producers still
+// sending an older shape keep working after the type changes. The current
+// version of a type is one past its last step, version 1 without any.
+type Upgrades struct {
+	steps map[api.EventType][]UpgradeFunc
+}
+
+func NewUpgrades() *Upgrades {
+	return &Upgrades{steps: make(map[api.EventType][]UpgradeFunc)}
+}
+
+// Register adds the step upgrading events of eventType from version from to
+// from+1. Steps are registered in version order starting at 1; any other
+// order is a programming error and panics.
+func (u *Upgrades) Register(eventType api.EventType, from int, fn UpgradeFunc) {
+	if next := len(u.steps[eventType]) + 1; from != next {
+		panic(fmt.Sprintf("pipeline: upgrade of %s events from version %d registered, expected version %d", eventType, from, next))
+	}
+	u.steps[eventType] = append(u.steps[eventType], fn)
+}
+
+// UpgradeStep is an upgrade step declared in an upgrade file. Its changes
+// apply in field order; a step without any only raises the version.
+type UpgradeStep struct {
+	// RenameMetadata moves metadata keys to new names, overwriting the
+	// target.
+	RenameMetadata map[string]string `json:"rename_metadata,omitempty"`
+	// DropMetadata removes metadata keys.
+	DropMetadata []string `json:"drop_metadata,omitempty"`
+	// DefaultMetadata sets metadata keys that are missing or null.
+	DefaultMetadata map[string]any `json:"default_metadata,omitempty"`
+	// ScaleValue multiplies the value of float events, e.g. 0.01 for a
+	// version that sent cents.
+	ScaleValue float64 `json:"scale_value,omitempty"`
+}
+
+// LoadUpgrades reads the upgrade steps from a JSON file holding an object of
+// step arrays keyed by event type. The first step of a type upgrades its
+// events from version 1, the next from version 2, and so on.
+func LoadUpgrades(path string) (*Upgrades, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	var steps map[api.EventType][]UpgradeStep
+	if err := decoder.Decode(&steps); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	upgrades := NewUpgrades()
+	for eventType, typeSteps := range steps {
+		for i, step := range typeSteps {
+			if err := step.validate(); err != nil {
+				return nil, fmt.Errorf("%s: step %d of %q: %w", path, i, eventType, err)
+			}
+			upgrades.Register(eventType, storage.DefaultSchemaVersion+i, step.apply)
+		}
+	}
+
+	return upgrades, nil
+}
+
+func (s UpgradeStep) validate() error {
+	for from, to := range s.RenameMetadata {
+		if from == "" || to == "" {
+			return errors.New("rename_metadata needs non-empty keys")
+		}
+	}
+	if slices.Contains(s.DropMetadata, "") {
+		return errors.New("drop_metadata needs non-empty keys")
+	}
+	if math.IsNaN(s.ScaleValue) || math.IsInf(s.ScaleValue, 0) {
+		return errors.New("scale_value must be a finite number")
+	}
+	return nil
+}
+
+func (s UpgradeStep) apply(event api.EventDTO) (api.EventDTO, error) {
+	metadata := event.Data.Metadata
+	if metadata == nil && len(s.DefaultMetadata) > 0 {
+		metadata = make(api.Metadata, len(s.DefaultMetadata))
+	}
+	// Renames read the keys as they were, so swapping two keys works.
+	renamed := make(api.Metadata, len(s.RenameMetadata))
+	for from, to := range s.RenameMetadata {
+		if value, ok := metadata[from]; ok {
+			renamed[to] = value
+		}
+	}
+	for from := range s.RenameMetadata {
+		delete(metadata, from)
+	}
+	maps.Copy(metadata, renamed)
+	for _, key := range s.DropMetadata {
+		delete(metadata, key)
+	}
+	for key, value := range s.DefaultMetadata {
+		if metadata[key] == nil {
+			metadata[key] = value
+		}
+	}
+	event.Data.Metadata = metadata
+
+	if s.ScaleValue != 0 {
+		if event.Data.ValueType == api.ValueTypeInt {
+			return event, errors.New("scale_value cannot scale an int value")
+		}
+		event.Data.Value = api.FloatValue(event.Data.Value.Float() * s.ScaleValue)
+	}
+	return event, nil
+}
+
+// Current returns the schema version events of eventType are upgraded to.
+func (u *Upgrades) Current(eventType api.EventType) int {
+	if u == nil {
+		return storage.DefaultSchemaVersion
+	}
+	return storage.DefaultSchemaVersion + len(u.steps[eventType])
+}
+
+// Upgrade runs the steps from the schema version of event up to the current
+// one and returns the event stamped with the current version. A missing
+// version, or one this service does not know, is read as version 1.
+func (u *Upgrades) Upgrade(event api.EventDTO) (api.EventDTO, error) {
+	eventType := event.Type
+	current := u.Current(eventType)
+	version := event.SchemaVersion
+	if version < storage.DefaultSchemaVersion || version > current {
+		version = storage.DefaultSchemaVersion
+	}
+
+	if version < current {
+		event.Data.Metadata = maps.Clone(event.Data.Metadata)
+	}
+	for ; version < current; version++ {
+		upgraded, err := u.steps[eventType][version-1](event)
+		if err != nil {
+			return event, fmt.Errorf("upgrade %s event from schema version %d: %w", eventType, version, err)
+		}
+		event = upgraded
+	}
+
+	event.SchemaVersion = current
+	return event, nil
+}
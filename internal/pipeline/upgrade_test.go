@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// centsToUnits is the upgrade of a purchase event whose version 1 sent cents.
+func centsToUnits(event api.EventDTO) (api.EventDTO, error) {
+	event.Data.Value = api.FloatValue(event.Data.Value.Float() / 100)
+	return event, nil
+}
+
+func TestUpgradeRegisteredStep(t *testing.T) {
+	upgrades := NewUpgrades()
+	upgrades.Register("purchase", 1, centsToUnits)
+
+	tests := []struct {
+		name      string
+		eventType api.EventType
+		version   int
+		wantValue float64
+	}{
+		{name: "version 1", eventType: "purchase", version: 1, wantValue: 12.5},
+		{name: "missing version read as 1", eventType: "purchase", wantValue: 12.5},
+		{name: "unknown version read as 1", eventType: "purchase", version: 7, wantValue: 12.5},
+		{name: "current version", eventType: "purchase", version: 2, wantValue: 1250},
+		{name: "type without steps", eventType: "click", version: 1, wantValue: 1250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testEvent("evt-1")
+			event.Type, event.SchemaVersion = tt.eventType, tt.version
+			event.Data.Value = api.FloatValue(1250)
+
+			upgraded, err := upgrades.Upgrade(event)
+			if err != nil {
+				t.Fatalf("Upgrade: %v", err)
+			}
+			if got := upgraded.Data.Value.Float(); got != tt.wantValue {
+				t.Errorf("value = %v, want %v", got, tt.wantValue)
+			}
+			if want := upgrades.Current(tt.eventType); upgraded.SchemaVersion != want {
+				t.Errorf("schema version = %d, want %d", upgraded.SchemaVersion, want)
+			}
+		})
+	}
+}
+
+func TestProcessStoresUpgradedVersion(t *testing.T) {
+	upgrades := NewUpgrades()
+	upgrades.Register("purchase", 1, centsToUnits)
+	service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{Upgrades: upgrades})
+
+	event := testEvent("evt-1")
+	event.Type, event.SchemaVersion = "purchase", 1
+	event.Data.Value = api.FloatValue(1250)
+
+	processed, err := service.Process(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if processed.SchemaVersion != 2 || processed.Data.Value != 12.5 {
+		t.Errorf("processed version %d, value %v; want 2 and 12.5", processed.SchemaVersion, processed.Data.Value)
+	}
+}
+
+// writeUpgradeFile writes content to an upgrade file and loads it.
+func writeUpgradeFile(t *testing.T, content string) (*Upgrades, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "upgrades.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadUpgrades(path)
+}
+
+func TestLoadUpgrades(t *testing.T) {
+	upgrades, err := writeUpgradeFile(t, `{
+		"purchase": [
+			{"scale_value": 0.01},
+			{"rename_metadata": {"sku": "product_id", "a": "b", "b": "a"}, "drop_metadata": ["debug"], "default_metadata": {"currency": "EUR"}},
+			{}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("LoadUpgrades: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		version      int
+		metadata     api.Metadata
+		wantValue    float64
+		wantMetadata string
+	}{
+		{
+			name:         "version 1",
+			version:      1,
+			metadata:     api.Metadata{"sku": "x1", "debug": true},
+			wantValue:    12.5,
+			wantMetadata: "map[currency:EUR product_id:x1]",
+		},
+		{
+			name:         "version 2 swapping keys",
+			version:      2,
+			metadata:     api.Metadata{"a": 1, "b": 2, "currency": "USD"},
+			wantValue:    1250,
+			wantMetadata: "map[a:2 b:1 currency:USD]",
+		},
+		{
+			name:         "version 2 without metadata",
+			version:      2,
+			wantValue:    1250,
+			wantMetadata: "map[currency:EUR]",
+		},
+		{
+			name:         "current version",
+			version:      4,
+			metadata:     api.Metadata{"sku": "x1"},
+			wantValue:    1250,
+			wantMetadata: "map[sku:x1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testEvent("evt-1")
+			event.Type, event.SchemaVersion = "purchase", tt.version
+			event.Data.Value, event.Data.Metadata = api.FloatValue(1250), tt.metadata
+
+			upgraded, err := upgrades.Upgrade(event)
+			if err != nil {
+				t.Fatalf("Upgrade: %v", err)
+			}
+			if upgraded.SchemaVersion != 4 {
+				t.Errorf("schema version = %d, want 4", upgraded.SchemaVersion)
+			}
+			if got := upgraded.Data.Value.Float(); got != tt.wantValue {
+				t.Errorf("value = %v, want %v", got, tt.wantValue)
+			}
+			if got := fmt.Sprint(upgraded.Data.Metadata); got != tt.wantMetadata {
+				t.Errorf("metadata = %s, want %s", got, tt.wantMetadata)
+			}
+		})
+	}
+
+	event := testEvent("evt-1")
+	event.Type = "purchase"
+	event.Data.Value, event.Data.ValueType = api.IntValue(1250), api.ValueTypeInt
+	if _, err := upgrades.Upgrade(event); err == nil {
+		t.Error("Upgrade scaled an int value")
+	}
+}
+
+func TestLoadUpgradesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "not an object", content: `[]`, want: "decode"},
+		{name: "unknown field", content: `{"purchase": [{"scale": 2}]}`, want: "unknown field"},
+		{name: "empty rename", content: `{"purchase": [{}, {"rename_metadata": {"sku": ""}}]}`, want: `step 1 of "purchase": rename_metadata`},
+		{name: "empty drop", content: `{"purchase": [{"drop_metadata": [""]}]}`, want: "drop_metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := writeUpgradeFile(t, tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadUpgrades error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
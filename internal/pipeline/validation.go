@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"strings"
+)
+
+// ValidationMode decides whether Validate reports every problem of an event
+// or stops at the first.
+type ValidationMode string
+
+const (
+	// ValidationCollectAll runs every check, so clients fix an event in one
+	// round trip.
+	ValidationCollectAll ValidationMode = "all"
+	// ValidationFailFast stops at the first failed check, sparing the rest
+	// for high volume producers that only need to know an event was
+	// rejected.
+	ValidationFailFast ValidationMode = "fail_fast"
+)
+
+// ValidationErrors lists every check an event failed, in the order they ran.
+// errors.As and errors.Is look through it, so a *LimitError among the
+// failures is still found.
+type ValidationErrors struct {
+	Errors []error
+}
+
+func (e *ValidationErrors) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationErrors) Unwrap() []error {
+	return e.Errors
+}
+
+// joinValidationErrors returns nil for no errors, the error itself for one,
+// so single failures read as before, and *ValidationErrors for more.
+func joinValidationErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return &ValidationErrors{Errors: errs}
+	}
+}
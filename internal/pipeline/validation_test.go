@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	api "event-processing-pipeline/internal/api/dtos"
+	"event-processing-pipeline/internal/storage"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateCollectsEveryFailure(t *testing.T) {
+	// An event failing every check that does not depend on another.
+	invalid := api.EventDTO{
+		Data: api.Data{
+			Value:    api.FloatValue(math.NaN()),
+			Metadata: map[string]any{"a": 1, "b": 2},
+		},
+	}
+
+	tests := []struct {
+		name string
+		mode ValidationMode
+		want []string
+	}{
+		{
+			name: "collect all",
+			mode: ValidationCollectAll,
+			want: []string{
+				"event id is required",
+				"event type is required",
+				"event source is required",
+				"event timestamp is required",
+				"event value must be a finite number, got NaN",
+				"max_metadata_keys is 1, got 2",
+			},
+		},
+		{name: "fail fast", mode: ValidationFailFast, want: []string{"event id is required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(storage.NewMemoryEventRepository(storage.RepositoryConfig{}), ServiceConfig{
+				MaxClockSkew:   time.Minute,
+				RequireEventID: true,
+				Limits:         Limits{MaxMetadataKeys: 1},
+				ValidationMode: tt.mode,
+			})
+
+			err := service.Validate(context.Background(), invalid)
+			if err == nil {
+				t.Fatal("Validate accepted the event")
+			}
+
+			var got []string
+			var validationErrs *ValidationErrors
+			if errors.As(err, &validationErrs) {
+				for _, err := range validationErrs.Errors {
+					got = append(got, err.Error())
+				}
+			} else {
+				got = []string{err.Error()}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate errors =\n%q\nwant\n%q", got, tt.want)
+			}
+
+			var limitErr *LimitError
+			if errors.As(err, &limitErr) != (tt.mode == ValidationCollectAll) {
+				t.Errorf("errors.As found a limit error %t in %v", limitErr != nil, err)
+			}
+		})
+	}
+}
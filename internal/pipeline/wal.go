@@ -0,0 +1,346 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrWALFull is returned for events that would grow the write-ahead log past
+// its maximum size.
+var ErrWALFull = errors.New("write-ahead log is full")
+
+// walReplayBatch is the number of events stored per write during a replay.
+const walReplayBatch = 500
+
+type WALConfig struct {
+	// Path is the file events are appended to while the database is down.
+	// Empty disables the log.
+	Path string
+	// MaxBytes bounds the size of the file. Events that do not fit fail like
+	// the write they stand in for.
+	MaxBytes int64
+	// ReplayInterval is the time between attempts to replay the log into the
+	// database.
+	ReplayInterval time.Duration
+}
+
+// WAL keeps events whose write failed because the database could not be
+// reached, one JSON object per line, until Run replays them. A nil *WAL
+// keeps nothing.
+type WAL struct {
+	cfg WALConfig
+
+	// replayMu serializes replays.
+	replayMu sync.Mutex
+	// mu guards the file and its size. Appends hold it throughout, replays
+	// only to note the size they replay up to and to drop that part, so
+	// events appended during a replay are neither lost nor replayed twice.
+	mu   sync.Mutex
+	size int64
+}
+
+type walContextKey struct{}
+
+// NewWAL returns nil when cfg.Path is empty. Events left in the file by a
+// previous run are kept for the next replay.
+func NewWAL(cfg WALConfig) (*WAL, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+
+	return &WAL{cfg: cfg, size: info.Size()}, nil
+}
+
+// Append writes events to the end of the log and syncs it to disk. Either all
+// events are appended or none are.
+func (w *WAL) Append(events []storage.ProcessedEvent) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("encode event %s: %w", event.ID, err)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cfg.MaxBytes > 0 && w.size+int64(buf.Len()) > w.cfg.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrWALFull, w.size, w.cfg.MaxBytes)
+	}
+
+	file, err := os.OpenFile(w.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	n, err := file.Write(buf.Bytes())
+	w.size += int64(n)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil && n > 0 && n < buf.Len() {
+		// Cut off the partial line rather than leave it to corrupt the next
+		// append.
+		if truncErr := os.Truncate(w.cfg.Path, w.size-int64(n)); truncErr == nil {
+			w.size -= int64(n)
+		}
+	}
+
+	return err
+}
+
+// Size returns the current size of the log in bytes.
+func (w *WAL) Size() int64 {
+	if w == nil {
+		return 0
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Run replays the log into store every ReplayInterval, starting right away,
+// until ctx is done, dead-lettering the events the database rejects and
+// publishing the stored ones to publisher, which may be nil. It returns
+// immediately for a nil *WAL.
+func (w *WAL) Run(ctx context.Context, store Storage, deadLetters DeadLetterService, publisher Publisher) {
+	if w == nil {
+		return
+	}
+
+	slog.Info("Write-ahead log enabled", "path", w.cfg.Path, "max_bytes", w.cfg.MaxBytes, "size", w.Size())
+	ticker := time.NewTicker(w.cfg.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		if w.Size() > 0 {
+			replayed, err := w.Replay(ctx, store, deadLetters, publisher)
+			if err != nil {
+				// Retried on the next tick.
+				slog.Warn("Write-ahead log replay failed", "replayed", replayed, "error", err)
+			} else if replayed > 0 {
+				slog.Info("Write-ahead log replayed", "events", replayed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replay stores the events in the log through store, oldest first, and drops
+// every batch from the log as soon as it is stored, so a failure keeps only
+// the events not stored yet. A batch the database rejects is stored one event
+// at a time instead: events stored before, such as by a replay that failed to
+// drop them, are skipped and those rejected again are sent to deadLetters, so
+// one bad event cannot hold up the log. Stored events are published to
+// publisher, which may be nil, like events stored by the workers. The replay
+// stops when the database cannot be reached, keeping the rest of the log for
+// the next one. Appends go on during the replay; their events are kept for
+// the next one too. Lines that do not decode, such as one cut short by a
+// crash, are logged and skipped.
+func (w *WAL) Replay(ctx context.Context, store Storage, deadLetters DeadLetterService, publisher Publisher) (int, error) {
+	w.replayMu.Lock()
+	defer w.replayMu.Unlock()
+
+	// Appends only write past the current size, so the part before it can
+	// be read without holding mu.
+	size := w.Size()
+	file, err := os.Open(w.cfg.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// Writes of the replay must fail rather than land back in the log.
+	ctx = context.WithValue(ctx, walContextKey{}, true)
+
+	replayed := 0
+	batch := make([]storage.ProcessedEvent, 0, walReplayBatch)
+	// read is the number of bytes read since the last drop.
+	var read int64
+	flush := func() error {
+		if len(batch) > 0 {
+			stored, err := storeReplayed(ctx, store, deadLetters, publisher, batch)
+			replayed += stored
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if read == 0 {
+			return nil
+		}
+		if err := w.drop(read); err != nil {
+			return err
+		}
+		read = 0
+		return nil
+	}
+
+	reader := bufio.NewReader(io.LimitReader(file, size))
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		read += int64(len(data))
+		if len(bytes.TrimSpace(data)) > 0 {
+			event, decodeErr := decodeWALEvent(data)
+			if decodeErr != nil {
+				slog.Warn("Skipping malformed write-ahead log line", "path", w.cfg.Path, "line", line, "error", decodeErr)
+			} else {
+				batch = append(batch, event)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return replayed, err
+		}
+
+		if len(batch) == walReplayBatch {
+			if err := flush(); err != nil {
+				return replayed, err
+			}
+		}
+	}
+	return replayed, flush()
+}
+
+// storeReplayed stores a batch of replayed events and publishes the ones that
+// were new. When the database rejects the batch, the events are stored one at
+// a time, skipping duplicates and dead-lettering the rejected ones. It returns
+// the number of events stored or found stored already, failing only when the
+// database cannot be reached or ctx is done.
+func storeReplayed(ctx context.Context, store Storage, deadLetters DeadLetterService, publisher Publisher, events []storage.ProcessedEvent) (int, error) {
+	result, err := store.Store(ctx, events, false)
+	if err == nil {
+		publishNew(publisher, events, result.DuplicateIDs)
+		return len(events), nil
+	}
+	if ctx.Err() != nil || isOutage(err) || errors.Is(err, ErrCircuitOpen) {
+		return 0, err
+	}
+
+	stored := 0
+	for _, event := range events {
+		result, err := store.Store(ctx, []storage.ProcessedEvent{event}, false)
+		switch {
+		case err == nil:
+			publishNew(publisher, []storage.ProcessedEvent{event}, result.DuplicateIDs)
+			stored++
+		case isDuplicate(err):
+			stored++
+		case ctx.Err() != nil || isOutage(err) || errors.Is(err, ErrCircuitOpen):
+			return stored, err
+		default:
+			slog.Warn("Dead-lettering write-ahead log event the database rejected", "event_id", event.ID, "error", err)
+			deadLetters.Send(ctx, ToEventDTO(event), metrics.StageStore, err)
+		}
+	}
+
+	return stored, nil
+}
+
+// publishNew publishes the events whose id is not among duplicates.
+func publishNew(publisher Publisher, events []storage.ProcessedEvent, duplicates []string) {
+	if publisher == nil {
+		return
+	}
+	for _, event := range events {
+		if !slices.Contains(duplicates, event.ID) {
+			publisher.Publish(event)
+		}
+	}
+}
+
+// drop removes the first n bytes of the log, keeping the events appended
+// after them.
+func (w *WAL) drop(n int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size == n {
+		if err := os.Truncate(w.cfg.Path, 0); err != nil {
+			return err
+		}
+		w.size = 0
+		return nil
+	}
+
+	file, err := os.Open(w.cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Write the rest to a new file and move it over the log, so a crash
+	// leaves either the old log or the new one.
+	tmp := w.cfg.Path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	kept, err := io.Copy(out, io.NewSectionReader(file, n, w.size-n))
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.cfg.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	w.size = kept
+	return nil
+}
+
+// decodeWALEvent decodes a line of the log, keeping metadata numbers exact.
+func decodeWALEvent(data []byte) (storage.ProcessedEvent, error) {
+	var event storage.ProcessedEvent
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&event)
+	return event, err
+}
+
+// replaying reports whether ctx belongs to a replay of the log.
+func replaying(ctx context.Context) bool {
+	replay, _ := ctx.Value(walContextKey{}).(bool)
+	return replay
+}
@@ -0,0 +1,413 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// flakyRepository fails every transaction like an unreachable database while
+// down is set.
+type flakyRepository struct {
+	storage.EventRepository
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (r *flakyRepository) setDown(down bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.down = down
+}
+
+func (r *flakyRepository) WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	r.mu.Lock()
+	down := r.down
+	r.mu.Unlock()
+	if down {
+		return sql.ErrConnDone
+	}
+	return r.EventRepository.WithTransaction(ctx, fn)
+}
+
+// storeFunc is a Storage whose Store calls itself.
+type storeFunc func(ctx context.Context, events []storage.ProcessedEvent) error
+
+// rejectingRepository fails every transaction inserting the event with id,
+// like a constraint the event violates.
+type rejectingRepository struct {
+	storage.EventRepository
+	id string
+}
+
+func (r rejectingRepository) InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []storage.ProcessedEvent) (storage.InsertResult, error) {
+	for _, event := range events {
+		if event.ID == r.id {
+			return storage.InsertResult{}, fmt.Errorf("event %s violates a constraint", r.id)
+		}
+	}
+	return r.EventRepository.InsertEventsTx(ctx, tx, events)
+}
+
+func (f storeFunc) Store(ctx context.Context, events []storage.ProcessedEvent, _ bool) (storage.InsertResult, error) {
+	if err := f(ctx, events); err != nil {
+		return storage.InsertResult{}, err
+	}
+	return storage.InsertResult{Inserted: len(events)}, nil
+}
+
+func (f storeFunc) Upsert(context.Context, []storage.ProcessedEvent) (int, int, error) {
+	return 0, 0, errors.New("not supported")
+}
+
+func (f storeFunc) PurgeEvents(context.Context, storage.EventFilter, int) (int64, error) {
+	return 0, errors.New("not supported")
+}
+
+func walEvents(prefix string, n int) []storage.ProcessedEvent {
+	events := make([]storage.ProcessedEvent, n)
+	for i := range events {
+		events[i] = storage.ProcessedEvent{
+			ID:            prefix + strconv.Itoa(i),
+			Type:          "user_action",
+			Source:        "web",
+			Timestamp:     time.Date(2024, 5, 1, 9, 30, i, 0, time.UTC),
+			Data:          storage.Data{Action: "click", Value: 1},
+			SchemaVersion: storage.DefaultSchemaVersion,
+		}
+	}
+	return events
+}
+
+func newTestWAL(t *testing.T) *WAL {
+	t.Helper()
+	wal, err := NewWAL(WALConfig{Path: filepath.Join(t.TempDir(), "events.wal"), ReplayInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWAL: %v", err)
+	}
+	return wal
+}
+
+func newTestDeadLetters() DeadLetterService {
+	return NewDeadLetterService(storage.NewMemoryDeadLetterRepository())
+}
+
+func ids(events []storage.ProcessedEvent) []string {
+	result := make([]string, len(events))
+	for i, event := range events {
+		result[i] = event.ID
+	}
+	return result
+}
+
+func TestStoreSpoolsDuringOutage(t *testing.T) {
+	tests := []struct {
+		name    string
+		down    bool
+		wal     bool
+		want    storage.InsertResult
+		wantErr bool
+	}{
+		{name: "database up", wal: true, want: storage.InsertResult{Inserted: 2}},
+		{name: "database down", down: true, wal: true, want: storage.InsertResult{Spooled: 2}},
+		{name: "database down without a log", down: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: tt.down}
+			var wal *WAL
+			if tt.wal {
+				wal = newTestWAL(t)
+			}
+			service := NewEventService(repo, ServiceConfig{WAL: wal})
+
+			result, err := service.Store(context.Background(), walEvents("evt-", 2), true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Store error = %v, want error %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("Store = %+v, want %+v", result, tt.want)
+			}
+			if spooled := wal.Size() > 0; spooled != (tt.want.Spooled > 0) {
+				t.Errorf("log holds events = %t, want %t", spooled, tt.want.Spooled > 0)
+			}
+		})
+	}
+}
+
+func TestWALReplayStoresSpooledEvents(t *testing.T) {
+	repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: true}
+	wal := newTestWAL(t)
+	service := NewEventService(repo, ServiceConfig{WAL: wal})
+
+	events := walEvents("evt-", 3)
+	if _, err := service.Store(context.Background(), events, true); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	repo.setDown(false)
+	publisher := &recordingPublisher{}
+	replayed, err := wal.Replay(context.Background(), service, newTestDeadLetters(), publisher)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if replayed != len(events) || wal.Size() != 0 {
+		t.Errorf("replayed %d events leaving %d bytes, want %d and 0", replayed, wal.Size(), len(events))
+	}
+	for _, event := range events {
+		if _, err := repo.FindEventByID(context.Background(), event.ID); err != nil {
+			t.Errorf("FindEventByID(%s): %v", event.ID, err)
+		}
+	}
+	if got := publisher.published(); fmt.Sprint(got) != fmt.Sprint(ids(events)) {
+		t.Errorf("published %v, want %v", got, ids(events))
+	}
+}
+
+func TestWALReplayKeepsEventsAppendedDuringReplay(t *testing.T) {
+	wal := newTestWAL(t)
+	if err := wal.Append(walEvents("old-", 2)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// The first replay appends while it stores, which must neither block on
+	// the log nor lose the new events.
+	var stored [][]string
+	appended := false
+	store := storeFunc(func(_ context.Context, events []storage.ProcessedEvent) error {
+		stored = append(stored, ids(events))
+		if !appended {
+			appended = true
+			return wal.Append(walEvents("new-", 1))
+		}
+		return nil
+	})
+
+	for _, want := range []string{"[old-0 old-1]", "[new-0]"} {
+		if _, err := wal.Replay(context.Background(), store, newTestDeadLetters(), nil); err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+		if got := stored[len(stored)-1]; fmt.Sprint(got) != want {
+			t.Errorf("replay stored %v, want %s", got, want)
+		}
+	}
+	if wal.Size() != 0 {
+		t.Errorf("log holds %d bytes after replaying everything", wal.Size())
+	}
+}
+
+func TestWALReplayFailureKeepsLog(t *testing.T) {
+	wal := newTestWAL(t)
+	if err := wal.Append(walEvents("evt-", 2)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	size := wal.Size()
+
+	failing := storeFunc(func(context.Context, []storage.ProcessedEvent) error { return sql.ErrConnDone })
+	if _, err := wal.Replay(context.Background(), failing, newTestDeadLetters(), nil); !errors.Is(err, sql.ErrConnDone) {
+		t.Fatalf("Replay error = %v, want %v", err, sql.ErrConnDone)
+	}
+	if wal.Size() != size {
+		t.Errorf("log holds %d bytes after a failed replay, want %d", wal.Size(), size)
+	}
+}
+
+func TestWALReplayDropsStoredBatches(t *testing.T) {
+	wal := newTestWAL(t)
+	if err := wal.Append(walEvents("evt-", walReplayBatch+2)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// The database goes away after the first batch.
+	calls := 0
+	store := storeFunc(func(context.Context, []storage.ProcessedEvent) error {
+		if calls++; calls > 1 {
+			return sql.ErrConnDone
+		}
+		return nil
+	})
+	replayed, err := wal.Replay(context.Background(), store, newTestDeadLetters(), nil)
+	if !errors.Is(err, sql.ErrConnDone) || replayed != walReplayBatch {
+		t.Fatalf("Replay = %d, %v; want %d and %v", replayed, err, walReplayBatch, sql.ErrConnDone)
+	}
+
+	var stored []string
+	store = storeFunc(func(_ context.Context, events []storage.ProcessedEvent) error {
+		stored = append(stored, ids(events)...)
+		return nil
+	})
+	if _, err := wal.Replay(context.Background(), store, newTestDeadLetters(), nil); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if want := fmt.Sprint(ids(walEvents("evt-", walReplayBatch+2)[walReplayBatch:])); fmt.Sprint(stored) != want {
+		t.Errorf("second replay stored %v, want %s", stored, want)
+	}
+}
+
+func TestWALReplayRejectedEvents(t *testing.T) {
+	tests := []struct {
+		name            string
+		stored          []string
+		rejected        string
+		wantPublished   []string
+		wantDeadLetters int64
+	}{
+		{
+			name:            "poison event",
+			rejected:        "evt-1",
+			wantPublished:   []string{"evt-0", "evt-2"},
+			wantDeadLetters: 1,
+		},
+		{
+			name:          "stored before with DEDUP_MODE=error",
+			stored:        []string{"evt-0", "evt-1"},
+			wantPublished: []string{"evt-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryEventRepository(storage.RepositoryConfig{DedupMode: storage.DedupError})
+			for _, event := range walEvents("evt-", 3) {
+				if slices.Contains(tt.stored, event.ID) {
+					if _, err := repo.InsertEvents(context.Background(), []storage.ProcessedEvent{event}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// The database rejects one event for good.
+			service := NewEventService(rejectingRepository{EventRepository: repo, id: tt.rejected}, ServiceConfig{})
+
+			wal := newTestWAL(t)
+			if err := wal.Append(walEvents("evt-", 3)); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			deadLetters := newTestDeadLetters()
+			publisher := &recordingPublisher{}
+			replayed, err := wal.Replay(context.Background(), service, deadLetters, publisher)
+			if err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+
+			if wantReplayed := 3 - int(tt.wantDeadLetters); replayed != wantReplayed || wal.Size() != 0 {
+				t.Errorf("replayed %d events leaving %d bytes, want %d and an empty log", replayed, wal.Size(), wantReplayed)
+			}
+			if got := publisher.published(); fmt.Sprint(got) != fmt.Sprint(tt.wantPublished) {
+				t.Errorf("published %v, want %v", got, tt.wantPublished)
+			}
+			if count, _ := deadLetters.Count(context.Background()); count != tt.wantDeadLetters {
+				t.Errorf("dead letters = %d, want %d", count, tt.wantDeadLetters)
+			}
+		})
+	}
+}
+
+func TestWALReplaySkipsMalformedLines(t *testing.T) {
+	wal := newTestWAL(t)
+	if err := wal.Append(walEvents("evt-", 1)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// A line cut short by a crash.
+	file, err := os.OpenFile(wal.cfg.Path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := file.WriteString(`{"id":"cut`)
+	file.Close()
+	wal.size += int64(n)
+
+	var stored []string
+	store := storeFunc(func(_ context.Context, events []storage.ProcessedEvent) error {
+		stored = append(stored, ids(events)...)
+		return nil
+	})
+	if _, err := wal.Replay(context.Background(), store, newTestDeadLetters(), nil); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if fmt.Sprint(stored) != "[evt-0]" || wal.Size() != 0 {
+		t.Errorf("stored %v leaving %d bytes, want [evt-0] and an empty log", stored, wal.Size())
+	}
+}
+
+func TestWALAppendFull(t *testing.T) {
+	wal, err := NewWAL(WALConfig{Path: filepath.Join(t.TempDir(), "events.wal"), MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("NewWAL: %v", err)
+	}
+	if err := wal.Append(walEvents("evt-", 1)); !errors.Is(err, ErrWALFull) {
+		t.Errorf("Append error = %v, want %v", err, ErrWALFull)
+	}
+	if wal.Size() != 0 {
+		t.Errorf("log holds %d bytes after a rejected append", wal.Size())
+	}
+}
+
+// recordingPublisher collects the ids of the events published.
+type recordingPublisher struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (p *recordingPublisher) Publish(event storage.ProcessedEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, event.ID)
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ids...)
+}
+
+func TestPipelineReportsSpooledEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		down          bool
+		wantSpooled   bool
+		wantPublished []string
+	}{
+		{name: "stored", wantPublished: []string{"evt-1"}},
+		{name: "spooled", down: true, wantSpooled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepository{EventRepository: storage.NewMemoryEventRepository(storage.RepositoryConfig{}), down: tt.down}
+			service := NewEventService(repo, ServiceConfig{WAL: newTestWAL(t)})
+			publisher := &recordingPublisher{}
+			p, m := newTestPipeline(t, service, publisher, PipelineConfig{})
+
+			result := process(t, p, context.Background(), testEvent("evt-1"))
+			if result.Err != nil || result.Spooled != tt.wantSpooled {
+				t.Fatalf("result error %v, spooled %t; want no error, spooled %t", result.Err, result.Spooled, tt.wantSpooled)
+			}
+			if got := publisher.published(); fmt.Sprint(got) != fmt.Sprint(tt.wantPublished) {
+				t.Errorf("published %v, want %v", got, tt.wantPublished)
+			}
+
+			snapshot := m.Snapshot()
+			wantStored, wantSpooledCount := int64(1), int64(0)
+			if tt.wantSpooled {
+				wantStored, wantSpooledCount = 0, 1
+			}
+			if snapshot.Stored != wantStored || snapshot.Spooled != wantSpooledCount {
+				t.Errorf("metrics stored %d, spooled %d; want %d and %d", snapshot.Stored, snapshot.Spooled, wantStored, wantSpooledCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/api/eventpb"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+)
+
+const kafkaSink = "kafka"
+
+// KafkaKey picks the message key, which decides the partition.
+type KafkaKey string
+
+const (
+	KafkaKeyEventID KafkaKey = "id"
+	// KafkaKeyUserID keeps each user's events in order on one partition.
+	// Events without a user id are keyed by event id.
+	KafkaKeyUserID KafkaKey = "user_id"
+)
+
+// KafkaFormat is the serialization of produced messages.
+type KafkaFormat string
+
+const (
+	KafkaFormatJSON     KafkaFormat = "json"
+	KafkaFormatProtobuf KafkaFormat = "protobuf"
+)
+
+type KafkaProducerConfig struct {
+	Brokers []string
+	Topic   string
+	Key     KafkaKey
+	Format  KafkaFormat
+	// QueueSize bounds the events waiting to be produced. Events published
+	// while it is full are dropped.
+	QueueSize int
+	// BatchSize is the most messages written per produce request.
+	BatchSize int
+}
+
+// KafkaProducer publishes stored events to a Kafka topic from a goroutine of
+// its own, so a slow or unreachable cluster never holds up the pipeline.
+// Failed writes are logged and counted; the writer retries on its own first.
+type KafkaProducer struct {
+	cfg     KafkaProducerConfig
+	writer  *kafka.Writer
+	metrics *metrics.Metrics
+	queue   *queue
+}
+
+func NewKafkaProducer(cfg KafkaProducerConfig, eventMetrics *metrics.Metrics) *KafkaProducer {
+	p := &KafkaProducer{
+		cfg: cfg,
+		writer: &kafka.Writer{
+			Addr:      kafka.TCP(cfg.Brokers...),
+			Topic:     cfg.Topic,
+			Balancer:  &kafka.Hash{},
+			BatchSize: max(cfg.BatchSize, 1),
+		},
+		metrics: eventMetrics,
+	}
+	p.queue = newQueue(kafkaSink, cfg.QueueSize, cfg.BatchSize, eventMetrics, p.produce)
+
+	return p
+}
+
+// Start launches the producing goroutine.
+func (p *KafkaProducer) Start() {
+	p.queue.start()
+}
+
+// Publish queues the event for producing, dropping it when the queue is full.
+func (p *KafkaProducer) Publish(event storage.ProcessedEvent) {
+	p.queue.publish(event)
+}
+
+// Close waits until the queued events are produced or ctx is done, then
+// closes the writer.
+func (p *KafkaProducer) Close(ctx context.Context) error {
+	return errors.Join(p.queue.close(ctx), p.writer.Close())
+}
+
+func (p *KafkaProducer) produce(ctx context.Context, events []storage.ProcessedEvent) {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		message, err := p.message(event)
+		if err != nil {
+			p.metrics.AddDeliveries(kafkaSink, metrics.DeliveryFailed, 1)
+			slog.Error("Failed to encode event for Kafka", "event_id", event.ID, "error", err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	err := p.writer.WriteMessages(ctx, messages...)
+	if err == nil {
+		p.metrics.AddDeliveries(kafkaSink, metrics.DeliverySucceeded, len(messages))
+		return
+	}
+
+	// WriteErrors holds one entry per message, nil for those written.
+	failed := len(messages)
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		failed = writeErrors.Count()
+	}
+	p.metrics.AddDeliveries(kafkaSink, metrics.DeliverySucceeded, len(messages)-failed)
+	p.metrics.AddDeliveries(kafkaSink, metrics.DeliveryFailed, failed)
+	slog.Error("Failed to produce events to Kafka", "topic", p.cfg.Topic, "events", len(messages), "failed", failed, "error", err)
+}
+
+func (p *KafkaProducer) message(event storage.ProcessedEvent) (kafka.Message, error) {
+	key := event.ID
+	if p.cfg.Key == KafkaKeyUserID && event.UserID != nil {
+		key = *event.UserID
+	}
+
+	var value []byte
+	var err error
+	contentType := "application/json"
+	if p.cfg.Format == KafkaFormatProtobuf {
+		var message *eventpb.Event
+		if message, err = eventpb.FromEventDTO(pipeline.ToEventDTO(event)); err != nil {
+			return kafka.Message{}, fmt.Errorf("convert to protobuf: %w", err)
+		}
+		value, err = proto.Marshal(message)
+		contentType = "application/x-protobuf"
+	} else {
+		value, err = json.Marshal(pipeline.ToEventDTO(event))
+	}
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(contentType)}},
+	}, nil
+}
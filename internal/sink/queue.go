@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"context"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// queue buffers stored events for a sink's delivery goroutine. Publishing
+// never blocks: events arriving while the queue is full are dropped and
+// counted instead.
+type queue struct {
+	sink      string
+	batchSize int
+	deliver   func(ctx context.Context, events []storage.ProcessedEvent)
+	metrics   *metrics.Metrics
+
+	mu     sync.RWMutex
+	closed bool
+	events chan storage.ProcessedEvent
+	done   chan struct{}
+	// ctx is cancelled when close gives up waiting, abandoning the delivery
+	// in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newQueue creates a queue holding up to size events and passing deliver up
+// to batchSize at a time.
+func newQueue(sink string, size, batchSize int, eventMetrics *metrics.Metrics, deliver func(ctx context.Context, events []storage.ProcessedEvent)) *queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &queue{
+		sink:      sink,
+		batchSize: max(batchSize, 1),
+		deliver:   deliver,
+		metrics:   eventMetrics,
+		events:    make(chan storage.ProcessedEvent, size),
+		done:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (q *queue) start() {
+	go q.run()
+}
+
+func (q *queue) publish(event storage.ProcessedEvent) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.events <- event:
+			return
+		default:
+		}
+	}
+
+	q.metrics.AddDeliveries(q.sink, metrics.DeliveryDropped, 1)
+	slog.Warn("Dropping event, sink queue is full", "sink", q.sink, "event_id", event.ID)
+}
+
+// close stops accepting events and waits until the queued ones are delivered
+// or ctx is done, in which case the rest are abandoned.
+func (q *queue) close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return fmt.Errorf("abandoned %s deliveries: %w", q.sink, ctx.Err())
+	}
+}
+
+// run passes deliver whatever is queued, up to batchSize events, without
+// waiting for a batch to fill up.
+func (q *queue) run() {
+	defer close(q.done)
+
+	batch := make([]storage.ProcessedEvent, 0, q.batchSize)
+	for event := range q.events {
+		if q.ctx.Err() != nil {
+			continue
+		}
+
+		batch = append(batch[:0], event)
+	fill:
+		for len(batch) < q.batchSize {
+			select {
+			case event, ok := <-q.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, event)
+			default:
+				break fill
+			}
+		}
+
+		q.deliver(q.ctx, batch)
+	}
+}
@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"event-processing-pipeline/internal/metrics"
+	"event-processing-pipeline/internal/pipeline"
+	"event-processing-pipeline/internal/storage"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the request
+// body, prefixed with "sha256=", when a secret is configured.
+const WebhookSignatureHeader = "X-Signature-256"
+
+const webhookSink = "webhook"
+
+type WebhookConfig struct {
+	URL string
+	// Secret signs every request body, unsigned when empty.
+	Secret string
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+	// QueueSize bounds the events waiting for delivery. Events published
+	// while it is full are dropped.
+	QueueSize int
+	// BatchSize is the most events sent per request. Above 1 the body is a
+	// JSON array even when fewer events are waiting, otherwise a single
+	// event object.
+	BatchSize int
+	// MaxRetries is the number of retries after a failed attempt.
+	MaxRetries  int
+	BaseBackoff time.Duration
+}
+
+// Webhook posts stored events to a URL from a goroutine of its own, so a slow
+// or unreachable receiver never holds up the pipeline. Events still failing
+// after the retries are dead-lettered.
+type Webhook struct {
+	cfg         WebhookConfig
+	client      *http.Client
+	deadLetters pipeline.DeadLetterService
+	metrics     *metrics.Metrics
+	queue       *queue
+}
+
+func NewWebhook(cfg WebhookConfig, deadLetters pipeline.DeadLetterService, eventMetrics *metrics.Metrics) *Webhook {
+	w := &Webhook{
+		cfg:         cfg,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		deadLetters: deadLetters,
+		metrics:     eventMetrics,
+	}
+	w.queue = newQueue(webhookSink, cfg.QueueSize, cfg.BatchSize, eventMetrics, w.deliver)
+
+	return w
+}
+
+// Start launches the delivery goroutine.
+func (w *Webhook) Start() {
+	w.queue.start()
+}
+
+// Publish queues the event for delivery, dropping it when the queue is full.
+func (w *Webhook) Publish(event storage.ProcessedEvent) {
+	w.queue.publish(event)
+}
+
+// Close stops accepting events and waits until the queued ones are delivered
+// or ctx is done, in which case the rest are abandoned.
+func (w *Webhook) Close(ctx context.Context) error {
+	return w.queue.close(ctx)
+}
+
+// deliver posts the batch, retrying with exponential backoff and full jitter
+// on network errors, 429 and 5xx responses. Other responses fail at once.
+func (w *Webhook) deliver(ctx context.Context, events []storage.ProcessedEvent) {
+	body, err := w.encode(events)
+	if err == nil {
+		err = w.post(ctx, body)
+		for attempt := 0; attempt < w.cfg.MaxRetries && err != nil && isRetryable(err); attempt++ {
+			if !wait(ctx, w.cfg.BaseBackoff<<attempt) {
+				err = errors.Join(err, ctx.Err())
+				break
+			}
+			err = w.post(ctx, body)
+		}
+	}
+
+	if err == nil {
+		w.metrics.AddDeliveries(webhookSink, metrics.DeliverySucceeded, len(events))
+		return
+	}
+
+	w.metrics.AddDeliveries(webhookSink, metrics.DeliveryFailed, len(events))
+	slog.Warn("Webhook delivery failed", "events", len(events), "error", err)
+	for _, event := range events {
+		w.deadLetters.Send(context.Background(), pipeline.ToEventDTO(event), metrics.StageWebhook, err)
+	}
+}
+
+// wait sleeps for a random duration up to backoff and reports whether ctx
+// was still live when it finished.
+func wait(ctx context.Context, backoff time.Duration) bool {
+	if backoff > 0 {
+		backoff = rand.N(backoff) + 1
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (w *Webhook) encode(events []storage.ProcessedEvent) ([]byte, error) {
+	if w.cfg.BatchSize <= 1 {
+		return json.Marshal(pipeline.ToEventDTO(events[0]))
+	}
+
+	dtos := make([]any, len(events))
+	for i, event := range events {
+		dtos[i] = pipeline.ToEventDTO(event)
+	}
+	return json.Marshal(dtos)
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if w.cfg.Secret != "" {
+		request.Header.Set(WebhookSignatureHeader, "sha256="+Sign(w.cfg.Secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return &deliveryError{err: err}
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &deliveryError{status: response.StatusCode}
+	}
+
+	slog.Debug("Webhook delivered", "status", response.StatusCode, "bytes", len(body))
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body under secret, as sent in
+// WebhookSignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveryError is a failed request, either without a response or with a
+// non-2xx status.
+type deliveryError struct {
+	status int
+	err    error
+}
+
+func (e *deliveryError) Error() string {
+	if e.err != nil {
+		return "webhook request failed: " + e.err.Error()
+	}
+	return fmt.Sprintf("webhook responded %d", e.status)
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+func isRetryable(err error) bool {
+	var deliveryErr *deliveryError
+	if !errors.As(err, &deliveryErr) {
+		return false
+	}
+
+	return deliveryErr.err != nil || deliveryErr.status == http.StatusTooManyRequests || deliveryErr.status >= 500
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is an event that failed a pipeline stage, kept with its original
+// payload so it can be inspected and retried.
+//
+// @Schema DeadLetter
+// @Property id integer
+// @Property event_id string(nullable)
+// @Property stage string
+// @Property error string
+// @Property payload object
+// @Property created_at date-time
+type DeadLetter struct {
+	ID        int64           `db:"id" json:"id"`
+	EventID   *string         `db:"event_id" json:"event_id"`
+	Stage     string          `db:"stage" json:"stage"`
+	Error     string          `db:"error" json:"error"`
+	Payload   json.RawMessage `db:"payload" json:"payload"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+type deadLetterRepository struct {
+	db      *sqlx.DB
+	dialect dialect
+	timeout statementTimeout
+}
+
+type DeadLetterRepository interface {
+	InsertDeadLetter(deadLetter DeadLetter) (int64, error)
+	FindDeadLetters(limit, offset int) ([]DeadLetter, error)
+	FindDeadLetterByID(id int64) (*DeadLetter, error)
+	DeleteDeadLetter(id int64) error
+	CountDeadLetters() (int64, error)
+}
+
+// NewDeadLetterRepository only applies the statement timeout of cfg.
+func NewDeadLetterRepository(db *sqlx.DB, cfg RepositoryConfig) DeadLetterRepository {
+	return &deadLetterRepository{
+		db:      db,
+		dialect: dialectFor(db.DriverName()),
+		timeout: statementTimeout{timeout: cfg.StatementTimeout, observe: cfg.ObserveStatementTimeout},
+	}
+}
+
+func (r *deadLetterRepository) InsertDeadLetter(deadLetter DeadLetter) (id int64, err error) {
+	// JSON columns reject binary strings, so the payload is sent as text.
+	err = r.timeout.run(context.Background(), OperationInsert, func(ctx context.Context) error {
+		id, err = r.dialect.insertReturningID(ctx, r.db,
+			"INSERT INTO dead_letters (event_id, stage, error, payload, created_at) VALUES (?, ?, ?, ?, ?)",
+			deadLetter.EventID, deadLetter.Stage, deadLetter.Error, string(deadLetter.Payload), deadLetter.CreatedAt,
+		)
+		return err
+	})
+	return id, err
+}
+
+func (r *deadLetterRepository) FindDeadLetters(limit, offset int) ([]DeadLetter, error) {
+	deadLetters := []DeadLetter{}
+	err := r.timeout.run(context.Background(), OperationSelect, func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &deadLetters,
+			r.db.Rebind("SELECT id, event_id, stage, error, payload, created_at FROM dead_letters ORDER BY id DESC LIMIT ? OFFSET ?"),
+			limit, offset,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deadLetters, nil
+}
+
+func (r *deadLetterRepository) FindDeadLetterByID(id int64) (*DeadLetter, error) {
+	var deadLetter DeadLetter
+	err := r.timeout.run(context.Background(), OperationSelect, func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &deadLetter, r.db.Rebind("SELECT id, event_id, stage, error, payload, created_at FROM dead_letters WHERE id = ?"), id)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetter, nil
+}
+
+func (r *deadLetterRepository) DeleteDeadLetter(id int64) error {
+	return r.timeout.run(context.Background(), OperationDelete, func(ctx context.Context) error {
+		_, err := r.db.ExecContext(ctx, r.db.Rebind("DELETE FROM dead_letters WHERE id = ?"), id)
+		return err
+	})
+}
+
+func (r *deadLetterRepository) CountDeadLetters() (int64, error) {
+	var count int64
+	err := r.timeout.run(context.Background(), OperationSelect, func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM dead_letters")
+	})
+	return count, err
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// dialect covers the SQL that differs between the supported databases.
+// Placeholders are written as "?" everywhere and rebound per driver by sqlx.
+type dialect interface {
+	// quote quotes an identifier such as a column alias.
+	quote(name string) string
+	// insertEvents completes an INSERT into table of the given column list
+	// and VALUES rows according to the dedup mode.
+	insertEvents(table, columns, rows string, mode DedupMode) string
+	// insertReturningID runs an INSERT into a table with a generated id
+	// column and returns the new id.
+	insertReturningID(ctx context.Context, db *sqlx.DB, query string, args ...interface{}) (int64, error)
+	// truncateTime rounds a timestamp column down to the start of its UTC
+	// interval bucket.
+	truncateTime(column string, interval Interval) string
+	// deleteEvents deletes the oldest events of table matching the where
+	// clause, at most as many as the argument following its own.
+	deleteEvents(table, where string) string
+	// createTableLike creates table with the columns and indexes of source
+	// unless it already exists.
+	createTableLike(table, source string) string
+	// columnExists selects whether the table named by the first argument has
+	// a column named by the second.
+	columnExists() string
+	// columnTypes selects the name and data type of every column of the
+	// table named by its argument, as columnType rows.
+	columnTypes() string
+	// eventColumnType returns the information_schema data type the
+	// migrations give an events column.
+	eventColumnType(column string) string
+	// addMetadataColumn returns the statements adding to table an indexed
+	// column generated from the first metadataIndexLength characters of the
+	// metadata value under key.
+	addMetadataColumn(table, key string) []string
+}
+
+func dialectFor(driverName string) dialect {
+	if driverName == DriverPostgres {
+		return postgresDialect{}
+	}
+
+	return mysqlDialect{}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) quote(name string) string {
+	return "`" + name + "`"
+}
+
+func (mysqlDialect) insertEvents(table, columns, rows string, mode DedupMode) string {
+	insert := "INSERT"
+	if mode == DedupIgnore {
+		insert = "INSERT IGNORE"
+	}
+
+	query := insert + " INTO " + table + " (" + columns + ") VALUES " + rows
+	if mode == DedupUpdate {
+		query += " AS new ON DUPLICATE KEY UPDATE " + updateAssignments(func(column string) string {
+			return "IF(tenant_id = new.tenant_id, new." + column + ", " + column + ")"
+		})
+	}
+
+	return query
+}
+
+func (mysqlDialect) insertReturningID(ctx context.Context, db *sqlx.DB, query string, args ...interface{}) (int64, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// truncateTime relies on DATETIME columns holding UTC, which is what the driver
+// writes with its default location.
+func (mysqlDialect) truncateTime(column string, interval Interval) string {
+	format := "%Y-%m-%d %H:%i:00"
+	switch interval {
+	case IntervalHour:
+		format = "%Y-%m-%d %H:00:00"
+	case IntervalDay:
+		format = "%Y-%m-%d 00:00:00"
+	}
+
+	return "CAST(DATE_FORMAT(" + column + ", '" + format + "') AS DATETIME)"
+}
+
+// deleteEvents walks the events in timestamp order, so a batch bounded by
+// time only locks the rows it deletes.
+func (mysqlDialect) deleteEvents(table, where string) string {
+	return "DELETE FROM " + table + where + " ORDER BY timestamp LIMIT ?"
+}
+
+func (mysqlDialect) createTableLike(table, source string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " LIKE " + source
+}
+
+func (mysqlDialect) columnExists() string {
+	return "SELECT COUNT(*) > 0 FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+}
+
+func (mysqlDialect) columnTypes() string {
+	return "SELECT column_name AS name, data_type AS type FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?"
+}
+
+var mysqlEventColumnTypes = map[string]string{
+	"id":             "varchar",
+	"type":           "varchar",
+	"source":         "varchar",
+	"timestamp":      "datetime",
+	"user_id":        "varchar",
+	"action":         "varchar",
+	"value":          "double",
+	"value_int":      "bigint",
+	"metadata":       "json",
+	"schema_version": "int",
+	"tenant_id":      "varchar",
+}
+
+func (mysqlDialect) eventColumnType(column string) string {
+	return mysqlEventColumnTypes[column]
+}
+
+// addMetadataColumn adds a virtual column, which costs no storage and is
+// added without rebuilding the table; only the index is materialized.
+func (mysqlDialect) addMetadataColumn(table, key string) []string {
+	column := metadataColumn(key)
+	return []string{
+		"ALTER TABLE " + table + " ADD COLUMN " + column + " VARCHAR(" + strconv.Itoa(metadataIndexLength) + ")" +
+			" GENERATED ALWAYS AS (LEFT(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.\"" + key + "\"')), " + strconv.Itoa(metadataIndexLength) + ")) VIRTUAL," +
+			" ADD INDEX idx_" + table + "_" + column + " (" + column + ")",
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) quote(name string) string {
+	return `"` + name + `"`
+}
+
+func (postgresDialect) insertEvents(table, columns, rows string, mode DedupMode) string {
+	query := "INSERT INTO " + table + " (" + columns + ") VALUES " + rows
+
+	switch mode {
+	case DedupIgnore:
+		query += " ON CONFLICT (id) DO NOTHING"
+	case DedupUpdate:
+		query += " ON CONFLICT (id) DO UPDATE SET " + updateAssignments(func(column string) string {
+			return "EXCLUDED." + column
+		}) + " WHERE " + table + ".tenant_id = EXCLUDED.tenant_id"
+	}
+
+	return query
+}
+
+// insertReturningID uses RETURNING since the Postgres driver does not support
+// LastInsertId.
+func (postgresDialect) insertReturningID(ctx context.Context, db *sqlx.DB, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if err := db.GetContext(ctx, &id, db.Rebind(query+" RETURNING id"), args...); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// truncateTime converts to UTC first so buckets do not depend on the session
+// time zone.
+func (postgresDialect) truncateTime(column string, interval Interval) string {
+	return "date_trunc('" + string(interval) + "', " + column + " AT TIME ZONE 'UTC')"
+}
+
+// deleteEvents selects the batch through a subquery since Postgres has no
+// DELETE ... LIMIT.
+func (postgresDialect) deleteEvents(table, where string) string {
+	return "DELETE FROM " + table + " WHERE id IN (SELECT id FROM " + table + where + " ORDER BY timestamp LIMIT ?)"
+}
+
+// createTableLike copies defaults and indexes too, which LIKE leaves out
+// unless told otherwise.
+func (postgresDialect) createTableLike(table, source string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (LIKE " + source + " INCLUDING ALL)"
+}
+
+func (postgresDialect) columnExists() string {
+	return "SELECT COUNT(*) > 0 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+}
+
+func (postgresDialect) columnTypes() string {
+	return "SELECT column_name AS name, data_type AS type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+var postgresEventColumnTypes = map[string]string{
+	"id":             "character varying",
+	"type":           "character varying",
+	"source":         "character varying",
+	"timestamp":      "timestamp with time zone",
+	"user_id":        "character varying",
+	"action":         "character varying",
+	"value":          "double precision",
+	"value_int":      "bigint",
+	"metadata":       "jsonb",
+	"schema_version": "integer",
+	"tenant_id":      "character varying",
+}
+
+func (postgresDialect) eventColumnType(column string) string {
+	return postgresEventColumnTypes[column]
+}
+
+// addMetadataColumn adds a stored column since Postgres cannot index virtual
+// ones, which rewrites the table once.
+func (postgresDialect) addMetadataColumn(table, key string) []string {
+	column := metadataColumn(key)
+	return []string{
+		"ALTER TABLE " + table + " ADD COLUMN IF NOT EXISTS " + column + " TEXT" +
+			" GENERATED ALWAYS AS (left(metadata->>'" + key + "', " + strconv.Itoa(metadataIndexLength) + ")) STORED",
+		"CREATE INDEX IF NOT EXISTS idx_" + table + "_" + column + " ON " + table + " (" + column + ")",
+	}
+}
+
+// updateAssignments overwrites every column but the id and the tenant with
+// the value the dialect computes from the new row. The dialects only take the
+// new values when the stored event belongs to the same tenant, so one tenant
+// cannot overwrite the events of another by reusing their ids.
+func updateAssignments(value func(column string) string) string {
+	assignments := make([]string, 0, len(eventColumns)-2)
+	for _, column := range eventColumns[1:] {
+		if column != "tenant_id" {
+			assignments = append(assignments, column+" = "+value(column))
+		}
+	}
+	return strings.Join(assignments, ", ")
+}
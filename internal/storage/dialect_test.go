@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestDialectQueries(t *testing.T) {
+	const columns = "id, type, source, timestamp, user_id, action, value, value_int, metadata, schema_version, tenant_id"
+
+	tests := []struct {
+		driver     string
+		wantInsert string
+		wantSelect string
+	}{
+		{
+			driver: DriverMySQL,
+			wantInsert: "INSERT IGNORE INTO events (" + columns + ") VALUES " +
+				"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			wantSelect: "SELECT id, type, source, timestamp, user_id, action AS `data.action`, value AS `data.value`, " +
+				"value_int AS `data.value_int`, metadata AS `data.metadata`, schema_version, tenant_id " +
+				"FROM events WHERE source = ? ORDER BY timestamp DESC LIMIT ? OFFSET ?",
+		},
+		{
+			driver: DriverPostgres,
+			wantInsert: "INSERT INTO events (" + columns + ") VALUES " +
+				"($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11), ($12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22) " +
+				"ON CONFLICT (id) DO NOTHING",
+			wantSelect: `SELECT id, type, source, timestamp, user_id, action AS "data.action", value AS "data.value", ` +
+				`value_int AS "data.value_int", metadata AS "data.metadata", schema_version, tenant_id ` +
+				"FROM events WHERE source = $1 ORDER BY timestamp DESC LIMIT $2 OFFSET $3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			db, fake := newFakeDB(t, tt.driver)
+			var selects []string
+			fake.query = func(query string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				selects = append(selects, query)
+				return nil, nil, nil
+			}
+			repo := NewEventRepository(db, RepositoryConfig{})
+
+			if _, err := repo.InsertEvents(context.Background(), testEvents(2)); err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+			if _, err := repo.FindEvents(context.Background(), EventFilter{Source: "web", Limit: 10}); err != nil {
+				t.Fatalf("FindEvents: %v", err)
+			}
+
+			executed := fake.executed()
+			if len(executed) != 1 || executed[0].query != tt.wantInsert {
+				t.Errorf("executed %+v, want the insert\n%s", executed, tt.wantInsert)
+			} else if args := len(executed[0].args); args != 2*eventColumnCount {
+				t.Errorf("insert bound %d arguments, want %d", args, 2*eventColumnCount)
+			}
+			if got := selects[len(selects)-1]; got != tt.wantSelect {
+				t.Errorf("select\n%s\nwant\n%s", got, tt.wantSelect)
+			}
+		})
+	}
+}
+
+func TestTruncateTime(t *testing.T) {
+	tests := []struct {
+		driver   string
+		interval Interval
+		want     string
+	}{
+		{driver: DriverMySQL, interval: IntervalMinute, want: "CAST(DATE_FORMAT(timestamp, '%Y-%m-%d %H:%i:00') AS DATETIME)"},
+		{driver: DriverMySQL, interval: IntervalHour, want: "CAST(DATE_FORMAT(timestamp, '%Y-%m-%d %H:00:00') AS DATETIME)"},
+		{driver: DriverMySQL, interval: IntervalDay, want: "CAST(DATE_FORMAT(timestamp, '%Y-%m-%d 00:00:00') AS DATETIME)"},
+		{driver: DriverPostgres, interval: IntervalHour, want: "date_trunc('hour', timestamp AT TIME ZONE 'UTC')"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver+"/"+string(tt.interval), func(t *testing.T) {
+			if got := dialectFor(tt.driver).truncateTime("timestamp", tt.interval); got != tt.want {
+				t.Errorf("truncateTime = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,9 +17,12 @@ type EventType string
 type Source string
 
 type Data struct {
-	Action   string                 `db:"action"`
-	Value    float32                `db:"value"`
-	Metadata map[string]interface{} `db:"metadata"`
+	Action string  `db:"action"`
+	Value  float64 `db:"value"`
+	// IntValue holds the exact value of events with an integer value type,
+	// whose Value is rounded to the nearest float64. It is nil otherwise.
+	IntValue *int64   `db:"value_int"`
+	Metadata Metadata `db:"metadata"`
 }
 
 type ProcessedEvent struct {
@@ -23,40 +32,456 @@ type ProcessedEvent struct {
 	Timestamp time.Time `db:"timestamp"`
 	UserID    *string   `db:"user_id"`
 	Data      Data      `db:"data"`
+	// SchemaVersion is the version of the event shape the data follows.
+	SchemaVersion int `db:"schema_version"`
+	// TenantID is the tenant owning the event, empty without multi-tenancy.
+	TenantID string `db:"tenant_id"`
+}
+
+// DefaultSchemaVersion is the schema version of events that do not state one.
+const DefaultSchemaVersion = 1
+
+// MaxInsertBatchSize keeps a multi-row insert under MySQL's limit of 65535
+// placeholders per prepared statement.
+const MaxInsertBatchSize = 65535 / eventColumnCount
+
+const eventColumnCount = 11
+
+var eventColumns = [eventColumnCount]string{"id", "type", "source", "timestamp", "user_id", "action", "value", "value_int", "metadata", "schema_version", "tenant_id"}
+
+// DedupMode controls what happens when an inserted event id already exists.
+type DedupMode string
+
+const (
+	// DedupIgnore skips duplicates and keeps the stored row.
+	DedupIgnore DedupMode = "ignore"
+	// DedupUpdate overwrites the stored row with the new event.
+	DedupUpdate DedupMode = "update"
+	// DedupError fails the insert with a duplicate key error.
+	DedupError DedupMode = "error"
+)
+
+type RepositoryConfig struct {
+	InsertBatchSize int
+	DedupMode       DedupMode
+	// ObserveWrite, when set, is called after every INSERT statement with the
+	// number of events it carried.
+	ObserveWrite func(rows int, duration time.Duration, err error)
+	// SlowWriteThreshold logs INSERT statements taking at least this long.
+	// Zero disables the log. The in-memory repository ignores both.
+	SlowWriteThreshold time.Duration
+	// PreparedInserts is the number of INSERT statements kept prepared,
+	// zero runs every INSERT ad hoc.
+	PreparedInserts int
+	// StatementTimeout cancels any single statement running longer, failing
+	// it with ErrStatementTimeout. Zero leaves statements unbounded. Exports
+	// stream for as long as they take and are not bounded, and the in-memory
+	// repository ignores it.
+	StatementTimeout time.Duration
+	// ObserveStatementTimeout, when set, is called with the operation of
+	// every statement cancelled by StatementTimeout.
+	ObserveStatementTimeout func(operation string)
+}
+
+// eventsTable is the table events are stored in without sharding.
+const eventsTable = "events"
+
+// maxLoggedQueryLength truncates multi-row INSERTs in the slow write log.
+const maxLoggedQueryLength = 256
+
+// InsertResult reports how many events were newly inserted and how many
+// already existed. With DedupUpdate the duplicates were overwritten. Spooled
+// counts the events set aside to be written later instead, such as to the
+// pipeline's write-ahead log, which are neither inserted nor duplicates yet.
+// DuplicateIDs lists the ids of the duplicates, an id repeated within the
+// events once for every occurrence after the first.
+type InsertResult struct {
+	Inserted     int      `json:"inserted"`
+	Duplicates   int      `json:"duplicates"`
+	Spooled      int      `json:"spooled,omitempty"`
+	DuplicateIDs []string `json:"-"`
+}
+
+func (r InsertResult) Add(other InsertResult) InsertResult {
+	return InsertResult{
+		Inserted:     r.Inserted + other.Inserted,
+		Duplicates:   r.Duplicates + other.Duplicates,
+		Spooled:      r.Spooled + other.Spooled,
+		DuplicateIDs: append(r.DuplicateIDs, other.DuplicateIDs...),
+	}
 }
 
 type eventRepository struct {
-	db *sqlx.DB
+	db           *sqlx.DB
+	dialect      dialect
+	table        string
+	batchSize    int
+	dedupMode    DedupMode
+	observeWrite func(rows int, duration time.Duration, err error)
+	slowWrite    time.Duration
+	statements   *stmtCache
+	timeout      statementTimeout
 }
 
+// EventRepository is the storage contract of the pipeline. The SQL
+// implementation supports MySQL and Postgres, picking the dialect from the
+// driver the database handle was opened with. Every call is abandoned once
+// its context is done.
 type EventRepository interface {
-	InsertEvent(id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error)
+	InsertEvent(ctx context.Context, id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error)
+	InsertEvents(ctx context.Context, events []ProcessedEvent) (InsertResult, error)
+	InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []ProcessedEvent) (InsertResult, error)
+	WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error
+	UpsertEvents(ctx context.Context, events []ProcessedEvent) (inserted, updated int, err error)
+	DeleteEvents(ctx context.Context, filter EventFilter, limit int) (int64, error)
+	FindEventByID(ctx context.Context, id string) (*ProcessedEvent, error)
+	FindEvents(ctx context.Context, filter EventFilter) ([]ProcessedEvent, error)
+	CountEvents(ctx context.Context, filter EventFilter) (int64, error)
+	ExportEvents(ctx context.Context, filter EventFilter, fn func(ProcessedEvent) error) error
+	CountEventsByGroup(ctx context.Context, filter EventFilter, groupBy GroupBy) ([]GroupCount, error)
+	CountEventsByInterval(ctx context.Context, filter EventFilter, interval Interval, groupBy GroupBy) ([]TimeBucket, error)
+	// Close releases what the repository holds besides the database handle.
+	Close() error
+}
+
+func NewEventRepository(db *sqlx.DB, cfg RepositoryConfig) EventRepository {
+	return newEventRepository(db, cfg, eventsTable, newStmtCache(db, cfg.PreparedInserts))
 }
 
-func NewEventRepository(db *sqlx.DB) EventRepository {
+// newEventRepository returns a repository of the events stored in table,
+// preparing its inserts through statements.
+func newEventRepository(db *sqlx.DB, cfg RepositoryConfig, table string, statements *stmtCache) *eventRepository {
+	batchSize := cfg.InsertBatchSize
+	if batchSize < 1 || batchSize > MaxInsertBatchSize {
+		batchSize = MaxInsertBatchSize
+	}
+
+	dedupMode := cfg.DedupMode
+	if dedupMode == "" {
+		dedupMode = DedupIgnore
+	}
+
 	return &eventRepository{
-		db: db,
+		db:           db,
+		dialect:      dialectFor(db.DriverName()),
+		table:        table,
+		batchSize:    batchSize,
+		dedupMode:    dedupMode,
+		observeWrite: cfg.ObserveWrite,
+		slowWrite:    cfg.SlowWriteThreshold,
+		statements:   statements,
+		timeout:      statementTimeout{timeout: cfg.StatementTimeout, observe: cfg.ObserveStatementTimeout},
 	}
 }
 
-func (r *eventRepository) InsertEvent(id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error) {
+// Close closes the prepared statements. Inserts after Close run ad hoc.
+func (r *eventRepository) Close() error {
+	return r.statements.close()
+}
+
+func (r *eventRepository) InsertEvent(ctx context.Context, id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error) {
 
 	event := &ProcessedEvent{
-		ID:        id,
-		Type:      eventType,
-		Source:    source,
-		Timestamp: timestamp,
-		UserID:    userId,
-		Data:      data,
+		ID:            id,
+		Type:          eventType,
+		Source:        source,
+		Timestamp:     timestamp,
+		UserID:        userId,
+		Data:          data,
+		SchemaVersion: DefaultSchemaVersion,
 	}
 
-	query := `INSERT INTO events (id, type, source, timestamp, user_id, action, value, metadata) 
-			  VALUES (:id, :type, :source, :timestamp, :user_id, :action, :value, :metadata)`
-
-	_, err := r.db.NamedExec(query, event)
+	query, args := r.buildInsertQuery([]ProcessedEvent{*event}, r.dedupMode)
+	_, err := r.execWrite(ctx, nil, r.db.Rebind(query), args, 1)
 	if err != nil {
 		return nil, err
 	}
 
 	return event, nil
 }
+
+// InsertEvents writes the events with multi-row INSERT statements of at most
+// batchSize rows each, all inside a single transaction.
+func (r *eventRepository) InsertEvents(ctx context.Context, events []ProcessedEvent) (InsertResult, error) {
+	var result InsertResult
+	err := r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = r.InsertEventsTx(ctx, tx, events)
+		return err
+	})
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	return result, nil
+}
+
+// InsertEventsTx writes the events within a transaction owned by the caller,
+// giving up once ctx is done.
+func (r *eventRepository) InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []ProcessedEvent) (InsertResult, error) {
+	return r.insertEventsTx(ctx, tx, events, r.dedupMode)
+}
+
+// UpsertEvents writes the events in a single transaction, overwriting stored
+// events with the same id whatever the DedupMode, and returns how many were
+// new and how many replaced a stored event.
+func (r *eventRepository) UpsertEvents(ctx context.Context, events []ProcessedEvent) (inserted, updated int, err error) {
+	var result InsertResult
+	err = r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = r.insertEventsTx(ctx, tx, events, DedupUpdate)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return result.Inserted, result.Duplicates, nil
+}
+
+// DeleteEvents deletes up to limit of the oldest events matching filter,
+// ignoring its Limit and Offset, and returns how many it deleted.
+func (r *eventRepository) DeleteEvents(ctx context.Context, filter EventFilter, limit int) (int64, error) {
+	where, args := buildWhereClause(filter)
+	args = append(args, limit)
+
+	var result sql.Result
+	err := r.timeout.run(ctx, OperationDelete, func(ctx context.Context) error {
+		var err error
+		result, err = r.db.ExecContext(ctx, r.db.Rebind(r.dialect.deleteEvents(r.table, where)), args...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *eventRepository) insertEventsTx(ctx context.Context, tx *sqlx.Tx, events []ProcessedEvent, mode DedupMode) (InsertResult, error) {
+	var result InsertResult
+	for start := 0; start < len(events); start += r.batchSize {
+		end := min(start+r.batchSize, len(events))
+
+		chunk, err := r.insertChunk(ctx, tx, events[start:end], mode)
+		if err != nil {
+			return InsertResult{}, err
+		}
+		result = result.Add(chunk)
+	}
+
+	return result, nil
+}
+
+// WithTransaction runs fn inside a transaction, committing when it returns nil
+// and rolling back otherwise. The driver rolls back on its own when ctx is done
+// first.
+func (r *eventRepository) WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *eventRepository) insertChunk(ctx context.Context, tx *sqlx.Tx, events []ProcessedEvent, mode DedupMode) (InsertResult, error) {
+	// The affected row count does not tell updates apart reliably: MySQL
+	// counts an update leaving the row unchanged like an insert, and neither
+	// dialect reports rows of other tenants left alone. Look the existing
+	// rows up first instead, locking them until the transaction ends. Nor
+	// does it tell which rows were skipped as duplicates, so look those up
+	// too, without locking, when there is more than one.
+	var existing map[string]string
+	if mode == DedupUpdate || mode == DedupIgnore && len(events) > 1 {
+		err := r.timeout.run(ctx, OperationSelect, func(ctx context.Context) error {
+			var err error
+			existing, err = existingTenants(ctx, tx, r.table, events, mode == DedupUpdate)
+			return err
+		})
+		if err != nil {
+			return InsertResult{}, err
+		}
+	}
+
+	query, args := r.buildInsertQuery(events, mode)
+	result, err := r.execWrite(ctx, tx, tx.Rebind(query), args, len(events))
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	if mode == DedupUpdate {
+		return countUpserts(events, existing), nil
+	}
+
+	inserted := InsertResult{Inserted: int(rows), Duplicates: len(events) - int(rows)}
+	switch {
+	case inserted.Duplicates == 0:
+	case len(events) == 1:
+		inserted.DuplicateIDs = []string{events[0].ID}
+	default:
+		inserted.DuplicateIDs = duplicateIDs(events, existing)
+	}
+	return inserted, nil
+}
+
+// execWrite runs an INSERT of rows events inside tx, or outside any
+// transaction when tx is nil, reporting it to the write observer and logging
+// it when it is slow. Only the parameter count is logged, never the values.
+func (r *eventRepository) execWrite(ctx context.Context, tx *sqlx.Tx, query string, args []interface{}, rows int) (sql.Result, error) {
+	var result sql.Result
+	start := time.Now()
+	err := r.timeout.run(ctx, OperationInsert, func(ctx context.Context) error {
+		var err error
+		result, err = r.exec(ctx, tx, query, args, rows)
+		return err
+	})
+	duration := time.Since(start)
+
+	if r.observeWrite != nil {
+		r.observeWrite(rows, duration, err)
+	}
+
+	if r.slowWrite > 0 && duration >= r.slowWrite {
+		logged := query
+		if len(logged) > maxLoggedQueryLength {
+			logged = logged[:maxLoggedQueryLength] + "..."
+		}
+		slog.Warn("Slow write", "query", logged, "params", len(args), "rows", rows, "duration", duration.String(), "error", err)
+	}
+
+	return result, err
+}
+
+// exec runs an INSERT of rows events as a cached prepared statement when
+// there is one, ad hoc otherwise. Only single events and full chunks are
+// prepared: the sizes of the last chunk of a batch vary from write to write,
+// and caching the first ones seen would fill the cache with sizes that may
+// never come back.
+func (r *eventRepository) exec(ctx context.Context, tx *sqlx.Tx, query string, args []interface{}, rows int) (sql.Result, error) {
+	var stmt *sqlx.Stmt
+	if rows == 1 || rows == r.batchSize {
+		stmt = r.statements.get(ctx, query)
+	}
+	switch {
+	case stmt != nil && tx != nil:
+		return tx.StmtxContext(ctx, stmt).ExecContext(ctx, args...)
+	case stmt != nil:
+		return stmt.ExecContext(ctx, args...)
+	case tx != nil:
+		return tx.ExecContext(ctx, query, args...)
+	default:
+		return r.db.ExecContext(ctx, query, args...)
+	}
+}
+
+// existingTenants maps the ids of events already stored in table to the
+// tenant owning them, locking their rows when lock is set.
+func existingTenants(ctx context.Context, tx *sqlx.Tx, table string, events []ProcessedEvent, lock bool) (map[string]string, error) {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+
+	query := "SELECT id, tenant_id FROM " + table + " WHERE id IN (?)"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	query, args, err := sqlx.In(query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID       string `db:"id"`
+		TenantID string `db:"tenant_id"`
+	}
+	if err := tx.SelectContext(ctx, &rows, tx.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	tenants := make(map[string]string, len(rows))
+	for _, row := range rows {
+		tenants[row.ID] = row.TenantID
+	}
+
+	return tenants, nil
+}
+
+// countUpserts counts the events an upsert inserted and those overwriting a
+// row of their own tenant, given the rows that existed before it. Events
+// colliding with another tenant's row leave it alone and count as neither. A
+// repeated id counts as an update of the row its first occurrence wrote.
+func countUpserts(events []ProcessedEvent, existing map[string]string) InsertResult {
+	var result InsertResult
+	for _, event := range events {
+		tenant, exists := existing[event.ID]
+		switch {
+		case !exists:
+			result.Inserted++
+			existing[event.ID] = event.TenantID
+		case tenant == event.TenantID:
+			result.Duplicates++
+			result.DuplicateIDs = append(result.DuplicateIDs, event.ID)
+		}
+	}
+
+	return result
+}
+
+// duplicateIDs lists the ids of the events an insert skipped, given the rows
+// that existed before it: those stored already and the repeats of an id
+// within events.
+func duplicateIDs(events []ProcessedEvent, existing map[string]string) []string {
+	var ids []string
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		if _, exists := existing[event.ID]; exists || seen[event.ID] {
+			ids = append(ids, event.ID)
+		}
+		seen[event.ID] = true
+	}
+
+	return ids
+}
+
+func (r *eventRepository) buildInsertQuery(events []ProcessedEvent, mode DedupMode) (string, []interface{}) {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(eventColumns)), ", ") + ")"
+	rows := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*len(eventColumns))
+
+	for i, event := range events {
+		rows[i] = row
+		args = append(args,
+			event.ID,
+			event.Type,
+			event.Source,
+			event.Timestamp,
+			event.UserID,
+			event.Data.Action,
+			event.Data.Value,
+			event.Data.IntValue,
+			event.Data.Metadata,
+			event.SchemaVersion,
+			event.TenantID,
+		)
+	}
+
+	return r.dialect.insertEvents(r.table, strings.Join(eventColumns[:], ", "), strings.Join(rows, ", "), mode), args
+}
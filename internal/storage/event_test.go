@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInsertEventsReportsDuplicateIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []ProcessedEvent
+		existing []string
+		rows     int64
+		want     []string
+		lookups  int
+	}{
+		{name: "single new event", events: testEvents(1), rows: 1},
+		{name: "single duplicate", events: testEvents(1), rows: 0, want: []string{"evt-0"}},
+		{name: "none stored", events: testEvents(3), rows: 3, lookups: 1},
+		{name: "one stored", events: testEvents(3), existing: []string{"evt-1"}, rows: 2, want: []string{"evt-1"}, lookups: 1},
+		{name: "repeated id", events: append(testEvents(2), testEvents(1)...), rows: 2, want: []string{"evt-0"}, lookups: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			lookups := 0
+			fake.query = func(query string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				if strings.Contains(query, "FOR UPDATE") {
+					return nil, nil, fmt.Errorf("ignored duplicates locked: %s", query)
+				}
+				lookups++
+				rows := make([][]driver.Value, len(tt.existing))
+				for i, id := range tt.existing {
+					rows[i] = []driver.Value{id, ""}
+				}
+				return []string{"id", "tenant_id"}, rows, nil
+			}
+			fake.exec = func(string, []driver.NamedValue) (int64, error) { return tt.rows, nil }
+			repo := NewEventRepository(db, RepositoryConfig{})
+
+			result, err := repo.InsertEvents(context.Background(), tt.events)
+			if err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+			if fmt.Sprint(result.DuplicateIDs) != fmt.Sprint(tt.want) || result.Duplicates != len(tt.want) {
+				t.Errorf("duplicates %d %v, want %v", result.Duplicates, result.DuplicateIDs, tt.want)
+			}
+			if lookups != tt.lookups {
+				t.Errorf("looked existing ids up %d times, want %d", lookups, tt.lookups)
+			}
+		})
+	}
+}
+
+func TestInsertEventsCancelledMidWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(ctx context.Context) (context.Context, context.CancelFunc)
+		want error
+	}{
+		{name: "cancelled", stop: context.WithCancel, want: context.Canceled},
+		{
+			name: "deadline",
+			stop: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(ctx, 20*time.Millisecond)
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.stop(context.Background())
+			defer cancel()
+
+			// The first chunk is written, the second hangs until the
+			// context is done.
+			db, fake := newFakeDB(t, DriverMySQL)
+			inserts := 0
+			fake.wait = func(ctx context.Context, query string) error {
+				if !strings.HasPrefix(query, "INSERT") {
+					return nil
+				}
+				if inserts++; inserts == 1 {
+					return nil
+				}
+				if tt.want == context.Canceled {
+					cancel()
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			repo := NewEventRepository(db, RepositoryConfig{InsertBatchSize: 2})
+
+			start := time.Now()
+			if _, err := repo.InsertEvents(ctx, testEvents(4)); !errors.Is(err, tt.want) {
+				t.Fatalf("InsertEvents error = %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("InsertEvents returned after %s", elapsed)
+			}
+			if executed := len(fake.executed()); executed != 1 {
+				t.Errorf("executed %d statements, want the first chunk only", executed)
+			}
+		})
+	}
+}
+
+func TestCountUpserts(t *testing.T) {
+	tenantEvent := func(id, tenant string) ProcessedEvent {
+		return ProcessedEvent{ID: id, TenantID: tenant}
+	}
+
+	tests := []struct {
+		name     string
+		events   []ProcessedEvent
+		existing map[string]string
+		want     InsertResult
+	}{
+		{name: "all new", events: testEvents(2), want: InsertResult{Inserted: 2}},
+		{
+			name:     "new and existing",
+			events:   testEvents(3),
+			existing: map[string]string{"evt-1": ""},
+			want:     InsertResult{Inserted: 2, Duplicates: 1, DuplicateIDs: []string{"evt-1"}},
+		},
+		{
+			name:   "repeated id",
+			events: append(testEvents(1), testEvents(1)...),
+			want:   InsertResult{Inserted: 1, Duplicates: 1, DuplicateIDs: []string{"evt-0"}},
+		},
+		{
+			name:     "row of another tenant",
+			events:   []ProcessedEvent{tenantEvent("evt-1", "acme"), tenantEvent("evt-2", "acme")},
+			existing: map[string]string{"evt-1": "globex", "evt-2": "acme"},
+			want:     InsertResult{Duplicates: 1, DuplicateIDs: []string{"evt-2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := map[string]string{}
+			for id, tenant := range tt.existing {
+				existing[id] = tenant
+			}
+			if got := countUpserts(tt.events, existing); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("countUpserts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindEventByID(t *testing.T) {
+	columns := []string{"id", "type", "source", "timestamp", "user_id", "data.action", "data.value", "data.value_int", "data.metadata", "schema_version", "tenant_id"}
+	stored := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	errLost := errors.New("connection lost")
+
+	tests := []struct {
+		name    string
+		rows    [][]driver.Value
+		err     error
+		want    *ProcessedEvent
+		wantErr error
+	}{
+		{
+			name: "found",
+			rows: [][]driver.Value{{"evt-1", "user_action", "web", stored, nil, "click", 1.5, nil, []byte(`{"a":"b"}`), int64(1), ""}},
+			want: &ProcessedEvent{ID: "evt-1", Type: "user_action", Source: "web", Timestamp: stored, Data: Data{Action: "click", Value: 1.5, Metadata: Metadata{"a": "b"}}, SchemaVersion: 1},
+		},
+		{name: "not found", wantErr: ErrEventNotFound},
+		{name: "database error", err: errLost, wantErr: errLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			fake.query = func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				return columns, tt.rows, tt.err
+			}
+			repo := NewEventRepository(db, RepositoryConfig{})
+
+			event, err := repo.FindEventByID(context.Background(), "evt-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FindEventByID error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(event, tt.want) {
+				t.Errorf("FindEventByID = %+v, want %+v", event, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueriesScopedToTenant(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(repo EventRepository, filter EventFilter) error
+	}{
+		{name: "find", run: func(repo EventRepository, filter EventFilter) error {
+			_, err := repo.FindEvents(context.Background(), filter)
+			return err
+		}},
+		{name: "count", run: func(repo EventRepository, filter EventFilter) error {
+			_, err := repo.CountEvents(context.Background(), filter)
+			return err
+		}},
+		{name: "delete", run: func(repo EventRepository, filter EventFilter) error {
+			_, err := repo.DeleteEvents(context.Background(), filter, 10)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			var queries []string
+			var args [][]driver.NamedValue
+			fake.query = func(query string, a []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				queries, args = append(queries, query), append(args, a)
+				if !strings.Contains(query, "COUNT(") {
+					return nil, nil, nil
+				}
+				return []string{"count"}, [][]driver.Value{{int64(0)}}, nil
+			}
+			fake.exec = func(query string, a []driver.NamedValue) (int64, error) {
+				queries, args = append(queries, query), append(args, a)
+				return 0, nil
+			}
+			repo := NewEventRepository(db, RepositoryConfig{})
+
+			if err := tt.run(repo, EventFilter{Source: "web", TenantID: "acme"}); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if len(queries) != 1 || !strings.Contains(queries[0], "source = ? AND tenant_id = ?") {
+				t.Fatalf("queries %q, want one filtering on the tenant", queries)
+			}
+			if len(args[0]) < 2 || args[0][1].Value != "acme" {
+				t.Errorf("args = %v, want web and acme first", args[0])
+			}
+		})
+	}
+}
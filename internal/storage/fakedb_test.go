@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB is a database/sql driver recording the statements run through it,
+// for testing the SQL the repository sends without a database. Statements
+// succeed unless exec or query say otherwise.
+type fakeDB struct {
+	// exec returns the rows affected by a statement, all of its rows by
+	// default.
+	exec func(query string, args []driver.NamedValue) (int64, error)
+	// query returns the columns and rows of a SELECT, none by default.
+	query func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error)
+	// wait runs before each statement with its context, for simulating
+	// slow statements.
+	wait func(ctx context.Context, query string) error
+
+	mu       sync.Mutex
+	prepared []string
+	closed   []string
+	execs    []fakeExec
+}
+
+type fakeExec struct {
+	query    string
+	args     []driver.NamedValue
+	prepared bool
+}
+
+// newFakeDB returns a handle on a fakeDB that sqlx and the dialects take for
+// driverName.
+func newFakeDB(t *testing.T, driverName string) (*sqlx.DB, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{}
+	db := sqlx.NewDb(sql.OpenDB(fake), driverName)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{} }
+
+// preparedQueries returns the queries prepared so far.
+func (f *fakeDB) preparedQueries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prepared...)
+}
+
+// executed returns the statements run so far.
+func (f *fakeDB) executed() []fakeExec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeExec(nil), f.execs...)
+}
+
+func (f *fakeDB) run(ctx context.Context, query string, args []driver.NamedValue, prepared bool) (driver.Result, error) {
+	if f.wait != nil {
+		if err := f.wait(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	f.mu.Lock()
+	f.execs = append(f.execs, fakeExec{query: query, args: args, prepared: prepared})
+	f.mu.Unlock()
+
+	if f.exec != nil {
+		n, err := f.exec(query, args)
+		return driver.RowsAffected(n), err
+	}
+	return driver.RowsAffected(len(args) / eventColumnCount), nil
+}
+
+func (f *fakeDB) rows(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if f.wait != nil {
+		if err := f.wait(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.query == nil {
+		return &fakeRows{}, nil
+	}
+	columns, rows, err := f.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, driver.ErrSkip }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.prepared = append(c.db.prepared, query)
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.run(ctx, query, args, false)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.rows(ctx, query, args)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.closed = append(s.db.closed, s.query)
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { panic("not used") }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error)  { panic("not used") }
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.db.run(ctx, s.query, args, true)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.db.rows(ctx, s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,455 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const DriverMemory = "memory"
+
+// ErrDuplicateEvent is returned by the in-memory repository for an existing
+// id when running with DedupError, mirroring the SQL duplicate key error.
+var ErrDuplicateEvent = errors.New("duplicate event id")
+
+// memoryEventRepository keeps events in a map keyed by id. It is meant for
+// tests and local runs without a database and loses everything on restart.
+//
+// Writes are serialized by txMu and undone on rollback through an undo log,
+// so WithTransaction keeps the all-or-nothing semantics of the SQL backend.
+// The tx argument of InsertEventsTx is unused and may be nil. Readers may see
+// rows of a transaction that is still in progress.
+type memoryEventRepository struct {
+	txMu      sync.Mutex
+	undo      []undoEntry
+	mu        sync.RWMutex
+	events    map[string]ProcessedEvent
+	dedupMode DedupMode
+}
+
+// undoEntry restores the previous state of one id on rollback.
+type undoEntry struct {
+	id       string
+	previous ProcessedEvent
+	existed  bool
+}
+
+func NewMemoryEventRepository(cfg RepositoryConfig) EventRepository {
+	dedupMode := cfg.DedupMode
+	if dedupMode == "" {
+		dedupMode = DedupIgnore
+	}
+
+	return &memoryEventRepository{
+		events:    make(map[string]ProcessedEvent),
+		dedupMode: dedupMode,
+	}
+}
+
+func (r *memoryEventRepository) InsertEvent(ctx context.Context, id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error) {
+	event := ProcessedEvent{
+		ID:            id,
+		Type:          eventType,
+		Source:        source,
+		Timestamp:     timestamp,
+		UserID:        userId,
+		Data:          data,
+		SchemaVersion: DefaultSchemaVersion,
+	}
+
+	if _, err := r.InsertEvents(ctx, []ProcessedEvent{event}); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (r *memoryEventRepository) InsertEvents(ctx context.Context, events []ProcessedEvent) (InsertResult, error) {
+	var result InsertResult
+	err := r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = r.InsertEventsTx(ctx, tx, events)
+		return err
+	})
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	return result, nil
+}
+
+// InsertEventsTx must run inside WithTransaction, which owns the undo log.
+func (r *memoryEventRepository) InsertEventsTx(ctx context.Context, _ *sqlx.Tx, events []ProcessedEvent) (InsertResult, error) {
+	return r.insertEventsTx(ctx, events, r.dedupMode)
+}
+
+func (r *memoryEventRepository) UpsertEvents(ctx context.Context, events []ProcessedEvent) (inserted, updated int, err error) {
+	var result InsertResult
+	err = r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = r.insertEventsTx(ctx, events, DedupUpdate)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return result.Inserted, result.Duplicates, nil
+}
+
+func (r *memoryEventRepository) insertEventsTx(ctx context.Context, events []ProcessedEvent, mode DedupMode) (InsertResult, error) {
+	if err := ctx.Err(); err != nil {
+		return InsertResult{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result InsertResult
+	for _, event := range events {
+		previous, exists := r.events[event.ID]
+		if exists {
+			switch mode {
+			case DedupError:
+				return InsertResult{}, fmt.Errorf("%w: %s", ErrDuplicateEvent, event.ID)
+			case DedupIgnore:
+				result.Duplicates++
+				result.DuplicateIDs = append(result.DuplicateIDs, event.ID)
+				continue
+			}
+			if previous.TenantID != event.TenantID {
+				// Like the SQL dialects, leave other tenants' events alone
+				// and count them as neither inserted nor updated.
+				continue
+			}
+			result.Duplicates++
+			result.DuplicateIDs = append(result.DuplicateIDs, event.ID)
+		} else {
+			result.Inserted++
+		}
+
+		r.undo = append(r.undo, undoEntry{id: event.ID, previous: previous, existed: exists})
+		r.events[event.ID] = cloneEvent(event)
+	}
+
+	return result, nil
+}
+
+func (r *memoryEventRepository) Close() error {
+	return nil
+}
+
+func (r *memoryEventRepository) WithTransaction(_ context.Context, fn func(tx *sqlx.Tx) error) error {
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	r.undo = r.undo[:0]
+	if err := fn(nil); err != nil {
+		r.rollback()
+		return err
+	}
+
+	return nil
+}
+
+// DeleteEvents waits for running transactions, so a rollback cannot bring
+// deleted events back.
+func (r *memoryEventRepository) DeleteEvents(ctx context.Context, filter EventFilter, limit int) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired []ProcessedEvent
+	for _, event := range r.events {
+		if matches(event, filter) {
+			expired = append(expired, event)
+		}
+	}
+	slices.SortFunc(expired, func(a, b ProcessedEvent) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	expired = expired[:min(limit, len(expired))]
+	for _, event := range expired {
+		delete(r.events, event.ID)
+	}
+
+	return int64(len(expired)), nil
+}
+
+func (r *memoryEventRepository) rollback() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		entry := r.undo[i]
+		if entry.existed {
+			r.events[entry.id] = entry.previous
+		} else {
+			delete(r.events, entry.id)
+		}
+	}
+	r.undo = r.undo[:0]
+}
+
+func (r *memoryEventRepository) FindEventByID(_ context.Context, id string) (*ProcessedEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	event, ok := r.events[id]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+
+	event = cloneEvent(event)
+	return &event, nil
+}
+
+// FindEvents matches the SQL backend: newest first, then Limit and Offset.
+func (r *memoryEventRepository) FindEvents(_ context.Context, filter EventFilter) ([]ProcessedEvent, error) {
+	events := r.filter(filter)
+	slices.SortStableFunc(events, func(a, b ProcessedEvent) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+
+	if filter.Limit > 0 {
+		start := min(filter.Offset, len(events))
+		end := min(start+filter.Limit, len(events))
+		events = events[start:end]
+	}
+
+	return events, nil
+}
+
+func (r *memoryEventRepository) ExportEvents(ctx context.Context, filter EventFilter, fn func(ProcessedEvent) error) error {
+	events := r.filter(filter)
+	slices.SortStableFunc(events, func(a, b ProcessedEvent) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryEventRepository) CountEvents(_ context.Context, filter EventFilter) (int64, error) {
+	return int64(len(r.filter(filter))), nil
+}
+
+func (r *memoryEventRepository) CountEventsByGroup(_ context.Context, filter EventFilter, groupBy GroupBy) ([]GroupCount, error) {
+	if groupBy != GroupByType && groupBy != GroupBySource {
+		return nil, fmt.Errorf("cannot group by %q", groupBy)
+	}
+
+	totals := make(map[string]int64)
+	for _, event := range r.filter(filter) {
+		if groupBy == GroupByType {
+			totals[string(event.Type)]++
+		} else {
+			totals[string(event.Source)]++
+		}
+	}
+
+	counts := make([]GroupCount, 0, len(totals))
+	for group, count := range totals {
+		counts = append(counts, GroupCount{Group: group, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b GroupCount) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return cmp.Compare(a.Group, b.Group)
+	})
+
+	return counts, nil
+}
+
+func (r *memoryEventRepository) CountEventsByInterval(_ context.Context, filter EventFilter, interval Interval, groupBy GroupBy) ([]TimeBucket, error) {
+	width := interval.Duration()
+	if width == 0 {
+		return nil, fmt.Errorf("unknown interval %q", interval)
+	}
+	if groupBy != "" && groupBy != GroupByType && groupBy != GroupBySource {
+		return nil, fmt.Errorf("cannot group by %q", groupBy)
+	}
+
+	type bucketKey struct {
+		start time.Time
+		group string
+	}
+
+	totals := make(map[bucketKey]int64)
+	for _, event := range r.filter(filter) {
+		key := bucketKey{start: event.Timestamp.UTC().Truncate(width)}
+		switch groupBy {
+		case GroupByType:
+			key.group = string(event.Type)
+		case GroupBySource:
+			key.group = string(event.Source)
+		}
+		totals[key]++
+	}
+
+	buckets := make([]TimeBucket, 0, len(totals))
+	for key, count := range totals {
+		buckets = append(buckets, TimeBucket{Start: key.start, Group: key.group, Count: count})
+	}
+	slices.SortFunc(buckets, func(a, b TimeBucket) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Group, b.Group)
+	})
+
+	return buckets, nil
+}
+
+func (r *memoryEventRepository) filter(filter EventFilter) []ProcessedEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []ProcessedEvent{}
+	for _, event := range r.events {
+		if matches(event, filter) {
+			events = append(events, cloneEvent(event))
+		}
+	}
+
+	return events
+}
+
+func matches(event ProcessedEvent, filter EventFilter) bool {
+	if filter.Type != "" && event.Type != filter.Type {
+		return false
+	}
+	if filter.Source != "" && event.Source != filter.Source {
+		return false
+	}
+	if filter.UserID != "" && (event.UserID == nil || *event.UserID != filter.UserID) {
+		return false
+	}
+	if filter.TenantID != "" && event.TenantID != filter.TenantID {
+		return false
+	}
+	if !filter.From.IsZero() && event.Timestamp.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && event.Timestamp.After(filter.To) {
+		return false
+	}
+	if !filter.Before.IsZero() && !event.Timestamp.Before(filter.Before) {
+		return false
+	}
+	for key, want := range filter.Metadata {
+		if value, ok := metadataString(event.Data.Metadata[key]); !ok || value != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cloneEvent copies the pointer and map fields so callers cannot mutate the
+// stored event.
+func cloneEvent(event ProcessedEvent) ProcessedEvent {
+	if event.UserID != nil {
+		userID := *event.UserID
+		event.UserID = &userID
+	}
+	if event.Data.Metadata != nil {
+		metadata := make(Metadata, len(event.Data.Metadata))
+		for key, value := range event.Data.Metadata {
+			metadata[key] = value
+		}
+		event.Data.Metadata = metadata
+	}
+
+	return event
+}
+
+// memoryDeadLetterRepository keeps dead letters in insertion order.
+type memoryDeadLetterRepository struct {
+	mu          sync.RWMutex
+	nextID      int64
+	deadLetters []DeadLetter
+}
+
+func NewMemoryDeadLetterRepository() DeadLetterRepository {
+	return &memoryDeadLetterRepository{}
+}
+
+func (r *memoryDeadLetterRepository) InsertDeadLetter(deadLetter DeadLetter) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	deadLetter.ID = r.nextID
+	r.deadLetters = append(r.deadLetters, deadLetter)
+
+	return deadLetter.ID, nil
+}
+
+// FindDeadLetters returns the newest dead letters first, like the SQL backend.
+func (r *memoryDeadLetterRepository) FindDeadLetters(limit, offset int) ([]DeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deadLetters := []DeadLetter{}
+	for i := len(r.deadLetters) - 1 - offset; i >= 0 && len(deadLetters) < limit; i-- {
+		deadLetters = append(deadLetters, r.deadLetters[i])
+	}
+
+	return deadLetters, nil
+}
+
+func (r *memoryDeadLetterRepository) FindDeadLetterByID(id int64) (*DeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, deadLetter := range r.deadLetters {
+		if deadLetter.ID == id {
+			return &deadLetter, nil
+		}
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+func (r *memoryDeadLetterRepository) CountDeadLetters() (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.deadLetters)), nil
+}
+
+func (r *memoryDeadLetterRepository) DeleteDeadLetter(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadLetters = slices.DeleteFunc(r.deadLetters, func(deadLetter DeadLetter) bool {
+		return deadLetter.ID == id
+	})
+
+	return nil
+}
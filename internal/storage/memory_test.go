@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestMemoryInsertDedupModes(t *testing.T) {
+	tests := []struct {
+		mode       DedupMode
+		wantResult string
+		wantErr    error
+		wantValue  float64
+	}{
+		{mode: DedupIgnore, wantResult: "1 inserted, 1 duplicates", wantValue: 0},
+		{mode: DedupUpdate, wantResult: "1 inserted, 1 duplicates", wantValue: 7},
+		{mode: DedupError, wantErr: ErrDuplicateEvent, wantValue: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			repo := NewMemoryEventRepository(RepositoryConfig{DedupMode: tt.mode})
+			if _, err := repo.InsertEvents(context.Background(), testEvents(1)); err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+
+			events := testEvents(2)
+			events[0].Data.Value = 7
+			result, err := repo.InsertEvents(context.Background(), events)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InsertEvents error = %v, want %v", err, tt.wantErr)
+			}
+			if got := fmt.Sprintf("%d inserted, %d duplicates", result.Inserted, result.Duplicates); err == nil && got != tt.wantResult {
+				t.Errorf("InsertEvents = %s, want %s", got, tt.wantResult)
+			}
+
+			event, err := repo.FindEventByID(context.Background(), "evt-0")
+			if err != nil {
+				t.Fatalf("FindEventByID: %v", err)
+			}
+			if event.Data.Value != tt.wantValue {
+				t.Errorf("stored value = %v, want %v", event.Data.Value, tt.wantValue)
+			}
+			// A failed batch inserts none of its events.
+			if _, err := repo.FindEventByID(context.Background(), "evt-1"); (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("FindEventByID(evt-1) error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryTransactionRollsBack(t *testing.T) {
+	repo := NewMemoryEventRepository(RepositoryConfig{DedupMode: DedupUpdate})
+	if _, err := repo.InsertEvents(context.Background(), testEvents(1)); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	err := repo.WithTransaction(context.Background(), func(tx *sqlx.Tx) error {
+		events := testEvents(2)
+		events[0].Data.Value = 7
+		if _, err := repo.InsertEventsTx(context.Background(), tx, events); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTransaction error = %v, want %v", err, errAbort)
+	}
+
+	if event, err := repo.FindEventByID(context.Background(), "evt-0"); err != nil || event.Data.Value != 0 {
+		t.Errorf("evt-0 = %+v, %v; want the value before the transaction", event, err)
+	}
+	if _, err := repo.FindEventByID(context.Background(), "evt-1"); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("FindEventByID(evt-1) error = %v, want %v", err, ErrEventNotFound)
+	}
+}
+
+func TestMemoryFindEvents(t *testing.T) {
+	repo := NewMemoryEventRepository(RepositoryConfig{})
+	events := testEvents(5)
+	events[1].Source = "mobile"
+	events[3].Source = "mobile"
+	events[4].TenantID = "acme"
+	if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   string
+	}{
+		{name: "newest first", filter: EventFilter{}, want: "[evt-4 evt-3 evt-2 evt-1 evt-0]"},
+		{name: "by source", filter: EventFilter{Source: "mobile"}, want: "[evt-3 evt-1]"},
+		{name: "by tenant", filter: EventFilter{TenantID: "acme"}, want: "[evt-4]"},
+		{name: "time range", filter: EventFilter{From: events[1].Timestamp, To: events[3].Timestamp}, want: "[evt-3 evt-2 evt-1]"},
+		{name: "before", filter: EventFilter{Before: events[2].Timestamp}, want: "[evt-1 evt-0]"},
+		{name: "page", filter: EventFilter{Limit: 2, Offset: 1}, want: "[evt-3 evt-2]"},
+		{name: "past the end", filter: EventFilter{Limit: 2, Offset: 9}, want: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := repo.FindEvents(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("FindEvents: %v", err)
+			}
+			ids := make([]string, len(found))
+			for i, event := range found {
+				ids[i] = event.ID
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("FindEvents = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryReturnsCopies(t *testing.T) {
+	repo := NewMemoryEventRepository(RepositoryConfig{})
+	events := testEvents(1)
+	events[0].Data.Metadata = Metadata{"page": "home"}
+	if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	events[0].Data.Metadata["page"] = "changed by the caller"
+
+	found, err := repo.FindEventByID(context.Background(), "evt-0")
+	if err != nil {
+		t.Fatalf("FindEventByID: %v", err)
+	}
+	found.Data.Metadata["page"] = "changed by a reader"
+
+	again, _ := repo.FindEventByID(context.Background(), "evt-0")
+	if page := again.Data.Metadata["page"]; page != "home" {
+		t.Errorf("stored page = %v, want home", page)
+	}
+}
+
+func TestMemoryConcurrentInserts(t *testing.T) {
+	repo := NewMemoryEventRepository(RepositoryConfig{})
+
+	const writers = 8
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events := testEvents(10)
+			for j := range events {
+				events[j].ID = strconv.Itoa(i) + "-" + events[j].ID
+			}
+			if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+				t.Errorf("InsertEvents: %v", err)
+			}
+			repo.FindEvents(context.Background(), EventFilter{})
+		}()
+	}
+	wg.Wait()
+
+	if count, _ := repo.CountEvents(context.Background(), EventFilter{}); count != writers*10 {
+		t.Errorf("CountEvents = %d, want %d", count, writers*10)
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Metadata is stored as a JSON document. A nil map is stored as SQL NULL and
+// read back as nil, while an empty map round-trips as "{}". Numbers are read
+// back as json.Number, so integers keep the digits they were stored with.
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode metadata: %w", err)
+	}
+
+	return string(encoded), nil
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	var raw []byte
+	switch value := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		return fmt.Errorf("scan metadata: unsupported type %T", src)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var decoded map[string]interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Errorf("decode metadata: %w", err)
+	}
+
+	*m = decoded
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		want     Metadata
+	}{
+		{name: "nil", metadata: nil, want: nil},
+		{name: "empty", metadata: Metadata{}, want: Metadata{}},
+		{
+			name: "nested",
+			metadata: Metadata{
+				"session": map[string]any{"id": "s-1", "pages": []any{"home", "cart"}},
+				"count":   3,
+				"ratio":   0.5,
+				"flag":    true,
+				"missing": nil,
+			},
+			want: Metadata{
+				"session": map[string]any{"id": "s-1", "pages": []any{"home", "cart"}},
+				"count":   json.Number("3"),
+				"ratio":   json.Number("0.5"),
+				"flag":    true,
+				"missing": nil,
+			},
+		},
+		{
+			name:     "64-bit integer",
+			metadata: Metadata{"id": json.Number("9223372036854775807")},
+			want:     Metadata{"id": json.Number("9223372036854775807")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Insert through the driver and scan back what it was given.
+			db, fake := newFakeDB(t, DriverMySQL)
+			repo := NewEventRepository(db, RepositoryConfig{})
+			events := testEvents(1)
+			events[0].Data.Metadata = tt.metadata
+			if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+
+			execs := fake.executed()
+			if len(execs) != 1 {
+				t.Fatalf("ran %d statements, want 1", len(execs))
+			}
+			stored := execs[0].args[8].Value
+			if tt.metadata == nil && stored != nil {
+				t.Errorf("nil metadata stored as %v, want NULL", stored)
+			}
+
+			var got Metadata
+			if err := got.Scan(stored); err != nil {
+				t.Fatalf("Scan(%v): %v", stored, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metadata read back as %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    Metadata
+		wantErr bool
+	}{
+		{name: "bytes", src: []byte(`{"a":{"b":1}}`), want: Metadata{"a": map[string]any{"b": json.Number("1")}}},
+		{name: "string", src: `{"a":"b"}`, want: Metadata{"a": "b"}},
+		{name: "64-bit integer", src: `{"id":9007199254740993}`, want: Metadata{"id": json.Number("9007199254740993")}},
+		{name: "null", src: nil, want: nil},
+		{name: "not an object", src: `[1]`, wantErr: true},
+		{name: "unsupported type", src: 42, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Metadata
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// metadataColumnPrefix names the generated column of a promoted metadata key.
+const metadataColumnPrefix = "meta_"
+
+// metadataIndexLength is how much of a promoted value is indexed. Longer
+// values cannot be matched exactly.
+const metadataIndexLength = 255
+
+// metadataKeyPattern keeps promoted keys usable in column and index names
+// within the identifier limits of both databases.
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,40}$`)
+
+// ValidMetadataIndexKey reports whether key can be promoted to a column.
+func ValidMetadataIndexKey(key string) bool {
+	return metadataKeyPattern.MatchString(key)
+}
+
+func metadataColumn(key string) string {
+	return metadataColumnPrefix + key
+}
+
+// IndexMetadataKeys adds a generated column holding the value of each
+// metadata key, and an index on it, to the events table and the first shards
+// shard tables, skipping tables that have the column already. Keys must pass
+// ValidMetadataIndexKey.
+func IndexMetadataKeys(ctx context.Context, db *sqlx.DB, keys []string, shards int) error {
+	tables := []string{eventsTable}
+	for i := 0; shards > 1 && i < shards; i++ {
+		tables = append(tables, shardTable(i))
+	}
+
+	d := dialectFor(db.DriverName())
+	for _, key := range keys {
+		if !ValidMetadataIndexKey(key) {
+			return fmt.Errorf("metadata key %q cannot be indexed", key)
+		}
+
+		for _, table := range tables {
+			var exists bool
+			if err := db.GetContext(ctx, &exists, db.Rebind(d.columnExists()), table, metadataColumn(key)); err != nil {
+				return fmt.Errorf("look up column %s of %s: %w", metadataColumn(key), table, err)
+			}
+			if exists {
+				continue
+			}
+
+			for _, statement := range d.addMetadataColumn(table, key) {
+				if _, err := db.ExecContext(ctx, statement); err != nil {
+					return fmt.Errorf("index metadata key %s on %s: %w", key, table, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// metadataString renders a metadata value the way the generated columns hold
+// it, for the in-memory repository to match on.
+func metadataString(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		s = v.String()
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return "", false
+	}
+
+	if len(s) > metadataIndexLength {
+		s = s[:metadataIndexLength]
+	}
+	return s, true
+}
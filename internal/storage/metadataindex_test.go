@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIndexMetadataKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		shards   int
+		existing map[string]bool
+		want     []string
+		wantErr  string
+	}{
+		{name: "one key", keys: []string{"customer_id"}, want: []string{"events.meta_customer_id"}},
+		{
+			name:   "sharded",
+			keys:   []string{"customer_id"},
+			shards: 2,
+			want:   []string{"events.meta_customer_id", "events_0.meta_customer_id", "events_1.meta_customer_id"},
+		},
+		{
+			name:     "column exists",
+			keys:     []string{"customer_id", "plan"},
+			existing: map[string]bool{"events.meta_customer_id": true},
+			want:     []string{"events.meta_plan"},
+		},
+		{name: "invalid key", keys: []string{"customer-id"}, wantErr: `metadata key "customer-id" cannot be indexed`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			fake.query = func(_ string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				column := fmt.Sprint(args[0].Value, ".", args[1].Value)
+				return []string{"exists"}, [][]driver.Value{{tt.existing[column]}}, nil
+			}
+
+			err := IndexMetadataKeys(context.Background(), db, tt.keys, tt.shards)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("IndexMetadataKeys error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IndexMetadataKeys: %v", err)
+			}
+
+			var added []string
+			for _, exec := range fake.executed() {
+				table, rest, _ := strings.Cut(strings.TrimPrefix(exec.query, "ALTER TABLE "), " ADD COLUMN ")
+				column, _, _ := strings.Cut(rest, " ")
+				added = append(added, table+"."+column)
+			}
+			if fmt.Sprint(added) != fmt.Sprint(tt.want) {
+				t.Errorf("added columns %v, want %v", added, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindEventsByMetadata(t *testing.T) {
+	db, fake := newFakeDB(t, DriverMySQL)
+	var query string
+	var args []driver.NamedValue
+	fake.query = func(q string, a []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		query, args = q, a
+		return nil, nil, nil
+	}
+	repo := NewEventRepository(db, RepositoryConfig{})
+
+	filter := EventFilter{Metadata: map[string]string{"plan": "pro", "customer_id": "123"}}
+	if _, err := repo.FindEvents(context.Background(), filter); err != nil {
+		t.Fatalf("FindEvents: %v", err)
+	}
+	if !strings.Contains(query, "WHERE meta_customer_id = ? AND meta_plan = ?") {
+		t.Errorf("query %s does not filter on the generated columns", query)
+	}
+	if len(args) < 2 || args[0].Value != "123" || args[1].Value != "pro" {
+		t.Errorf("args = %v, want 123 and pro first", args)
+	}
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
+// EventFilter narrows down event queries. Zero values mean "no constraint".
+type EventFilter struct {
+	Type   EventType
+	Source Source
+	UserID string
+	From   time.Time
+	To     time.Time
+	// Before excludes events at or after it, unlike To.
+	Before time.Time
+	// Metadata matches metadata values by key. Only keys indexed with
+	// IndexMetadataKeys can be filtered on.
+	Metadata map[string]string
+	// TenantID restricts the events to those of one tenant. Unlike the other
+	// fields it is not chosen by clients but set from the request's tenant.
+	TenantID string
+	Limit    int
+	Offset   int
+}
+
+// LogValue logs the fields of the filter that are set.
+func (f EventFilter) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{"type", string(f.Type)},
+		{"source", string(f.Source)},
+		{"user_id", f.UserID},
+		{"tenant_id", f.TenantID},
+	} {
+		if field.value != "" {
+			attrs = append(attrs, slog.String(field.key, field.value))
+		}
+	}
+	for _, field := range []struct {
+		key   string
+		value time.Time
+	}{
+		{"from", f.From},
+		{"to", f.To},
+		{"before", f.Before},
+	} {
+		if !field.value.IsZero() {
+			attrs = append(attrs, slog.Time(field.key, field.value))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(f.Metadata)) {
+		attrs = append(attrs, slog.String("meta."+key, f.Metadata[key]))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// IsZero reports whether the filter matches every event, or every event of
+// its tenant, whatever its Limit and Offset.
+func (f EventFilter) IsZero() bool {
+	return f.Type == "" && f.Source == "" && f.UserID == "" &&
+		f.From.IsZero() && f.To.IsZero() && f.Before.IsZero() && len(f.Metadata) == 0
+}
+
+// GroupBy names the column counts can be grouped by.
+type GroupBy string
+
+const (
+	GroupByType   GroupBy = "type"
+	GroupBySource GroupBy = "source"
+)
+
+// GroupCount is the number of events sharing one value of the grouped column.
+type GroupCount struct {
+	Group string `db:"group_key" json:"group"`
+	Count int64  `db:"event_count" json:"count"`
+}
+
+// Interval is the width of a time series bucket.
+type Interval string
+
+const (
+	IntervalMinute Interval = "minute"
+	IntervalHour   Interval = "hour"
+	IntervalDay    Interval = "day"
+)
+
+// Duration returns the bucket width, or 0 for an unknown interval.
+func (i Interval) Duration() time.Duration {
+	switch i {
+	case IntervalMinute:
+		return time.Minute
+	case IntervalHour:
+		return time.Hour
+	case IntervalDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// TimeBucket counts the events whose timestamp falls in [Start, Start+interval).
+// Group is only set when the series is grouped.
+type TimeBucket struct {
+	Start time.Time `db:"bucket_start" json:"start"`
+	Group string    `db:"group_key" json:"group,omitempty"`
+	Count int64     `db:"event_count" json:"count"`
+}
+
+// selectEventColumns aliases the flat columns onto the nested Data struct so
+// sqlx can scan rows straight into ProcessedEvent.
+func (r *eventRepository) selectEventColumns() string {
+	return "id, type, source, timestamp, user_id, " +
+		"action AS " + r.dialect.quote("data.action") +
+		", value AS " + r.dialect.quote("data.value") +
+		", value_int AS " + r.dialect.quote("data.value_int") +
+		", metadata AS " + r.dialect.quote("data.metadata") +
+		", schema_version, tenant_id"
+}
+
+// FindEventByID returns ErrEventNotFound when no event has the given id.
+func (r *eventRepository) FindEventByID(ctx context.Context, id string) (*ProcessedEvent, error) {
+	var event ProcessedEvent
+	err := r.get(ctx, &event, "SELECT "+r.selectEventColumns()+" FROM "+r.table+" WHERE id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (r *eventRepository) FindEvents(ctx context.Context, filter EventFilter) ([]ProcessedEvent, error) {
+	where, args := buildWhereClause(filter)
+	query := "SELECT " + r.selectEventColumns() + " FROM " + r.table + where + " ORDER BY timestamp DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	events := []ProcessedEvent{}
+	if err := r.selectAll(ctx, &events, query, args...); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ExportEvents calls fn for every event matching filter, oldest first,
+// reading rows through a cursor so the result set is never held in memory.
+// Limit and Offset are ignored. An error from fn stops the export and is
+// returned as is. The statement timeout does not apply since the cursor stays
+// open for as long as the export takes.
+func (r *eventRepository) ExportEvents(ctx context.Context, filter EventFilter, fn func(ProcessedEvent) error) error {
+	where, args := buildWhereClause(filter)
+	query := "SELECT " + r.selectEventColumns() + " FROM " + r.table + where + " ORDER BY timestamp, id"
+
+	rows, err := r.db.QueryxContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event ProcessedEvent
+		if err := rows.StructScan(&event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *eventRepository) CountEvents(ctx context.Context, filter EventFilter) (int64, error) {
+	where, args := buildWhereClause(filter)
+
+	var count int64
+	if err := r.get(ctx, &count, "SELECT COUNT(*) FROM "+r.table+where, args...); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountEventsByGroup counts the events matching filter per value of groupBy,
+// largest groups first.
+func (r *eventRepository) CountEventsByGroup(ctx context.Context, filter EventFilter, groupBy GroupBy) ([]GroupCount, error) {
+	if groupBy != GroupByType && groupBy != GroupBySource {
+		return nil, fmt.Errorf("cannot group by %q", groupBy)
+	}
+
+	where, args := buildWhereClause(filter)
+	column := string(groupBy)
+	query := "SELECT " + column + " AS group_key, COUNT(*) AS event_count FROM " + r.table + where +
+		" GROUP BY " + column + " ORDER BY event_count DESC, group_key"
+
+	counts := []GroupCount{}
+	if err := r.selectAll(ctx, &counts, query, args...); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// CountEventsByInterval counts the events matching filter per UTC time bucket,
+// oldest first. Buckets without events are left out. groupBy may be empty to
+// count all events of a bucket together.
+func (r *eventRepository) CountEventsByInterval(ctx context.Context, filter EventFilter, interval Interval, groupBy GroupBy) ([]TimeBucket, error) {
+	if interval.Duration() == 0 {
+		return nil, fmt.Errorf("unknown interval %q", interval)
+	}
+	if groupBy != "" && groupBy != GroupByType && groupBy != GroupBySource {
+		return nil, fmt.Errorf("cannot group by %q", groupBy)
+	}
+
+	bucket := r.dialect.truncateTime("timestamp", interval)
+	columns, groupColumns := bucket+" AS bucket_start", bucket
+	if groupBy != "" {
+		columns += ", " + string(groupBy) + " AS group_key"
+		groupColumns += ", " + string(groupBy)
+	}
+
+	where, args := buildWhereClause(filter)
+	query := "SELECT " + columns + ", COUNT(*) AS event_count FROM " + r.table + where +
+		" GROUP BY " + groupColumns + " ORDER BY bucket_start"
+	if groupBy != "" {
+		query += ", group_key"
+	}
+
+	buckets := []TimeBucket{}
+	if err := r.selectAll(ctx, &buckets, query, args...); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// get scans the single row of query into dest within the statement timeout.
+func (r *eventRepository) get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.timeout.run(ctx, OperationSelect, func(ctx context.Context) error {
+		return r.db.GetContext(ctx, dest, r.db.Rebind(query), args...)
+	})
+}
+
+// selectAll scans every row of query into dest within the statement timeout.
+func (r *eventRepository) selectAll(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.timeout.run(ctx, OperationSelect, func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, dest, r.db.Rebind(query), args...)
+	})
+}
+
+// buildWhereClause turns the filter into a WHERE clause shared by every
+// filtered query, ignoring Limit and Offset.
+func buildWhereClause(filter EventFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	if filter.TenantID != "" {
+		conditions = append(conditions, "tenant_id = ?")
+		args = append(args, filter.TenantID)
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, filter.To)
+	}
+
+	if !filter.Before.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, filter.Before)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(filter.Metadata)) {
+		conditions = append(conditions, metadataColumn(key)+" = ?")
+		args = append(args, filter.Metadata[key])
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
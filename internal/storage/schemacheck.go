@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// columnType is a row of the dialect's columnTypes query.
+type columnType struct {
+	Name string `db:"name"`
+	Type string `db:"type"`
+}
+
+// CheckEventsSchema compares the columns of the events table, and of the
+// first shards shard tables, with the ones the repository reads and writes,
+// so a database that missed a migration fails at startup instead of on the
+// first insert. The returned error lists every mismatch found. Extra columns,
+// such as promoted metadata keys, are allowed.
+func CheckEventsSchema(ctx context.Context, db *sqlx.DB, shards int) error {
+	tables := []string{eventsTable}
+	for i := 0; shards > 1 && i < shards; i++ {
+		tables = append(tables, shardTable(i))
+	}
+
+	d := dialectFor(db.DriverName())
+	var mismatches []string
+	for _, table := range tables {
+		var columns []columnType
+		if err := db.SelectContext(ctx, &columns, db.Rebind(d.columnTypes()), table); err != nil {
+			return fmt.Errorf("look up columns of %s: %w", table, err)
+		}
+		if len(columns) == 0 {
+			mismatches = append(mismatches, "table "+table+" does not exist")
+			continue
+		}
+
+		actual := make(map[string]string, len(columns))
+		for _, column := range columns {
+			actual[strings.ToLower(column.Name)] = strings.ToLower(column.Type)
+		}
+		for _, column := range eventColumns {
+			want := d.eventColumnType(column)
+			got, ok := actual[column]
+			switch {
+			case !ok:
+				mismatches = append(mismatches, fmt.Sprintf("%s is missing column %s", table, column))
+			case got != want:
+				mismatches = append(mismatches, fmt.Sprintf("%s.%s is %s, want %s", table, column, got, want))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		slices.Sort(mismatches)
+		return fmt.Errorf("events schema does not match, are migrations applied? %s", strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"maps"
+	"testing"
+)
+
+func TestCheckEventsSchema(t *testing.T) {
+	// without returns the columns of types without column.
+	without := func(types map[string]string, column string) map[string]string {
+		columns := maps.Clone(types)
+		delete(columns, column)
+		return columns
+	}
+	// with returns the columns of types with column set to typ.
+	with := func(types map[string]string, column, typ string) map[string]string {
+		columns := maps.Clone(types)
+		columns[column] = typ
+		return columns
+	}
+
+	tests := []struct {
+		name       string
+		driverName string
+		shards     int
+		tables     map[string]map[string]string
+		wantErr    string
+	}{
+		{
+			name:       "mysql",
+			driverName: DriverMySQL,
+			tables:     map[string]map[string]string{"events": mysqlEventColumnTypes},
+		},
+		{
+			name:       "postgres",
+			driverName: DriverPostgres,
+			tables:     map[string]map[string]string{"events": postgresEventColumnTypes},
+		},
+		{
+			name:       "promoted metadata column",
+			driverName: DriverMySQL,
+			tables:     map[string]map[string]string{"events": with(mysqlEventColumnTypes, "meta_plan", "varchar")},
+		},
+		{
+			name:       "missing column",
+			driverName: DriverMySQL,
+			tables:     map[string]map[string]string{"events": without(mysqlEventColumnTypes, "metadata")},
+			wantErr:    "events schema does not match, are migrations applied? events is missing column metadata",
+		},
+		{
+			name:       "wrong type",
+			driverName: DriverPostgres,
+			tables:     map[string]map[string]string{"events": with(postgresEventColumnTypes, "metadata", "json")},
+			wantErr:    "events schema does not match, are migrations applied? events.metadata is json, want jsonb",
+		},
+		{
+			name:       "missing table",
+			driverName: DriverMySQL,
+			wantErr:    "events schema does not match, are migrations applied? table events does not exist",
+		},
+		{
+			name:       "every mismatch of the shards",
+			driverName: DriverMySQL,
+			shards:     2,
+			tables: map[string]map[string]string{
+				"events":   mysqlEventColumnTypes,
+				"events_0": without(mysqlEventColumnTypes, "value_int"),
+			},
+			wantErr: "events schema does not match, are migrations applied? events_0 is missing column value_int; table events_1 does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, tt.driverName)
+			fake.query = func(_ string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				var rows [][]driver.Value
+				for name, typ := range tt.tables[args[0].Value.(string)] {
+					rows = append(rows, []driver.Value{name, typ})
+				}
+				return []string{"name", "type"}, rows, nil
+			}
+
+			err := CheckEventsSchema(context.Background(), db, tt.shards)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckEventsSchema: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("CheckEventsSchema error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// shardedEventRepository spreads events over several tables of one database,
+// picking the table from a hash of the event source. Writes only touch the
+// shards their events belong to, queries filtered by source read a single
+// shard and every other query reads all of them and merges the results.
+//
+// All shards share the database handle, so a transaction begun through any of
+// them covers writes to every shard.
+type shardedEventRepository struct {
+	shards []*eventRepository
+}
+
+// NewShardedEventRepository returns a repository storing events in the tables
+// events_0 to events_<shards-1>, creating the missing ones with the columns
+// and indexes of events and adding to existing ones the columns migrations
+// added to events since. The events table itself is left untouched, so events
+// stored before sharding was enabled are no longer visible.
+func NewShardedEventRepository(ctx context.Context, db *sqlx.DB, cfg RepositoryConfig, shards int) (EventRepository, error) {
+	if shards < 2 {
+		return nil, fmt.Errorf("sharding needs at least 2 shards, got %d", shards)
+	}
+
+	d := dialectFor(db.DriverName())
+	r := &shardedEventRepository{shards: make([]*eventRepository, shards)}
+	for i := range r.shards {
+		table := shardTable(i)
+		if _, err := db.ExecContext(ctx, d.createTableLike(table, eventsTable)); err != nil {
+			return nil, errors.Join(fmt.Errorf("create shard table %s: %w", table, err), r.Close())
+		}
+		if err := addMigratedColumns(ctx, db, d, table); err != nil {
+			return nil, errors.Join(fmt.Errorf("upgrade shard table %s: %w", table, err), r.Close())
+		}
+		r.shards[i] = newEventRepository(db, cfg, table, newStmtCache(db, cfg.PreparedInserts))
+	}
+
+	return r, nil
+}
+
+// migratedColumn is a column a migration added to events after shard tables
+// may have been created from it, with the statements adding it to a table.
+type migratedColumn struct {
+	name       string
+	statements func(table string) []string
+}
+
+// migratedColumns must follow every migration adding a column to events,
+// since existing shard tables do not get it from the migration.
+var migratedColumns = []migratedColumn{
+	{"schema_version", func(table string) []string {
+		return []string{"ALTER TABLE " + table + " ADD COLUMN schema_version INT NOT NULL DEFAULT 1"}
+	}},
+	{"value_int", func(table string) []string {
+		return []string{"ALTER TABLE " + table + " ADD COLUMN value_int BIGINT NULL"}
+	}},
+	{"tenant_id", func(table string) []string {
+		return []string{
+			"ALTER TABLE " + table + " ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT ''",
+			"CREATE INDEX idx_" + table + "_tenant_timestamp ON " + table + " (tenant_id, timestamp)",
+		}
+	}},
+}
+
+// addMigratedColumns adds the migrated columns table is missing.
+func addMigratedColumns(ctx context.Context, db *sqlx.DB, d dialect, table string) error {
+	var columns []columnType
+	if err := db.SelectContext(ctx, &columns, db.Rebind(d.columnTypes()), table); err != nil {
+		return fmt.Errorf("look up columns: %w", err)
+	}
+
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[strings.ToLower(column.Name)] = true
+	}
+
+	for _, column := range migratedColumns {
+		if existing[column.name] {
+			continue
+		}
+		for _, statement := range column.statements(table) {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("add column %s: %w", column.name, err)
+			}
+		}
+		slog.Info("Added migrated column to shard table", "table", table, "column", column.name)
+	}
+
+	return nil
+}
+
+// shardTable names the table of the i-th shard.
+func shardTable(i int) string {
+	return eventsTable + "_" + strconv.Itoa(i)
+}
+
+// shardFor returns the shard events from source are stored in.
+func (r *shardedEventRepository) shardFor(source Source) *eventRepository {
+	return r.shards[r.shardIndex(source)]
+}
+
+func (r *shardedEventRepository) shardIndex(source Source) int {
+	h := fnv.New32a()
+	h.Write([]byte(source))
+	return int(h.Sum32() % uint32(len(r.shards)))
+}
+
+// shardsFor returns the shards holding the events matching filter.
+func (r *shardedEventRepository) shardsFor(filter EventFilter) []*eventRepository {
+	if filter.Source != "" {
+		return []*eventRepository{r.shardFor(filter.Source)}
+	}
+	return r.shards
+}
+
+// groupByShard splits events by shard index, keeping their order within a
+// shard. Writing the groups in shard order keeps concurrent transactions
+// from locking shards in opposite orders.
+func (r *shardedEventRepository) groupByShard(events []ProcessedEvent) [][]ProcessedEvent {
+	groups := make([][]ProcessedEvent, len(r.shards))
+	for _, event := range events {
+		i := r.shardIndex(event.Source)
+		groups[i] = append(groups[i], event)
+	}
+	return groups
+}
+
+func (r *shardedEventRepository) Close() error {
+	var errs []error
+	for _, shard := range r.shards {
+		if shard != nil {
+			errs = append(errs, shard.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *shardedEventRepository) InsertEvent(ctx context.Context, id string, eventType EventType, source Source, timestamp time.Time, userId *string, data Data) (*ProcessedEvent, error) {
+	return r.shardFor(source).InsertEvent(ctx, id, eventType, source, timestamp, userId, data)
+}
+
+func (r *shardedEventRepository) InsertEvents(ctx context.Context, events []ProcessedEvent) (InsertResult, error) {
+	var result InsertResult
+	err := r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = r.InsertEventsTx(ctx, tx, events)
+		return err
+	})
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	return result, nil
+}
+
+func (r *shardedEventRepository) InsertEventsTx(ctx context.Context, tx *sqlx.Tx, events []ProcessedEvent) (InsertResult, error) {
+	var result InsertResult
+	for i, group := range r.groupByShard(events) {
+		if len(group) == 0 {
+			continue
+		}
+		inserted, err := r.shards[i].InsertEventsTx(ctx, tx, group)
+		if err != nil {
+			return InsertResult{}, err
+		}
+		result = result.Add(inserted)
+	}
+
+	return result, nil
+}
+
+func (r *shardedEventRepository) WithTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return r.shards[0].WithTransaction(ctx, fn)
+}
+
+func (r *shardedEventRepository) UpsertEvents(ctx context.Context, events []ProcessedEvent) (inserted, updated int, err error) {
+	var result InsertResult
+	err = r.WithTransaction(ctx, func(tx *sqlx.Tx) error {
+		for i, group := range r.groupByShard(events) {
+			if len(group) == 0 {
+				continue
+			}
+			upserted, err := r.shards[i].insertEventsTx(ctx, tx, group, DedupUpdate)
+			if err != nil {
+				return err
+			}
+			result = result.Add(upserted)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return result.Inserted, result.Duplicates, nil
+}
+
+// DeleteEvents deletes from one shard after the other, so the events deleted
+// are the oldest of each shard rather than the oldest overall.
+func (r *shardedEventRepository) DeleteEvents(ctx context.Context, filter EventFilter, limit int) (int64, error) {
+	var deleted int64
+	for _, shard := range r.shardsFor(filter) {
+		if deleted >= int64(limit) {
+			break
+		}
+		n, err := shard.DeleteEvents(ctx, filter, limit-int(deleted))
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// FindEventByID looks the id up in every shard since it says nothing about
+// the source.
+func (r *shardedEventRepository) FindEventByID(ctx context.Context, id string) (*ProcessedEvent, error) {
+	for _, shard := range r.shards {
+		event, err := shard.FindEventByID(ctx, id)
+		if !errors.Is(err, ErrEventNotFound) {
+			return event, err
+		}
+	}
+
+	return nil, ErrEventNotFound
+}
+
+// FindEvents reads the first Offset+Limit events of every shard and pages
+// through their merge, so deep pages cost more than with a single table.
+func (r *shardedEventRepository) FindEvents(ctx context.Context, filter EventFilter) ([]ProcessedEvent, error) {
+	shards := r.shardsFor(filter)
+	if len(shards) == 1 {
+		return shards[0].FindEvents(ctx, filter)
+	}
+
+	shardFilter := filter
+	if filter.Limit > 0 {
+		shardFilter.Limit, shardFilter.Offset = filter.Offset+filter.Limit, 0
+	}
+
+	events := []ProcessedEvent{}
+	for _, shard := range shards {
+		found, err := shard.FindEvents(ctx, shardFilter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+
+	slices.SortStableFunc(events, func(a, b ProcessedEvent) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+
+	if filter.Limit > 0 {
+		start := min(filter.Offset, len(events))
+		events = events[start:min(start+filter.Limit, len(events))]
+	}
+
+	return events, nil
+}
+
+func (r *shardedEventRepository) CountEvents(ctx context.Context, filter EventFilter) (int64, error) {
+	var count int64
+	for _, shard := range r.shardsFor(filter) {
+		n, err := shard.CountEvents(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// ExportEvents streams every shard at once and merges the streams by
+// timestamp and id, the order each shard exports in.
+func (r *shardedEventRepository) ExportEvents(ctx context.Context, filter EventFilter, fn func(ProcessedEvent) error) error {
+	shards := r.shardsFor(filter)
+	if len(shards) == 1 {
+		return shards[0].ExportEvents(ctx, filter, fn)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	streams := make([]chan ProcessedEvent, len(shards))
+	errs := make(chan error, len(shards))
+	for i, shard := range shards {
+		stream := make(chan ProcessedEvent)
+		streams[i] = stream
+		go func() {
+			defer close(stream)
+			errs <- shard.ExportEvents(ctx, filter, func(event ProcessedEvent) error {
+				select {
+				case stream <- event:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+	}
+
+	// heads holds the next event of each stream, nil once it is drained.
+	heads := make([]*ProcessedEvent, len(streams))
+	next := func(i int) {
+		heads[i] = nil
+		if event, ok := <-streams[i]; ok {
+			heads[i] = &event
+		}
+	}
+	for i := range streams {
+		next(i)
+	}
+
+	for {
+		oldest := -1
+		for i, head := range heads {
+			if head != nil && (oldest < 0 || exportsBefore(*head, *heads[oldest])) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			break
+		}
+
+		if err := fn(*heads[oldest]); err != nil {
+			cancel()
+			drain(streams)
+			return err
+		}
+		next(oldest)
+	}
+
+	for range shards {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportsBefore orders events by timestamp, then id, like ExportEvents.
+func exportsBefore(a, b ProcessedEvent) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+// drain empties the streams until their producers give up and close them.
+func drain(streams []chan ProcessedEvent) {
+	for _, stream := range streams {
+		for range stream {
+		}
+	}
+}
+
+// CountEventsByGroup adds up the groups of every shard. Sharding by source
+// keeps each source in one shard, but types span several.
+func (r *shardedEventRepository) CountEventsByGroup(ctx context.Context, filter EventFilter, groupBy GroupBy) ([]GroupCount, error) {
+	totals := make(map[string]int64)
+	for _, shard := range r.shardsFor(filter) {
+		counts, err := shard.CountEventsByGroup(ctx, filter, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			totals[count.Group] += count.Count
+		}
+	}
+
+	counts := make([]GroupCount, 0, len(totals))
+	for group, count := range totals {
+		counts = append(counts, GroupCount{Group: group, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b GroupCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Group, b.Group)
+	})
+
+	return counts, nil
+}
+
+func (r *shardedEventRepository) CountEventsByInterval(ctx context.Context, filter EventFilter, interval Interval, groupBy GroupBy) ([]TimeBucket, error) {
+	type bucketKey struct {
+		start int64
+		group string
+	}
+
+	totals := make(map[bucketKey]TimeBucket)
+	for _, shard := range r.shardsFor(filter) {
+		buckets, err := shard.CountEventsByInterval(ctx, filter, interval, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			key := bucketKey{start: bucket.Start.UnixNano(), group: bucket.Group}
+			total, ok := totals[key]
+			if !ok {
+				total = TimeBucket{Start: bucket.Start, Group: bucket.Group}
+			}
+			total.Count += bucket.Count
+			totals[key] = total
+		}
+	}
+
+	buckets := make([]TimeBucket, 0, len(totals))
+	for _, bucket := range totals {
+		buckets = append(buckets, bucket)
+	}
+	slices.SortFunc(buckets, func(a, b TimeBucket) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Group, b.Group)
+	})
+
+	return buckets, nil
+}
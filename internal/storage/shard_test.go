@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var shardTablePattern = regexp.MustCompile(`\bevents_\d+\b`)
+
+// newTestShards returns a sharded repository over a fakeDB whose shard tables
+// already have every column. query answers the other SELECTs.
+func newTestShards(t *testing.T, shards int, query func(table, query string) ([]string, [][]driver.Value, error)) (*shardedEventRepository, *fakeDB) {
+	t.Helper()
+
+	db, fake := newFakeDB(t, DriverMySQL)
+	fake.query = func(q string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.Contains(q, "information_schema") {
+			var rows [][]driver.Value
+			for _, column := range migratedColumns {
+				rows = append(rows, []driver.Value{column.name, ""})
+			}
+			return []string{"name", "type"}, rows, nil
+		}
+		if query == nil {
+			return nil, nil, nil
+		}
+		return query(shardTablePattern.FindString(q), q)
+	}
+
+	repo, err := NewShardedEventRepository(context.Background(), db, RepositoryConfig{}, shards)
+	if err != nil {
+		t.Fatalf("NewShardedEventRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo.(*shardedEventRepository), fake
+}
+
+func TestShardedInsertRoutesBySource(t *testing.T) {
+	repo, fake := newTestShards(t, 4, nil)
+
+	sources := []Source{"web", "mobile", "api", "billing", "web", "iot", "mobile"}
+	events := make([]ProcessedEvent, len(sources))
+	for i, source := range sources {
+		events[i] = testEvents(1)[0]
+		events[i].ID, events[i].Source = fmt.Sprint("evt-", i), source
+	}
+	if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	tables := make(map[Source]string)
+	written := 0
+	for _, exec := range fake.executed() {
+		if !strings.HasPrefix(exec.query, "INSERT") {
+			continue
+		}
+		table := shardTablePattern.FindString(exec.query)
+		if table == "" {
+			t.Fatalf("insert outside the shard tables: %s", exec.query)
+		}
+		for i := 2; i < len(exec.args); i += eventColumnCount {
+			source := Source(exec.args[i].Value.(string))
+			if previous, ok := tables[source]; ok && previous != table {
+				t.Errorf("source %s written to %s and %s", source, previous, table)
+			}
+			tables[source] = table
+			written++
+		}
+	}
+
+	if written != len(events) {
+		t.Errorf("wrote %d events, want %d", written, len(events))
+	}
+	for source, table := range tables {
+		if want := shardTable(repo.shardIndex(source)); table != want {
+			t.Errorf("source %s written to %s, want %s", source, table, want)
+		}
+	}
+	if used := slices.Compact(slices.Sorted(maps.Values(tables))); len(used) < 2 {
+		t.Errorf("every source written to %v", used)
+	}
+}
+
+func TestShardedReadsMerge(t *testing.T) {
+	columns := []string{"id", "type", "source", "timestamp", "user_id", "data.action", "data.value", "data.value_int", "data.metadata", "schema_version", "tenant_id"}
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	row := func(id string, second int) []driver.Value {
+		return []driver.Value{id, "user_action", "web", start.Add(time.Duration(second) * time.Second), nil, "click", 1.0, nil, nil, int64(1), ""}
+	}
+	// Each shard returns its events newest first, like the database.
+	stored := map[string][][]driver.Value{
+		"events_0": {row("evt-5", 5), row("evt-2", 2)},
+		"events_1": {row("evt-4", 4), row("evt-3", 3), row("evt-0", 0)},
+		"events_2": {row("evt-1", 1)},
+	}
+
+	repo, _ := newTestShards(t, 3, func(table, query string) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "COUNT(") {
+			return []string{"count"}, [][]driver.Value{{int64(len(stored[table]))}}, nil
+		}
+		return columns, stored[table], nil
+	})
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   string
+	}{
+		{name: "all", want: "[evt-5 evt-4 evt-3 evt-2 evt-1 evt-0]"},
+		{name: "first page", filter: EventFilter{Limit: 2}, want: "[evt-5 evt-4]"},
+		{name: "second page", filter: EventFilter{Limit: 2, Offset: 2}, want: "[evt-3 evt-2]"},
+		{name: "past the end", filter: EventFilter{Limit: 2, Offset: 10}, want: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.FindEvents(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("FindEvents: %v", err)
+			}
+			ids := make([]string, len(events))
+			for i, event := range events {
+				ids[i] = event.ID
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("FindEvents = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if count, err := repo.CountEvents(context.Background(), EventFilter{}); err != nil || count != 6 {
+		t.Errorf("CountEvents = %d, %v; want 6", count, err)
+	}
+}
+
+func TestShardTablesGetMigratedColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		missing []string
+		want    []string
+	}{
+		{name: "up to date"},
+		{
+			name:    "before multi-tenancy",
+			missing: []string{"tenant_id"},
+			want: []string{
+				"ALTER TABLE events_0 ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT ''",
+				"CREATE INDEX idx_events_0_tenant_timestamp ON events_0 (tenant_id, timestamp)",
+				"ALTER TABLE events_1 ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT ''",
+				"CREATE INDEX idx_events_1_tenant_timestamp ON events_1 (tenant_id, timestamp)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			fake.query = func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				var rows [][]driver.Value
+				for _, column := range migratedColumns {
+					if !slices.Contains(tt.missing, column.name) {
+						rows = append(rows, []driver.Value{column.name, ""})
+					}
+				}
+				return []string{"name", "type"}, rows, nil
+			}
+
+			repo, err := NewShardedEventRepository(context.Background(), db, RepositoryConfig{}, 2)
+			if err != nil {
+				t.Fatalf("NewShardedEventRepository: %v", err)
+			}
+			defer repo.Close()
+
+			var added []string
+			for _, exec := range fake.executed() {
+				if !strings.HasPrefix(exec.query, "CREATE TABLE") {
+					added = append(added, exec.query)
+				}
+			}
+			if fmt.Sprint(added) != fmt.Sprint(tt.want) {
+				t.Errorf("ran %q, want %q", added, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtCache keeps INSERT statements prepared for reuse, sparing the database
+// from parsing them again on every write. A batch needs one statement per
+// distinct row count and dedup mode, so callers only cache the canonical
+// sizes, single events and full chunks, and the cache is bounded on top of
+// that. It is safe for concurrent use.
+//
+// database/sql prepares a statement again on each connection it runs on, so a
+// statement survives its connection being lost. A nil *stmtCache caches
+// nothing.
+type stmtCache struct {
+	db   *sqlx.DB
+	size int
+
+	mu     sync.Mutex
+	stmts  map[string]*sqlx.Stmt
+	closed bool
+}
+
+// newStmtCache returns nil when size is not positive.
+func newStmtCache(db *sqlx.DB, size int) *stmtCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &stmtCache{
+		db:    db,
+		size:  size,
+		stmts: make(map[string]*sqlx.Stmt),
+	}
+}
+
+// get returns the prepared statement for query, preparing it on first use.
+// It returns nil when the cache is full or closed or preparing fails, for the
+// caller to run the query ad hoc.
+//
+// The statement is prepared without holding the lock, so a round trip to the
+// database does not hold up writers using other statements. Writers racing
+// to prepare the same query each prepare it once; the first to finish is
+// cached and the others close theirs.
+func (c *stmtCache) get(ctx context.Context, query string) *sqlx.Stmt {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	full := c.closed || len(c.stmts) >= c.size
+	c.mu.Unlock()
+	if ok {
+		return stmt
+	}
+	if full {
+		return nil
+	}
+
+	stmt, err := c.db.PreparexContext(ctx, query)
+	if err != nil {
+		slog.Warn("Failed to prepare insert, running it ad hoc", "error", err)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return cached
+	}
+	if c.closed || len(c.stmts) >= c.size {
+		stmt.Close()
+		return nil
+	}
+
+	c.stmts[query] = stmt
+	return stmt
+}
+
+// close closes every cached statement. Later calls to get return nil.
+func (c *stmtCache) close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	c.closed = true
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func testEvents(n int) []ProcessedEvent {
+	events := make([]ProcessedEvent, n)
+	for i := range events {
+		events[i] = ProcessedEvent{
+			ID:            "evt-" + strconv.Itoa(i),
+			Type:          "user_action",
+			Source:        "web",
+			Timestamp:     time.Date(2024, 5, 1, 9, 30, i, 0, time.UTC),
+			Data:          Data{Action: "click", Value: float64(i)},
+			SchemaVersion: DefaultSchemaVersion,
+		}
+	}
+	return events
+}
+
+func TestExecPreparesCanonicalSizesOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   int
+		prepared []int
+		adHoc    []int
+	}{
+		{name: "single event", events: 1, prepared: []int{1}},
+		{name: "full chunk", events: 3, prepared: []int{3}},
+		{name: "full chunk and remainder", events: 5, prepared: []int{3}, adHoc: []int{2}},
+		{name: "remainder only", events: 2, adHoc: []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, DriverMySQL)
+			repo := NewEventRepository(db, RepositoryConfig{InsertBatchSize: 3, PreparedInserts: 8})
+			defer repo.Close()
+
+			if _, err := repo.InsertEvents(context.Background(), testEvents(tt.events)); err != nil {
+				t.Fatalf("InsertEvents: %v", err)
+			}
+
+			var prepared, adHoc []int
+			for _, exec := range fake.executed() {
+				rows := len(exec.args) / eventColumnCount
+				if exec.prepared {
+					prepared = append(prepared, rows)
+				} else {
+					adHoc = append(adHoc, rows)
+				}
+			}
+			if fmt.Sprint(prepared) != fmt.Sprint(tt.prepared) || fmt.Sprint(adHoc) != fmt.Sprint(tt.adHoc) {
+				t.Errorf("prepared rows %v, ad hoc rows %v; want %v and %v", prepared, adHoc, tt.prepared, tt.adHoc)
+			}
+		})
+	}
+}
+
+func TestStmtCacheBounded(t *testing.T) {
+	db, fake := newFakeDB(t, DriverMySQL)
+	cache := newStmtCache(db, 2)
+
+	for _, query := range []string{"q1", "q2", "q3", "q1"} {
+		stmt := cache.get(context.Background(), query)
+		if cached := query != "q3"; (stmt != nil) != cached {
+			t.Errorf("get(%s) cached = %t, want %t", query, stmt != nil, cached)
+		}
+	}
+	if got := fake.preparedQueries(); len(got) != 2 {
+		t.Errorf("prepared %v, want q1 and q2 only", got)
+	}
+
+	if err := cache.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if stmt := cache.get(context.Background(), "q1"); stmt != nil {
+		t.Error("get after close returned a statement")
+	}
+}
+
+func TestStmtCacheConcurrentPrepare(t *testing.T) {
+	db, fake := newFakeDB(t, DriverMySQL)
+	cache := newStmtCache(db, 4)
+	defer cache.close()
+
+	const writers = 16
+	stmts := make([]*sqlx.Stmt, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stmts[i] = cache.get(context.Background(), "q")
+		}()
+	}
+	wg.Wait()
+
+	for i, stmt := range stmts {
+		if stmt != stmts[0] {
+			t.Fatalf("writer %d got a different statement than writer 0", i)
+		}
+	}
+
+	fake.mu.Lock()
+	prepared, closed := len(fake.prepared), len(fake.closed)
+	fake.mu.Unlock()
+	if prepared-closed != 1 {
+		t.Errorf("prepared %d statements and closed %d, want all but the cached one closed", prepared, closed)
+	}
+}
+
+func TestStmtCacheNil(t *testing.T) {
+	db, _ := newFakeDB(t, DriverMySQL)
+	if cache := newStmtCache(db, 0); cache != nil {
+		t.Fatal("newStmtCache(0) != nil")
+	}
+
+	var cache *stmtCache
+	if stmt := cache.get(context.Background(), "q"); stmt != nil {
+		t.Error("nil cache returned a statement")
+	}
+	if err := cache.close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
+
+// benchDB opens the database named by BENCH_DB_DRIVER ("mysql" or
+// "postgres") and BENCH_DB_DSN, which must have the migrations applied, and
+// a scratch copy of the events table dropped after the benchmark.
+func benchDB(b *testing.B) (*sqlx.DB, string) {
+	driverName, dsn := os.Getenv("BENCH_DB_DRIVER"), os.Getenv("BENCH_DB_DSN")
+	if driverName == "" || dsn == "" {
+		b.Skip("BENCH_DB_DRIVER and BENCH_DB_DSN are not set")
+	}
+
+	db, err := sqlx.Connect(driverName, dsn)
+	if err != nil {
+		b.Fatalf("connect: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	const table = "events_bench"
+	d := dialectFor(driverName)
+	if _, err := db.Exec(d.createTableLike(table, eventsTable)); err != nil {
+		b.Fatalf("create %s: %v", table, err)
+	}
+	b.Cleanup(func() { db.Exec("DROP TABLE " + table) })
+
+	return db, table
+}
+
+// benchmarkInsert stores batches of 100 events, the way the flush buffer and
+// async batches write, and reports the events stored per second.
+func benchmarkInsert(b *testing.B, preparedInserts int) {
+	db, table := benchDB(b)
+	cfg := RepositoryConfig{InsertBatchSize: 100, PreparedInserts: preparedInserts}
+	repo := newEventRepository(db, cfg, table, newStmtCache(db, cfg.PreparedInserts))
+	defer repo.Close()
+
+	events := testEvents(100)
+	b.ResetTimer()
+	for i := range b.N {
+		for j := range events {
+			events[j].ID = fmt.Sprintf("bench-%d-%d-%d", preparedInserts, i, j)
+		}
+		if _, err := repo.InsertEvents(context.Background(), events); err != nil {
+			b.Fatalf("InsertEvents: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N*len(events))/b.Elapsed().Seconds(), "events/s")
+}
+
+func BenchmarkInsertPrepared(b *testing.B) { benchmarkInsert(b, 32) }
+
+func BenchmarkInsertAdHoc(b *testing.B) { benchmarkInsert(b, 0) }
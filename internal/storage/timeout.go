@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStatementTimeout fails a statement cancelled for running longer than the
+// statement timeout. The database may well succeed on a retry once whatever
+// held it up is gone.
+var ErrStatementTimeout = errors.New("statement timed out")
+
+// Operations reported to the statement timeout observer.
+const (
+	OperationInsert = "insert"
+	OperationDelete = "delete"
+	OperationSelect = "select"
+)
+
+// statementTimeout cancels statements through their context once they run
+// for longer than timeout. A zero timeout leaves statements unbounded.
+type statementTimeout struct {
+	timeout time.Duration
+	// observe, when set, is told the operation of every statement that
+	// timed out.
+	observe func(operation string)
+}
+
+// run calls fn with ctx bounded by the timeout. When the timeout cancels the
+// statement the error is wrapped in ErrStatementTimeout; cancellations of ctx
+// itself are returned as they are.
+func (t statementTimeout) run(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	if t.timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, t.timeout, ErrStatementTimeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err != nil && errors.Is(context.Cause(ctx), ErrStatementTimeout) {
+		if t.observe != nil {
+			t.observe(operation)
+		}
+		return fmt.Errorf("%w after %s: %w", ErrStatementTimeout, t.timeout, err)
+	}
+
+	return err
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatementTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		delay        time.Duration
+		cancel       bool
+		run          func(ctx context.Context, repo EventRepository) error
+		wantErr      error
+		wantObserved []string
+	}{
+		{
+			name:  "fast insert",
+			delay: time.Millisecond,
+			run:   insertOne,
+		},
+		{
+			name:         "slow insert",
+			delay:        time.Hour,
+			run:          insertOne,
+			wantErr:      ErrStatementTimeout,
+			wantObserved: []string{OperationInsert},
+		},
+		{
+			name:  "slow select",
+			delay: time.Hour,
+			run: func(ctx context.Context, repo EventRepository) error {
+				_, err := repo.CountEvents(ctx, EventFilter{})
+				return err
+			},
+			wantErr:      ErrStatementTimeout,
+			wantObserved: []string{OperationSelect},
+		},
+		{
+			name:    "cancelled by the caller",
+			delay:   time.Hour,
+			cancel:  true,
+			run:     insertOne,
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			db, fake := newFakeDB(t, DriverMySQL)
+			fake.wait = func(ctx context.Context, _ string) error {
+				if tt.cancel {
+					cancel()
+				}
+				select {
+				case <-time.After(tt.delay):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			var observed []string
+			repo := NewEventRepository(db, RepositoryConfig{
+				StatementTimeout:        timeout,
+				ObserveStatementTimeout: func(operation string) { observed = append(observed, operation) },
+			})
+
+			err := tt.run(ctx, repo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != ErrStatementTimeout && errors.Is(err, ErrStatementTimeout) {
+				t.Errorf("error = %v, reported as a statement timeout", err)
+			}
+			if fmt.Sprint(observed) != fmt.Sprint(tt.wantObserved) {
+				t.Errorf("observed timeouts %v, want %v", observed, tt.wantObserved)
+			}
+		})
+	}
+}
+
+func insertOne(ctx context.Context, repo EventRepository) error {
+	_, err := repo.InsertEvents(ctx, testEvents(1))
+	return err
+}
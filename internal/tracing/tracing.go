@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "event-processing-pipeline"
+
+// EventIDKey is the span attribute holding the event id.
+const EventIDKey = attribute.Key("event.id")
+
+type Config struct {
+	// Enabled is set when an OTLP endpoint is configured. Without it the
+	// global no-op provider stays in place and spans cost nothing.
+	Enabled     bool
+	ServiceName string
+}
+
+// Setup installs an OTLP/HTTP exporting tracer provider and the W3C trace
+// context propagator. The exporter reads its endpoint and options from the
+// standard OTEL_EXPORTER_OTLP_* variables. The returned function flushes and
+// stops the provider.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for all pipeline spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span named name, tagged with the event id when it is known.
+func Start(ctx context.Context, name string, eventID string) (context.Context, trace.Span) {
+	if eventID == "" {
+		return Tracer().Start(ctx, name)
+	}
+
+	return Tracer().Start(ctx, name, trace.WithAttributes(EventIDKey.String(eventID)))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}